@@ -1,40 +1,70 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/koyashimano/docker-volume-manager/internal/commands"
+	"github.com/koyashimano/docker-volume-manager/internal/compose"
 	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
 )
 
 const version = "1.0.0"
 
 var (
 	// Global flags
-	globalFlags    = flag.NewFlagSet("dvm", flag.ExitOnError)
-	composePath    string
-	projectName    string
-	noCompose      bool
-	verbose        bool
-	quiet          bool
-	configPath     string
-	showVersion    bool
-	showHelp       bool
+	globalFlags = flag.NewFlagSet("dvm", flag.ExitOnError)
+	composePath string
+	projectName string
+	noCompose   bool
+	verbose     bool
+	quiet       bool
+	configPath  string
+	dbPath      string
+	profiles    stringList
+	logFormat   string
+	useUTC      bool
+	noColor     bool
+	timeout     time.Duration
+	showVersion bool
+	showHelp    bool
 )
 
+// stringList is a flag that may be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func init() {
 	globalFlags.StringVar(&composePath, "file", "", "Compose file path")
 	globalFlags.StringVar(&composePath, "f", "", "Compose file path (shorthand)")
 	globalFlags.StringVar(&projectName, "project", "", "Project name override")
 	globalFlags.StringVar(&projectName, "p", "", "Project name override (shorthand)")
 	globalFlags.BoolVar(&noCompose, "no-compose", false, "Disable Compose integration")
+	globalFlags.Var(&profiles, "profile", "Activate a Compose profile (repeatable)")
 	globalFlags.BoolVar(&verbose, "verbose", false, "Verbose output")
 	globalFlags.BoolVar(&verbose, "v", false, "Verbose output (shorthand)")
 	globalFlags.BoolVar(&quiet, "quiet", false, "Minimal output")
 	globalFlags.BoolVar(&quiet, "q", false, "Minimal output (shorthand)")
+	globalFlags.StringVar(&logFormat, "log-format", commands.LogFormatText, "Diagnostics format on stderr (text or json)")
+	globalFlags.BoolVar(&useUTC, "utc", false, "Use UTC in backup filenames and output")
+	globalFlags.BoolVar(&noColor, "no-color", false, "Disable colored output")
 	globalFlags.StringVar(&configPath, "config", "", "Config file path")
+	globalFlags.StringVar(&dbPath, "db", "", "Metadata database path, :memory: for an in-memory one (default: paths.database)")
+	globalFlags.DurationVar(&timeout, "timeout", 0, "Abort the command after this long, e.g. 30m (0 for no limit)")
 	globalFlags.BoolVar(&showVersion, "version", false, "Show version")
 	globalFlags.BoolVar(&showHelp, "help", false, "Show help")
 	globalFlags.BoolVar(&showHelp, "h", false, "Show help (shorthand)")
@@ -69,17 +99,54 @@ func main() {
 	command := args[0]
 	commandArgs := args[1:]
 
-	// Load config
+	if logFormat != commands.LogFormatText && logFormat != commands.LogFormatJSON {
+		fmt.Fprintf(os.Stderr, "Error: invalid --log-format %q (must be text or json)\n", logFormat)
+		os.Exit(int(commands.ExitError))
+	}
+
+	if err := resolvePathFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(int(commands.ExitError))
+	}
+
 	cfgPath := configPath
 	if cfgPath == "" {
 		cfgPath = config.GetConfigPath()
 	}
 
+	// The config command manages the config file itself and does not need
+	// Docker or a loaded configuration
+	if command == "config" {
+		if err := runConfig(cfgPath, commandArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(int(commands.ExitError))
+		}
+		os.Exit(0)
+	}
+
+	// Load config
 	cfg, err := config.Load(cfgPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	if useUTC {
+		cfg.Defaults.UseUTC = true
+	}
+	if dbPath != "" {
+		cfg.Paths.Database = dbPath
+	}
+
+	// doctor diagnoses the environment the other commands need, so it runs
+	// before the directories are created and without requiring Docker or
+	// the database to work
+	if command == "doctor" {
+		if err := runDoctor(cfg, cfgPath, commandArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(int(commands.ExitError))
+		}
+		os.Exit(0)
+	}
 
 	// Ensure directories exist
 	if err := cfg.EnsureDirectories(); err != nil {
@@ -87,31 +154,69 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Create context
-	ctx, err := commands.NewContext(cfg, verbose, quiet)
+	// Create context; history, prune, tag and metrics only work on the
+	// metadata database and backup files, and can run without a reachable
+	// Docker daemon
+	requireDocker := command != "history" && command != "prune" && command != "tag" && command != "metrics"
+	cmdCtx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(cmdCtx, timeout)
+		defer cancel()
+	}
+	ctx, err := commands.NewContext(cmdCtx, cfg, cfgPath, verbose, quiet, requireDocker)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing: %v\n", err)
-		os.Exit(1)
+		os.Exit(int(commands.GetExitCode(err)))
 	}
 	defer ctx.Close()
+	ctx.LogFormat = logFormat
+	ctx.NoColor = noColor
 
 	// Load compose file unless --no-compose
 	if !noCompose {
 		if err := ctx.LoadCompose(composePath, projectName); err != nil {
-			if command != "list" && command != "clean" && command != "history" {
-				if verbose {
-					fmt.Fprintf(os.Stderr, "Warning: Could not load compose file: %v\n", err)
-				}
+			if command != "list" && command != "clean" && command != "history" && command != "prune" && command != "metrics" {
+				ctx.Debug("could not load compose file: %v", err)
 			}
 		}
 	}
 
+	// Like docker compose, --profile replaces COMPOSE_PROFILES
+	ctx.Profiles = profiles
+	if len(ctx.Profiles) == 0 {
+		ctx.Profiles = compose.ProfilesFromEnv()
+	}
+
+	// Without a compose file, -p still names the project
+	if ctx.ProjectName == "" && projectName != "" {
+		ctx.ProjectName = compose.NormalizeProjectName(projectName)
+	}
+
 	// Execute command
-	exitCode := runCommand(ctx, command, commandArgs)
+	exitCode := runCommand(cmdCtx, ctx, command, commandArgs)
 	os.Exit(int(exitCode))
 }
 
-func runCommand(ctx *commands.Context, command string, args []string) commands.ExitCode {
+// resolvePathFlags expands ~ in the global path flags and makes them
+// absolute, so they mean the same wherever they are used later
+func resolvePathFlags() error {
+	paths := []*string{&configPath, &composePath}
+	if !database.IsMemoryPath(dbPath) {
+		paths = append(paths, &dbPath)
+	}
+	for _, p := range paths {
+		resolved, err := config.ResolvePath(*p)
+		if err != nil {
+			return err
+		}
+		*p = resolved
+	}
+	return nil
+}
+
+// runCommand runs a command under cmdCtx, which bounds it with --timeout
+func runCommand(cmdCtx context.Context, ctx *commands.Context, command string, args []string) commands.ExitCode {
 	var err error
 
 	switch command {
@@ -129,10 +234,28 @@ func runCommand(ctx *commands.Context, command string, args []string) commands.E
 		err = runClean(ctx, args)
 	case "history":
 		err = runHistory(ctx, args)
+	case "prune":
+		err = runPrune(ctx, args)
+	case "tag":
+		err = runTag(ctx, args)
 	case "inspect":
 		err = runInspect(ctx, args)
+	case "check":
+		err = runCheck(ctx, args)
+	case "list-contents":
+		err = runListContents(ctx, args)
+	case "metrics":
+		err = runMetrics(ctx, args)
 	case "clone":
 		err = runClone(ctx, args)
+	case "snapshot":
+		err = runSnapshot(ctx, args)
+	case "rollback":
+		err = runRollback(ctx, args)
+	case "mount":
+		err = runMount(ctx, args)
+	case "cp":
+		err = runCp(ctx, args)
 	case "help":
 		printUsage()
 		return commands.ExitSuccess
@@ -142,8 +265,12 @@ func runCommand(ctx *commands.Context, command string, args []string) commands.E
 		return commands.ExitError
 	}
 
+	// Whatever the command returned, running out of time is what went wrong
+	err = commands.TimeoutError(cmdCtx, timeout, err)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if !commands.Reported(err) {
+			ctx.Error("%v", err)
+		}
 		return commands.GetExitCode(err)
 	}
 
@@ -157,15 +284,34 @@ func runList(ctx *commands.Context, args []string) error {
 	unused := fs.Bool("unused", false, "Show only unused volumes")
 	unusedShort := fs.Bool("u", false, "Show only unused volumes (shorthand)")
 	stale := fs.Int("stale", 0, "Show volumes not accessed for N days")
+	driver := fs.String("driver", "", "Show only volumes using this driver")
+	label := fs.String("label", "", "Show only volumes with this label (key or key=value)")
 	format := fs.String("format", "table", "Output format: table/json/csv")
+	output := fs.String("output", "", "Write output to file (- for stdout)")
+	outputShort := fs.String("o", "", "Write output to file (shorthand)")
+	projectLabel := fs.Bool("project-label", false, "Select project volumes by Compose label instead of name prefix")
+	namesOnly := fs.Bool("names-only", false, "Print only volume names")
+	quietShort := fs.Bool("q", false, "Print only volume names (shorthand)")
+	backups := fs.Bool("backups", false, "Show backup count and last backup time")
 
 	fs.Parse(args)
 
+	outPath := *output
+	if outPath == "" {
+		outPath = *outputShort
+	}
+
 	opts := commands.ListOptions{
-		All:    *all || *allShort,
-		Unused: *unused || *unusedShort,
-		Stale:  *stale,
-		Format: *format,
+		All:          *all || *allShort,
+		Unused:       *unused || *unusedShort,
+		Stale:        *stale,
+		Driver:       *driver,
+		Label:        *label,
+		Format:       *format,
+		Output:       outPath,
+		NamesOnly:    *namesOnly || *quietShort,
+		ProjectLabel: *projectLabel,
+		Backups:      *backups,
 	}
 
 	return ctx.List(opts)
@@ -175,31 +321,88 @@ func runBackup(ctx *commands.Context, args []string) error {
 	fs := flag.NewFlagSet("backup", flag.ExitOnError)
 	output := fs.String("output", "", "Output directory")
 	outputShort := fs.String("o", "", "Output directory (shorthand)")
-	format := fs.String("format", "", "Compression format: tar.gz/tar.zst")
+	allowOutside := fs.Bool("allow-outside", false, "Allow an output directory outside the backups directory")
+	name := fs.String("name", "", "File name of the backup (single volume only)")
+	format := fs.String("format", "", "Compression format: tar.gz/tgz/tar.zst/tar")
 	noCompress := fs.Bool("no-compress", false, "No compression")
-	tag := fs.String("tag", "", "Tag for backup")
-	tagShort := fs.String("t", "", "Tag for backup (shorthand)")
+	level := fs.Int("level", 0, "Compression level 1-9, or 1-19 for tar.zst (default: compress_level)")
+	var tags stringList
+	fs.Var(&tags, "tag", "Tag for backup (repeatable)")
+	fs.Var(&tags, "t", "Tag for backup (shorthand)")
 	stop := fs.Bool("stop", false, "Stop containers before backup")
+	noStop := fs.Bool("no-stop", false, "Do not stop containers, even if stop_before_backup is set")
+	noRestart := fs.Bool("no-restart", false, "Leave containers stopped for the backup down afterwards")
+	includeBinds := fs.Bool("include-binds", false, "Also back up compose bind mounts")
+	keep := fs.Int("keep", 0, "Backups to keep in this run's cleanup, 0 to skip it (default: keep_generations)")
+	noPrune := fs.Bool("no-prune", false, "Do not remove old backups after this run")
+	sparse := fs.Bool("sparse", false, "Archive holes in sparse files as holes (default: sparse config)")
+	xattrs := fs.Bool("xattrs", false, "Keep extended attributes and ACLs (default: xattrs config)")
+	followSymlinks := fs.Bool("follow-symlinks", false, "Archive the files symbolic links point to instead of the links")
+	incremental := fs.Bool("incremental", false, "Back up only changes since the previous incremental backup")
+	noDedup := fs.Bool("no-dedup", false, "Keep a new copy even if the volume is unchanged since the last backup")
+	outputFormat := fs.String("output-format", "text", "Result format: text/json")
+	projectLabel := fs.Bool("project-label", false, "Select project volumes by Compose label instead of the compose file")
+	allProjects := fs.Bool("all-projects", false, "Back up the volumes of every Compose project on the host")
+	watch := fs.Bool("watch", false, "Keep running and back up again whenever a volume changes")
+	interval := fs.Duration("interval", 5*time.Minute, "How often --watch checks for changes")
+	ignoreErrors := fs.Bool("ignore-errors", false, "Exit 0 even if some volumes fail")
 
 	fs.Parse(args)
 
+	if err := validateSummaryFormat(*outputFormat); err != nil {
+		return err
+	}
+	if *format != "" {
+		if err := config.ValidateFormat(*format); err != nil {
+			return err
+		}
+	}
+	if *allProjects && (len(fs.Args()) > 0 || *projectLabel || *includeBinds) {
+		return fmt.Errorf("--all-projects cannot be combined with services, --project-label or --include-binds")
+	}
+	if *watch && (*allProjects || *includeBinds) {
+		return fmt.Errorf("--watch cannot be combined with --all-projects or --include-binds")
+	}
+
 	outDir := *output
 	if outDir == "" {
 		outDir = *outputShort
 	}
 
-	tagVal := *tag
-	if tagVal == "" {
-		tagVal = *tagShort
-	}
+	// An explicit --keep 0 skips the cleanup like --no-prune
+	keepZero := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "keep" && *keep == 0 {
+			keepZero = true
+		}
+	})
 
 	opts := commands.BackupOptions{
-		Output:     outDir,
-		Format:     *format,
-		NoCompress: *noCompress,
-		Tag:        tagVal,
-		Stop:       *stop,
-		Services:   fs.Args(),
+		Output:         outDir,
+		AllowOutside:   *allowOutside,
+		Name:           *name,
+		Format:         *format,
+		NoCompress:     *noCompress,
+		Level:          *level,
+		Tags:           tags,
+		Stop:           *stop,
+		NoStop:         *noStop,
+		NoRestart:      *noRestart,
+		Keep:           *keep,
+		NoPrune:        *noPrune || keepZero,
+		IncludeBinds:   *includeBinds,
+		Sparse:         *sparse,
+		Xattrs:         *xattrs,
+		FollowSymlinks: *followSymlinks,
+		Incremental:    *incremental,
+		NoDedup:        *noDedup,
+		ProjectLabel:   *projectLabel,
+		AllProjects:    *allProjects,
+		Watch:          *watch,
+		Interval:       *interval,
+		Services:       fs.Args(),
+		OutputFormat:   *outputFormat,
+		IgnoreErrors:   *ignoreErrors,
 	}
 
 	return ctx.Backup(opts)
@@ -213,20 +416,70 @@ func runRestore(ctx *commands.Context, args []string) error {
 	listShort := fs.Bool("l", false, "List available backups (shorthand)")
 	force := fs.Bool("force", false, "Force without confirmation")
 	restart := fs.Bool("restart", false, "Restart containers after restore")
+	stop := fs.Bool("stop", false, "Stop containers using the volume during restore and start them afterwards")
+	hot := fs.Bool("hot", false, "Restore while containers keep running, without the in-use confirmation")
+	recreate := fs.Bool("recreate", false, "Recreate the volume with the backup's driver and options if its driver differs")
+	plain := fs.Bool("plain", false, "Ignore the backup's driver and create a missing volume as a plain local one")
+	generation := fs.Int("generation", 0, "Restore the Nth backup counting back from the latest (0 = latest)")
+	includeBinds := fs.Bool("include-binds", false, "Also restore compose bind mounts")
+	atomic := fs.Bool("atomic", false, "Restore into a scratch volume and replace the target only on success")
+	sparse := fs.Bool("sparse", false, "Restore a --sparse backup, keeping its holes (default: sparse config)")
+	xattrs := fs.Bool("xattrs", false, "Restore the extended attributes and ACLs of an --xattrs backup (default: xattrs config)")
+	chown := fs.String("chown", "", "Give restored files to this numeric uid:gid instead of the archived owners")
+	format := fs.String("format", "text", "Format of --list: text/json")
+	path := fs.String("path", "", "Restore only this file or directory, relative to the volume root")
+	ignoreErrors := fs.Bool("ignore-errors", false, "When restoring every volume, exit 0 even if some fail")
 
 	fs.Parse(args)
 
-	target := ""
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unsupported list format %q (want text or json)", *format)
+	}
+
+	if *generation < 0 {
+		return fmt.Errorf("--generation must not be negative")
+	}
+	if *generation > 0 && (*selectBackup || *selectShort) {
+		return fmt.Errorf("--generation cannot be combined with --select")
+	}
+	if *stop && *hot {
+		return fmt.Errorf("--stop cannot be combined with --hot")
+	}
+	if *plain && *recreate {
+		return fmt.Errorf("--plain cannot be combined with --recreate")
+	}
+	if *format == "json" && !*list && !*listShort {
+		return fmt.Errorf("--format json requires --list")
+	}
+
+	target, into := "", ""
 	if len(fs.Args()) > 0 {
 		target = fs.Args()[0]
 	}
+	if len(fs.Args()) > 1 {
+		into = fs.Args()[1]
+	}
 
 	opts := commands.RestoreOptions{
-		Select:  *selectBackup || *selectShort,
-		List:    *list || *listShort,
-		Force:   *force,
-		Restart: *restart,
-		Target:  target,
+		Select:       *selectBackup || *selectShort,
+		List:         *list || *listShort,
+		Force:        *force,
+		Restart:      *restart,
+		Stop:         *stop,
+		Hot:          *hot,
+		Recreate:     *recreate,
+		Plain:        *plain,
+		IncludeBinds: *includeBinds,
+		Sparse:       *sparse,
+		Xattrs:       *xattrs,
+		Chown:        *chown,
+		Atomic:       *atomic,
+		Generation:   *generation,
+		Target:       target,
+		Into:         into,
+		Format:       *format,
+		Path:         *path,
+		IgnoreErrors: *ignoreErrors,
 	}
 
 	return ctx.Restore(opts)
@@ -236,37 +489,86 @@ func runArchive(ctx *commands.Context, args []string) error {
 	fs := flag.NewFlagSet("archive", flag.ExitOnError)
 	output := fs.String("output", "", "Archive directory")
 	outputShort := fs.String("o", "", "Archive directory (shorthand)")
+	allowOutside := fs.Bool("allow-outside", false, "Allow an archive directory outside the archives directory")
 	verify := fs.Bool("verify", false, "Verify integrity before delete")
 	force := fs.Bool("force", false, "Force without confirmation")
+	iKnow := fs.Bool("i-know-what-im-doing", false, "Skip typing the name out under require_name_confirmation")
+	fs.String("output-format", "text", "Result format: text/json")
+	fs.String("format", "text", "Deprecated alias of --output-format")
+	ignoreErrors := fs.Bool("ignore-errors", false, "Exit 0 even if some volumes fail")
 
 	fs.Parse(args)
 
+	format, deprecated := resultFormat(fs)
+	if deprecated {
+		ctx.Warn("--format is deprecated, use --output-format")
+	}
+	if err := validateSummaryFormat(format); err != nil {
+		return err
+	}
+
 	outDir := *output
 	if outDir == "" {
 		outDir = *outputShort
 	}
 
 	opts := commands.ArchiveOptions{
-		Output:   outDir,
-		Verify:   *verify,
-		Force:    *force,
-		Services: fs.Args(),
+		Output:       outDir,
+		AllowOutside: *allowOutside,
+		Verify:       *verify,
+		Force:        *force,
+		SkipConfirm:  *iKnow,
+		Services:     fs.Args(),
+		OutputFormat: format,
+		IgnoreErrors: *ignoreErrors,
 	}
 
 	return ctx.Archive(opts)
 }
 
+// resultFormat returns the result format of archive and clean, given by
+// --output-format or by --format, its deprecated old name, when only that
+// was set. It reports whether --format was used.
+func resultFormat(fs *flag.FlagSet) (string, bool) {
+	outputFormatSet, formatSet := false, false
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "output-format":
+			outputFormatSet = true
+		case "format":
+			formatSet = true
+		}
+	})
+	if formatSet && !outputFormatSet {
+		return fs.Lookup("format").Value.String(), true
+	}
+	return fs.Lookup("output-format").Value.String(), formatSet
+}
+
+// validateSummaryFormat checks the result format of backup, clean and archive
+func validateSummaryFormat(format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported result format %q (want text or json)", format)
+	}
+	return nil
+}
+
 func runSwap(ctx *commands.Context, args []string) error {
 	fs := flag.NewFlagSet("swap", flag.ExitOnError)
 	empty := fs.Bool("empty", false, "Swap to empty volume")
 	noBackup := fs.Bool("no-backup", false, "Don't backup current volume")
 	restart := fs.Bool("restart", false, "Restart containers after swap")
+	rollback := fs.Bool("rollback", false, "Swap back to the most recent swap backup")
+	iKnow := fs.Bool("i-know-what-im-doing", false, "Skip typing the name out under require_name_confirmation")
 
 	fs.Parse(args)
 
 	if len(fs.Args()) < 1 {
 		return fmt.Errorf("service name required")
 	}
+	if *rollback && (*empty || len(fs.Args()) > 1) {
+		return fmt.Errorf("--rollback cannot be combined with --empty or a source")
+	}
 
 	service := fs.Args()[0]
 	source := ""
@@ -278,8 +580,11 @@ func runSwap(ctx *commands.Context, args []string) error {
 		Empty:    *empty,
 		NoBackup: *noBackup,
 		Restart:  *restart,
+		Rollback: *rollback,
 		Service:  service,
 		Source:   source,
+
+		SkipConfirm: *iKnow,
 	}
 
 	return ctx.Swap(opts)
@@ -290,34 +595,163 @@ func runClean(ctx *commands.Context, args []string) error {
 	unused := fs.Bool("unused", false, "Clean unused volumes")
 	unusedShort := fs.Bool("u", false, "Clean unused volumes (shorthand)")
 	stale := fs.Int("stale", 0, "Clean volumes not accessed for N days")
+	notAccessedSince := fs.String("not-accessed-since", "", "Clean volumes not accessed since a date (YYYY-MM-DD or RFC 3339)")
 	dryRun := fs.Bool("dry-run", false, "Show what would be cleaned")
 	dryRunShort := fs.Bool("n", false, "Show what would be cleaned (shorthand)")
 	archive := fs.Bool("archive", false, "Archive before cleaning")
 	archiveShort := fs.Bool("a", false, "Archive before cleaning (shorthand)")
 	force := fs.Bool("force", false, "Force without confirmation")
+	iKnow := fs.Bool("i-know-what-im-doing", false, "Skip typing the name out under require_name_confirmation")
+	fs.String("output-format", "text", "Result format: text/json")
+	fs.String("format", "text", "Deprecated alias of --output-format")
+	ignoreErrors := fs.Bool("ignore-errors", false, "Exit 0 even if some volumes fail")
 
 	fs.Parse(args)
 
+	format, deprecated := resultFormat(fs)
+	if deprecated {
+		ctx.Warn("--format is deprecated, use --output-format")
+	}
+	if err := validateSummaryFormat(format); err != nil {
+		return err
+	}
+
+	var since time.Time
+	if *notAccessedSince != "" {
+		var err error
+		if since, err = commands.ParseDate(*notAccessedSince, ctx.Config.Defaults.UseUTC); err != nil {
+			return err
+		}
+	}
+
 	opts := commands.CleanOptions{
-		Unused:  *unused || *unusedShort,
-		Stale:   *stale,
-		DryRun:  *dryRun || *dryRunShort,
-		Archive: *archive || *archiveShort,
-		Force:   *force,
+		Unused:           *unused || *unusedShort,
+		Stale:            *stale,
+		NotAccessedSince: since,
+		DryRun:           *dryRun || *dryRunShort,
+		Archive:          *archive || *archiveShort,
+		Force:            *force,
+		SkipConfirm:      *iKnow,
+		OutputFormat:     format,
+		IgnoreErrors:     *ignoreErrors,
 	}
 
 	return ctx.Clean(opts)
 }
 
+func runDoctor(cfg *config.Config, cfgPath string, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Parse(args)
+
+	ctx := &commands.Context{
+		Config:  cfg,
+		Verbose: verbose,
+		Quiet:   quiet,
+		Out:     os.Stdout,
+		Err:     os.Stderr,
+	}
+	defer ctx.Close()
+
+	return ctx.Doctor(commands.DoctorOptions{
+		ConfigPath:  cfgPath,
+		DBPath:      cfg.DatabasePath(cfgPath),
+		ComposePath: composePath,
+		ProjectName: projectName,
+		NoCompose:   noCompose,
+	})
+}
+
+func runPrune(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show which backups would be removed")
+	dryRunShort := fs.Bool("n", false, "Show which backups would be removed (shorthand)")
+	force := fs.Bool("force", false, "Force without confirmation")
+
+	fs.Parse(args)
+
+	opts := commands.PruneOptions{
+		Services: fs.Args(),
+		DryRun:   *dryRun || *dryRunShort,
+		Force:    *force,
+	}
+
+	return ctx.Prune(opts)
+}
+
+func runTag(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ExitOnError)
+	var set stringList
+	fs.Var(&set, "set", "Tag to add, repeatable")
+	replace := fs.Bool("replace", false, "Replace the existing tags with the --set tags")
+	clearTags := fs.Bool("clear", false, "Remove all tags")
+	backupIDs := fs.String("backup-id", "", "Comma-separated IDs of the backups to tag (default: latest)")
+
+	// Accept the service before the options as well as after them
+	service := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		service, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if service == "" && len(fs.Args()) > 0 {
+		service = fs.Args()[0]
+	}
+	if service == "" {
+		return fmt.Errorf("usage: dvm tag <service> (--set <tag> [--set <tag>...] [--replace] | --clear) [--backup-id <id>[,<id>...]]")
+	}
+
+	if *clearTags && len(set) > 0 {
+		return fmt.Errorf("--clear cannot be combined with --set")
+	}
+	if !*clearTags && len(set) == 0 {
+		return fmt.Errorf("--set or --clear is required")
+	}
+
+	var ids []int
+	if *backupIDs != "" {
+		for _, field := range strings.Split(*backupIDs, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || id <= 0 {
+				return fmt.Errorf("invalid backup ID %q", field)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	opts := commands.TagOptions{
+		Service:   service,
+		Tags:      set,
+		Replace:   *replace || *clearTags,
+		BackupIDs: ids,
+	}
+
+	return ctx.Tag(opts)
+}
+
 func runHistory(ctx *commands.Context, args []string) error {
 	fs := flag.NewFlagSet("history", flag.ExitOnError)
 	limit := fs.Int("limit", 10, "Number of records to show")
 	limitShort := fs.Int("n", 10, "Number of records to show (shorthand)")
+	page := fs.Int("page", 1, "Page of records to show, starting at 1")
+	pageSize := fs.Int("page-size", 10, "Records per page (same as --limit)")
 	all := fs.Bool("all", false, "Show all projects")
 	allShort := fs.Bool("a", false, "Show all projects (shorthand)")
+	tag := fs.String("tag", "", "Only show backups with this tag")
+	host := fs.String("host", "", "Only show backups taken on this host")
+	format := fs.String("format", "table", "Output format: table/json")
+	output := fs.String("output", "", "Write output to file (- for stdout)")
+	outputShort := fs.String("o", "", "Write output to file (shorthand)")
 
 	fs.Parse(args)
 
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unsupported output format %q (want table or json)", *format)
+	}
+
+	outPath := *output
+	if outPath == "" {
+		outPath = *outputShort
+	}
+
 	service := ""
 	if len(fs.Args()) > 0 {
 		service = fs.Args()[0]
@@ -327,6 +761,7 @@ func runHistory(ctx *commands.Context, args []string) error {
 	var (
 		limitSet      bool
 		limitShortSet bool
+		pageSizeSet   bool
 	)
 	fs.Visit(func(f *flag.Flag) {
 		switch f.Name {
@@ -334,20 +769,32 @@ func runHistory(ctx *commands.Context, args []string) error {
 			limitSet = true
 		case "n":
 			limitShortSet = true
+		case "page-size":
+			pageSizeSet = true
 		}
 	})
 
 	lim := *limit
-	if limitShortSet {
+	if pageSizeSet {
+		lim = *pageSize
+	} else if limitShortSet {
 		lim = *limitShort
 	} else if limitSet {
 		lim = *limit
 	}
+	if *page < 1 {
+		return fmt.Errorf("invalid page %d (pages start at 1)", *page)
+	}
 
 	opts := commands.HistoryOptions{
 		Limit:   lim,
+		Page:    *page,
 		All:     *all || *allShort,
 		Service: service,
+		Tag:     *tag,
+		Host:    *host,
+		Format:  *format,
+		Output:  outPath,
 	}
 
 	return ctx.History(opts)
@@ -357,7 +804,7 @@ func runInspect(ctx *commands.Context, args []string) error {
 	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
 	files := fs.Bool("files", false, "Show files in volume")
 	top := fs.Int("top", 0, "Show top N largest files")
-	format := fs.String("format", "table", "Output format: table/json/yaml")
+	format := fs.String("format", "table", "Output format: table/json/yaml, or a Go template such as '{{.Mountpoint}}'")
 
 	fs.Parse(args)
 
@@ -375,19 +822,191 @@ func runInspect(ctx *commands.Context, args []string) error {
 	return ctx.Inspect(opts)
 }
 
+func runCheck(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	overdue := fs.Bool("overdue", false, "Fail if a volume's last backup is older than its backup_interval")
+	all := fs.Bool("all", false, "Check all volumes")
+	allShort := fs.Bool("a", false, "Check all volumes (shorthand)")
+
+	fs.Parse(args)
+
+	opts := commands.CheckOptions{
+		Overdue: *overdue,
+		All:     *all || *allShort,
+	}
+
+	return ctx.Check(opts)
+}
+
+func runListContents(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("list-contents", flag.ExitOnError)
+	sizes := fs.Bool("sizes", false, "Show the size of each entry")
+	top := fs.Int("top", 0, "Show only the N largest files")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) < 1 {
+		return fmt.Errorf("usage: dvm list-contents [--sizes] [--top N] <backup-file|service>")
+	}
+
+	opts := commands.ContentsOptions{
+		Target: fs.Args()[0],
+		Sizes:  *sizes,
+		Top:    *top,
+	}
+
+	return ctx.ListContents(opts)
+}
+
+func runMetrics(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("metrics", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: dvm metrics")
+	}
+
+	return ctx.Metrics()
+}
+
 func runClone(ctx *commands.Context, args []string) error {
-	if len(args) < 2 {
-		return fmt.Errorf("usage: dvm clone <service> <new-name>")
+	fs := flag.NewFlagSet("clone", flag.ExitOnError)
+	noLabels := fs.Bool("no-labels", false, "Create the clone without the source volume's labels")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) < 2 {
+		return fmt.Errorf("usage: dvm clone [--no-labels] <service> <new-name>")
 	}
 
 	opts := commands.CloneOptions{
-		Service: args[0],
-		NewName: args[1],
+		Service:  fs.Args()[0],
+		NewName:  fs.Args()[1],
+		NoLabels: *noLabels,
 	}
 
 	return ctx.Clone(opts)
 }
 
+func runSnapshot(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	list := fs.Bool("list", false, "List the snapshots of the service")
+	force := fs.Bool("force", false, "Replace an existing snapshot of the same name")
+
+	// Accept the service before the options as well as after them
+	var positional []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	fs.Parse(args)
+	positional = append(positional, fs.Args()...)
+
+	if len(positional) < 1 || (!*list && len(positional) < 2) {
+		return fmt.Errorf("usage: dvm snapshot <service> <name> [--force] | dvm snapshot <service> --list")
+	}
+
+	opts := commands.SnapshotOptions{
+		Service: positional[0],
+		List:    *list,
+		Force:   *force,
+	}
+	if len(positional) > 1 {
+		opts.Name = positional[1]
+	}
+
+	return ctx.Snapshot(opts)
+}
+
+func runRollback(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	force := fs.Bool("force", false, "Roll back without confirmation")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) < 2 {
+		return fmt.Errorf("usage: dvm rollback [--force] <service> <name>")
+	}
+
+	opts := commands.RollbackOptions{
+		Service: fs.Args()[0],
+		Name:    fs.Args()[1],
+		Force:   *force,
+	}
+
+	return ctx.Rollback(opts)
+}
+
+func runMount(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("mount", flag.ExitOnError)
+	readOnly := fs.Bool("read-only", false, "Mount the volume read-only")
+	image := fs.String("image", "", "Shell image (default: the worker image)")
+
+	fs.Parse(args)
+
+	if len(fs.Args()) < 1 {
+		return fmt.Errorf("usage: dvm mount <service> [--read-only] [--image <image>]")
+	}
+
+	opts := commands.MountOptions{
+		Service:  fs.Args()[0],
+		ReadOnly: *readOnly,
+		Image:    *image,
+	}
+
+	return ctx.Mount(opts)
+}
+
+func runCp(ctx *commands.Context, args []string) error {
+	fs := flag.NewFlagSet("cp", flag.ExitOnError)
+
+	fs.Parse(args)
+
+	if len(fs.Args()) != 2 {
+		return fmt.Errorf("usage: dvm cp <service>[:<volume>]:<path> <local-path> | dvm cp <local-path> <service>[:<volume>]:<path>")
+	}
+
+	opts := commands.CopyOptions{
+		Source:      fs.Args()[0],
+		Destination: fs.Args()[1],
+	}
+
+	return ctx.Copy(opts)
+}
+
+func runConfig(cfgPath string, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: dvm config <init|validate>")
+	}
+
+	switch args[0] {
+	case "init":
+		fs := flag.NewFlagSet("config init", flag.ExitOnError)
+		force := fs.Bool("force", false, "Overwrite an existing config file")
+
+		fs.Parse(args[1:])
+
+		if err := config.Init(cfgPath, *force); err != nil {
+			return err
+		}
+
+		if !quiet {
+			fmt.Printf("✓ Config written to %s\n", cfgPath)
+		}
+		return nil
+	case "validate":
+		if _, err := config.Load(cfgPath); err != nil {
+			return err
+		}
+
+		if !quiet {
+			fmt.Printf("✓ Config is valid: %s\n", cfgPath)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown config subcommand: %s", args[0])
+	}
+}
+
 func printUsage() {
 	fmt.Println(`dvm - Docker Volume Manager
 
@@ -398,9 +1017,15 @@ Global Options:
   -f, --file <path>      Compose file path
   -p, --project <name>   Project name override
   --no-compose           Disable Compose integration
+  --profile <name>       Activate a Compose profile (repeatable)
   -v, --verbose          Verbose output
   -q, --quiet            Minimal output
+  --log-format <format>  Diagnostics on stderr: text (default) or json events
+  --utc                  Use UTC in backup filenames and output
+  --no-color             Disable colored output (also with NO_COLOR set)
   --config <path>        Config file path
+  --db <path|:memory:>   Metadata database path, :memory: for an in-memory one
+  --timeout <duration>   Abort the command after this long, e.g. 30m
   --version              Show version
   -h, --help             Show help
 
@@ -408,20 +1033,36 @@ Commands:
   list        List volumes
   backup      Backup volumes
   restore     Restore volumes from backup
+  list-contents  List the files in a backup without restoring it
   archive     Archive and delete volumes
   swap        Swap volume with another
   clean       Clean up unused volumes
   history     Show backup history
+  prune       Remove backups beyond the retention policy
+  tag         Add tags to existing backups
   inspect     Show detailed volume information
+  check       Check for volumes with overdue backups
+  metrics     Print Prometheus metrics about recorded backups
   clone       Clone a volume
+  snapshot    Copy a volume into a named snapshot volume
+  rollback    Copy a snapshot back into its volume
+  mount       Open a shell with a volume mounted at /data
+  cp          Copy files between a volume and the local filesystem
+  config      Manage the config file (init, validate)
+  doctor      Check Docker, directories, database and compose setup
   help        Show help
 
 Examples:
   dvm list
   dvm backup db
+  dvm inspect app:logs       # One volume of a service with several
   dvm restore db --select
   dvm swap db --empty --restart
   dvm clean --unused --dry-run
+  dvm prune --dry-run
+  dvm tag db --set keep-forever
+  dvm snapshot db before-migration
+  dvm check --overdue
 
 For more information: https://github.com/koyashimano/docker-volume-manager`)
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestResultFormat(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		want           string
+		wantDeprecated bool
+	}{
+		{name: "default", want: "text"},
+		{name: "outputFormat", args: []string{"--output-format", "json"}, want: "json"},
+		{name: "deprecatedFormat", args: []string{"--format", "json"}, want: "json", wantDeprecated: true},
+		{name: "outputFormatWins", args: []string{"--format", "text", "--output-format", "json"}, want: "json", wantDeprecated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			fs.String("output-format", "text", "")
+			fs.String("format", "text", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+
+			got, deprecated := resultFormat(fs)
+			if got != tt.want || deprecated != tt.wantDeprecated {
+				t.Fatalf("resultFormat() = %q, %v, want %q, %v", got, deprecated, tt.want, tt.wantDeprecated)
+			}
+		})
+	}
+}
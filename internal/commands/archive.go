@@ -9,14 +9,29 @@ import (
 
 // ArchiveOptions contains options for archive command
 type ArchiveOptions struct {
-	Output   string
-	Verify   bool
-	Force    bool
-	Services []string
+	Output       string
+	AllowOutside bool // allow an Output outside the archives directory
+	Verify       bool
+	Force        bool
+	SkipConfirm  bool // skip the typed confirmation of require_name_confirmation
+	Services     []string
+	OutputFormat string // "" for text, "json" for a Summary
+	IgnoreErrors bool   // return nil even if some volumes fail
 }
 
-// Archive archives and deletes volumes
+// Archive archives and deletes volumes. If some fail it returns a
+// *BatchError after trying the rest, unless opts.IgnoreErrors is set.
 func (c *Context) Archive(opts ArchiveOptions) error {
+	c.forgetContainers()
+	return c.withSummary("archive", opts.OutputFormat, func(s *Summary) error {
+		if err := c.archive(opts, s); err != nil {
+			return err
+		}
+		return s.failure(opts.IgnoreErrors)
+	})
+}
+
+func (c *Context) archive(opts ArchiveOptions, s *Summary) error {
 	// Determine which volumes to archive
 	var volumesToArchive []string
 
@@ -26,30 +41,44 @@ func (c *Context) Archive(opts ArchiveOptions) error {
 			return ErrComposeNotFound
 		}
 
-		volumesToArchive = c.Compose.GetAllFullVolumeNames(c.ProjectName)
+		volumesToArchive = c.Compose.GetAllFullVolumeNames(c.ProjectName, c.Profiles)
 		if len(volumesToArchive) == 0 {
-			fmt.Println("No volumes found in project")
+			c.Info("No volumes found in project")
 			return nil
 		}
 	} else {
 		// Archive specific services
-		for _, service := range opts.Services {
-			volumeName, err := c.ResolveVolumeName(service)
+		services, err := c.expandServices(opts.Services)
+		if err != nil {
+			return err
+		}
+		for _, service := range services {
+			volumeNames, err := c.resolveVolumeNames(service)
+			if err != nil && isSelector(service) {
+				// An explicit service:volume that does not match is a mistake
+				c.Error("%v", err)
+				s.fail(service, err)
+				continue
+			}
 			if err != nil {
-				fmt.Printf("Warning: %s not found, skipping\n", service)
+				c.Warn("%s not found, skipping", service)
+				s.skip(service, "not found")
 				continue
 			}
-			volumesToArchive = append(volumesToArchive, volumeName)
+			volumesToArchive = append(volumesToArchive, volumeNames...)
 		}
 	}
 
 	if len(volumesToArchive) == 0 {
-		fmt.Println("No volumes to archive")
+		c.Info("No volumes to archive")
 		return nil
 	}
 
 	// Determine output directory
-	outputDir := opts.Output
+	outputDir, err := sanitizeOutputDir(opts.Output, c.Config.Paths.Archives, opts.AllowOutside)
+	if err != nil {
+		return err
+	}
 	if outputDir == "" {
 		outputDir = filepath.Join(c.Config.Paths.Archives, c.ProjectName)
 	}
@@ -59,43 +88,60 @@ func (c *Context) Archive(opts ArchiveOptions) error {
 	}
 
 	// Confirm if not forced
-	if !opts.Force {
-		fmt.Printf("This will archive and DELETE the following volumes:\n")
+	if !opts.Force || c.Config.Defaults.RequireNameConfirmation {
+		fmt.Fprintf(c.Out, "This will archive and DELETE the following volumes:\n")
 		for _, vol := range volumesToArchive {
-			fmt.Printf("  - %s\n", vol)
-		}
-		if !Confirm("Continue?") {
-			return fmt.Errorf("archive cancelled")
+			fmt.Fprintf(c.Out, "  - %s\n", vol)
 		}
 	}
+	if !c.confirmDestructive("Continue?", c.confirmationName(volumesToArchive), opts.Force, opts.SkipConfirm) {
+		return fmt.Errorf("archive cancelled")
+	}
+
+	// Record sizes up front; they are gone once the volumes are removed
+	sizes := c.volumeSizes()
 
 	// Archive each volume
 	for _, volumeName := range volumesToArchive {
-		if err := c.archiveVolume(volumeName, outputDir, opts); err != nil {
-			fmt.Printf("Error archiving %s: %v\n", volumeName, err)
+		var archivePath string
+		var size int64
+		err := c.track("archive", volumeName, func() (err error) {
+			archivePath, size, err = c.archiveVolume(volumeName, outputDir, opts)
+			return err
+		})
+		if err != nil {
+			c.reportError(err, "failed to archive %s: %v", volumeName, err)
+			s.fail(volumeName, err)
 			continue
 		}
+		s.ok(volumeName, archivePath, size, sizes[volumeName])
+	}
+
+	if !c.Quiet || s.Skipped > 0 || s.Failed > 0 {
+		fmt.Fprintf(c.Out, "\n%s\n", s.line("Archived"))
 	}
 
 	return nil
 }
 
-func (c *Context) archiveVolume(volumeName, outputDir string, opts ArchiveOptions) error {
+// archiveVolume archives a volume into outputDir and deletes it, returning
+// the archive file written and its size
+func (c *Context) archiveVolume(volumeName, outputDir string, opts ArchiveOptions) (string, int64, error) {
 	// Check if volume exists
 	if !c.Docker.VolumeExists(volumeName) {
-		return ErrVolumeNotFound
+		return "", 0, ErrVolumeNotFound
 	}
 
 	// Check if in use
-	inUse, _ := c.Docker.IsVolumeInUse(volumeName)
+	containers, _ := c.containersUsing(volumeName)
+	inUse := len(containers) > 0
 	if inUse && !opts.Force {
-		containers, _ := c.Docker.GetContainersUsingVolume(volumeName)
-		return fmt.Errorf("volume is in use by: %v (use --force to archive anyway)", containers)
+		return "", 0, fmt.Errorf("volume is in use by: %v (use --force to archive anyway)", containers)
 	}
 
 	// Warn if force is being used on an in-use volume
-	if inUse && opts.Force && !c.Quiet {
-		fmt.Printf("Warning: volume %s is in use, but proceeding due to --force option\n", volumeName)
+	if inUse && opts.Force {
+		c.Warn("volume %s is in use; its containers will be stopped and removed due to --force option", volumeName)
 	}
 
 	// Get service name for metadata
@@ -103,39 +149,33 @@ func (c *Context) archiveVolume(volumeName, outputDir string, opts ArchiveOption
 
 	// Generate filename using volume name (not service name)
 	// This ensures uniqueness even when multiple services share the same volume
-	filename := GenerateBackupFilename(volumeName, c.Config.Defaults.CompressFormat)
+	filename := GenerateBackupFilename(volumeName, c.Config.Defaults.CompressFormat, c.useUTC())
 	archivePath := filepath.Join(outputDir, filename)
 
-	if !c.Quiet {
-		fmt.Printf("Archiving %s to %s...\n", volumeName, archivePath)
-	}
+	c.Info("Archiving %s to %s...", volumeName, archivePath)
 
 	// Backup to archive location
-	if err := c.Docker.BackupVolume(volumeName, archivePath, true); err != nil {
-		return fmt.Errorf("archive backup failed: %w", err)
+	if err := c.Docker.BackupVolume(volumeName, archivePath, true, c.Config.Defaults.CompressLevel, c.tarOptions(false, false)); err != nil {
+		return "", 0, fmt.Errorf("archive backup failed: %w", err)
 	}
 
 	// Calculate checksum (reuse if verify was requested)
-	var checksum string
+	var checksum, algo string
 	var err error
 
 	// Verify if requested
 	if opts.Verify {
-		if !c.Quiet {
-			fmt.Printf("Verifying archive integrity...\n")
-		}
+		c.Info("Verifying archive integrity...")
 
-		checksum, err = CalculateChecksum(archivePath)
+		checksum, algo, err = c.checksum(archivePath)
 		if err != nil {
-			return fmt.Errorf("checksum calculation failed: %w", err)
+			return "", 0, fmt.Errorf("checksum calculation failed: %w", err)
 		}
 
-		if c.Verbose {
-			fmt.Printf("Checksum: %s\n", checksum)
-		}
+		c.Debug("Checksum: %s", checksum)
 	} else {
 		// Calculate checksum only if not already done
-		checksum, _ = CalculateChecksum(archivePath)
+		checksum, algo, _ = c.checksum(archivePath)
 	}
 
 	// Get file size
@@ -143,31 +183,33 @@ func (c *Context) archiveVolume(volumeName, outputDir string, opts ArchiveOption
 
 	// Save archive record
 	record := &database.BackupRecord{
-		VolumeName:  volumeName,
-		ServiceName: serviceName,
-		ProjectName: c.ProjectName,
-		FilePath:    archivePath,
-		Size:        size,
-		Tag:         "archive",
-		Checksum:    checksum,
+		VolumeName:   volumeName,
+		ServiceName:  serviceName,
+		ProjectName:  c.ProjectName,
+		FilePath:     archivePath,
+		Size:         size,
+		Tag:          "archive",
+		Checksum:     checksum,
+		ChecksumAlgo: algo,
 	}
 
 	if err := c.DB.AddBackupRecord(record); err != nil {
-		fmt.Printf("Warning: failed to save archive record: %v\n", err)
+		c.Warn("failed to save archive record: %v", err)
 	}
 
 	// Delete volume
-	if !c.Quiet {
-		fmt.Printf("Deleting volume %s...\n", volumeName)
+	if inUse {
+		if err := c.removeVolumeContainers(volumeName); err != nil {
+			return archivePath, size, err
+		}
 	}
+	c.Info("Deleting volume %s...", volumeName)
 
 	if err := c.Docker.RemoveVolume(volumeName, false); err != nil {
-		return fmt.Errorf("failed to delete volume: %w", err)
+		return archivePath, size, fmt.Errorf("failed to delete volume: %w", err)
 	}
 
-	if !c.Quiet {
-		fmt.Printf("✓ Archived and deleted: %s (%s)\n", volumeName, FormatSize(size))
-	}
+	c.Info("✓ Archived and deleted: %s (%s)", volumeName, FormatSize(size))
 
-	return nil
+	return archivePath, size, nil
 }
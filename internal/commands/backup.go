@@ -4,55 +4,174 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/compose"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
 	"github.com/koyashimano/docker-volume-manager/internal/database"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
 )
 
 // BackupOptions contains options for backup command
 type BackupOptions struct {
-	Output      string
-	Format      string
-	NoCompress  bool
-	Tag         string
-	Stop        bool
-	Services    []string
+	Output         string
+	AllowOutside   bool   // allow an Output outside the backups directory
+	Name           string // file name of a single-volume backup instead of a generated one
+	Format         string
+	NoCompress     bool
+	Level          int // compression level, 0 for compress_level
+	Tags           []string
+	Stop           bool
+	NoStop         bool // never stop containers, overriding stop_before_backup
+	NoRestart      bool // leave containers stopped for the backup down afterwards
+	IncludeBinds   bool
+	Keep           int           // keep_generations for this run's cleanup, 0 for the configured one
+	NoPrune        bool          // skip the cleanup of old backups after this run
+	Sparse         bool          // archive holes in sparse files as holes, as does the sparse config default
+	Xattrs         bool          // keep extended attributes and ACLs, as does the xattrs config default
+	FollowSymlinks bool          // archive what symbolic links point to instead of the links
+	Incremental    bool          // archive only changes since the previous incremental backup
+	NoDedup        bool          // keep a new copy even if nothing changed since the last backup
+	ProjectLabel   bool          // select volumes by Compose project label, not compose file
+	AllProjects    bool          // back up the volumes of every Compose project on the host
+	Watch          bool          // keep running, backing up volumes again when they change
+	Interval       time.Duration // how often --watch polls for changes
+	Services       []string
+	OutputFormat   string // "" for text, "json" for a Summary
+	IgnoreErrors   bool   // return nil even if some volumes fail
 }
 
-// Backup backs up volumes
+// Backup backs up volumes. If some fail it returns a *BatchError after
+// trying the rest, unless opts.IgnoreErrors is set.
 func (c *Context) Backup(opts BackupOptions) error {
+	return c.withSummary("backup", opts.OutputFormat, func(s *Summary) error {
+		if err := c.backup(opts, s); err != nil {
+			return err
+		}
+		if s.Failed > 0 && !c.Quiet {
+			fmt.Fprintf(c.Out, "\n%s\n", s.line("Backed up"))
+		}
+		return s.failure(opts.IgnoreErrors)
+	})
+}
+
+func (c *Context) backup(opts BackupOptions, s *Summary) error {
+	if err := config.ValidateFormat(c.backupFormat(opts)); err != nil {
+		return err
+	}
+	if opts.Level != 0 {
+		if err := config.ValidateCompressLevel(c.backupFormat(opts), opts.Level); err != nil {
+			return err
+		}
+	}
+
+	if opts.Keep < 0 {
+		return fmt.Errorf("--keep must not be negative")
+	}
+	if opts.Watch && opts.Interval < time.Second {
+		return fmt.Errorf("--interval must be at least 1s")
+	}
+	for _, tag := range opts.Tags {
+		if err := database.ValidateTag(tag); err != nil {
+			return err
+		}
+	}
+
+	if opts.Name != "" {
+		if opts.AllProjects || opts.Watch || len(opts.Services) > 1 {
+			return fmt.Errorf("--name backs up a single volume and cannot be combined with several services, --all-projects or --watch")
+		}
+		if _, err := namedBackupFilename(opts.Name, c.backupFormat(opts)); err != nil {
+			return err
+		}
+	}
+
+	if opts.AllProjects {
+		return c.backupAllProjects(opts, s)
+	}
+
 	// Determine which volumes to backup
 	var volumesToBackup []string
+	var bindsToBackup []compose.VolumeMapping
 
-	if len(opts.Services) == 0 {
+	if len(opts.Services) == 0 && opts.ProjectLabel {
+		// Backup every volume labelled with the project, compose file or not
+		vols, err := c.listProjectVolumesByLabel()
+		if err != nil {
+			return err
+		}
+		for _, vol := range vols {
+			volumesToBackup = append(volumesToBackup, vol.Name)
+		}
+		sort.Strings(volumesToBackup)
+		if opts.IncludeBinds && c.Compose != nil {
+			bindsToBackup = c.Compose.GetAllBindMounts(c.Profiles)
+		}
+		if len(volumesToBackup) == 0 && len(bindsToBackup) == 0 {
+			c.Info("No volumes found in project")
+			return nil
+		}
+	} else if len(opts.Services) == 0 {
 		// Backup all volumes in project
 		if c.Compose == nil {
 			return ErrComposeNotFound
 		}
 
-		volumesToBackup = c.Compose.GetAllFullVolumeNames(c.ProjectName)
-		if len(volumesToBackup) == 0 {
-			fmt.Println("No volumes found in project")
+		volumesToBackup = c.Compose.GetAllFullVolumeNames(c.ProjectName, c.Profiles)
+		if opts.IncludeBinds {
+			bindsToBackup = c.Compose.GetAllBindMounts(c.Profiles)
+		}
+		if len(volumesToBackup) == 0 && len(bindsToBackup) == 0 {
+			c.Info("No volumes found in project")
 			return nil
 		}
 	} else {
 		// Backup specific services
-		for _, service := range opts.Services {
-			volumeName, err := c.ResolveVolumeName(service)
+		services, err := c.expandServices(opts.Services)
+		if err != nil {
+			return err
+		}
+		for _, service := range services {
+			var binds []compose.VolumeMapping
+			if opts.IncludeBinds && c.Compose != nil {
+				binds, _ = c.Compose.GetBindMounts(service)
+				bindsToBackup = append(bindsToBackup, binds...)
+			}
+
+			volumeNames, err := c.resolveVolumeNames(service)
+			if err != nil && isSelector(service) {
+				// An explicit service:volume that does not match is a mistake
+				c.Error("%v", err)
+				s.fail(service, err)
+				continue
+			}
 			if err != nil {
-				fmt.Printf("Warning: %s not found, skipping\n", service)
+				if len(binds) == 0 {
+					c.Warn("%s not found, skipping", service)
+					s.skip(service, "not found")
+				}
 				continue
 			}
-			volumesToBackup = append(volumesToBackup, volumeName)
+			volumesToBackup = append(volumesToBackup, volumeNames...)
 		}
 	}
 
-	if len(volumesToBackup) == 0 {
-		fmt.Println("No volumes to backup")
+	if len(volumesToBackup) == 0 && len(bindsToBackup) == 0 {
+		c.Info("No volumes to backup")
 		return nil
 	}
+	if opts.Name != "" && len(volumesToBackup)+len(bindsToBackup) > 1 {
+		return fmt.Errorf("--name backs up a single volume, but %d were selected", len(volumesToBackup)+len(bindsToBackup))
+	}
 
 	// Determine output directory
-	outputDir := opts.Output
+	outputDir, err := sanitizeOutputDir(opts.Output, c.Config.Paths.Backups, opts.AllowOutside)
+	if err != nil {
+		return err
+	}
 	if outputDir == "" {
 		outputDir = filepath.Join(c.Config.Paths.Backups, c.ProjectName)
 	}
@@ -61,107 +180,479 @@ func (c *Context) Backup(opts BackupOptions) error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Backup each volume
-	for _, volumeName := range volumesToBackup {
-		if err := c.backupVolume(volumeName, outputDir, opts); err != nil {
-			fmt.Printf("Error backing up %s: %v\n", volumeName, err)
+	if opts.Watch {
+		c.watch(volumesToBackup, outputDir, opts, s)
+		return nil
+	}
+
+	c.backupVolumes(volumesToBackup, outputDir, opts, s)
+
+	// Backup each bind mount
+	for _, bind := range bindsToBackup {
+		var outputPath string
+		var size int64
+		err := c.track("backup", bind.BindName(), func() (err error) {
+			outputPath, size, err = c.backupBind(bind, outputDir, opts)
+			return err
+		})
+		if err != nil {
+			c.reportError(err, "failed to back up %s: %v", bind.VolumeName, err)
+			s.fail(bind.BindName(), err)
+			continue
+		}
+		s.ok(bind.BindName(), outputPath, size, 0)
+	}
+
+	return nil
+}
+
+// backupVolumes backs up each volume into outputDir, recording the outcome
+// in s
+func (c *Context) backupVolumes(volumes []string, outputDir string, opts BackupOptions, s *Summary) {
+	for _, volumeName := range volumes {
+		var outputPath string
+		var size int64
+		err := c.track("backup", volumeName, func() (err error) {
+			outputPath, size, err = c.backupVolume(volumeName, outputDir, opts)
+			return err
+		})
+		if err != nil {
+			c.reportError(err, "failed to back up %s: %v", volumeName, err)
+			s.fail(volumeName, err)
 			continue
 		}
+		s.ok(volumeName, outputPath, size, 0)
+	}
+}
+
+// backupAllProjects backs up the volumes of every Compose project on the
+// host, each project into its own subdirectory of the backup directory.
+// Volumes are grouped by their Compose project label, or by the name prefix
+// before the first underscore for volumes created without Compose labels.
+func (c *Context) backupAllProjects(opts BackupOptions, s *Summary) error {
+	vols, err := c.Docker.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	projects := groupVolumesByProject(vols)
+	if len(projects) == 0 {
+		c.Info("No project volumes found")
+		return nil
+	}
+
+	baseDir, err := sanitizeOutputDir(opts.Output, c.Config.Paths.Backups, opts.AllowOutside)
+	if err != nil {
+		return err
+	}
+	if baseDir == "" {
+		baseDir = c.Config.Paths.Backups
+	}
+
+	// Back up each project as if dvm ran inside it, so records, retention
+	// and service lookups use that project. The loaded compose file only
+	// describes its own project.
+	projectName, composeFile := c.ProjectName, c.Compose
+	defer func() { c.ProjectName, c.Compose = projectName, composeFile }()
+
+	names := make([]string, 0, len(projects))
+	for name := range projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c.ProjectName, c.Compose = name, nil
+		if name == projectName {
+			c.Compose = composeFile
+		}
+
+		outputDir := filepath.Join(baseDir, name)
+		if err := EnsureDirectory(outputDir); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+
+		c.Info("Project %s: %d volume(s)", name, len(projects[name]))
+		c.backupVolumes(projects[name], outputDir, opts, s)
 	}
 
 	return nil
 }
 
-func (c *Context) backupVolume(volumeName, outputDir string, opts BackupOptions) error {
+// groupVolumesByProject maps Compose project names to their sorted volume
+// names. Volumes without a project label are assigned by the prefix before
+// their first underscore; those without one, such as anonymous volumes,
+// belong to no project.
+func groupVolumesByProject(vols []*volume.Volume) map[string][]string {
+	projects := make(map[string][]string)
+	for _, vol := range vols {
+		project := vol.Labels[docker.LabelComposeProject]
+		if project == "" {
+			prefix, _, ok := strings.Cut(vol.Name, "_")
+			if !ok || prefix == "" {
+				continue
+			}
+			project = prefix
+		}
+		projects[project] = append(projects[project], vol.Name)
+	}
+	for _, names := range projects {
+		sort.Strings(names)
+	}
+	return projects
+}
+
+// backupVolume backs up a volume into outputDir, returning the backup file
+// written and its size
+func (c *Context) backupVolume(volumeName, outputDir string, opts BackupOptions) (string, int64, error) {
 	// Check if volume exists
 	if !c.Docker.VolumeExists(volumeName) {
-		return ErrVolumeNotFound
+		return "", 0, ErrVolumeNotFound
 	}
 
 	// Get service name for metadata
 	serviceName := c.GetServiceName(volumeName)
 
-	// Stop containers if requested
-	if opts.Stop {
-		if !c.Quiet {
-			fmt.Printf("Stopping containers using %s...\n", volumeName)
+	if network := c.networkType(volumeName); network != "" {
+		c.Info("Note: %s is a network-backed volume (%s); its data is read from the remote server", volumeName, network)
+	}
+
+	// Stop containers if requested, either with --stop or by default via
+	// stop_before_backup, and start them again once the backup is done,
+	// whether it succeeded or not, unless --no-restart leaves them down
+	if (opts.Stop || c.Config.Defaults.StopBeforeBackup) && !opts.NoStop {
+		containerIDs, err := c.stopVolumeContainers(volumeName)
+		if err != nil {
+			return "", 0, err
 		}
-		if err := c.Docker.StopContainersUsingVolume(volumeName); err != nil {
-			return fmt.Errorf("failed to stop containers: %w", err)
+		if !opts.NoRestart && len(containerIDs) > 0 {
+			defer c.restartContainers(containerIDs)
 		}
 	}
 
 	// Generate filename using volume name (not service name)
 	// This ensures uniqueness even when multiple services share the same volume
-	format := opts.Format
-	if format == "" {
-		format = c.Config.Defaults.CompressFormat
+	format := c.backupFormat(opts)
+	if err := config.ValidateFormat(format); err != nil {
+		return "", 0, err
 	}
 
-	filename := GenerateBackupFilename(volumeName, format)
-	outputPath := filepath.Join(outputDir, filename)
+	outputPath, err := c.backupOutputPath(volumeName, outputDir, format, opts)
+	if err != nil {
+		return "", 0, err
+	}
+	compress := config.IsCompressedFormat(format)
 
-	if !c.Quiet {
-		fmt.Printf("Backing up %s to %s...\n", volumeName, outputPath)
+	if opts.Incremental {
+		return c.backupVolumeIncremental(volumeName, serviceName, outputPath, format, compress, opts)
+	}
+
+	c.Info("Backing up %s to %s...", volumeName, outputPath)
+
+	// Measure the volume for the compression ratio; 0 records it as unknown
+	uncompressedSize, err := c.Docker.GetVolumeSize(volumeName)
+	if err != nil {
+		c.Debug("size of %s is unknown: %v", volumeName, err)
 	}
 
 	// Perform backup
-	compress := !opts.NoCompress && (format == "tar.gz" || format == "tar.zst")
-	if err := c.Docker.BackupVolume(volumeName, outputPath, compress); err != nil {
-		return fmt.Errorf("backup failed: %w", err)
+	if err := c.Docker.BackupVolume(volumeName, outputPath, compress, c.compressLevel(format, opts), c.backupTarOptions(opts)); err != nil {
+		return "", 0, fmt.Errorf("backup failed: %w", err)
+	}
+
+	size, err := c.finishBackup(volumeName, serviceName, outputPath, opts, nil, uncompressedSize)
+	return outputPath, size, err
+}
+
+// backupFormat returns the archive format of backups taken with opts.
+// --no-compress always makes a plain tar archive, named .tar to match.
+func (c *Context) backupFormat(opts BackupOptions) string {
+	if opts.NoCompress {
+		return "tar"
+	}
+	if opts.Format != "" {
+		return opts.Format
+	}
+	return c.Config.Defaults.CompressFormat
+}
+
+// backupOutputPath returns the path of a new backup of name in outputDir:
+// the file named by opts.Name, which must not exist yet, or a generated
+// name_timestamp file
+func (c *Context) backupOutputPath(name, outputDir, format string, opts BackupOptions) (string, error) {
+	if opts.Name == "" {
+		return filepath.Join(outputDir, GenerateBackupFilename(name, format, c.useUTC())), nil
 	}
 
+	filename, err := namedBackupFilename(opts.Name, format)
+	if err != nil {
+		return "", err
+	}
+	outputPath := filepath.Join(outputDir, filename)
+	if _, err := os.Stat(outputPath); err == nil {
+		return "", fmt.Errorf("backup file %s already exists", outputPath)
+	}
+	return outputPath, nil
+}
+
+// backupTarOptions returns the tar options a backup with opts is taken with
+func (c *Context) backupTarOptions(opts BackupOptions) docker.TarOptions {
+	tarOpts := c.tarOptions(opts.Sparse, opts.Xattrs)
+	tarOpts.FollowSymlinks = opts.FollowSymlinks
+	return tarOpts
+}
+
+// tarOptions returns the GNU tar features a backup or restore uses: those
+// asked for, and those enabled by the sparse and xattrs config defaults
+func (c *Context) tarOptions(sparse, xattrs bool) docker.TarOptions {
+	return docker.TarOptions{
+		Sparse: sparse || c.Config.Defaults.Sparse,
+		Xattrs: xattrs || c.Config.Defaults.Xattrs,
+	}
+}
+
+// compressLevel returns the compression level of a backup in format: the
+// level given in opts, or compress_level if format is compressed
+func (c *Context) compressLevel(format string, opts BackupOptions) int {
+	if opts.Level != 0 {
+		return opts.Level
+	}
+	if _, _, ok := config.CompressLevelRange(format); ok {
+		return c.Config.Defaults.CompressLevel
+	}
+	return 0
+}
+
+// stopVolumeContainers stops the running containers using the volume and
+// returns their IDs. If stopping fails, containers already stopped are
+// started again.
+func (c *Context) stopVolumeContainers(volumeName string) ([]string, error) {
+	containerIDs, err := c.Docker.GetRunningContainerIDsUsingVolume(volumeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	if len(containerIDs) == 0 {
+		return nil, nil
+	}
+
+	c.Info("Stopping containers using %s...", volumeName)
+	defer c.forgetContainers()
+	if err := c.Docker.StopContainers(containerIDs); err != nil {
+		if startErr := c.Docker.StartContainers(containerIDs); startErr != nil {
+			return nil, fmt.Errorf("failed to stop containers: %w (also failed to restart containers: %v)", err, startErr)
+		}
+		return nil, fmt.Errorf("failed to stop containers: %w", err)
+	}
+
+	return containerIDs, nil
+}
+
+// restartContainers starts the containers stopped by stopVolumeContainers
+func (c *Context) restartContainers(containerIDs []string) {
+	c.Info("Restarting containers...")
+	defer c.forgetContainers()
+	if err := c.Docker.StartContainers(containerIDs); err != nil {
+		c.Warn("failed to restart some containers: %v", err)
+	}
+}
+
+// backupVolumeIncremental backs up the changes to a volume since its latest
+// incremental backup, or takes a full level-0 backup that later increments
+// can build on if there is none
+func (c *Context) backupVolumeIncremental(volumeName, serviceName, outputPath, format string, compress bool, opts BackupOptions) (string, int64, error) {
+	if format == "tar.zst" {
+		return "", 0, fmt.Errorf("incremental backups support tar, tar.gz and tgz, not %s", format)
+	}
+
+	base, err := c.incrementalBase(volumeName)
+	if err != nil {
+		return "", 0, err
+	}
+
+	baseSnapshot := ""
+	level := 0
+	if base != nil {
+		baseSnapshot = docker.SnapshotPath(base.FilePath)
+		level = base.Level + 1
+	}
+
+	c.Info("Backing up %s to %s (incremental, level %d)...", volumeName, outputPath, level)
+
+	if err := c.Docker.BackupVolumeIncremental(volumeName, outputPath, baseSnapshot, compress, c.compressLevel(format, opts), c.backupTarOptions(opts)); err != nil {
+		return "", 0, fmt.Errorf("backup failed: %w", err)
+	}
+
+	size, err := c.finishBackup(volumeName, serviceName, outputPath, opts, base, 0)
+	return outputPath, size, err
+}
+
+// dedupBackup replaces the backup at outputPath with a hard link to the
+// volume's most recent backup if both have the same checksum, returning the
+// path of the backup linked to. It returns "" and leaves outputPath alone if
+// they differ or the link cannot be made (e.g. across filesystems).
+func (c *Context) dedupBackup(volumeName, outputPath, checksum string) string {
+	latest, previous, err := c.DB.GetLatestBackupChecksum(volumeName)
+	if err != nil || previous == "" || previous == outputPath || !sameChecksum(latest, checksum) {
+		return ""
+	}
+	if !fileExists(previous) || fileExists(docker.SnapshotPath(previous)) {
+		return ""
+	}
+
+	// Link to a temporary name first so outputPath is never missing
+	temp := outputPath + ".dedup"
+	if err := os.Link(previous, temp); err != nil {
+		c.Debug("could not link to unchanged backup %s: %v", previous, err)
+		return ""
+	}
+	if err := os.Rename(temp, outputPath); err != nil {
+		os.Remove(temp)
+		return ""
+	}
+	return previous
+}
+
+// incrementalBase returns the latest backup of a volume that an incremental
+// backup can build on: one whose file and snapshot file both still exist.
+// It returns nil if there is none.
+func (c *Context) incrementalBase(volumeName string) (*database.BackupRecord, error) {
+	records, err := c.DB.GetBackupRecords(volumeName, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up previous backups: %w", err)
+	}
+
+	for _, record := range records {
+		if !fileExists(record.FilePath) {
+			continue
+		}
+		if fileExists(docker.SnapshotPath(record.FilePath)) {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordVolumeDriver stores the driver and driver options of the backed-up
+// volume in record so a restore can recreate it the same way. Bind mounts
+// have neither.
+func (c *Context) recordVolumeDriver(record *database.BackupRecord) {
+	if c.Docker == nil {
+		return
+	}
+	if vol, err := c.Docker.GetVolume(record.VolumeName); err == nil {
+		record.Driver = vol.Driver
+		record.DriverOpts = vol.Options
+	}
+}
+
+// backupBind backs up the host directory behind a compose bind mount,
+// recording it under the mount's synthetic BindName
+func (c *Context) backupBind(bind compose.VolumeMapping, outputDir string, opts BackupOptions) (string, int64, error) {
+	name := bind.BindName()
+
+	format := c.backupFormat(opts)
+
+	outputPath, err := c.backupOutputPath(name, outputDir, format, opts)
+	if err != nil {
+		return "", 0, err
+	}
+
+	c.Info("Backing up bind mount %s (%s) to %s...", bind.VolumeName, name, outputPath)
+
+	compress := config.IsCompressedFormat(format)
+	if err := c.Docker.BackupBind(bind.VolumeName, outputPath, compress, c.compressLevel(format, opts), c.backupTarOptions(opts)); err != nil {
+		return "", 0, fmt.Errorf("backup failed: %w", err)
+	}
+
+	size, err := c.finishBackup(name, bind.Service, outputPath, opts, nil, 0)
+	return outputPath, size, err
+}
+
+// finishBackup records a completed backup file and prunes old generations,
+// returning the size of the backup file. base is the backup an incremental
+// backup builds on, or nil. uncompressedSize is the size of the data backed
+// up, or 0 if unknown.
+func (c *Context) finishBackup(volumeName, serviceName, outputPath string, opts BackupOptions, base *database.BackupRecord, uncompressedSize int64) (int64, error) {
+	filename := filepath.Base(outputPath)
+
 	// Get file size
 	size, _ := GetFileSize(outputPath)
 
 	// Calculate checksum
-	checksum, _ := CalculateChecksum(outputPath)
+	checksum, algo, _ := c.checksum(outputPath)
+
+	// Replace an unchanged backup with a hard link to the previous one.
+	// Increments are never identical to their base, so skip them.
+	if checksum != "" && !opts.NoDedup && !opts.Incremental {
+		if previous := c.dedupBackup(volumeName, outputPath, checksum); previous != "" {
+			c.Info("Unchanged since %s; linked instead of storing a new copy", filepath.Base(previous))
+		}
+	}
 
 	// Save backup record
 	record := &database.BackupRecord{
-		VolumeName:  volumeName,
-		ServiceName: serviceName,
-		ProjectName: c.ProjectName,
-		FilePath:    outputPath,
-		Size:        size,
-		Tag:         opts.Tag,
-		Checksum:    checksum,
+		VolumeName:       volumeName,
+		ServiceName:      serviceName,
+		ProjectName:      c.ProjectName,
+		FilePath:         outputPath,
+		Size:             size,
+		Tag:              database.JoinTags(opts.Tags),
+		Checksum:         checksum,
+		ChecksumAlgo:     algo,
+		UncompressedSize: uncompressedSize,
 	}
-
-	if err := c.DB.AddBackupRecord(record); err != nil {
-		return fmt.Errorf("backup completed but failed to save backup record: %w", err)
+	if base != nil {
+		record.BaseID = base.ID
+		record.Level = base.Level + 1
 	}
+	c.recordVolumeDriver(record)
 
-	// Update metadata
-	if err := c.DB.UpdateLastBackup(volumeName); err != nil {
-		return fmt.Errorf("backup completed but failed to update metadata for volume %s: %w", volumeName, err)
+	// Save the backup record and update metadata together
+	if err := c.DB.RecordBackup(record); err != nil {
+		return size, fmt.Errorf("backup completed but failed to save backup record: %w", err)
 	}
 
-	if !c.Quiet {
-		fmt.Printf("✓ Backup complete: %s (%s)\n", filename, FormatSize(size))
-	}
+	c.Info("✓ Backup complete: %s (%s)", filename, FormatSize(size))
 
 	// Cleanup old backups
-	keepGenerations := c.Config.Defaults.KeepGenerations
-	if projectCfg, ok := c.Config.Projects[c.ProjectName]; ok && projectCfg.KeepGenerations > 0 {
-		keepGenerations = projectCfg.KeepGenerations
-	}
-
-	if keepGenerations > 0 {
-		if deleted, err := c.DB.CleanupOldBackups(volumeName, keepGenerations); err == nil && len(deleted) > 0 {
-			// Delete the actual backup files from filesystem
-			for _, record := range deleted {
-				if err := os.Remove(record.FilePath); err != nil {
-					if c.Verbose {
-						fmt.Fprintf(os.Stderr, "Warning: failed to delete backup file %s: %v\n", record.FilePath, err)
-					}
-				}
-			}
-			if c.Verbose {
-				fmt.Printf("Cleaned up %d old backup(s)\n", len(deleted))
-			}
+	if opts.NoPrune {
+		return size, nil
+	}
+	keepGenerations, keepDays := c.retention()
+	if opts.Keep > 0 {
+		keepGenerations = opts.Keep
+	}
+	if deleted, err := c.DB.CleanupOldBackups(volumeName, keepGenerations, keepDays, c.Config.Defaults.ProtectedTags); err == nil && len(deleted) > 0 {
+		c.removeBackupFiles(deleted)
+		c.Debug("Cleaned up %d old backup(s)", len(deleted))
+	}
+
+	return size, nil
+}
+
+// retention returns the keep_generations and keep_days policy of the
+// current project, falling back to the defaults
+func (c *Context) retention() (keepGenerations, keepDays int) {
+	keepGenerations = c.Config.Defaults.KeepGenerations
+	keepDays = c.Config.Defaults.KeepDays
+	if projectCfg, ok := c.Config.Projects[c.ProjectName]; ok {
+		if projectCfg.KeepGenerations > 0 {
+			keepGenerations = projectCfg.KeepGenerations
+		}
+		if projectCfg.KeepDays > 0 {
+			keepDays = projectCfg.KeepDays
 		}
 	}
+	return keepGenerations, keepDays
+}
 
-	return nil
+// removeBackupFiles deletes the files of pruned backup records, along with
+// the snapshot files of incremental backups
+func (c *Context) removeBackupFiles(records []*database.BackupRecord) {
+	for _, record := range records {
+		if err := os.Remove(record.FilePath); err != nil {
+			c.Debug("failed to delete backup file %s: %v", record.FilePath, err)
+		}
+		os.Remove(docker.SnapshotPath(record.FilePath))
+	}
 }
@@ -0,0 +1,1074 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/compose"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+// newIncrementalChain records a level-0 backup and two increments for
+// app_data in dir, with their snapshot files, and returns them oldest first
+func newIncrementalChain(t *testing.T, c *Context, dir string) []*database.BackupRecord {
+	t.Helper()
+	now := time.Now()
+
+	var chain []*database.BackupRecord
+	for i, name := range []string{
+		"app_data_2024-01-01_000000.tar.gz",
+		"app_data_2024-01-02_000000.tar.gz",
+		"app_data_2024-01-03_000000.tar.gz",
+	} {
+		path := writeBackup(t, dir, name, now.Add(time.Duration(i)*time.Minute))
+		if err := os.WriteFile(docker.SnapshotPath(path), nil, 0o644); err != nil {
+			t.Fatalf("failed to write snapshot: %v", err)
+		}
+		rec := &database.BackupRecord{VolumeName: "app_data", FilePath: path, Level: i}
+		if i > 0 {
+			rec.BaseID = chain[i-1].ID
+		}
+		if err := c.DB.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+		chain = append(chain, rec)
+	}
+	return chain
+}
+
+func newTestContext(t *testing.T) (*Context, string) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.NewDB(filepath.Join(dir, "meta.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Context{DB: db}, dir
+}
+
+func TestBackupChain(t *testing.T) {
+	c, dir := newTestContext(t)
+	chain := newIncrementalChain(t, c, dir)
+
+	t.Run("latestIncrement", func(t *testing.T) {
+		got, err := c.backupChain(chain[2].FilePath)
+		if err != nil {
+			t.Fatalf("chain lookup failed: %v", err)
+		}
+		want := []string{chain[0].FilePath, chain[1].FilePath, chain[2].FilePath}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("levelZero", func(t *testing.T) {
+		got, err := c.backupChain(chain[0].FilePath)
+		if err != nil {
+			t.Fatalf("chain lookup failed: %v", err)
+		}
+		if len(got) != 1 || got[0] != chain[0].FilePath {
+			t.Fatalf("expected only the level-0 backup, got %v", got)
+		}
+	})
+
+	t.Run("fullBackup", func(t *testing.T) {
+		full := writeBackup(t, dir, "app_data_2024-01-04_000000.tar.gz", time.Now())
+		if err := c.DB.AddBackupRecord(&database.BackupRecord{VolumeName: "app_data", FilePath: full}); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+		got, err := c.backupChain(full)
+		if err != nil || got != nil {
+			t.Fatalf("expected no chain for a full backup, got %v, %v", got, err)
+		}
+	})
+
+	t.Run("missingBase", func(t *testing.T) {
+		if err := os.Remove(chain[0].FilePath); err != nil {
+			t.Fatalf("remove failed: %v", err)
+		}
+		if _, err := c.backupChain(chain[2].FilePath); !errors.Is(err, ErrBackupNotFound) {
+			t.Fatalf("expected ErrBackupNotFound for a broken chain, got %v", err)
+		}
+	})
+}
+
+func TestIncrementalBase(t *testing.T) {
+	c, dir := newTestContext(t)
+
+	base, err := c.incrementalBase("app_data")
+	if err != nil || base != nil {
+		t.Fatalf("expected no base without backups, got %+v, %v", base, err)
+	}
+
+	chain := newIncrementalChain(t, c, dir)
+
+	// A newer full backup has no snapshot and cannot be built on
+	full := writeBackup(t, dir, "app_data_2024-01-04_000000.tar.gz", time.Now().Add(time.Hour))
+	if err := c.DB.AddBackupRecord(&database.BackupRecord{VolumeName: "app_data", FilePath: full}); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	base, err = c.incrementalBase("app_data")
+	if err != nil {
+		t.Fatalf("base lookup failed: %v", err)
+	}
+	if base == nil || base.ID != chain[2].ID || base.Level != 2 {
+		t.Fatalf("expected latest increment as base, got %+v", base)
+	}
+}
+
+func TestFinishBackupDeduplicatesUnchangedBackups(t *testing.T) {
+	c, dir := newTestContext(t)
+	c.Config = config.DefaultConfig()
+	c.Out, c.Err = io.Discard, io.Discard
+
+	backup := func(name, content string, opts BackupOptions) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write backup: %v", err)
+		}
+		if _, err := c.finishBackup("app_data", "app", path, opts, nil, 0); err != nil {
+			t.Fatalf("finish failed: %v", err)
+		}
+		return path
+	}
+	sameFile := func(a, b string) bool {
+		infoA, errA := os.Stat(a)
+		infoB, errB := os.Stat(b)
+		return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+	}
+
+	first := backup("app_data_2024-01-01_000000.tar.gz", "v1", BackupOptions{})
+
+	unchanged := backup("app_data_2024-01-02_000000.tar.gz", "v1", BackupOptions{})
+	if !sameFile(first, unchanged) {
+		t.Fatalf("expected unchanged backup to be linked to %s", first)
+	}
+
+	modified := backup("app_data_2024-01-03_000000.tar.gz", "v2", BackupOptions{})
+	if sameFile(unchanged, modified) {
+		t.Fatalf("expected a new file for a modified volume")
+	}
+
+	forced := backup("app_data_2024-01-04_000000.tar.gz", "v2", BackupOptions{NoDedup: true})
+	if sameFile(modified, forced) {
+		t.Fatalf("expected --no-dedup to keep a separate copy")
+	}
+
+	// Every backup is recorded, linked or not
+	records, err := c.DB.GetBackupRecords("app_data", 0)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected 4 backup records, got %d", len(records))
+	}
+	if records[2].FilePath != unchanged || records[2].Checksum != records[3].Checksum {
+		t.Fatalf("expected the linked backup to be recorded with the same checksum, got %+v", records[2])
+	}
+}
+
+// fakeDaemon is a stub Docker Engine API for running commands end to end.
+// Application containers are listed per volume and record stop/start
+// actions; worker containers "run" a backup by writing the archive named
+// by their tar command into the bind-mounted backup directory, unless
+// exitCode makes them fail, or failing does for the volumes they mount.
+type fakeDaemon struct {
+	mu         sync.Mutex
+	volumes    map[string]bool
+	specs      map[string]volume.Volume // volume -> driver, options and labels; plain local if unset
+	containers map[string][]string      // volume -> IDs of the containers using it, which start out running
+	sizes      map[string]int64         // volume -> disk usage reported by system df
+	exitCode   int
+	failing    map[string]bool // volumes whose workers fail
+	hang       bool            // workers never exit; waits return once the client gives up
+	lists      int             // container list requests not filtered by volume
+	actions    []string
+	workers    map[string]workerSpec
+	created    []volume.CreateOptions
+	removed    []string
+}
+
+type workerSpec struct {
+	Image  string
+	Cmd    []string
+	Mounts []mount.Mount
+}
+
+// workerExitCode returns the exit status of a worker container
+func (f *fakeDaemon) workerExitCode(id string) int {
+	for _, m := range f.workers[id].Mounts {
+		if f.failing[m.Source] {
+			return 2
+		}
+	}
+	return f.exitCode
+}
+
+func (f *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/_ping") {
+		w.Header().Set("Api-Version", "1.47")
+		io.WriteString(w, "OK")
+		return
+	}
+
+	// Paths look like /v1.47/<resource>/...
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+	resource, name, action := parts[1], "", ""
+	if len(parts) > 2 {
+		name = parts[2]
+	}
+	if len(parts) > 3 {
+		action = parts[3]
+	}
+
+	switch {
+	case resource == "volumes" && name == "" && r.Method == http.MethodGet:
+		var list volume.ListResponse
+		for vol := range f.volumes {
+			spec, ok := f.specs[vol]
+			if !ok {
+				spec = volume.Volume{Name: vol, Driver: "local"}
+			}
+			list.Volumes = append(list.Volumes, &spec)
+		}
+		writeJSON(w, list)
+
+	case resource == "volumes" && name == "create" && r.Method == http.MethodPost:
+		var req volume.CreateOptions
+		json.NewDecoder(r.Body).Decode(&req)
+		if f.volumes == nil {
+			f.volumes = make(map[string]bool)
+		}
+		if f.specs == nil {
+			f.specs = make(map[string]volume.Volume)
+		}
+		spec := volume.Volume{Name: req.Name, Driver: req.Driver, Options: req.DriverOpts, Labels: req.Labels}
+		f.volumes[req.Name] = true
+		f.specs[req.Name] = spec
+		f.created = append(f.created, req)
+		writeJSON(w, spec)
+
+	case resource == "volumes" && r.Method == http.MethodDelete:
+		// Like Docker, even a forced remove fails while containers, running
+		// or stopped, still reference the volume
+		if len(f.containers[name]) > 0 {
+			http.Error(w, `{"message":"remove `+name+`: volume is in use"}`, http.StatusConflict)
+			return
+		}
+		delete(f.volumes, name)
+		delete(f.specs, name)
+		f.removed = append(f.removed, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	case resource == "volumes" && r.Method == http.MethodGet:
+		if !f.volumes[name] {
+			http.Error(w, `{"message":"no such volume"}`, http.StatusNotFound)
+			return
+		}
+		spec, ok := f.specs[name]
+		if !ok || spec.Driver == "" {
+			spec.Name, spec.Driver = name, "local"
+		}
+		writeJSON(w, spec)
+
+	case resource == "system" && name == "df":
+		var du types.DiskUsage
+		for vol, size := range f.sizes {
+			du.Volumes = append(du.Volumes, &volume.Volume{Name: vol, UsageData: &volume.UsageData{Size: size}})
+		}
+		writeJSON(w, du)
+
+	case resource == "version":
+		writeJSON(w, types.Version{Version: "28.5.2", APIVersion: "1.47"})
+
+	case resource == "images":
+		writeJSON(w, map[string]string{"Id": "sha256:alpine"})
+
+	case resource == "containers" && name == "json":
+		args, _ := filters.FromJSON(r.URL.Query().Get("filters"))
+		var list []container.Summary
+		for _, vol := range args.Get("volume") {
+			for _, id := range f.containers[vol] {
+				list = append(list, container.Summary{ID: id, Names: []string{"/" + id}, State: "running"})
+			}
+		}
+		if !args.Contains("volume") {
+			// Every container, with the volumes it mounts
+			f.lists++
+			byID := make(map[string]*container.Summary)
+			for vol, ids := range f.containers {
+				for _, id := range ids {
+					if byID[id] == nil {
+						byID[id] = &container.Summary{ID: id, Names: []string{"/" + id}, State: "running"}
+					}
+					byID[id].Mounts = append(byID[id].Mounts, container.MountPoint{Type: mount.TypeVolume, Name: vol})
+				}
+			}
+			for _, cont := range byID {
+				sort.Slice(cont.Mounts, func(i, j int) bool { return cont.Mounts[i].Name < cont.Mounts[j].Name })
+				list = append(list, *cont)
+			}
+			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		}
+		writeJSON(w, list)
+
+	case resource == "containers" && name == "create":
+		var req struct {
+			container.Config
+			HostConfig container.HostConfig
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if f.workers == nil {
+			f.workers = make(map[string]workerSpec)
+		}
+		id := fmt.Sprintf("worker%d", len(f.workers)+1)
+		f.workers[id] = workerSpec{Image: req.Image, Cmd: req.Cmd, Mounts: req.HostConfig.Mounts}
+		writeJSON(w, container.CreateResponse{ID: id})
+
+	case resource == "containers" && r.Method == http.MethodDelete:
+		if _, ok := f.workers[name]; !ok {
+			f.actions = append(f.actions, "remove "+name)
+			for vol, ids := range f.containers {
+				f.containers[vol] = slices.DeleteFunc(ids, func(id string) bool { return id == name })
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case resource == "containers" && action == "wait":
+		if f.hang {
+			f.mu.Unlock()
+			<-r.Context().Done()
+			f.mu.Lock()
+			return
+		}
+		writeJSON(w, container.WaitResponse{StatusCode: int64(f.workerExitCode(name))})
+
+	case resource == "containers" && action == "logs":
+		io.WriteString(w, "tar: simulated failure")
+
+	case resource == "containers" && (action == "start" || action == "stop"):
+		if spec, ok := f.workers[name]; ok {
+			if action == "start" && f.workerExitCode(name) == 0 {
+				f.runWorker(spec)
+			}
+		} else {
+			f.actions = append(f.actions, action+" "+name)
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// runWorker writes the archive a worker's "tar -f /backup/<name>" command,
+// or a shell pipeline ending in "> '/backup/<name>'", would create into the
+// host directory mounted at /backup
+func (f *fakeDaemon) runWorker(spec workerSpec) {
+	for i, arg := range spec.Cmd {
+		var archive string
+		switch {
+		case arg == "-f" && i+1 < len(spec.Cmd):
+			archive = spec.Cmd[i+1]
+		case strings.Contains(arg, "> '/backup/"):
+			_, archive, _ = strings.Cut(arg, "> ")
+			archive = strings.Trim(archive, "'")
+		default:
+			continue
+		}
+		for _, m := range spec.Mounts {
+			if m.Target == "/backup" && strings.HasPrefix(archive, "/backup/") {
+				os.WriteFile(filepath.Join(m.Source, strings.TrimPrefix(archive, "/backup/")), []byte("archive"), 0o644)
+			}
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// newDockerTestContext returns a test context whose Docker client talks to
+// daemon, with backups written below the returned directory
+func newDockerTestContext(t *testing.T, daemon *fakeDaemon) (*Context, string) {
+	t.Helper()
+	srv := httptest.NewServer(daemon)
+	t.Cleanup(srv.Close)
+
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(srv.URL, "http://"))
+	t.Setenv("DOCKER_API_VERSION", "")
+	t.Setenv("DOCKER_CERT_PATH", "")
+	t.Setenv("DOCKER_TLS_VERIFY", "")
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		t.Fatalf("failed to create docker client: %v", err)
+	}
+	t.Cleanup(func() { cli.Close() })
+
+	c, dir := newTestContext(t)
+	c.Docker = cli
+	c.Config = config.DefaultConfig()
+	c.Config.Paths.Backups = filepath.Join(dir, "backups")
+	c.Out = io.Discard
+	c.Err = io.Discard
+	return c, dir
+}
+
+func TestBackupStopsContainersByConfigDefault(t *testing.T) {
+	tests := []struct {
+		name        string
+		configStop  bool
+		opts        BackupOptions
+		wantActions []string
+	}{
+		{
+			name:        "configDefaultStopsAndRestarts",
+			configStop:  true,
+			wantActions: []string{"stop app1", "start app1"},
+		},
+		{
+			name:        "noStopOverridesConfig",
+			configStop:  true,
+			opts:        BackupOptions{NoStop: true},
+			wantActions: nil,
+		},
+		{
+			name:        "stopFlagWithoutConfig",
+			opts:        BackupOptions{Stop: true},
+			wantActions: []string{"stop app1", "start app1"},
+		},
+		{
+			name:        "neither",
+			wantActions: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{
+				volumes:    map[string]bool{"app_data": true},
+				containers: map[string][]string{"app_data": {"app1"}},
+				sizes:      map[string]int64{"app_data": 4096},
+			}
+			c, _ := newDockerTestContext(t, daemon)
+			c.Config.Defaults.StopBeforeBackup = tt.configStop
+
+			opts := tt.opts
+			opts.Services = []string{"app_data"}
+			if err := c.Backup(opts); err != nil {
+				t.Fatalf("backup failed: %v", err)
+			}
+
+			if strings.Join(daemon.actions, ",") != strings.Join(tt.wantActions, ",") {
+				t.Fatalf("expected actions %v, got %v", tt.wantActions, daemon.actions)
+			}
+			records, err := c.DB.GetBackupRecords("app_data", 0)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("expected one backup record, got %v, %v", records, err)
+			}
+			if records[0].Driver != "local" {
+				t.Fatalf("expected the volume driver to be recorded, got %q", records[0].Driver)
+			}
+			if records[0].UncompressedSize != 4096 {
+				t.Fatalf("expected the volume size to be recorded, got %d", records[0].UncompressedSize)
+			}
+		})
+	}
+}
+
+func TestBackupNoCompressWritesPlainTar(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, Format: "tar.gz", NoCompress: true}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	records, err := c.DB.GetBackupRecords("app_data", 0)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected one backup record, got %v, %v", records, err)
+	}
+	backupFile := records[0].FilePath
+	if !strings.HasSuffix(backupFile, ".tar") {
+		t.Fatalf("expected an uncompressed backup named .tar, got %s", backupFile)
+	}
+	if cmd := strings.Join(daemon.workers["worker1"].Cmd, " "); strings.Contains(cmd, "-z") || strings.Contains(cmd, "gzip") {
+		t.Fatalf("expected an uncompressed tar command, got %q", cmd)
+	}
+
+	// The volume is inferred from the .tar name and extracted without gzip
+	if err := c.Restore(RestoreOptions{Target: backupFile, Force: true}); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	cmd := strings.Join(daemon.workers["worker2"].Cmd, " ")
+	if !strings.Contains(cmd, filepath.Base(backupFile)) || strings.Contains(cmd, "-z") {
+		t.Fatalf("expected a plain tar extraction of %s, got %q", filepath.Base(backupFile), cmd)
+	}
+}
+
+func TestBackupFollowSymlinks(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if cmd := daemon.workers["worker1"].Cmd; containsArg(cmd, "-h") {
+		t.Fatalf("expected links to be stored as links by default, got %q", cmd)
+	}
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, FollowSymlinks: true, NoDedup: true}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if cmd := daemon.workers["worker2"].Cmd; !containsArg(cmd, "-h") {
+		t.Fatalf("expected tar -h with --follow-symlinks, got %q", cmd)
+	}
+}
+
+// containsArg reports whether cmd has arg as one of its arguments
+func containsArg(cmd []string, arg string) bool {
+	for _, a := range cmd {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBackupWritesTgz(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+	c.Config.Defaults.CompressFormat = "tgz"
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	records, err := c.DB.GetBackupRecords("app_data", 0)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected one backup record, got %v, %v", records, err)
+	}
+	backupFile := records[0].FilePath
+	if !strings.HasSuffix(backupFile, ".tgz") {
+		t.Fatalf("expected a backup named .tgz, got %s", backupFile)
+	}
+	if cmd := strings.Join(daemon.workers["worker1"].Cmd, " "); !strings.Contains(cmd, "-z") {
+		t.Fatalf("expected a gzip-compressed tar command, got %q", cmd)
+	}
+
+	backupDir := filepath.Dir(backupFile)
+	if found, err := FindBackupFile(backupDir, "app_data"); err != nil || found != backupFile {
+		t.Fatalf("expected the tgz backup to be found, got %q, %v", found, err)
+	}
+
+	if err := c.Restore(RestoreOptions{Target: "app_data", Force: true}); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if cmd := strings.Join(daemon.workers["worker2"].Cmd, " "); !strings.Contains(cmd, filepath.Base(backupFile)) {
+		t.Fatalf("expected %s to be restored, got %q", filepath.Base(backupFile), cmd)
+	}
+}
+
+func TestBackupCompressLevel(t *testing.T) {
+	tests := []struct {
+		name        string
+		configLevel int
+		opts        BackupOptions
+		wantCmd     string // substring of the worker command, "" for no gzip pipe
+		wantImage   string // worker image, "" for any
+		wantErr     bool
+	}{
+		{name: "default", wantCmd: ""},
+		{name: "fromConfig", configLevel: 3, wantCmd: "gzip -3"},
+		{name: "flagOverridesConfig", configLevel: 3, opts: BackupOptions{Level: 9}, wantCmd: "gzip -9"},
+		{name: "zstdFormat", opts: BackupOptions{Format: "tar.zst", Level: 19}, wantCmd: "-I zstd -19 ", wantImage: docker.ZstdImage},
+		{name: "zstdDefault", opts: BackupOptions{Format: "tar.zst"}, wantCmd: "-I zstd -f", wantImage: docker.ZstdImage},
+		{name: "configIgnoredForTar", configLevel: 3, opts: BackupOptions{Format: "tar"}, wantCmd: ""},
+		{name: "outOfRange", opts: BackupOptions{Level: 10}, wantErr: true},
+		{name: "zstdOutOfRange", opts: BackupOptions{Format: "tar.zst", Level: 20}, wantErr: true},
+		{name: "uncompressed", opts: BackupOptions{NoCompress: true, Level: 5}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+			c, _ := newDockerTestContext(t, daemon)
+			c.Config.Defaults.CompressLevel = tt.configLevel
+
+			opts := tt.opts
+			opts.Services = []string{"app_data"}
+			err := c.Backup(opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error for level %d", opts.Level)
+				}
+				if len(daemon.workers) != 0 {
+					t.Fatalf("expected no worker to run, got %v", daemon.workers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("backup failed: %v", err)
+			}
+
+			if len(daemon.workers) != 1 {
+				t.Fatalf("expected one worker, got %v", daemon.workers)
+			}
+			cmd := strings.Join(daemon.workers["worker1"].Cmd, " ")
+			if tt.wantCmd == "" && strings.Contains(cmd, "gzip") {
+				t.Fatalf("expected tar without a gzip pipe, got %q", cmd)
+			}
+			if !strings.Contains(cmd, tt.wantCmd) {
+				t.Fatalf("expected %q in worker command %q", tt.wantCmd, cmd)
+			}
+			if image := daemon.workers["worker1"].Image; tt.wantImage != "" && image != tt.wantImage {
+				t.Fatalf("expected the worker to run %s, got %s", tt.wantImage, image)
+			}
+			records, err := c.DB.GetBackupRecords("app_data", 0)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("expected one backup record, got %v, %v", records, err)
+			}
+		})
+	}
+}
+
+func TestBackupRestartsStoppedContainers(t *testing.T) {
+	tests := []struct {
+		name        string
+		exitCode    int
+		opts        BackupOptions
+		wantActions []string
+		wantRecords int
+	}{
+		{
+			name:        "afterSuccess",
+			opts:        BackupOptions{Stop: true},
+			wantActions: []string{"stop app1", "stop app2", "start app1", "start app2"},
+			wantRecords: 1,
+		},
+		{
+			name:        "afterFailure",
+			exitCode:    2,
+			opts:        BackupOptions{Stop: true},
+			wantActions: []string{"stop app1", "stop app2", "start app1", "start app2"},
+		},
+		{
+			name:        "noRestartLeavesThemDown",
+			opts:        BackupOptions{Stop: true, NoRestart: true},
+			wantActions: []string{"stop app1", "stop app2"},
+			wantRecords: 1,
+		},
+		{
+			name:        "noRestartAfterFailure",
+			exitCode:    2,
+			opts:        BackupOptions{Stop: true, NoRestart: true},
+			wantActions: []string{"stop app1", "stop app2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{
+				volumes:    map[string]bool{"app_data": true},
+				containers: map[string][]string{"app_data": {"app1", "app2"}},
+				exitCode:   tt.exitCode,
+			}
+			c, _ := newDockerTestContext(t, daemon)
+
+			opts := tt.opts
+			opts.Services = []string{"app_data"}
+			opts.OutputFormat = "json"
+			var out bytes.Buffer
+			c.Out = &out
+			err := c.Backup(opts)
+			var batch *BatchError
+			if tt.exitCode == 0 && err != nil {
+				t.Fatalf("backup failed: %v", err)
+			}
+			if tt.exitCode != 0 && !errors.As(err, &batch) {
+				t.Fatalf("expected a BatchError for the failed backup, got %v", err)
+			}
+
+			var summary Summary
+			if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+				t.Fatalf("invalid summary: %v\n%s", err, out.String())
+			}
+			if wantFailed := 1 - tt.wantRecords; summary.Failed != wantFailed {
+				t.Fatalf("expected %d failed volumes, got %+v", wantFailed, summary)
+			}
+
+			if strings.Join(daemon.actions, ",") != strings.Join(tt.wantActions, ",") {
+				t.Fatalf("expected actions %v, got %v", tt.wantActions, daemon.actions)
+			}
+			records, err := c.DB.GetBackupRecords("app_data", 0)
+			if err != nil || len(records) != tt.wantRecords {
+				t.Fatalf("expected %d backup records, got %v, %v", tt.wantRecords, records, err)
+			}
+		})
+	}
+}
+
+func TestBackupReportsPartialFailure(t *testing.T) {
+	for _, ignoreErrors := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ignoreErrors=%v", ignoreErrors), func(t *testing.T) {
+			daemon := &fakeDaemon{
+				volumes: map[string]bool{"app_data": true, "app_cache": true},
+				failing: map[string]bool{"app_cache": true},
+			}
+			c, _ := newDockerTestContext(t, daemon)
+			var out bytes.Buffer
+			c.Out = &out
+
+			err := c.Backup(BackupOptions{Services: []string{"app_data", "app_cache"}, IgnoreErrors: ignoreErrors})
+			if ignoreErrors {
+				if err != nil {
+					t.Fatalf("expected --ignore-errors to succeed, got %v", err)
+				}
+			} else {
+				var batch *BatchError
+				if !errors.As(err, &batch) || batch.Succeeded != 1 || batch.Failed != 1 {
+					t.Fatalf("expected a BatchError for 1 of 2 volumes, got %v", err)
+				}
+				if err.Error() != "backup: 1 succeeded, 1 failed" {
+					t.Fatalf("unexpected error message %q", err.Error())
+				}
+				if GetExitCode(err) != ExitError {
+					t.Fatalf("expected exit code %d, got %d", ExitError, GetExitCode(err))
+				}
+			}
+
+			if !strings.Contains(out.String(), "! Backed up 1 volume(s)") || !strings.Contains(out.String(), "1 failed") {
+				t.Fatalf("expected a summary line, got:\n%s", out.String())
+			}
+			if records, _ := c.DB.GetBackupRecords("app_data", 0); len(records) != 1 {
+				t.Fatalf("expected the healthy volume to be backed up, got %v", records)
+			}
+		})
+	}
+}
+
+func TestBackupTimesOut(t *testing.T) {
+	daemon := &fakeDaemon{
+		volumes:    map[string]bool{"app_data": true},
+		containers: map[string][]string{"app_data": {"app1"}},
+		hang:       true,
+	}
+	c, _ := newDockerTestContext(t, daemon)
+
+	const limit = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), limit)
+	defer cancel()
+	c.Docker.(*docker.Client).SetContext(ctx)
+
+	err := TimeoutError(ctx, limit, c.Backup(BackupOptions{Services: []string{"app_data"}, Stop: true}))
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Fatalf("expected the limit in the error, got %q", err)
+	}
+	if code := GetExitCode(err); code != ExitTimeout {
+		t.Fatalf("expected exit code %d, got %d", ExitTimeout, code)
+	}
+
+	// The container stopped for the backup is started again regardless
+	if got := strings.Join(daemon.actions, ","); got != "stop app1,start app1" {
+		t.Fatalf("expected app1 to be restarted, got actions %v", daemon.actions)
+	}
+}
+
+func TestBackupNamed(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, Name: "release-2024.tar.gz"}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	records, err := c.DB.GetBackupRecords("app_data", 0)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected one backup record, got %v, %v", records, err)
+	}
+	backupFile := records[0].FilePath
+	if filepath.Base(backupFile) != "release-2024.tar.gz" {
+		t.Fatalf("expected the backup to be named release-2024.tar.gz, got %s", backupFile)
+	}
+	if _, err := os.Stat(backupFile); err != nil {
+		t.Fatalf("expected %s to be written: %v", backupFile, err)
+	}
+
+	// The same name again would overwrite the first backup
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, Name: "release-2024"}); err == nil {
+		t.Fatal("expected an existing backup file to be refused")
+	}
+
+	// An extension of another format is refused before anything runs
+	err = c.Backup(BackupOptions{Services: []string{"app_data"}, Name: "release.tar", Format: "tar.zst"})
+	if err == nil || !strings.Contains(err.Error(), "does not match format tar.zst") {
+		t.Fatalf("expected a format mismatch error, got %v", err)
+	}
+	if len(daemon.workers) != 1 {
+		t.Fatalf("expected no further backups, got %d workers", len(daemon.workers))
+	}
+}
+
+func TestBackupKeepOverridesRetention(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+	c.Config.Defaults.KeepGenerations = 1
+
+	dir := t.TempDir()
+	for i, name := range []string{
+		"app_data_2024-01-01_000000Z.tar.gz",
+		"app_data_2024-01-02_000000Z.tar.gz",
+		"app_data_2024-01-03_000000Z.tar.gz",
+	} {
+		path := writeBackup(t, dir, name, time.Now().Add(time.Duration(i-10)*time.Minute))
+		if err := c.DB.AddBackupRecord(&database.BackupRecord{VolumeName: "app_data", FilePath: path}); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	count := func() int {
+		records, err := c.DB.GetBackupRecords("app_data", 0)
+		if err != nil {
+			t.Fatalf("failed to get records: %v", err)
+		}
+		return len(records)
+	}
+
+	// --keep 3 keeps the new backup and the two newest old ones
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, Keep: 3, NoDedup: true}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if n := count(); n != 3 {
+		t.Fatalf("expected 3 backups kept with --keep 3, got %d", n)
+	}
+
+	// --no-prune leaves every backup in place
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, NoPrune: true, NoDedup: true}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if n := count(); n != 4 {
+		t.Fatalf("expected 4 backups kept with --no-prune, got %d", n)
+	}
+
+	// Without an override keep_generations applies again
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, NoDedup: true}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("expected 1 backup kept by keep_generations, got %d", n)
+	}
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, Keep: -1}); err == nil {
+		t.Fatal("expected a negative --keep to be refused")
+	}
+}
+
+func TestBackupRejectsUnknownFormat(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+
+	err := c.Backup(BackupOptions{Services: []string{"app_data"}, Format: "gzip"})
+	if err == nil || !strings.Contains(err.Error(), "supported: tar.gz") {
+		t.Fatalf("expected an unsupported format error, got %v", err)
+	}
+	if len(daemon.workers) != 0 {
+		t.Fatalf("expected no backup to run, got %d workers", len(daemon.workers))
+	}
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}, Format: "tar"}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+}
+
+func TestBackupNameRejectsMultipleVolumes(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"shop_data": true, "shop_logs": true, "shop_db_data": true}}
+	c, dir := newDockerTestContext(t, daemon)
+	path := filepath.Join(dir, "compose.yaml")
+	writeFile(t, path, `services:
+  app:
+    volumes:
+      - data:/srv/data
+      - logs:/var/log/app
+  db:
+    volumes:
+      - db_data:/var/lib/postgresql/data
+`)
+	cf, err := compose.LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	c.Compose, c.ProjectName = cf, "shop"
+
+	tests := []struct {
+		name string
+		opts BackupOptions
+	}{
+		{name: "wholeProject", opts: BackupOptions{}},
+		{name: "severalServices", opts: BackupOptions{Services: []string{"app:data", "db"}}},
+		{name: "multiVolumeService", opts: BackupOptions{Services: []string{"app"}}},
+		{name: "pattern", opts: BackupOptions{Services: []string{"*"}}},
+		{name: "allProjects", opts: BackupOptions{AllProjects: true}},
+		{name: "watch", opts: BackupOptions{Services: []string{"db"}, Watch: true, Interval: time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Name = "export.tar.gz"
+			if err := c.Backup(tt.opts); err == nil || !strings.Contains(err.Error(), "--name") {
+				t.Fatalf("expected --name to be rejected, got %v", err)
+			}
+		})
+	}
+	if len(daemon.workers) != 0 {
+		t.Fatalf("expected nothing to be backed up, got %d workers", len(daemon.workers))
+	}
+
+	// One volume of a multi-volume service is a single volume
+	if err := c.Backup(BackupOptions{Services: []string{"app:logs"}, Name: "export.tar.gz"}); err != nil {
+		t.Fatalf("backup of app:logs failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Config.Paths.Backups, "shop", "export.tar.gz")); err != nil {
+		t.Fatalf("expected export.tar.gz to be written: %v", err)
+	}
+}
+
+func TestBackupAllProjectsGroupsByProject(t *testing.T) {
+	shop := map[string]string{docker.LabelComposeProject: "shop"}
+	daemon := &fakeDaemon{
+		volumes: map[string]bool{
+			"shop_db":    true,
+			"shop_cache": true,
+			"legacy":     true, // labelled, but named without the project prefix
+			"blog_data":  true, // no labels, grouped by name prefix
+			"0123abcdef": true, // anonymous, belongs to no project
+		},
+		specs: map[string]volume.Volume{
+			"shop_db":    {Name: "shop_db", Driver: "local", Labels: shop},
+			"shop_cache": {Name: "shop_cache", Driver: "local", Labels: shop},
+			"legacy":     {Name: "legacy", Driver: "local", Labels: shop},
+		},
+	}
+	c, dir := newDockerTestContext(t, daemon)
+	c.ProjectName = "current"
+	c.Config.Projects = map[string]config.Project{"blog": {KeepGenerations: 1}}
+
+	// An older blog backup that blog's own retention of 1 should prune
+	old := writeBackup(t, t.TempDir(), "blog_data_2024-01-01_000000.tar.gz", time.Now().Add(-time.Hour))
+	if err := c.DB.AddBackupRecord(&database.BackupRecord{VolumeName: "blog_data", ProjectName: "blog", FilePath: old}); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	var out bytes.Buffer
+	c.Out = &out
+	if err := c.Backup(BackupOptions{AllProjects: true, OutputFormat: "json"}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	var summary Summary
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("invalid summary: %v\n%s", err, out.String())
+	}
+	if summary.OK != 4 || summary.Failed != 0 {
+		t.Fatalf("expected 4 volumes backed up, got %+v", summary)
+	}
+
+	wantProject := map[string]string{"shop_db": "shop", "shop_cache": "shop", "legacy": "shop", "blog_data": "blog"}
+	for _, result := range summary.Results {
+		project, ok := wantProject[result.Volume]
+		if !ok {
+			t.Fatalf("unexpected volume %s in summary", result.Volume)
+		}
+		if wantDir := filepath.Join(dir, "backups", project); filepath.Dir(result.Path) != wantDir {
+			t.Fatalf("expected %s to be backed up into %s, got %s", result.Volume, wantDir, result.Path)
+		}
+
+		records, err := c.DB.GetBackupRecords(result.Volume, 0)
+		if err != nil || len(records) != 1 || records[0].ProjectName != project {
+			t.Fatalf("expected one %s record for %s, got %+v, %v", project, result.Volume, records, err)
+		}
+	}
+
+	if c.ProjectName != "current" {
+		t.Fatalf("expected the project name to be restored, got %s", c.ProjectName)
+	}
+}
+
+func TestBackupSelectsServicesByPattern(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{
+		"shop_db_data":      true,
+		"shop_replica_data": true,
+		"shop_web_data":     true,
+	}}
+	c, dir := newDockerTestContext(t, daemon)
+	path := filepath.Join(dir, "compose.yaml")
+	writeFile(t, path, `services:
+  db:
+    volumes:
+      - db_data:/data
+  db_replica:
+    volumes:
+      - replica_data:/data
+  web:
+    volumes:
+      - web_data:/data
+`)
+	cf, err := compose.LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	c.Compose, c.ProjectName = cf, "shop"
+
+	var out bytes.Buffer
+	c.Out = &out
+	if err := c.Backup(BackupOptions{Services: []string{"db*"}, OutputFormat: "json"}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	var summary Summary
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("invalid summary: %v\n%s", err, out.String())
+	}
+	var got []string
+	for _, result := range summary.Results {
+		got = append(got, result.Volume)
+	}
+	if want := "shop_db_data,shop_replica_data"; strings.Join(got, ",") != want {
+		t.Fatalf("expected %s to be backed up, got %v", want, got)
+	}
+
+	if err := c.Backup(BackupOptions{Services: []string{"cache*"}}); !errors.Is(err, ErrServiceNotFound) {
+		t.Fatalf("expected ErrServiceNotFound for a pattern matching nothing, got %v", err)
+	}
+}
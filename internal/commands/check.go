@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// CheckOptions contains options for check command
+type CheckOptions struct {
+	Overdue bool
+	All     bool // check every volume, not just the current project's
+}
+
+// Check reports volumes whose last backup is older than their configured
+// backup_interval, for use from monitoring. It returns ErrBackupOverdue if
+// any are found.
+func (c *Context) Check(opts CheckOptions) error {
+	if !opts.Overdue {
+		return fmt.Errorf("nothing to check (use --overdue)")
+	}
+
+	items, err := c.ListVolumes(ListOptions{All: opts.All})
+	if err != nil {
+		return err
+	}
+
+	var checked int
+	var overdue []VolumeListItem
+	for _, item := range items {
+		if item.BackupInterval == 0 {
+			continue
+		}
+		checked++
+		if item.Overdue {
+			overdue = append(overdue, item)
+		}
+	}
+
+	if checked == 0 {
+		fmt.Fprintln(c.Out, "No volumes have a backup_interval configured")
+		return nil
+	}
+	if len(overdue) == 0 {
+		fmt.Fprintf(c.Out, "All %d volume(s) were backed up within their interval\n", checked)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VOLUME\tLAST_BACKUP\tINTERVAL")
+	for _, item := range overdue {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", item.VolumeName, FormatTimestamp(item.LastBackup, c.useUTC()), formatInterval(item.BackupInterval))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %d of %d volume(s)", ErrBackupOverdue, len(overdue), checked)
+}
+
+// backupInterval returns the configured backup_interval of a volume, or 0
+func (c *Context) backupInterval(volumeName, serviceName string) time.Duration {
+	if c.Config == nil {
+		return 0
+	}
+	var names []string
+	if serviceName != "" {
+		names = append(names, serviceName)
+	}
+	if c.Compose != nil {
+		if key, ok := c.Compose.VolumeKey(volumeName, c.ProjectName); ok {
+			names = append(names, key)
+		}
+	}
+	names = append(names, volumeName)
+	return c.Config.BackupInterval(c.ProjectName, names...)
+}
+
+// isOverdue reports whether a volume last backed up at lastBackup (zero if
+// never) is overdue at now for interval. Without an interval nothing is.
+func isOverdue(lastBackup time.Time, interval time.Duration, now time.Time) bool {
+	if interval <= 0 {
+		return false
+	}
+	return lastBackup.IsZero() || now.Sub(lastBackup) > interval
+}
+
+// formatInterval formats an interval the way it is configured: whole days
+// as "7d", otherwise like "6h" or "1h30m"
+func formatInterval(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	s := strings.TrimSuffix(d.String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
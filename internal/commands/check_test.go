@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+func TestCheckOverdue(t *testing.T) {
+	cli := newFakeDocker(
+		&volume.Volume{Name: "shop_db_data", Driver: "local"},
+		&volume.Volume{Name: "shop_cache", Driver: "local"},
+	)
+	store := newFakeStore()
+	store.meta["shop_db_data"] = &database.VolumeMetadata{VolumeName: "shop_db_data", LastBackup: time.Now().Add(-48 * time.Hour), BackupCount: 2}
+	store.meta["shop_cache"] = &database.VolumeMetadata{VolumeName: "shop_cache", LastBackup: time.Now().Add(-time.Hour), BackupCount: 9}
+
+	cfg := config.DefaultConfig()
+	c, err := New(Options{Config: cfg, Docker: cli, DB: store, Out: new(bytes.Buffer)})
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+
+	// Nothing is overdue without an interval
+	if err := c.Check(CheckOptions{Overdue: true}); err != nil {
+		t.Fatalf("expected no overdue volumes without backup_interval, got %v", err)
+	}
+
+	cfg.Defaults.BackupInterval = "24h"
+	var out bytes.Buffer
+	c.Out = &out
+	err = c.Check(CheckOptions{Overdue: true})
+	if !errors.Is(err, ErrBackupOverdue) || GetExitCode(err) != ExitError {
+		t.Fatalf("expected ErrBackupOverdue, got %v", err)
+	}
+	if !strings.Contains(out.String(), "shop_db_data") || !strings.Contains(out.String(), "1d") || strings.Contains(out.String(), "shop_cache") {
+		t.Fatalf("expected only shop_db_data to be reported, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := c.List(ListOptions{}); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		if overdue := strings.HasSuffix(line, "OVERDUE"); overdue != strings.Contains(line, "shop_db_data") {
+			t.Fatalf("expected only shop_db_data to be marked OVERDUE, got:\n%s", out.String())
+		}
+	}
+
+	// A longer interval for the volume itself clears it
+	cfg.Projects["shop"] = config.Project{Volumes: map[string]config.Volume{"shop_db_data": {BackupInterval: "3d"}}}
+	c.ProjectName = "shop"
+	if err := c.Check(CheckOptions{Overdue: true, All: true}); err != nil {
+		t.Fatalf("expected no overdue volumes with a 3d interval, got %v", err)
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		24 * time.Hour:               "1d",
+		7 * 24 * time.Hour:           "7d",
+		6 * time.Hour:                "6h",
+		90 * time.Minute:             "1h30m",
+		30*time.Minute + time.Second: "30m1s",
+	} {
+		if got := formatInterval(d); got != want {
+			t.Errorf("%v: expected %s, got %s", d, want, got)
+		}
+	}
+}
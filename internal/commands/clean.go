@@ -2,7 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"time"
 
@@ -11,15 +10,30 @@ import (
 
 // CleanOptions contains options for clean command
 type CleanOptions struct {
-	Unused  bool
-	Stale   int
-	DryRun  bool
-	Archive bool
-	Force   bool
+	Unused           bool
+	Stale            int
+	NotAccessedSince time.Time // clean volumes last accessed before this; zero to ignore
+	DryRun           bool
+	Archive          bool
+	Force            bool
+	SkipConfirm      bool   // skip the typed confirmation of require_name_confirmation
+	OutputFormat     string // "" for text, "json" for a Summary
+	IgnoreErrors     bool   // return nil even if some volumes fail
 }
 
-// Clean cleans up volumes
+// Clean cleans up volumes. If some fail it returns a *BatchError after
+// trying the rest, unless opts.IgnoreErrors is set.
 func (c *Context) Clean(opts CleanOptions) error {
+	c.forgetContainers()
+	return c.withSummary("clean", opts.OutputFormat, func(s *Summary) error {
+		if err := c.clean(opts, s); err != nil {
+			return err
+		}
+		return s.failure(opts.IgnoreErrors)
+	})
+}
+
+func (c *Context) clean(opts CleanOptions, s *Summary) error {
 	var volumesToClean []string
 
 	// Get all volumes
@@ -28,15 +42,29 @@ func (c *Context) Clean(opts CleanOptions) error {
 		return err
 	}
 
+	// One container listing answers for every volume. If it fails, volumes
+	// count as unused for --unused but are then held back as busy.
+	inUse, inUseErr := c.Docker.GetVolumesInUse()
+	isInUse := func(name string) (bool, error) { return inUse[name], inUseErr }
+
+	// Volumes last accessed before the cutoff of --not-accessed-since
+	notAccessed := make(map[string]bool)
+	if !opts.NotAccessedSince.IsZero() {
+		names, err := c.DB.GetVolumesNotAccessedSince(opts.NotAccessedSince)
+		if err != nil {
+			return fmt.Errorf("failed to read access times: %w", err)
+		}
+		for _, name := range names {
+			notAccessed[name] = true
+		}
+	}
+
 	// Filter volumes to clean
 	for _, vol := range volumes {
 		shouldClean := false
 
-		if opts.Unused {
-			inUse, _ := c.Docker.IsVolumeInUse(vol.Name)
-			if !inUse {
-				shouldClean = true
-			}
+		if opts.Unused && !inUse[vol.Name] {
+			shouldClean = true
 		}
 
 		if opts.Stale > 0 {
@@ -49,40 +77,61 @@ func (c *Context) Clean(opts CleanOptions) error {
 			}
 		}
 
+		if notAccessed[vol.Name] {
+			shouldClean = true
+		}
+
 		if shouldClean {
 			volumesToClean = append(volumesToClean, vol.Name)
 		}
 	}
 
 	if len(volumesToClean) == 0 {
-		if !c.Quiet {
-			fmt.Println("No volumes to clean")
-		}
+		c.Info("No volumes to clean")
 		return nil
 	}
 
+	// Split out volumes still referenced by containers; they are only
+	// touched with --force, which stops and removes those containers first
+	free, busy := partitionInUse(volumesToClean, isInUse)
+	busySet := make(map[string]bool, len(busy))
+	for _, name := range busy {
+		busySet[name] = true
+	}
+
 	// Show what will be cleaned
-	fmt.Printf("Volumes to clean (%d):\n", len(volumesToClean))
+	fmt.Fprintf(c.Out, "Volumes to clean (%d):\n", len(volumesToClean))
 	for _, volumeName := range volumesToClean {
 		meta, _ := c.DB.GetVolumeMetadata(volumeName)
 		lastUsed := "never"
 		if meta != nil && !meta.LastAccessed.IsZero() {
-			lastUsed = FormatTimestamp(meta.LastAccessed)
+			lastUsed = FormatTimestamp(meta.LastAccessed, c.useUTC())
+		}
+
+		note := ""
+		if busySet[volumeName] {
+			if opts.Force {
+				note = ", in use: containers will be stopped and removed"
+			} else {
+				note = ", in use: will be skipped"
+			}
 		}
 
-		fmt.Printf("  - %s (last used: %s)\n", volumeName, lastUsed)
+		fmt.Fprintf(c.Out, "  - %s (last used: %s%s)\n", volumeName, lastUsed, note)
 	}
 
 	if opts.DryRun {
-		fmt.Println("\n(Dry run - no changes made)")
+		s.DryRun = true
+		for _, volumeName := range volumesToClean {
+			s.skip(volumeName, "dry run")
+		}
+		fmt.Fprintln(c.Out, "\n(Dry run - no changes made)")
 		return nil
 	}
 
 	// Confirm unless forced
-	if !opts.Force {
-		if !Confirm("\nProceed with cleanup?") {
-			return fmt.Errorf("cleanup cancelled")
-		}
+	if !c.confirmDestructive("\nProceed with cleanup?", c.confirmationName(volumesToClean), opts.Force, opts.SkipConfirm) {
+		return fmt.Errorf("cleanup cancelled")
 	}
 
 	// Archive if requested
@@ -94,65 +143,154 @@ func (c *Context) Clean(opts CleanOptions) error {
 		}
 	}
 
+	// Record sizes up front; they are gone once the volumes are removed
+	sizes := c.volumeSizes()
+
+	// Skip in-use volumes unless forced
+	toClean := free
+	if opts.Force {
+		toClean = volumesToClean
+	} else {
+		for _, volumeName := range busy {
+			containers, _ := c.containersUsing(volumeName)
+			c.Warn("skipping %s: in use by %v (use --force to stop and remove them)", volumeName, containers)
+			s.skip(volumeName, fmt.Sprintf("in use by %v", containers))
+		}
+	}
+
 	// Clean each volume
-	for _, volumeName := range volumesToClean {
-		if err := c.cleanVolume(volumeName, archiveDir); err != nil {
-			fmt.Printf("Error cleaning %s: %v\n", volumeName, err)
+	for _, volumeName := range toClean {
+		if busySet[volumeName] {
+			if err := c.removeVolumeContainers(volumeName); err != nil {
+				c.Error("failed to clean %s: %v", volumeName, err)
+				s.fail(volumeName, err)
+				continue
+			}
+		}
+
+		var archivePath string
+		var archiveSize int64
+		err := c.track("clean", volumeName, func() (err error) {
+			archivePath, archiveSize, err = c.cleanVolume(volumeName, archiveDir)
+			return err
+		})
+		if err != nil {
+			c.reportError(err, "failed to clean %s: %v", volumeName, err)
+			s.fail(volumeName, err)
 			continue
 		}
+		s.ok(volumeName, archivePath, archiveSize, sizes[volumeName])
 	}
 
-	if !c.Quiet {
-		fmt.Printf("\n✓ Cleaned %d volume(s)\n", len(volumesToClean))
+	if !c.Quiet || s.Skipped > 0 || s.Failed > 0 {
+		fmt.Fprintf(c.Out, "\n%s\n", s.line("Removed"))
 	}
 
 	return nil
 }
 
-func (c *Context) cleanVolume(volumeName, archiveDir string) error {
+// partitionInUse splits volumes into those free to remove and those still
+// referenced by containers. Volumes whose status cannot be determined are
+// treated as in use.
+func partitionInUse(volumes []string, isInUse func(string) (bool, error)) (free, busy []string) {
+	for _, name := range volumes {
+		inUse, err := isInUse(name)
+		if err != nil || inUse {
+			busy = append(busy, name)
+			continue
+		}
+		free = append(free, name)
+	}
+	return free, busy
+}
+
+// volumeSizes returns the disk usage of all volumes keyed by name, or nil if
+// the daemon cannot report it
+func (c *Context) volumeSizes() map[string]int64 {
+	sizes, err := c.Docker.GetVolumeSizes()
+	if err != nil {
+		c.Debug("failed to get volume sizes: %v", err)
+		return nil
+	}
+	return sizes
+}
+
+// cleanVolume removes a volume, first archiving it into archiveDir if one is
+// given. It returns the archive written, if any, and its size.
+func (c *Context) cleanVolume(volumeName, archiveDir string) (string, int64, error) {
+	var archivePath string
+	var size int64
+
 	// Archive if directory is provided
 	if archiveDir != "" {
-		if !c.Quiet {
-			fmt.Printf("Archiving %s...\n", volumeName)
-		}
+		c.Info("Archiving %s...", volumeName)
 
 		// Get service name for metadata
 		serviceName := c.GetServiceName(volumeName)
 
 		// Generate filename using volume name (not service name)
 		// This ensures uniqueness even when multiple services share the same volume
-		filename := GenerateBackupFilename(volumeName, c.Config.Defaults.CompressFormat)
-		archivePath := filepath.Join(archiveDir, filename)
+		filename := GenerateBackupFilename(volumeName, c.Config.Defaults.CompressFormat, c.useUTC())
+		archivePath = filepath.Join(archiveDir, filename)
 
-		if err := c.Docker.BackupVolume(volumeName, archivePath, true); err != nil {
-			return fmt.Errorf("archive failed: %w", err)
+		if err := c.Docker.BackupVolume(volumeName, archivePath, true, c.Config.Defaults.CompressLevel, c.tarOptions(false, false)); err != nil {
+			return "", 0, fmt.Errorf("archive failed: %w", err)
 		}
 
 		// Save archive record
-		size, _ := GetFileSize(archivePath)
-		checksum, _ := CalculateChecksum(archivePath)
+		size, _ = GetFileSize(archivePath)
+		checksum, algo, _ := c.checksum(archivePath)
 		record := &database.BackupRecord{
-			VolumeName:  volumeName,
-			ServiceName: serviceName,
-			ProjectName: c.ProjectName,
-			FilePath:    archivePath,
-			Size:        size,
-			Tag:         "cleanup-archive",
-			Checksum:    checksum,
+			VolumeName:   volumeName,
+			ServiceName:  serviceName,
+			ProjectName:  c.ProjectName,
+			FilePath:     archivePath,
+			Size:         size,
+			Tag:          "cleanup-archive",
+			Checksum:     checksum,
+			ChecksumAlgo: algo,
 		}
 		if err := c.DB.AddBackupRecord(record); err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to save backup record: %v\n", err)
+			c.Warn("failed to save backup record: %v", err)
 		}
 	}
 
 	// Delete volume
-	if !c.Quiet {
-		fmt.Printf("Deleting %s...\n", volumeName)
-	}
+	c.Info("Deleting %s...", volumeName)
 
 	if err := c.Docker.RemoveVolume(volumeName, false); err != nil {
-		return fmt.Errorf("failed to delete: %w", err)
+		return archivePath, size, fmt.Errorf("failed to delete: %w", err)
+	}
+
+	return archivePath, size, nil
+}
+
+// removeVolumeContainers stops the containers using volumeName and removes
+// them, as Docker refuses to delete a volume that containers still
+// reference, stopped ones included. If they cannot be removed, the
+// containers that were running are started again.
+func (c *Context) removeVolumeContainers(volumeName string) error {
+	containers, err := c.containersUsing(volumeName)
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	users := c.volumeContainers
+	running, err := c.stopVolumeContainers(volumeName)
+	if err != nil {
+		return err
+	}
+
+	c.Info("Removing containers using %s...", volumeName)
+	if err := c.Docker.RemoveContainers(containers); err != nil {
+		if len(running) > 0 {
+			c.restartContainers(running)
+		}
+		return fmt.Errorf("failed to remove containers: %w", err)
 	}
 
+	// The listing covers stopped containers too, so without the removed
+	// ones it still holds for the volumes handled next
+	c.volumeContainers = users
+	c.dropContainers(containers)
 	return nil
 }
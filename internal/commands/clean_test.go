@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+func TestPartitionInUse(t *testing.T) {
+	status := map[string]bool{"free1": false, "busy1": true, "free2": false}
+	isInUse := func(name string) (bool, error) {
+		inUse, ok := status[name]
+		if !ok {
+			return false, errors.New("lookup failed")
+		}
+		return inUse, nil
+	}
+
+	free, busy := partitionInUse([]string{"free1", "busy1", "unknown", "free2"}, isInUse)
+
+	if len(free) != 2 || free[0] != "free1" || free[1] != "free2" {
+		t.Fatalf("expected [free1 free2] free, got %v", free)
+	}
+	if len(busy) != 2 || busy[0] != "busy1" || busy[1] != "unknown" {
+		t.Fatalf("expected [busy1 unknown] busy, got %v", busy)
+	}
+}
+
+func TestCleanNotAccessedSince(t *testing.T) {
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	accessed := map[string]time.Time{
+		"old":      cutoff.Add(-time.Second),
+		"boundary": cutoff,
+		"recent":   cutoff.Add(time.Second),
+	}
+
+	docker := newFakeDocker(&volume.Volume{Name: "never"})
+	store := newFakeStore()
+	for name, at := range accessed {
+		docker.volumes[name] = &volume.Volume{Name: name}
+		store.meta[name] = &database.VolumeMetadata{VolumeName: name, LastAccessed: at}
+	}
+	c := &Context{Docker: docker, DB: store, Out: io.Discard, Err: io.Discard}
+
+	if err := c.Clean(CleanOptions{NotAccessedSince: cutoff, DryRun: true}); err != nil {
+		t.Fatalf("clean failed: %v", err)
+	}
+
+	var got []string
+	for _, r := range c.LastSummary().Results {
+		got = append(got, r.Volume)
+	}
+	if strings.Join(got, ",") != "old" {
+		t.Fatalf("expected only the volume accessed before the cutoff, got %v", got)
+	}
+}
+
+func TestCleanInUseVolumes(t *testing.T) {
+	tests := []struct {
+		name        string
+		force       bool
+		wantRemoved []string
+		wantActions []string
+		wantSkipped int
+	}{
+		{
+			name:        "skipsInUse",
+			wantRemoved: []string{"old_free"},
+			wantSkipped: 1,
+		},
+		{
+			// The stopped containers would still hold on to the volume
+			name:        "forceRemovesContainers",
+			force:       true,
+			wantRemoved: []string{"old_busy", "old_free"},
+			wantActions: []string{"stop app1", "remove app1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{
+				volumes:    map[string]bool{"old_free": true, "old_busy": true},
+				containers: map[string][]string{"old_busy": {"app1"}},
+			}
+			c, _ := newDockerTestContext(t, daemon)
+			c.Err = io.Discard
+			// Confirm through the typed confirmation, which can be skipped
+			// without --force
+			c.Config.Defaults.RequireNameConfirmation = true
+			for name := range daemon.volumes {
+				if err := c.DB.UpdateLastAccessed(name); err != nil {
+					t.Fatalf("failed to record access: %v", err)
+				}
+			}
+
+			opts := CleanOptions{NotAccessedSince: time.Now().Add(time.Hour), Force: tt.force, SkipConfirm: true}
+			if err := c.Clean(opts); err != nil {
+				t.Fatalf("clean failed: %v", err)
+			}
+
+			removed := append([]string(nil), daemon.removed...)
+			sort.Strings(removed)
+			if strings.Join(removed, ",") != strings.Join(tt.wantRemoved, ",") {
+				t.Fatalf("expected %v removed, got %v", tt.wantRemoved, removed)
+			}
+			if strings.Join(daemon.actions, ",") != strings.Join(tt.wantActions, ",") {
+				t.Fatalf("expected actions %v, got %v", tt.wantActions, daemon.actions)
+			}
+			s := c.LastSummary()
+			if s.OK != len(tt.wantRemoved) || s.Skipped != tt.wantSkipped || s.Failed != 0 {
+				t.Fatalf("expected %d removed and %d skipped, got %+v", len(tt.wantRemoved), tt.wantSkipped, s)
+			}
+		})
+	}
+}
+
+func TestCleanRestartsContainersWhenRemovalFails(t *testing.T) {
+	docker := newFakeDocker(&volume.Volume{Name: "old_busy"})
+	docker.use("old_busy", "app1")
+	docker.removeErr = errors.New("removal of container app1 is already in progress")
+	store := newFakeStore()
+	store.meta["old_busy"] = &database.VolumeMetadata{VolumeName: "old_busy", LastAccessed: time.Now().Add(-time.Hour)}
+	c := &Context{Docker: docker, DB: store, Out: io.Discard, Err: io.Discard}
+
+	err := c.Clean(CleanOptions{NotAccessedSince: time.Now(), Force: true})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Failed != 1 {
+		t.Fatalf("expected the volume to fail, got %v", err)
+	}
+	if !docker.running["app1"] {
+		t.Fatalf("expected app1 to be started again")
+	}
+	if docker.volumes["old_busy"] == nil {
+		t.Fatalf("expected old_busy to be kept")
+	}
+}
@@ -33,8 +33,9 @@ func validateVolumeName(name string) error {
 
 // CloneOptions contains options for clone command
 type CloneOptions struct {
-	Service string
-	NewName string
+	Service  string
+	NewName  string
+	NoLabels bool // create the clone without the source volume's labels
 }
 
 // Clone clones a volume
@@ -68,6 +69,11 @@ func (c *Context) Clone(opts CloneOptions) error {
 		}
 	}
 
+	// Overwriting the target would remove the source before copying it
+	if targetVolume == sourceVolume {
+		return fmt.Errorf("cannot clone %s onto itself", sourceVolume)
+	}
+
 	// Check if target already exists
 	if c.Docker.VolumeExists(targetVolume) {
 		if !Confirm(fmt.Sprintf("Volume %s already exists. Overwrite?", targetVolume)) {
@@ -80,12 +86,16 @@ func (c *Context) Clone(opts CloneOptions) error {
 		}
 	}
 
-	if !c.Quiet {
-		fmt.Printf("Cloning %s to %s...\n", sourceVolume, targetVolume)
-	}
+	c.Info("Cloning %s to %s...", sourceVolume, targetVolume)
 
-	// Copy volume
-	if err := c.Docker.CopyVolume(sourceVolume, targetVolume); err != nil {
+	// Create the target like the source, then copy the data into it
+	err = c.track("clone", sourceVolume, func() error {
+		if err := c.createCloneTarget(sourceVolume, targetVolume, opts); err != nil {
+			return err
+		}
+		return c.Docker.CopyVolume(sourceVolume, targetVolume)
+	})
+	if err != nil {
 		return fmt.Errorf("clone failed: %w", err)
 	}
 
@@ -94,9 +104,34 @@ func (c *Context) Clone(opts CloneOptions) error {
 		return fmt.Errorf("clone completed but failed to update metadata for %s: %w", targetVolume, err)
 	}
 
-	if !c.Quiet {
-		fmt.Printf("✓ Clone complete: %s\n", targetVolume)
+	c.Info("✓ Clone complete: %s", targetVolume)
+
+	return nil
+}
+
+// createCloneTarget creates targetVolume with the driver, options and labels
+// of sourceVolume. Local volumes backed by a device (NFS exports, bind
+// directories) would share storage with the source, so their clone is
+// created as a plain local volume instead.
+func (c *Context) createCloneTarget(sourceVolume, targetVolume string, opts CloneOptions) error {
+	source, err := c.Docker.GetVolume(sourceVolume)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", sourceVolume, err)
+	}
+
+	driverOpts := source.Options
+	if source.Driver == "local" && driverOpts["device"] != "" {
+		c.Warn("%s is backed by %s; creating %s as a plain local volume so it does not share storage", sourceVolume, driverOpts["device"], targetVolume)
+		driverOpts = nil
 	}
 
+	labels := source.Labels
+	if opts.NoLabels {
+		labels = nil
+	}
+
+	if err := c.Docker.CreateVolumeWithOptions(targetVolume, source.Driver, driverOpts, labels); err != nil {
+		return fmt.Errorf("failed to create %s: %w", targetVolume, err)
+	}
 	return nil
 }
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/volume"
+)
+
+func TestCloneCreatesTargetLikeSource(t *testing.T) {
+	labels := map[string]string{"com.docker.compose.project": "app", "owner": "team-a"}
+
+	tests := []struct {
+		name       string
+		source     volume.Volume
+		opts       CloneOptions
+		wantOpts   int
+		wantLabels int
+	}{
+		{
+			name:       "keepsLabelsAndOptions",
+			source:     volume.Volume{Driver: "local", Options: map[string]string{"type": "tmpfs", "o": "size=64m"}, Labels: labels},
+			wantOpts:   2,
+			wantLabels: 2,
+		},
+		{
+			name:     "noLabels",
+			source:   volume.Volume{Driver: "local", Options: map[string]string{"type": "tmpfs"}, Labels: labels},
+			opts:     CloneOptions{NoLabels: true},
+			wantOpts: 1,
+		},
+		{
+			name:       "deviceBackedSourceIsNotShared",
+			source:     volume.Volume{Driver: "local", Options: map[string]string{"type": "nfs", "device": ":/exports/app"}, Labels: labels},
+			wantLabels: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := tt.source
+			source.Name = "app_data"
+			daemon := &fakeDaemon{
+				volumes: map[string]bool{"app_data": true},
+				specs:   map[string]volume.Volume{"app_data": source},
+			}
+			c, _ := newDockerTestContext(t, daemon)
+
+			opts := tt.opts
+			opts.Service, opts.NewName = "app_data", "app_data_copy"
+			if err := c.Clone(opts); err != nil {
+				t.Fatalf("clone failed: %v", err)
+			}
+
+			if len(daemon.created) != 1 {
+				t.Fatalf("expected one volume to be created, got %+v", daemon.created)
+			}
+			got := daemon.created[0]
+			if got.Name != "app_data_copy" || got.Driver != "local" {
+				t.Fatalf("unexpected create spec %+v", got)
+			}
+			if len(got.DriverOpts) != tt.wantOpts {
+				t.Fatalf("expected %d driver options, got %+v", tt.wantOpts, got.DriverOpts)
+			}
+			if len(got.Labels) != tt.wantLabels {
+				t.Fatalf("expected %d labels, got %+v", tt.wantLabels, got.Labels)
+			}
+			if tt.wantLabels > 0 && got.Labels["owner"] != "team-a" {
+				t.Fatalf("expected source labels on the clone, got %+v", got.Labels)
+			}
+		})
+	}
+}
+
+func TestCloneRejectsItself(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+	c.ProjectName = "app"
+
+	// "data" gets the project prefix and resolves to the source itself
+	for _, name := range []string{"app_data", "data"} {
+		err := c.Clone(CloneOptions{Service: "app_data", NewName: name})
+		if err == nil || !strings.Contains(err.Error(), "onto itself") {
+			t.Fatalf("expected cloning onto %s to be refused, got %v", name, err)
+		}
+	}
+	if len(daemon.removed) != 0 || len(daemon.created) != 0 || len(daemon.workers) != 0 || !daemon.volumes["app_data"] {
+		t.Fatalf("expected nothing to change, removed %v, created %+v, %d workers", daemon.removed, daemon.created, len(daemon.workers))
+	}
+}
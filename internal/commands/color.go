@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/moby/term"
+)
+
+// ANSI colors of table cells and log prefixes. The codes all have the same
+// length, so tabwriter, which counts them as text, still lines up a column
+// whose cells are each painted in one of them.
+const (
+	colorDefault = "\x1b[39m"
+	colorGreen   = "\x1b[32m"
+	colorGrey    = "\x1b[90m"
+	colorRed     = "\x1b[31m"
+	colorReset   = "\x1b[0m"
+)
+
+// colorEnabled reports whether output to w is colored: only on a terminal,
+// and neither with --no-color nor with NO_COLOR set
+func (c *Context) colorEnabled(w io.Writer) bool {
+	if c.NoColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(w)
+}
+
+// paint wraps s in an ANSI color when on, and returns it unchanged otherwise
+func paint(s, color string, on bool) string {
+	if !on {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// isTerminal reports whether w writes to a terminal
+func isTerminal(w io.Writer) bool {
+	_, ok := term.GetFdInfo(w)
+	return ok
+}
+
+// terminalWidth returns the width in columns of the terminal w writes to,
+// or 0 if w is not a terminal. COLUMNS overrides it.
+func terminalWidth(w io.Writer) int {
+	fd, ok := term.GetFdInfo(w)
+	if !ok {
+		return 0
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	size, err := term.GetWinsize(fd)
+	if err != nil {
+		return 0
+	}
+	return int(size.Width)
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/tabwriter"
+)
+
+func TestColorSuppressedOffTerminal(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "volumes.txt"))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	for _, w := range []io.Writer{&buf, file} {
+		c := &Context{Err: w}
+		if c.colorEnabled(w) {
+			t.Fatalf("expected no color for %T", w)
+		}
+		if err := c.outputTable(w, testListItems(), true); err != nil {
+			t.Fatalf("table output failed: %v", err)
+		}
+		c.Error("backup failed")
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	for _, out := range []string{buf.String(), string(data)} {
+		if !strings.Contains(out, "in-use") || !strings.Contains(out, "Error: backup failed") {
+			t.Fatalf("expected the table and the error, got:\n%s", out)
+		}
+		if strings.Contains(out, "\x1b[") {
+			t.Fatalf("expected no escape codes, got %q", out)
+		}
+	}
+}
+
+func TestColorDisabledByFlag(t *testing.T) {
+	if c := (&Context{NoColor: true}); c.colorEnabled(os.Stdout) {
+		t.Fatal("expected --no-color to disable color")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if c := (&Context{}); c.colorEnabled(os.Stdout) {
+		t.Fatal("expected NO_COLOR to disable color")
+	}
+}
+
+func TestPaintedColumnStaysAligned(t *testing.T) {
+	rows := []struct{ status, color string }{
+		{"STATUS", colorDefault},
+		{"in-use", colorGreen},
+		{"unused", colorGrey},
+		{"in-use OVERDUE", colorRed},
+	}
+
+	table := func(color bool) string {
+		var buf bytes.Buffer
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		for _, row := range rows {
+			fmt.Fprintf(w, "db\t%s\t3\n", paint(row.status, row.color, color))
+		}
+		w.Flush()
+		return buf.String()
+	}
+
+	painted := table(true)
+	if !strings.Contains(painted, colorGreen+"in-use"+colorReset) {
+		t.Fatalf("expected painted cells, got %q", painted)
+	}
+	stripped := painted
+	for _, code := range []string{colorDefault, colorGreen, colorGrey, colorRed, colorReset} {
+		stripped = strings.ReplaceAll(stripped, code, "")
+	}
+	// Every line carries the same codes, so padding only shifts by their length
+	plain := table(false)
+	if strings.ReplaceAll(stripped, " ", "") != strings.ReplaceAll(plain, " ", "") {
+		t.Fatalf("expected the same cells, got:\n%s\nwant:\n%s", stripped, plain)
+	}
+	var columns []int
+	for _, line := range strings.Split(strings.TrimSpace(stripped), "\n") {
+		columns = append(columns, strings.LastIndex(line, " ")+1)
+	}
+	for _, col := range columns[1:] {
+		if col != columns[0] {
+			t.Fatalf("expected the last column to line up, got:\n%s", stripped)
+		}
+	}
+}
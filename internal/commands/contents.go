@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+// ContentsOptions contains options for list-contents command
+type ContentsOptions struct {
+	Target string // backup file path, or service whose latest backup to list
+	Sizes  bool   // show the size of each entry
+	Top    int    // show only the N largest files, with sizes
+}
+
+// ListContents prints the files in a backup archive without restoring it
+func (c *Context) ListContents(opts ContentsOptions) error {
+	if opts.Target == "" {
+		return fmt.Errorf("backup file or service name is required")
+	}
+	if opts.Top < 0 {
+		return fmt.Errorf("--top must not be negative")
+	}
+
+	backupFile, err := c.contentsBackupFile(opts.Target)
+	if err != nil {
+		return err
+	}
+	c.Debug("Listing %s", backupFile)
+
+	entries, err := c.Docker.ListArchiveContents(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", filepath.Base(backupFile), err)
+	}
+
+	// Show paths relative to the volume root, as restore --path takes them
+	var shown []docker.ArchiveEntry
+	for _, entry := range entries {
+		entry.Name = strings.TrimPrefix(entry.Name, "./")
+		if entry.Name == "" {
+			continue
+		}
+		if opts.Top > 0 && entry.Dir {
+			continue
+		}
+		shown = append(shown, entry)
+	}
+
+	if opts.Top > 0 {
+		sort.SliceStable(shown, func(i, j int) bool { return shown[i].Size > shown[j].Size })
+		if len(shown) > opts.Top {
+			shown = shown[:opts.Top]
+		}
+	}
+
+	if !opts.Sizes && opts.Top == 0 {
+		for _, entry := range shown {
+			fmt.Fprintln(c.Out, entry.Name)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, entry := range shown {
+		size := FormatSize(entry.Size)
+		if entry.Dir {
+			size = "-"
+		}
+		fmt.Fprintf(w, "%s\t  %s\n", size, entry.Name)
+	}
+	return w.Flush()
+}
+
+// contentsBackupFile resolves a list-contents target: an existing file, or
+// the latest backup of a service
+func (c *Context) contentsBackupFile(target string) (string, error) {
+	path, err := config.ResolvePath(target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	_, searchNames, err := c.backupSearchNames(target)
+	if err != nil {
+		return "", err
+	}
+	backupDir := filepath.Join(c.Config.Paths.Backups, c.ProjectName)
+	backupFile, err := FindBackupFile(backupDir, searchNames...)
+	if err != nil {
+		return "", fmt.Errorf("no backup found for %s: %w", target, err)
+	}
+	return backupFile, nil
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+func TestListContents(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Paths.Backups = dir
+	older := writeBackup(t, dir, "app_data_2024-01-01_000000Z.tar.gz", time.Now().Add(-time.Hour))
+	latest := writeBackup(t, dir, "app_data_2024-01-02_000000Z.tar.gz", time.Now())
+
+	cli := newFakeDocker(&volume.Volume{Name: "app_data"})
+	cli.contents = map[string][]docker.ArchiveEntry{
+		older: {{Name: "./", Dir: true}, {Name: "./old.txt", Size: 1}},
+		latest: {
+			{Name: "./", Dir: true},
+			{Name: "./data/", Dir: true},
+			{Name: "./data/small.txt", Size: 10},
+			{Name: "./data/big.bin", Size: 5 << 20},
+			{Name: "./data/medium.log", Size: 4096},
+		},
+	}
+	c, err := New(Options{Config: cfg, Docker: cli, DB: newFakeStore(), Out: new(bytes.Buffer)})
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+
+	run := func(opts ContentsOptions) string {
+		t.Helper()
+		var out bytes.Buffer
+		c.Out = &out
+		if err := c.ListContents(opts); err != nil {
+			t.Fatalf("list-contents failed: %v", err)
+		}
+		return out.String()
+	}
+
+	// A service lists its latest backup
+	if got, want := run(ContentsOptions{Target: "app_data"}), "data/\ndata/small.txt\ndata/big.bin\ndata/medium.log\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if got := run(ContentsOptions{Target: older}); got != "old.txt\n" {
+		t.Fatalf("expected the given file to be listed, got %q", got)
+	}
+
+	// Files given with ~ or relative to the working directory resolve to
+	// the same backup
+	t.Setenv("HOME", dir)
+	t.Chdir(dir)
+	for _, target := range []string{"~/" + filepath.Base(older), filepath.Base(older)} {
+		if got := run(ContentsOptions{Target: target}); got != "old.txt\n" {
+			t.Fatalf("expected %s to list the older backup, got %q", target, got)
+		}
+	}
+
+	lines := strings.Split(strings.TrimRight(run(ContentsOptions{Target: "app_data", Top: 2}), "\n"), "\n")
+	if len(lines) != 2 || strings.Join(strings.Fields(lines[0]), " ") != "5.0 MB data/big.bin" || strings.Join(strings.Fields(lines[1]), " ") != "4.0 KB data/medium.log" {
+		t.Fatalf("expected the two largest files with sizes, got %q", lines)
+	}
+
+	if out := run(ContentsOptions{Target: "app_data", Sizes: true}); !strings.Contains(out, "10 B  data/small.txt") || !strings.Contains(out, "-  data/") {
+		t.Fatalf("expected sizes for files and - for directories, got:\n%s", out)
+	}
+
+	if err := c.ListContents(ContentsOptions{Target: filepath.Join(dir, "missing")}); err == nil {
+		t.Fatalf("expected an error for a service without backups")
+	}
+}
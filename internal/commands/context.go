@@ -1,8 +1,16 @@
 package commands
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/docker/docker/api/types/volume"
 	"github.com/koyashimano/docker-volume-manager/internal/compose"
 	"github.com/koyashimano/docker-volume-manager/internal/config"
 	"github.com/koyashimano/docker-volume-manager/internal/database"
@@ -12,36 +20,146 @@ import (
 // Context holds the application context
 type Context struct {
 	Config      *config.Config
-	Docker      *docker.Client
-	DB          *database.DB
+	Docker      DockerClient
+	DB          MetaStore
 	Compose     *compose.ComposeFile
 	ProjectName string
+	Profiles    []string // active compose profiles for whole-project commands
 	Verbose     bool
 	Quiet       bool
+	NoColor     bool      // never color output, even on a terminal
+	Out         io.Writer // command output, defaults to os.Stdout
+	Err         io.Writer // warnings and diagnostics, defaults to os.Stderr
+	LogFormat   string    // LogFormatText or LogFormatJSON
+
+	// ctx cancels Docker operations and interactive prompts, see
+	// Options.Context
+	ctx context.Context
+
+	// summary of the last backup, clean or archive, see LastSummary
+	summary *Summary
+
+	// containers using each volume, see containersUsing
+	volumeContainers map[string][]string
+
+	// operation and volume tag events emitted while track runs
+	operation string
+	volume    string
 }
 
-// NewContext creates a new context
-func NewContext(cfg *config.Config, verbose, quiet bool) (*Context, error) {
-	dockerClient, err := docker.NewClient()
-	if err != nil {
-		return nil, err
+// Options configures a Context created with New
+type Options struct {
+	Config *config.Config // required
+
+	// Docker and DB are used as given when set; otherwise New connects to
+	// the daemon from the environment and opens the database at DBPath (or
+	// the one of the default config file when empty). The Context owns
+	// them either way: Close closes them.
+	Docker DockerClient
+	DB     MetaStore
+	DBPath string
+
+	// DockerOptional tolerates an unreachable Docker daemon, leaving Docker
+	// nil, so that commands working only on the metadata database can run
+	DockerOptional bool
+
+	// Context bounds the commands: once it is done, Docker operations of a
+	// Docker client created by New are aborted, backup --watch stops, and
+	// interactive prompts such as restore --select fail with ErrCancelled,
+	// as they do on SIGINT and SIGTERM. Give it a deadline to cap how long
+	// a command may run, and see TimeoutError.
+	Context context.Context
+
+	Out     io.Writer // command output, nil for os.Stdout
+	Err     io.Writer // warnings and diagnostics, nil for os.Stderr
+	Verbose bool
+	Quiet   bool
+	NoColor bool
+}
+
+// New creates a context ready to run commands such as Backup, Restore and
+// List. It is the entry point for embedding dvm in another program; call
+// LoadCompose afterwards to work on a Compose project.
+func New(opts Options) (*Context, error) {
+	if opts.Config == nil {
+		return nil, fmt.Errorf("a config is required")
 	}
 
-	configPath := config.GetConfigPath()
-	dbPath := filepath.Join(filepath.Dir(configPath), "meta.db")
-	db, err := database.NewDB(dbPath)
-	if err != nil {
-		dockerClient.Close()
-		return nil, err
+	c := &Context{
+		Config:  opts.Config,
+		ctx:     opts.Context,
+		Verbose: opts.Verbose,
+		Quiet:   opts.Quiet,
+		NoColor: opts.NoColor,
+		Out:     opts.Out,
+		Err:     opts.Err,
+	}
+	if c.Out == nil {
+		c.Out = os.Stdout
+	}
+	if c.Err == nil {
+		c.Err = os.Stderr
+	}
+
+	c.Docker = opts.Docker
+	ownDocker := c.Docker == nil
+	if ownDocker {
+		cli, err := docker.NewClient()
+		if err != nil {
+			if !opts.DockerOptional {
+				return nil, err
+			}
+			c.Debug("%v; continuing without Docker", err)
+		} else {
+			var retryLog io.Writer
+			if c.enabled(LevelDebug) {
+				retryLog = c.Err
+			}
+			cli.SetRetryPolicy(docker.RetryPolicy{
+				Attempts: opts.Config.Defaults.RetryAttempts,
+				Backoff:  docker.DefaultRetryPolicy.Backoff,
+			}, retryLog)
+			cli.SetWarningHandler(c.Warn)
+			if opts.Context != nil {
+				cli.SetContext(opts.Context)
+			}
+			c.Docker = cli
+		}
 	}
 
-	return &Context{
-		Config:  cfg,
-		Docker:  dockerClient,
-		DB:      db,
-		Verbose: verbose,
-		Quiet:   quiet,
-	}, nil
+	c.DB = opts.DB
+	if c.DB == nil {
+		path := opts.DBPath
+		if path == "" {
+			path = opts.Config.DatabasePath(config.GetConfigPath())
+		}
+		db, err := database.NewDB(path)
+		if err != nil {
+			if ownDocker && c.Docker != nil {
+				c.Docker.Close()
+			}
+			return nil, err
+		}
+		c.DB = db
+	}
+
+	return c, nil
+}
+
+// NewContext creates a new context for the CLI, running commands under ctx
+// as Options.Context does, with the database of the config file at
+// configPath. When requireDocker is false, an unreachable Docker daemon is
+// tolerated and Docker is left nil so that commands working only on the
+// metadata database can still run.
+func NewContext(ctx context.Context, cfg *config.Config, configPath string, verbose, quiet, requireDocker bool) (*Context, error) {
+	return New(Options{
+		Config:         cfg,
+		DBPath:         cfg.DatabasePath(configPath),
+		Context:        ctx,
+		DockerOptional: !requireDocker,
+		Verbose:        verbose,
+		Quiet:          quiet,
+	})
 }
 
 // Close closes all connections
@@ -59,11 +177,21 @@ func (c *Context) LoadCompose(composePath, projectOverride string) error {
 	var cf *compose.ComposeFile
 	var err error
 
+	// Like docker compose: -f wins over COMPOSE_FILE, which wins over
+	// searching the project directory and its parents
+	projectDir := os.Getenv(compose.EnvComposeProjectDirectory)
 	if composePath != "" {
 		cf, err = compose.LoadComposeFile(composePath)
+	} else if files := compose.FilesFromEnv(); len(files) > 0 {
+		cf, err = compose.LoadComposeFiles(files)
 	} else {
+		dir := projectDir
+		if dir == "" {
+			dir = "."
+		}
+
 		var path string
-		path, err = compose.FindComposeFile(".")
+		path, err = compose.FindComposeFileUpward(dir)
 		if err != nil {
 			return err
 		}
@@ -74,21 +202,49 @@ func (c *Context) LoadCompose(composePath, projectOverride string) error {
 		return err
 	}
 
+	if projectDir != "" {
+		cf.SetProjectDir(projectDir)
+	}
+
 	c.Compose = cf
 	c.ProjectName = cf.GetProjectName(projectOverride)
 	return nil
 }
 
-// ResolveVolumeName resolves a service name to a full volume name
+// listProjectVolumesByLabel lists the volumes Compose labelled as belonging
+// to the current project, whatever their names
+func (c *Context) listProjectVolumesByLabel() ([]*volume.Volume, error) {
+	if c.ProjectName == "" {
+		return nil, fmt.Errorf("a project name is required to select volumes by label (use -p)")
+	}
+	return c.Docker.ListVolumesByLabel(docker.LabelComposeProject, c.ProjectName)
+}
+
+// ResolveVolumeName resolves a service name to a full volume name. A
+// service with several volumes is ambiguous and must be narrowed down with
+// a "service:volume" selector.
 func (c *Context) ResolveVolumeName(serviceOrVolume string) (string, error) {
+	if isSelector(serviceOrVolume) {
+		service, key, _ := strings.Cut(serviceOrVolume, ":")
+		return c.resolveSelector(service, key)
+	}
+
 	// If compose is loaded, try to resolve as service name
 	if c.Compose != nil {
-		fullName, err := c.Compose.GetFullVolumeName(serviceOrVolume, c.ProjectName)
-		if err == nil {
-			return fullName, nil
+		if keys, err := c.Compose.GetVolumeKeys(serviceOrVolume); err == nil && len(keys) > 0 {
+			if len(keys) > 1 {
+				return "", fmt.Errorf("%w: service %s has volumes %s; select one with %s:%s",
+					ErrAmbiguousVolume, serviceOrVolume, strings.Join(keys, ", "), serviceOrVolume, keys[0])
+			}
+			return c.Compose.FullVolumeName(keys[0], c.ProjectName), nil
 		}
 	}
 
+	// Without Docker, volume existence cannot be checked
+	if c.Docker == nil {
+		return "", ErrVolumeNotFound
+	}
+
 	// Otherwise, assume it's already a full volume name
 	if c.Docker.VolumeExists(serviceOrVolume) {
 		return serviceOrVolume, nil
@@ -102,9 +258,170 @@ func (c *Context) ResolveVolumeName(serviceOrVolume string) (string, error) {
 		}
 	}
 
+	// Try as a volume key of the compose file, which may map to a name:
+	// override or an external volume
+	if c.Compose != nil {
+		if _, ok := c.Compose.GetVolumeConfig(serviceOrVolume); ok {
+			fullName := c.Compose.FullVolumeName(serviceOrVolume, c.ProjectName)
+			if c.Docker.VolumeExists(fullName) {
+				return fullName, nil
+			}
+		}
+	}
+
 	return "", ErrVolumeNotFound
 }
 
+// isSelector reports whether a service argument is a "service:volume"
+// selector. Docker volume names cannot contain a colon.
+func isSelector(arg string) bool {
+	return strings.Contains(arg, ":")
+}
+
+// resolveSelector resolves a "service:volume" selector to the full name of
+// the volume the service mounts as volume, given as its key in the compose
+// file or its Docker name
+func (c *Context) resolveSelector(service, key string) (string, error) {
+	if service == "" || key == "" || strings.Contains(key, ":") {
+		return "", fmt.Errorf("invalid volume selector %q (want service:volume)", service+":"+key)
+	}
+	if c.Compose == nil {
+		return "", fmt.Errorf("%s:%s: a service:volume selector needs a compose file", service, key)
+	}
+	keys, err := c.Compose.GetVolumeKeys(service)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrServiceNotFound, service)
+	}
+
+	for _, k := range keys {
+		if fullName := c.Compose.FullVolumeName(k, c.ProjectName); k == key || fullName == key {
+			return fullName, nil
+		}
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("%w: service %s has no named volumes", ErrVolumeNotFound, service)
+	}
+	return "", fmt.Errorf("%w: service %s has no volume %s (it has %s)", ErrVolumeNotFound, service, key, strings.Join(keys, ", "))
+}
+
+// resolveVolumeNameOrSelf resolves like ResolveVolumeName, but falls back to
+// the argument itself when nothing by that name is known, for commands that
+// also work on volumes Docker no longer has. Ambiguous services and
+// service:volume selectors that do not match are still errors.
+func (c *Context) resolveVolumeNameOrSelf(serviceOrVolume string) (string, error) {
+	volumeName, err := c.ResolveVolumeName(serviceOrVolume)
+	if err == nil {
+		return volumeName, nil
+	}
+	if errors.Is(err, ErrAmbiguousVolume) || isSelector(serviceOrVolume) {
+		return "", err
+	}
+	return serviceOrVolume, nil
+}
+
+// resolveVolumeNames resolves a service to every volume it mounts, for
+// commands that act on each of them; other arguments, including
+// service:volume selectors, resolve to one volume like ResolveVolumeName
+func (c *Context) resolveVolumeNames(serviceOrVolume string) ([]string, error) {
+	if c.Compose != nil && !isSelector(serviceOrVolume) {
+		if keys, err := c.Compose.GetVolumeKeys(serviceOrVolume); err == nil && len(keys) > 0 {
+			names := make([]string, len(keys))
+			for i, key := range keys {
+				names[i] = c.Compose.FullVolumeName(key, c.ProjectName)
+			}
+			return names, nil
+		}
+	}
+
+	volumeName, err := c.ResolveVolumeName(serviceOrVolume)
+	if err != nil {
+		return nil, err
+	}
+	return []string{volumeName}, nil
+}
+
+// volumeSelector returns how to name a project volume to ResolveVolumeName:
+// its service, as "service:volume" if the service has several volumes, or
+// "" if no service mounts it
+func (c *Context) volumeSelector(volumeName string) string {
+	serviceName := c.GetServiceName(volumeName)
+	if serviceName == "" {
+		return ""
+	}
+	if keys, _ := c.Compose.GetVolumeKeys(serviceName); len(keys) > 1 {
+		if key, ok := c.Compose.VolumeKey(volumeName, c.ProjectName); ok {
+			return serviceName + ":" + key
+		}
+	}
+	return serviceName
+}
+
+// expandServices expands service arguments containing glob metacharacters
+// (as understood by filepath.Match) into the matching compose service names,
+// in sorted order. Other arguments are kept as given. A pattern that matches
+// no service is an error.
+func (c *Context) expandServices(args []string) ([]string, error) {
+	var services []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			services = append(services, name)
+		}
+	}
+
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			add(arg)
+			continue
+		}
+		if c.Compose == nil {
+			return nil, fmt.Errorf("%w: pattern %q needs a compose file to match services against", ErrComposeNotFound, arg)
+		}
+
+		names := make([]string, 0, len(c.Compose.Services))
+		for name := range c.Compose.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		matched := false
+		for _, name := range names {
+			ok, err := filepath.Match(arg, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid service pattern %q: %w", arg, err)
+			}
+			if ok {
+				add(name)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("%w: no service matches %q", ErrServiceNotFound, arg)
+		}
+	}
+	return services, nil
+}
+
+// belongsToProject reports whether a volume is part of the current project:
+// named with the project prefix, or declared in the compose file under a
+// name: override or as an external volume
+func (c *Context) belongsToProject(volumeName string) bool {
+	if strings.HasPrefix(volumeName, c.ProjectName+"_") {
+		return true
+	}
+	if c.Compose == nil {
+		return false
+	}
+	_, ok := c.Compose.VolumeKey(volumeName, c.ProjectName)
+	return ok
+}
+
+// useUTC reports whether timestamps in filenames and output are in UTC
+func (c *Context) useUTC() bool {
+	return c.Config != nil && c.Config.Defaults.UseUTC
+}
+
 // GetServiceName tries to get the service name from volume name
 func (c *Context) GetServiceName(volumeName string) string {
 	if c.Compose == nil {
@@ -118,3 +435,16 @@ func (c *Context) GetServiceName(volumeName string) string {
 
 	return serviceName
 }
+
+// networkType returns the network filesystem type, such as "nfs", of a
+// volume whose compose definition keeps its data on a remote server, or ""
+// otherwise
+func (c *Context) networkType(volumeName string) string {
+	if c.Compose == nil {
+		return ""
+	}
+
+	key, _ := c.Compose.VolumeKey(volumeName, c.ProjectName)
+	cfg, _ := c.Compose.GetVolumeConfig(key)
+	return cfg.NetworkType()
+}
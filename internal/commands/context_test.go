@@ -0,0 +1,446 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koyashimano/docker-volume-manager/internal/compose"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestLoadComposeHonorsComposeFile(t *testing.T) {
+	tmp := t.TempDir()
+	base := filepath.Join(tmp, "base.yaml")
+	extra := filepath.Join(tmp, "extra.yaml")
+	writeFile(t, base, `name: shop
+services:
+  db:
+    image: postgres
+    volumes:
+      - db_data:/var/lib/postgresql/data
+volumes:
+  db_data:
+`)
+	writeFile(t, extra, `services:
+  cache:
+    image: redis
+    volumes:
+      - cache_data:/data
+volumes:
+  cache_data:
+`)
+
+	// Run from a directory without a compose file
+	t.Chdir(t.TempDir())
+	t.Setenv(compose.EnvComposeProjectDirectory, "")
+
+	t.Run("single", func(t *testing.T) {
+		t.Setenv(compose.EnvComposeFile, base)
+		c := &Context{}
+		if err := c.LoadCompose("", ""); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if c.ProjectName != "shop" {
+			t.Fatalf("expected project shop, got %s", c.ProjectName)
+		}
+		if got := c.Compose.GetAllFullVolumeNames(c.ProjectName, nil); len(got) != 1 || got[0] != "shop_db_data" {
+			t.Fatalf("unexpected volumes: %v", got)
+		}
+	})
+
+	t.Run("multiple", func(t *testing.T) {
+		t.Setenv(compose.EnvComposeFile, base+string(os.PathListSeparator)+extra)
+		c := &Context{}
+		if err := c.LoadCompose("", ""); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		for _, service := range []string{"db", "cache"} {
+			if _, err := c.Compose.GetFullVolumeName(service, c.ProjectName); err != nil {
+				t.Errorf("expected service %s to be loaded: %v", service, err)
+			}
+		}
+	})
+
+	t.Run("flagWins", func(t *testing.T) {
+		t.Setenv(compose.EnvComposeFile, base)
+		c := &Context{}
+		if err := c.LoadCompose(extra, "override"); err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if _, err := c.Compose.GetFullVolumeName("db", c.ProjectName); err == nil {
+			t.Fatalf("expected -f to replace COMPOSE_FILE")
+		}
+	})
+}
+
+func TestLoadComposeSearchesProjectDirectory(t *testing.T) {
+	projectDir := filepath.Join(t.TempDir(), "inventory")
+	if err := os.Mkdir(projectDir, 0o755); err != nil {
+		t.Fatalf("failed to create project dir: %v", err)
+	}
+	writeFile(t, filepath.Join(projectDir, "compose.yaml"), `services:
+  db:
+    image: postgres
+    volumes:
+      - db_data:/data
+`)
+
+	t.Chdir(t.TempDir())
+	t.Setenv(compose.EnvComposeFile, "")
+	t.Setenv(compose.EnvComposeProjectDirectory, projectDir)
+	t.Setenv("COMPOSE_PROJECT_NAME", "")
+
+	c := &Context{}
+	if err := c.LoadCompose("", ""); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if c.ProjectName != "inventory" {
+		t.Fatalf("expected project inventory, got %s", c.ProjectName)
+	}
+}
+
+func TestCustomNamedVolumesResolve(t *testing.T) {
+	cf, err := compose.LoadComposeFile(filepath.Join("..", "compose", "testdata", "custom_names.yaml"))
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	daemon := &fakeDaemon{volumes: map[string]bool{
+		"shop-postgres": true, // name: override
+		"uploads":       true, // external
+		"other_data":    true, // another project's volume
+	}}
+	c, _ := newDockerTestContext(t, daemon)
+	c.Compose = cf
+	c.ProjectName = "shop"
+
+	t.Run("list", func(t *testing.T) {
+		var out bytes.Buffer
+		c.Out = &out
+		if err := c.List(ListOptions{Format: "json"}); err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		var items []map[string]string
+		if err := json.Unmarshal(out.Bytes(), &items); err != nil {
+			t.Fatalf("invalid list output: %v\n%s", err, out.String())
+		}
+		var got []string
+		for _, item := range items {
+			got = append(got, item["service"]+"="+item["volume"])
+		}
+		if want := "db=shop-postgres,media=uploads"; strings.Join(got, ",") != want {
+			t.Fatalf("expected %s, got %v", want, got)
+		}
+	})
+
+	t.Run("backup", func(t *testing.T) {
+		c.Out = &bytes.Buffer{}
+		if err := c.Backup(BackupOptions{Services: []string{"db"}}); err != nil {
+			t.Fatalf("backup failed: %v", err)
+		}
+		records, err := c.DB.GetBackupRecords("shop-postgres", 0)
+		if err != nil || len(records) != 1 || records[0].ServiceName != "db" {
+			t.Fatalf("expected one db backup of shop-postgres, got %+v, %v", records, err)
+		}
+	})
+
+	t.Run("inspect", func(t *testing.T) {
+		for service, volumeName := range map[string]string{"db": "shop-postgres", "media": "uploads", "db_data": "shop-postgres"} {
+			var out bytes.Buffer
+			c.Out = &out
+			if err := c.Inspect(InspectOptions{Service: service}); err != nil {
+				t.Fatalf("inspect %s failed: %v", service, err)
+			}
+			if !strings.Contains(out.String(), "Volume: "+volumeName) {
+				t.Fatalf("expected %s to resolve to %s, got:\n%s", service, volumeName, out.String())
+			}
+		}
+	})
+}
+
+func TestResolveVolumeNameMultiVolumeService(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compose.yaml")
+	writeFile(t, path, `services:
+  app:
+    image: app
+    volumes:
+      - data:/srv/data
+      - logs:/var/log/app
+  db:
+    image: postgres
+    volumes:
+      - db_data:/var/lib/postgresql/data
+`)
+	cf, err := compose.LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	daemon := &fakeDaemon{volumes: map[string]bool{"shop_data": true, "shop_logs": true, "shop_db_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+	c.Compose = cf
+	c.ProjectName = "shop"
+
+	_, err = c.ResolveVolumeName("app")
+	if !errors.Is(err, ErrAmbiguousVolume) {
+		t.Fatalf("expected an ambiguous volume error, got %v", err)
+	}
+	for _, want := range []string{"data, logs", "app:data"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+
+	for selector, want := range map[string]string{"app:logs": "shop_logs", "app:shop_data": "shop_data", "db": "shop_db_data"} {
+		if got, err := c.ResolveVolumeName(selector); err != nil || got != want {
+			t.Errorf("ResolveVolumeName(%s) = %q, %v; want %s", selector, got, err, want)
+		}
+	}
+
+	if err := c.Inspect(InspectOptions{Service: "app"}); !errors.Is(err, ErrAmbiguousVolume) {
+		t.Fatalf("expected inspect of app to be ambiguous, got %v", err)
+	}
+
+	// Backing up a service covers each of its volumes
+	c.Out = &bytes.Buffer{}
+	if err := c.Backup(BackupOptions{Services: []string{"app"}}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	for _, volumeName := range []string{"shop_data", "shop_logs"} {
+		if records, _ := c.DB.GetBackupRecords(volumeName, 0); len(records) != 1 {
+			t.Errorf("expected one backup of %s, got %v", volumeName, records)
+		}
+	}
+}
+
+func TestVolumeSelector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compose.yaml")
+	writeFile(t, path, `services:
+  app:
+    image: app
+    volumes:
+      - data:/srv/data
+      - logs:/var/log/app
+  db:
+    image: postgres
+    volumes:
+      - db_data:/var/lib/postgresql/data
+`)
+	cf, err := compose.LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	daemon := &fakeDaemon{volumes: map[string]bool{"shop_data": true, "shop_logs": true, "shop_db_data": true, "legacy": true}}
+	c, _ := newDockerTestContext(t, daemon)
+	c.Compose = cf
+	c.ProjectName = "shop"
+
+	t.Run("existing", func(t *testing.T) {
+		if got, err := c.ResolveVolumeName("app:data"); err != nil || got != "shop_data" {
+			t.Fatalf("expected app:data to resolve to shop_data, got %q, %v", got, err)
+		}
+		var out bytes.Buffer
+		c.Out = &out
+		if err := c.Inspect(InspectOptions{Service: "app:logs"}); err != nil {
+			t.Fatalf("inspect failed: %v", err)
+		}
+		if !strings.Contains(out.String(), "Volume: shop_logs") {
+			t.Fatalf("expected app:logs to be inspected, got:\n%s", out.String())
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		for _, selector := range []string{"app:cache", "db:data", "nope:data"} {
+			if _, err := c.ResolveVolumeName(selector); err == nil {
+				t.Errorf("expected %s not to resolve", selector)
+			}
+		}
+		_, err := c.ResolveVolumeName("app:cache")
+		if !errors.Is(err, ErrVolumeNotFound) || !strings.Contains(err.Error(), "data, logs") {
+			t.Fatalf("expected a not found error listing app's volumes, got %v", err)
+		}
+		if _, err := c.ResolveVolumeName("nope:data"); !errors.Is(err, ErrServiceNotFound) {
+			t.Fatalf("expected an unknown service error, got %v", err)
+		}
+		for _, selector := range []string{"app:", ":data"} {
+			if _, err := c.ResolveVolumeName(selector); err == nil || !strings.Contains(err.Error(), "invalid volume selector") {
+				t.Errorf("expected %q to be an invalid selector, got %v", selector, err)
+			}
+		}
+
+		// An explicit selector is never used as a volume name as is
+		if _, err := c.resolveVolumeNameOrSelf("app:cache"); err == nil {
+			t.Fatalf("expected a bad selector not to fall back to itself")
+		}
+
+		// backup counts a bad selector as a failed volume
+		c.Out = &bytes.Buffer{}
+		var batch *BatchError
+		if err := c.Backup(BackupOptions{Services: []string{"app:cache", "db"}}); !errors.As(err, &batch) || batch.Succeeded != 1 || batch.Failed != 1 {
+			t.Fatalf("expected app:cache to fail and db to be backed up, got %v", err)
+		}
+	})
+
+	t.Run("bareService", func(t *testing.T) {
+		for arg, want := range map[string]string{"db": "shop_db_data", "legacy": "legacy", "logs": "shop_logs"} {
+			if got, err := c.ResolveVolumeName(arg); err != nil || got != want {
+				t.Errorf("ResolveVolumeName(%s) = %q, %v; want %s", arg, got, err, want)
+			}
+		}
+		if got, err := c.resolveVolumeNameOrSelf("gone"); err != nil || got != "gone" {
+			t.Errorf("expected an unknown name to fall back to itself, got %q, %v", got, err)
+		}
+	})
+
+	t.Run("restoreAll", func(t *testing.T) {
+		for volumeName, want := range map[string]string{"shop_data": "app:data", "shop_logs": "app:logs", "shop_db_data": "db"} {
+			if got := c.volumeSelector(volumeName); got != want {
+				t.Errorf("volumeSelector(%s) = %q, want %s", volumeName, got, want)
+			}
+		}
+	})
+}
+
+func TestExpandServices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compose.yaml")
+	writeFile(t, path, `services:
+  db:
+    image: postgres
+  db_replica:
+    image: postgres
+  web:
+    image: nginx
+`)
+	cf, err := compose.LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	c := &Context{Compose: cf, ProjectName: "shop"}
+
+	tests := []struct {
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{args: []string{"db*"}, want: []string{"db", "db_replica"}},
+		{args: []string{"web", "db?replica"}, want: []string{"web", "db_replica"}},
+		{args: []string{"db", "db*"}, want: []string{"db", "db_replica"}},
+		{args: []string{"shop_db_data"}, want: []string{"shop_db_data"}},
+		{args: []string{"cache*"}, wantErr: true},
+		{args: []string{"db["}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := c.expandServices(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%v: expected error %v, got %v", tt.args, tt.wantErr, err)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Fatalf("%v: expected %v, got %v", tt.args, tt.want, got)
+		}
+	}
+
+	if _, err := (&Context{}).expandServices([]string{"db*"}); err == nil {
+		t.Fatalf("expected a pattern without a compose file to fail")
+	}
+}
+
+func TestNewEmbedsWithInjectedClients(t *testing.T) {
+	if _, err := New(Options{}); err == nil {
+		t.Fatalf("expected an error without a config")
+	}
+
+	daemon := &fakeDaemon{volumes: map[string]bool{"shop_db_data": true, "shop_cache": true}}
+	base, dir := newDockerTestContext(t, daemon)
+
+	var out bytes.Buffer
+	c, err := New(Options{
+		Config: base.Config,
+		Docker: base.Docker,
+		DB:     base.DB,
+		Out:    &out,
+		Err:    io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+	if c.Docker != base.Docker || c.DB != base.DB {
+		t.Fatalf("expected the injected Docker client and database to be used")
+	}
+
+	path := filepath.Join(dir, "compose.yaml")
+	writeFile(t, path, `services:
+  db:
+    volumes:
+      - db_data:/data
+`)
+	cf, err := compose.LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	c.Compose, c.ProjectName = cf, "shop"
+
+	if c.LastSummary() != nil {
+		t.Fatalf("expected no summary before a command ran")
+	}
+	if err := c.Backup(BackupOptions{Services: []string{"db"}}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	summary := c.LastSummary()
+	if summary == nil || summary.OK != 1 || summary.Results[0].Volume != "shop_db_data" {
+		t.Fatalf("expected one backed up volume, got %+v", summary)
+	}
+	if out.Len() == 0 {
+		t.Fatalf("expected progress output on the injected writer")
+	}
+
+	items, err := c.ListVolumes(ListOptions{All: true})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	var names []string
+	for _, item := range items {
+		names = append(names, item.VolumeName)
+	}
+	if strings.Join(names, ",") != "shop_cache,shop_db_data" {
+		t.Fatalf("expected both volumes sorted by name, got %v", names)
+	}
+}
+
+func TestNewContextUsesDatabaseNextToConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(home, "missing.sock"))
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "ci.yml")
+	writeFile(t, cfgPath, "defaults:\n  keep_generations: 2\n")
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	c, err := NewContext(context.Background(), cfg, cfgPath, false, true, false)
+	if err != nil {
+		t.Fatalf("new context failed: %v", err)
+	}
+	c.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "meta.db")); err != nil {
+		t.Fatalf("expected the database next to %s: %v", cfgPath, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".dvm", "meta.db")); !os.IsNotExist(err) {
+		t.Fatalf("expected no database at the default location, got %v", err)
+	}
+}
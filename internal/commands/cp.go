@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+)
+
+// CopyOptions contains options for cp command
+type CopyOptions struct {
+	Source      string // <service>[:<volume>]:<path> or a local path
+	Destination string // <service>[:<volume>]:<path> or a local path
+}
+
+// volumeRef is a path inside the volume of a service
+type volumeRef struct {
+	Service string // service, or service:volume selector
+	Path    string
+}
+
+// parseVolumeRef parses a <service>:<path> argument, or
+// <service>:<volume>:<path> for one volume of a service with several.
+// Arguments whose part before the colon looks like a path, such as ./a:b,
+// are local paths.
+func parseVolumeRef(arg string) (volumeRef, bool, error) {
+	service, p, ok := strings.Cut(arg, ":")
+	if !ok || service == "" || strings.ContainsAny(service, `/\`) || strings.HasPrefix(service, ".") {
+		return volumeRef{}, false, nil
+	}
+	if key, rest, ok := strings.Cut(p, ":"); ok && key != "" && !strings.Contains(key, "/") {
+		service, p = service+":"+key, rest
+	}
+
+	if p == "" {
+		return volumeRef{}, true, fmt.Errorf("path inside volume is required: %s", arg)
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if elem == ".." {
+			return volumeRef{}, true, fmt.Errorf("path must stay within the volume: %s", arg)
+		}
+	}
+
+	return volumeRef{Service: service, Path: path.Clean("/" + p)}, true, nil
+}
+
+// Copy copies files between a local path and a path inside a volume
+func (c *Context) Copy(opts CopyOptions) error {
+	src, srcIsVolume, err := parseVolumeRef(opts.Source)
+	if err != nil {
+		return err
+	}
+	dst, dstIsVolume, err := parseVolumeRef(opts.Destination)
+	if err != nil {
+		return err
+	}
+
+	if srcIsVolume == dstIsVolume {
+		return fmt.Errorf("exactly one of source and destination must be <service>[:<volume>]:<path>")
+	}
+
+	ref, local := src, &opts.Destination
+	if dstIsVolume {
+		ref, local = dst, &opts.Source
+	}
+	if *local, err = config.ResolvePath(*local); err != nil {
+		return err
+	}
+	volumeName, err := c.ResolveVolumeName(ref.Service)
+	if err != nil {
+		return err
+	}
+
+	if dstIsVolume {
+		if !fileExists(opts.Source) {
+			return fmt.Errorf("source not found: %s", opts.Source)
+		}
+		err := c.track("cp", volumeName, func() error {
+			return c.Docker.CopyToVolume(volumeName, opts.Source, dst.Path)
+		})
+		if err != nil {
+			return fmt.Errorf("copy failed: %w", err)
+		}
+		c.Info("Copied %s to %s:%s", opts.Source, volumeName, dst.Path)
+	} else {
+		err := c.track("cp", volumeName, func() error {
+			return c.Docker.CopyFromVolume(volumeName, src.Path, opts.Destination)
+		})
+		if err != nil {
+			return fmt.Errorf("copy failed: %w", err)
+		}
+		c.Info("Copied %s:%s to %s", volumeName, src.Path, opts.Destination)
+	}
+
+	if err := c.DB.UpdateLastAccessed(volumeName); err != nil {
+		c.Debug("failed to update metadata: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestParseVolumeRef(t *testing.T) {
+	tests := []struct {
+		arg      string
+		want     volumeRef
+		isVolume bool
+		wantErr  bool
+	}{
+		{"db:/var/lib/data", volumeRef{"db", "/var/lib/data"}, true, false},
+		{"db:conf/app.yml", volumeRef{"db", "/conf/app.yml"}, true, false},
+		{"db:/", volumeRef{"db", "/"}, true, false},
+		{"app:logs:/var/log/app.log", volumeRef{"app:logs", "/var/log/app.log"}, true, false},
+		{"app:logs:", volumeRef{}, true, true},
+		{"db:", volumeRef{}, true, true},
+		{"db:../etc/passwd", volumeRef{}, true, true},
+		{"db:/a/../../b", volumeRef{}, true, true},
+		{"./local", volumeRef{}, false, false},
+		{"./dir:with:colons", volumeRef{}, false, false},
+		{"/abs/path", volumeRef{}, false, false},
+		{"local.txt", volumeRef{}, false, false},
+	}
+
+	for _, tt := range tests {
+		got, isVolume, err := parseVolumeRef(tt.arg)
+		if (err != nil) != tt.wantErr || isVolume != tt.isVolume || got != tt.want {
+			t.Errorf("parseVolumeRef(%q) = %+v, %v, %v; want %+v, %v, err=%v", tt.arg, got, isVolume, err, tt.want, tt.isVolume, tt.wantErr)
+		}
+	}
+}
+
+func TestCopyRequiresExactlyOneVolumePath(t *testing.T) {
+	c := &Context{}
+	for _, opts := range []CopyOptions{
+		{Source: "./a", Destination: "./b"},
+		{Source: "db:/a", Destination: "web:/b"},
+	} {
+		if err := c.Copy(opts); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+// DoctorOptions contains options for doctor command
+type DoctorOptions struct {
+	ConfigPath  string // config file the configuration was loaded from
+	DBPath      string // metadata database to check
+	ComposePath string // compose file given with -f, "" to search for one
+	ProjectName string
+	NoCompose   bool
+}
+
+// Check is the outcome of one doctor check. A failed critical check means
+// dvm cannot work; other failures only limit what it can do.
+type Check struct {
+	Name     string
+	OK       bool
+	Critical bool
+	Detail   string
+}
+
+// status returns the STATUS column of a check
+func (ch Check) status() string {
+	switch {
+	case ch.OK:
+		return "ok"
+	case ch.Critical:
+		return "FAIL"
+	default:
+		return "warn"
+	}
+}
+
+// Doctor checks the environment dvm needs and prints a pass/fail table. It
+// returns an error if a critical check failed. Docker and the database are
+// connected to here unless the context already holds them, so doctor works
+// when NewContext would fail.
+func (c *Context) Doctor(opts DoctorOptions) error {
+	checks := c.doctorChecks(opts)
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	failed := 0
+	for _, ch := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", ch.Name, ch.status(), ch.Detail)
+		if !ch.OK && ch.Critical {
+			failed++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d critical check(s) failed", failed)
+	}
+	return nil
+}
+
+// doctorChecks runs every check in the order they are reported
+func (c *Context) doctorChecks(opts DoctorOptions) []Check {
+	checks := []Check{c.checkConfig(opts.ConfigPath)}
+
+	dockerCheck := c.checkDocker()
+	checks = append(checks, dockerCheck)
+	if dockerCheck.OK {
+		checks = append(checks,
+			c.checkImage(docker.AlpineImage, true),
+			c.checkImage(docker.GNUTarImage, false),
+		)
+	} else {
+		// Already counted as the docker failure
+		for _, image := range []string{docker.AlpineImage, docker.GNUTarImage} {
+			checks = append(checks, Check{Name: "image " + image, Detail: "skipped: Docker is unreachable"})
+		}
+	}
+
+	checks = append(checks,
+		checkWritableDir("backups dir", c.Config.Paths.Backups),
+		checkWritableDir("archives dir", c.Config.Paths.Archives),
+		c.checkDatabase(opts.DBPath),
+		c.checkCompose(opts),
+	)
+	return checks
+}
+
+// checkConfig reports whether the loaded configuration is valid
+func (c *Context) checkConfig(path string) Check {
+	check := Check{Name: "config", Critical: true}
+	if err := c.Config.Validate(); err != nil {
+		check.Detail = fmt.Sprintf("%s: %v", path, err)
+		return check
+	}
+	check.OK = true
+	check.Detail = path
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		check.Detail = fmt.Sprintf("%s not found, using defaults", path)
+	}
+	return check
+}
+
+// checkDocker connects to the daemon unless the context already has, and
+// reports its version
+func (c *Context) checkDocker() Check {
+	check := Check{Name: "docker", Critical: true}
+	if c.Docker == nil {
+		cli, err := docker.NewClient()
+		if err != nil {
+			check.Detail = err.Error()
+			return check
+		}
+		c.Docker = cli
+	}
+
+	version, err := c.Docker.ServerVersion()
+	if err != nil {
+		check.Detail = fmt.Sprintf("daemon responds to ping but not to version: %v", err)
+		return check
+	}
+	check.OK = true
+	check.Detail = "daemon " + version
+	return check
+}
+
+// checkImage reports whether a worker image is present, pulling it if not
+func (c *Context) checkImage(image string, critical bool) Check {
+	check := Check{Name: "image " + image, Critical: critical}
+	if c.Docker.ImageAvailable(image) {
+		check.OK = true
+		check.Detail = "present"
+		return check
+	}
+	if err := c.Docker.PullImage(image); err != nil {
+		check.Detail = fmt.Sprintf("not present and could not be pulled: %v", err)
+		if !critical {
+			check.Detail += " (only needed for incremental backups)"
+		}
+		return check
+	}
+	check.OK = true
+	check.Detail = "pulled"
+	return check
+}
+
+// checkWritableDir reports whether dir exists and files can be created in it
+func checkWritableDir(name, dir string) Check {
+	check := Check{Name: name, Critical: true}
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		check.Detail = fmt.Sprintf("%s does not exist (other commands create it)", dir)
+		return check
+	}
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	if !info.IsDir() {
+		check.Detail = fmt.Sprintf("%s is not a directory", dir)
+		return check
+	}
+
+	f, err := os.CreateTemp(dir, ".dvm-doctor-*")
+	if err != nil {
+		check.Detail = fmt.Sprintf("%s is not writable: %v", dir, err)
+		return check
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	check.OK = true
+	check.Detail = dir
+	return check
+}
+
+// checkDatabase opens the metadata database unless the context already has,
+// which also migrates an older schema, and verifies the schema is current
+func (c *Context) checkDatabase(path string) Check {
+	check := Check{Name: "database", Critical: true}
+	if c.DB == nil {
+		db, err := database.NewDB(path)
+		if err != nil {
+			check.Detail = fmt.Sprintf("cannot open %s: %v", path, err)
+			return check
+		}
+		c.DB = db
+	}
+
+	if err := c.DB.CheckSchema(); err != nil {
+		check.Detail = fmt.Sprintf("schema is out of date: %v", err)
+		return check
+	}
+	check.OK = true
+	check.Detail = path
+	return check
+}
+
+// checkCompose reports whether a compose file can be found. Commands given
+// volume names work without one, so this is not critical.
+func (c *Context) checkCompose(opts DoctorOptions) Check {
+	check := Check{Name: "compose file"}
+	if opts.NoCompose {
+		check.OK = true
+		check.Detail = "disabled with --no-compose"
+		return check
+	}
+
+	if c.Compose == nil {
+		if err := c.LoadCompose(opts.ComposePath, opts.ProjectName); err != nil {
+			check.Detail = err.Error()
+			return check
+		}
+	}
+
+	check.OK = true
+	check.Detail = "project " + c.ProjectName
+	return check
+}
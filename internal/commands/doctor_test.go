@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+)
+
+// findCheck returns the check named name
+func findCheck(t *testing.T, checks []Check, name string) Check {
+	t.Helper()
+	for _, ch := range checks {
+		if ch.Name == name {
+			return ch
+		}
+	}
+	t.Fatalf("no %s check in %+v", name, checks)
+	return Check{}
+}
+
+func TestDoctorReportsMissingBackupsDir(t *testing.T) {
+	c, dir := newDockerTestContext(t, &fakeDaemon{})
+	c.Config.Paths.Archives = filepath.Join(dir, "archives")
+	if err := os.MkdirAll(c.Config.Paths.Archives, 0o755); err != nil {
+		t.Fatalf("failed to create archives dir: %v", err)
+	}
+	var out bytes.Buffer
+	c.Out = &out
+
+	// Paths.Backups points at a directory that was never created
+	err := c.Doctor(DoctorOptions{NoCompose: true})
+	if err == nil {
+		t.Fatalf("expected doctor to fail, got:\n%s", out.String())
+	}
+
+	checks := c.doctorChecks(DoctorOptions{NoCompose: true})
+	if ch := findCheck(t, checks, "backups dir"); ch.OK || !strings.Contains(ch.Detail, "does not exist") {
+		t.Fatalf("expected the backups dir check to fail, got %+v", ch)
+	}
+	for _, name := range []string{"config", "docker", "image alpine:3.19", "archives dir", "database"} {
+		if ch := findCheck(t, checks, name); !ch.OK {
+			t.Fatalf("expected the %s check to pass, got %+v", name, ch)
+		}
+	}
+	if !strings.Contains(out.String(), "backups dir") || !strings.Contains(out.String(), "FAIL") {
+		t.Fatalf("expected a failing backups dir row, got:\n%s", out.String())
+	}
+}
+
+func TestDoctorReportsUnreachableDaemon(t *testing.T) {
+	// A daemon whose ping always fails
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(srv.URL, "http://"))
+	// Keep the docker CLI context fallback out of the picture
+	t.Setenv("PATH", "")
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Paths.Backups = dir
+	cfg.Paths.Archives = dir
+	c := &Context{Config: cfg, Out: &bytes.Buffer{}}
+	t.Cleanup(c.Close)
+
+	opts := DoctorOptions{DBPath: filepath.Join(dir, "meta.db"), NoCompose: true}
+	if err := c.Doctor(opts); err == nil {
+		t.Fatalf("expected doctor to fail without Docker")
+	}
+
+	checks := c.doctorChecks(opts)
+	if ch := findCheck(t, checks, "docker"); ch.OK || !ch.Critical || !strings.Contains(ch.Detail, "cannot connect") {
+		t.Fatalf("expected the docker check to fail, got %+v", ch)
+	}
+	if ch := findCheck(t, checks, "database"); !ch.OK {
+		t.Fatalf("expected the database check to pass without Docker, got %+v", ch)
+	}
+}
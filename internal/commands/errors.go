@@ -1,6 +1,13 @@
 package commands
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
 
 var (
 	// ErrVolumeNotFound is returned when a volume is not found
@@ -9,6 +16,10 @@ var (
 	// ErrServiceNotFound is returned when a service is not found
 	ErrServiceNotFound = errors.New("service not found")
 
+	// ErrAmbiguousVolume is returned when a service with several volumes is
+	// given where one volume is expected
+	ErrAmbiguousVolume = errors.New("service has several volumes")
+
 	// ErrComposeNotFound is returned when compose file is not found
 	ErrComposeNotFound = errors.New("compose file not found")
 
@@ -20,19 +31,35 @@ var (
 
 	// ErrInsufficientSpace is returned when there's not enough disk space
 	ErrInsufficientSpace = errors.New("insufficient disk space")
+
+	// ErrDockerUnavailable is returned when the Docker daemon cannot be reached
+	ErrDockerUnavailable = docker.ErrDockerUnavailable
+
+	// ErrBackupOverdue is returned by check when volumes have not been
+	// backed up within their backup_interval
+	ErrBackupOverdue = errors.New("backups overdue")
+
+	// ErrCancelled is returned when an interactive prompt is interrupted
+	ErrCancelled = errors.New("cancelled")
+
+	// ErrTimeout is returned when a command is cut short by --timeout
+	ErrTimeout = errors.New("timed out")
 )
 
 // ExitCode represents program exit codes
 type ExitCode int
 
 const (
-	ExitSuccess ExitCode = 0
-	ExitError   ExitCode = 1
-	ExitNotFound ExitCode = 2
-	ExitPermission ExitCode = 3
-	ExitDiskFull ExitCode = 4
-	ExitInUse ExitCode = 5
-	ExitNoCompose ExitCode = 6
+	ExitSuccess           ExitCode = 0
+	ExitError             ExitCode = 1
+	ExitNotFound          ExitCode = 2
+	ExitPermission        ExitCode = 3
+	ExitDiskFull          ExitCode = 4
+	ExitInUse             ExitCode = 5
+	ExitNoCompose         ExitCode = 6
+	ExitDockerUnavailable ExitCode = 7
+	ExitTimeout           ExitCode = 124 // as for a command killed by timeout(1)
+	ExitCancelled         ExitCode = 130 // as for a process killed by SIGINT
 )
 
 // GetExitCode returns the appropriate exit code for an error
@@ -41,16 +68,45 @@ func GetExitCode(err error) ExitCode {
 		return ExitSuccess
 	}
 
-	switch err {
-	case ErrVolumeNotFound, ErrServiceNotFound, ErrBackupNotFound:
+	// Whatever failed once the time was up failed because of it
+	if errors.Is(err, ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return ExitTimeout
+	}
+
+	// A partial failure is a failure of its own, whatever the volumes failed with
+	var batch *BatchError
+	if errors.As(err, &batch) {
+		return ExitError
+	}
+
+	switch {
+	case errors.Is(err, ErrVolumeNotFound), errors.Is(err, ErrServiceNotFound), errors.Is(err, ErrBackupNotFound):
 		return ExitNotFound
-	case ErrComposeNotFound:
+	case errors.Is(err, ErrComposeNotFound):
 		return ExitNoCompose
-	case ErrVolumeInUse:
+	case errors.Is(err, ErrVolumeInUse):
 		return ExitInUse
-	case ErrInsufficientSpace:
+	case errors.Is(err, ErrInsufficientSpace):
 		return ExitDiskFull
+	case errors.Is(err, ErrDockerUnavailable):
+		return ExitDockerUnavailable
+	case errors.Is(err, ErrCancelled):
+		return ExitCancelled
 	default:
 		return ExitError
 	}
 }
+
+// TimeoutError returns the result of a command run under ctx with a time
+// limit: ErrTimeout, wrapping err, if the deadline of ctx passed, and err
+// unchanged otherwise. Operations aborted by the deadline fail with
+// assorted errors, so the deadline itself is what tells a timeout apart.
+func TimeoutError(ctx context.Context, limit time.Duration, err error) error {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	if err == nil {
+		return fmt.Errorf("%w after %s", ErrTimeout, limit)
+	}
+	return fmt.Errorf("%w after %s: %w", ErrTimeout, limit, err)
+}
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestGetExitCodeUnwrapsErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ExitCode
+	}{
+		{nil, ExitSuccess},
+		{fmt.Errorf("no backup found for db: %w", ErrBackupNotFound), ExitNotFound},
+		{fmt.Errorf("%w at unix:///var/run/docker.sock", ErrDockerUnavailable), ExitDockerUnavailable},
+		{ErrComposeNotFound, ExitNoCompose},
+		{fmt.Errorf("restore %w", ErrCancelled), ExitCancelled},
+		{fmt.Errorf("other"), ExitError},
+		{fmt.Errorf("wait for worker: %w", context.DeadlineExceeded), ExitTimeout},
+		{fmt.Errorf("%w after 30m: %w", ErrTimeout, &BatchError{Command: "backup", Failed: 1}), ExitTimeout},
+		{&BatchError{Command: "backup", Succeeded: 1, Failed: 1, Err: ErrVolumeInUse}, ExitError},
+	}
+
+	for _, tt := range tests {
+		if got := GetExitCode(tt.err); got != tt.want {
+			t.Errorf("GetExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
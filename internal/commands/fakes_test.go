@@ -0,0 +1,213 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+// fakeDocker is an in-memory DockerClient. Volumes live in a map and the
+// containers using them are plain IDs. Methods a test needs that are not
+// implemented here panic through the nil embedded interface.
+type fakeDocker struct {
+	DockerClient
+
+	volumes  map[string]*volume.Volume
+	users    map[string][]string              // volume name -> IDs of containers using it
+	running  map[string]bool                  // container ID -> running
+	contents map[string][]docker.ArchiveEntry // backup path -> archive members
+
+	removeErr error // returned by RemoveContainers
+}
+
+func newFakeDocker(vols ...*volume.Volume) *fakeDocker {
+	f := &fakeDocker{
+		volumes: make(map[string]*volume.Volume),
+		users:   make(map[string][]string),
+		running: make(map[string]bool),
+	}
+	for _, vol := range vols {
+		f.volumes[vol.Name] = vol
+	}
+	return f
+}
+
+// use records a running container using a volume
+func (f *fakeDocker) use(volumeName, containerID string) {
+	f.users[volumeName] = append(f.users[volumeName], containerID)
+	f.running[containerID] = true
+}
+
+func (f *fakeDocker) Close() error { return nil }
+
+func (f *fakeDocker) ListVolumes() ([]*volume.Volume, error) {
+	var vols []*volume.Volume
+	for _, vol := range f.volumes {
+		vols = append(vols, vol)
+	}
+	sort.Slice(vols, func(i, j int) bool { return vols[i].Name < vols[j].Name })
+	return vols, nil
+}
+
+func (f *fakeDocker) ListVolumesByLabel(key, value string) ([]*volume.Volume, error) {
+	all, _ := f.ListVolumes()
+	var vols []*volume.Volume
+	for _, vol := range all {
+		if got, ok := vol.Labels[key]; ok && (value == "" || got == value) {
+			vols = append(vols, vol)
+		}
+	}
+	return vols, nil
+}
+
+func (f *fakeDocker) GetVolume(name string) (*volume.Volume, error) {
+	vol, ok := f.volumes[name]
+	if !ok {
+		return nil, fmt.Errorf("no such volume: %s", name)
+	}
+	return vol, nil
+}
+
+func (f *fakeDocker) VolumeExists(name string) bool {
+	_, ok := f.volumes[name]
+	return ok
+}
+
+func (f *fakeDocker) CreateVolumeWithOptions(name, driver string, driverOpts, labels map[string]string) error {
+	if driver == "" {
+		driver = "local"
+	}
+	f.volumes[name] = &volume.Volume{Name: name, Driver: driver, Options: driverOpts, Labels: labels}
+	return nil
+}
+
+func (f *fakeDocker) RemoveVolume(name string, force bool) error {
+	if _, ok := f.volumes[name]; !ok {
+		return fmt.Errorf("no such volume: %s", name)
+	}
+	if len(f.users[name]) > 0 && !force {
+		return fmt.Errorf("volume %s is in use", name)
+	}
+	delete(f.volumes, name)
+	return nil
+}
+
+func (f *fakeDocker) GetVolumeSizes() (map[string]int64, error) {
+	return nil, nil
+}
+
+func (f *fakeDocker) IsVolumeInUse(volumeName string) (bool, error) {
+	return len(f.users[volumeName]) > 0, nil
+}
+
+func (f *fakeDocker) GetVolumesInUse() (map[string]bool, error) {
+	inUse := make(map[string]bool)
+	for name, ids := range f.users {
+		inUse[name] = len(ids) > 0
+	}
+	return inUse, nil
+}
+
+func (f *fakeDocker) GetVolumeContainerMap() (map[string][]string, error) {
+	users := make(map[string][]string)
+	for name, ids := range f.users {
+		if len(ids) > 0 {
+			users[name] = ids
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeDocker) GetContainersUsingVolume(volumeName string) ([]string, error) {
+	return f.users[volumeName], nil
+}
+
+func (f *fakeDocker) GetRunningContainerIDsUsingVolume(volumeName string) ([]string, error) {
+	var ids []string
+	for _, id := range f.users[volumeName] {
+		if f.running[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakeDocker) StopContainers(ids []string) error {
+	for _, id := range ids {
+		f.running[id] = false
+	}
+	return nil
+}
+
+func (f *fakeDocker) ListArchiveContents(backupPath string) ([]docker.ArchiveEntry, error) {
+	entries, ok := f.contents[backupPath]
+	if !ok {
+		return nil, fmt.Errorf("backup file not found: %s", backupPath)
+	}
+	return entries, nil
+}
+
+func (f *fakeDocker) StartContainers(ids []string) error {
+	for _, id := range ids {
+		f.running[id] = true
+	}
+	return nil
+}
+
+func (f *fakeDocker) RemoveContainers(ids []string) error {
+	if f.removeErr != nil {
+		return f.removeErr
+	}
+	for _, id := range ids {
+		delete(f.running, id)
+		for name, users := range f.users {
+			f.users[name] = slices.DeleteFunc(users, func(user string) bool { return user == id })
+		}
+	}
+	return nil
+}
+
+// fakeStore is an in-memory MetaStore holding volume metadata only. Backup
+// record methods panic through the nil embedded interface; tests needing
+// them use the SQLite database from newTestContext.
+type fakeStore struct {
+	MetaStore
+
+	meta map[string]*database.VolumeMetadata
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{meta: make(map[string]*database.VolumeMetadata)}
+}
+
+func (f *fakeStore) Close() error { return nil }
+
+func (f *fakeStore) GetVolumeMetadata(volumeName string) (*database.VolumeMetadata, error) {
+	if meta, ok := f.meta[volumeName]; ok {
+		return meta, nil
+	}
+	return &database.VolumeMetadata{VolumeName: volumeName}, nil
+}
+
+func (f *fakeStore) GetVolumesNotAccessedSince(t time.Time) ([]string, error) {
+	var names []string
+	for name, meta := range f.meta {
+		if !meta.LastAccessed.IsZero() && meta.LastAccessed.Before(t) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *fakeStore) UpdateLastAccessed(volumeName string) error {
+	meta, _ := f.GetVolumeMetadata(volumeName)
+	meta.LastAccessed = time.Now()
+	f.meta[volumeName] = meta
+	return nil
+}
@@ -1,18 +1,27 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
-	"os"
+	"io"
+	"strings"
 	"text/tabwriter"
+	"time"
+	"unicode/utf8"
 
 	"github.com/koyashimano/docker-volume-manager/internal/database"
 )
 
 // HistoryOptions contains options for history command
 type HistoryOptions struct {
-	Limit   int
+	Limit   int // records per page, 10 if 0
+	Page    int // page of Limit records to show, from 1
 	All     bool
 	Service string
+	Tag     string // only show records with this among their tags
+	Host    string // only show records taken on this host
+	Format  string // table or json
+	Output  string // file path, or "" / "-" for stdout
 }
 
 // History shows backup history
@@ -21,57 +30,68 @@ func (c *Context) History(opts HistoryOptions) error {
 	if limit == 0 {
 		limit = 10
 	}
-
-	var records []*database.BackupRecord
-	var err error
-
+	if opts.Page < 0 {
+		return fmt.Errorf("invalid page %d (pages start at 1)", opts.Page)
+	}
+	page := max(opts.Page, 1)
+
+	// The database filters and pages the records, so large catalogs are
+	// never loaded whole
+	q := database.BackupRecordQuery{
+		Tag:        opts.Tag,
+		SourceHost: opts.Host,
+		Limit:      limit,
+		Offset:     (page - 1) * limit,
+	}
 	if opts.Service != "" {
 		// Get history for specific service
-		volumeName, err := c.ResolveVolumeName(opts.Service)
-		if err != nil {
-			// Try as volume name directly
-			volumeName = opts.Service
-		}
-
-		records, err = c.DB.GetBackupRecords(volumeName, limit)
+		// Unknown names are tried as volume names directly
+		volumeName, err := c.resolveVolumeNameOrSelf(opts.Service)
 		if err != nil {
 			return err
 		}
-	} else if opts.All {
-		// Get all history
-		records, err = c.DB.GetAllBackupRecords(limit)
-		if err != nil {
-			return err
-		}
-	} else {
+		q.VolumeName = volumeName
+	} else if !opts.All {
 		// Get history for current project
-		allRecords, err := c.DB.GetAllBackupRecords(0)
-		if err != nil {
-			return err
-		}
+		q.Project, q.ByProject = c.ProjectName, true
+	}
 
-		// Filter by project
-		for _, rec := range allRecords {
-			if rec.ProjectName == c.ProjectName {
-				records = append(records, rec)
-				if len(records) >= limit {
-					break
-				}
-			}
-		}
+	records, err := c.DB.QueryBackupRecords(q)
+	if err != nil {
+		return err
 	}
 
-	if len(records) == 0 {
-		fmt.Println("No backup history found")
+	// An empty JSON array is still valid output for scripts
+	if len(records) == 0 && opts.Format != "json" {
+		if page > 1 {
+			c.Info("No backup history found on page %d", page)
+		} else {
+			c.Info("No backup history found")
+		}
 		return nil
 	}
 
-	// Display as table
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	defer w.Flush()
+	w, closeOutput, err := c.openOutput(opts.Output)
+	if err != nil {
+		return fmt.Errorf("failed to open output: %w", err)
+	}
 
-	fmt.Fprintln(w, "SERVICE\tTIMESTAMP\tSIZE\tTAG\tPATH")
+	if opts.Format == "json" {
+		err = writeHistoryJSON(w, records)
+	} else {
+		err = writeHistoryTable(w, records, c.useUTC(), terminalWidth(w))
+	}
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
+}
 
+// writeHistoryTable writes backup records as a table, with times in UTC or
+// local time. Paths are shortened from the left to fit the table in width
+// columns; with a width of 0 they are written in full.
+func writeHistoryTable(out io.Writer, records []*database.BackupRecord, utc bool, width int) error {
+	rows := [][]string{{"SERVICE", "TIMESTAMP", "SIZE", "TAG", "PATH"}}
 	for _, rec := range records {
 		serviceName := rec.ServiceName
 		if serviceName == "" {
@@ -83,20 +103,98 @@ func (c *Context) History(opts HistoryOptions) error {
 			tag = "-"
 		}
 
-		// Shorten path for display
-		displayPath := rec.FilePath
-		if len(displayPath) > 50 {
-			displayPath = "..." + displayPath[len(displayPath)-47:]
-		}
-
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+		rows = append(rows, []string{
 			serviceName,
-			FormatTimestamp(rec.CreatedAt),
-			FormatSize(rec.Size),
+			FormatTimestamp(rec.CreatedAt, utc),
+			FormatBackupSize(rec.Size, rec.UncompressedSize),
 			tag,
-			displayPath,
-		)
+			rec.FilePath,
+		})
+	}
+
+	// The path gets whatever the other columns and their padding leave
+	maxPath := 0
+	if width > 0 {
+		maxPath = width
+		for col := 0; col < 4; col++ {
+			colWidth := 0
+			for _, row := range rows {
+				colWidth = max(colWidth, utf8.RuneCountInString(row[col]))
+			}
+			maxPath -= colWidth + 2
+		}
+		maxPath = max(maxPath, minPathWidth)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, row := range rows {
+		if i > 0 {
+			row[4] = shortenPath(row[4], maxPath)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// minPathWidth is the least a shortened path keeps, however narrow the
+// terminal: enough to tell backups apart by their timestamped names
+const minPathWidth = 30
+
+// shortenPath cuts a path to at most n characters, keeping its end and
+// marking the cut with "...". A limit of 0 keeps it whole.
+func shortenPath(path string, n int) string {
+	runes := []rune(path)
+	if n <= 0 || len(runes) <= n {
+		return path
+	}
+	return "..." + string(runes[len(runes)-(n-3):])
+}
+
+// historyEntry is a backup record as written by history --format json
+type historyEntry struct {
+	ID         int       `json:"id"`
+	Service    string    `json:"service"`
+	Volume     string    `json:"volume"`
+	Project    string    `json:"project"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+	Tag        string    `json:"tag"` // the tags joined with commas
+	Tags       []string  `json:"tags"`
+	Checksum   string    `json:"checksum"`
+	SourceHost string    `json:"source_host"`
+
+	// UncompressedSize and CompressionRatio (size / uncompressed_size) are
+	// 0 and null when the size of the backed-up data is unknown
+	UncompressedSize int64    `json:"uncompressed_size"`
+	CompressionRatio *float64 `json:"compression_ratio"`
+}
+
+// writeHistoryJSON writes backup records as a JSON array
+func writeHistoryJSON(out io.Writer, records []*database.BackupRecord) error {
+	entries := make([]historyEntry, len(records))
+	for i, rec := range records {
+		entries[i] = historyEntry{
+			ID:               rec.ID,
+			Service:          rec.ServiceName,
+			Volume:           rec.VolumeName,
+			Project:          rec.ProjectName,
+			Path:             rec.FilePath,
+			Size:             rec.Size,
+			CreatedAt:        rec.CreatedAt,
+			Tag:              rec.Tag,
+			Tags:             append([]string{}, rec.Tags()...),
+			Checksum:         rec.Checksum,
+			SourceHost:       rec.SourceHost,
+			UncompressedSize: rec.UncompressedSize,
+		}
+		if ratio, ok := CompressionRatio(rec.Size, rec.UncompressedSize); ok {
+			entries[i].CompressionRatio = &ratio
+		}
 	}
 
-	return nil
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
 }
@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+// queryStore is a MetaStore answering only paged backup record queries, so
+// a command reading every record panics through the nil embedded interface
+type queryStore struct {
+	MetaStore
+
+	queries []database.BackupRecordQuery
+}
+
+func (s *queryStore) QueryBackupRecords(q database.BackupRecordQuery) ([]*database.BackupRecord, error) {
+	s.queries = append(s.queries, q)
+	return []*database.BackupRecord{{VolumeName: "shop_db", FilePath: "/b/shop_db.tar.gz"}}, nil
+}
+
+func TestHistoryQueriesOnePage(t *testing.T) {
+	tests := []struct {
+		name string
+		opts HistoryOptions
+		want database.BackupRecordQuery
+	}{
+		{
+			name: "currentProject",
+			opts: HistoryOptions{},
+			want: database.BackupRecordQuery{Project: "shop", ByProject: true, Limit: 10},
+		},
+		{
+			name: "allProjectsFiltered",
+			opts: HistoryOptions{All: true, Tag: "daily", Host: "web1", Limit: 20},
+			want: database.BackupRecordQuery{Tag: "daily", SourceHost: "web1", Limit: 20},
+		},
+		{
+			name: "laterPage",
+			opts: HistoryOptions{Page: 3, Limit: 25},
+			want: database.BackupRecordQuery{Project: "shop", ByProject: true, Limit: 25, Offset: 50},
+		},
+		{
+			name: "volume",
+			opts: HistoryOptions{Service: "shop_db", Page: 2},
+			want: database.BackupRecordQuery{VolumeName: "shop_db", Limit: 10, Offset: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &queryStore{}
+			c := &Context{DB: store, ProjectName: "shop", Out: io.Discard}
+			if err := c.History(tt.opts); err != nil {
+				t.Fatalf("history failed: %v", err)
+			}
+			if len(store.queries) != 1 || store.queries[0] != tt.want {
+				t.Fatalf("expected the query %+v, got %+v", tt.want, store.queries)
+			}
+		})
+	}
+}
+
+func TestHistoryFiltersByHostAsJSON(t *testing.T) {
+	c, _ := newTestContext(t)
+	var out bytes.Buffer
+	c.Out = &out
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skipf("hostname unavailable: %v", err)
+	}
+
+	for _, rec := range []*database.BackupRecord{
+		{VolumeName: "app_data", FilePath: "/b/local.tar.gz"},
+		{VolumeName: "app_data", FilePath: "/b/remote.tar.gz", SourceHost: "build-01"},
+	} {
+		if err := c.DB.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	if err := c.History(HistoryOptions{All: true, Host: "build-01", Format: "json"}); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	var entries []historyEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if len(entries) != 1 || entries[0].Path != "/b/remote.tar.gz" || entries[0].SourceHost != "build-01" {
+		t.Fatalf("expected only the build-01 backup, got %+v", entries)
+	}
+
+	out.Reset()
+	if err := c.History(HistoryOptions{All: true, Format: "json"}); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	entries = nil
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if len(entries) != 2 || entries[1].SourceHost != host {
+		t.Fatalf("expected local backup stamped with %q, got %+v", host, entries)
+	}
+
+	out.Reset()
+	if err := c.History(HistoryOptions{All: true, Host: "elsewhere", Format: "json"}); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Fatalf("expected an empty JSON array, got %q", out.String())
+	}
+}
+
+func TestHistoryShowsCompressionRatio(t *testing.T) {
+	c, _ := newTestContext(t)
+	var out bytes.Buffer
+	c.Out = &out
+
+	for _, rec := range []*database.BackupRecord{
+		{VolumeName: "app_data", FilePath: "/b/legacy.tar.gz", Size: 300},
+		{VolumeName: "app_data", FilePath: "/b/new.tar.gz", Size: 250, UncompressedSize: 1000},
+	} {
+		if err := c.DB.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	if err := c.History(HistoryOptions{All: true}); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "1000 B → 250 B (25%)") {
+		t.Fatalf("expected the compression ratio in the table, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := c.History(HistoryOptions{All: true, Format: "json"}); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	var entries []historyEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	if entries[0].UncompressedSize != 1000 || entries[0].CompressionRatio == nil || *entries[0].CompressionRatio != 0.25 {
+		t.Fatalf("expected a ratio of 0.25 for the new backup, got %+v", entries[0])
+	}
+	if entries[1].UncompressedSize != 0 || entries[1].CompressionRatio != nil {
+		t.Fatalf("expected no ratio for a backup of unknown size, got %+v", entries[1])
+	}
+	if !strings.Contains(out.String(), `"compression_ratio": null`) {
+		t.Fatalf("expected an unknown ratio to be null, got:\n%s", out.String())
+	}
+}
+
+func TestWriteHistoryTableFitsWidth(t *testing.T) {
+	path := "/home/user/.dvm/backups/myproject/db/db_20240115_103000.tar.gz"
+	records := []*database.BackupRecord{{ServiceName: "db", FilePath: path, Size: 2048}}
+
+	tests := []struct {
+		name  string
+		width int
+		want  string
+	}{
+		{"unknownWidthKeepsPath", 0, path},
+		{"wideKeepsPath", 200, path},
+		// The other columns and their padding take 33 of the 80 columns
+		{"narrowShortens", 80, "..." + path[len(path)-(80-33-3):]},
+		{"tinyKeepsMinimum", 20, "..." + path[len(path)-(minPathWidth-3):]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeHistoryTable(&buf, records, true, tt.width); err != nil {
+				t.Fatalf("table output failed: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if !strings.HasSuffix(lines[1], "  "+tt.want) {
+				t.Fatalf("expected the path %q, got:\n%s", tt.want, buf.String())
+			}
+		})
+	}
+}
@@ -3,7 +3,12 @@ package commands
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/docker/docker/api/types/volume"
 	"github.com/koyashimano/docker-volume-manager/internal/database"
@@ -23,6 +28,20 @@ func (c *Context) Inspect(opts InspectOptions) error {
 		return fmt.Errorf("service name is required")
 	}
 
+	// Parse a template before touching Docker so mistakes fail fast
+	var tmpl *template.Template
+	switch opts.Format {
+	case "", "table", "json", "yaml":
+	default:
+		if !strings.Contains(opts.Format, "{{") {
+			return fmt.Errorf("unsupported inspect format %q (want table, json, yaml or a Go template)", opts.Format)
+		}
+		var err error
+		if tmpl, err = parseInspectTemplate(opts.Format); err != nil {
+			return err
+		}
+	}
+
 	// Resolve volume name
 	volumeName, err := c.ResolveVolumeName(opts.Service)
 	if err != nil {
@@ -39,52 +58,136 @@ func (c *Context) Inspect(opts InspectOptions) error {
 	meta, _ := c.DB.GetVolumeMetadata(volumeName)
 
 	// Get in-use status
-	inUse, _ := c.Docker.IsVolumeInUse(volumeName)
-	containers, _ := c.Docker.GetContainersUsingVolume(volumeName)
+	c.forgetContainers()
+	containers, _ := c.containersUsing(volumeName)
+	inUse := len(containers) > 0
+
+	// Get compose services declared against the volume
+	var services, readOnly []string
+	if c.Compose != nil {
+		services = c.Compose.GetServicesByVolumeName(volumeName, c.ProjectName)
+		readOnly = c.Compose.GetReadOnlyServicesByVolumeName(volumeName, c.ProjectName)
+	}
+	network := c.networkType(volumeName)
 
 	// Format output
 	switch opts.Format {
+	case "", "table":
+		return c.inspectTable(vol, meta, inUse, containers, services, readOnly, network)
 	case "json":
-		return c.inspectJSON(vol, meta, inUse, containers)
+		return c.inspectJSON(vol, meta, inUse, containers, services, readOnly, network)
 	case "yaml":
-		return c.inspectYAML(vol, meta, inUse, containers)
+		return c.inspectYAML(vol, meta, inUse, containers, services, readOnly, network)
 	default:
-		return c.inspectTable(vol, meta, inUse, containers)
+		return c.inspectTemplate(tmpl, vol, meta, inUse, containers, services, readOnly, network)
 	}
 }
 
-func (c *Context) inspectTable(vol *volume.Volume, meta *database.VolumeMetadata, inUse bool, containers []string) error {
-	fmt.Printf("Volume: %s\n", vol.Name)
-	fmt.Printf("Driver: %s\n", vol.Driver)
-	fmt.Printf("Mountpoint: %s\n", vol.Mountpoint)
-	fmt.Printf("Created: %s\n", vol.CreatedAt)
-	fmt.Printf("Status: %s\n", map[bool]string{true: "in-use", false: "unused"}[inUse])
+// inspectInfo is what an inspect --format template is rendered against.
+// The volume's fields (Name, Driver, Mountpoint, CreatedAt, Labels,
+// Options, ...) are available directly, e.g. {{.Mountpoint}}.
+type inspectInfo struct {
+	*volume.Volume
+	InUse            bool
+	Containers       []string
+	Services         []string
+	ReadOnlyServices []string // services mounting the volume read-only
+	Network          string
+	LastAccessed     time.Time
+	LastBackup       time.Time
+	BackupCount      int
+}
+
+// parseInspectTemplate parses an inspect --format template. Besides the
+// text/template builtins it provides json and join, as docker inspect does.
+func parseInspectTemplate(format string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"join": strings.Join,
+	}
+	tmpl, err := template.New("format").Funcs(funcs).Option("missingkey=error").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format template: %w", err)
+	}
+	return tmpl, nil
+}
+
+func (c *Context) inspectTemplate(tmpl *template.Template, vol *volume.Volume, meta *database.VolumeMetadata, inUse bool, containers, services, readOnly []string, network string) error {
+	info := inspectInfo{
+		Volume:           vol,
+		InUse:            inUse,
+		Containers:       containers,
+		Services:         services,
+		ReadOnlyServices: readOnly,
+		Network:          network,
+	}
+	if meta != nil {
+		info.LastAccessed = meta.LastAccessed
+		info.LastBackup = meta.LastBackup
+		info.BackupCount = meta.BackupCount
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, info); err != nil {
+		return fmt.Errorf("failed to render format template: %w", err)
+	}
+	fmt.Fprintln(c.Out, out.String())
+	return nil
+}
+
+func (c *Context) inspectTable(vol *volume.Volume, meta *database.VolumeMetadata, inUse bool, containers, services, readOnly []string, network string) error {
+	fmt.Fprintf(c.Out, "Volume: %s\n", vol.Name)
+	fmt.Fprintf(c.Out, "Driver: %s\n", vol.Driver)
+	fmt.Fprintf(c.Out, "Mountpoint: %s\n", vol.Mountpoint)
+	fmt.Fprintf(c.Out, "Created: %s\n", vol.CreatedAt)
+	fmt.Fprintf(c.Out, "Status: %s\n", map[bool]string{true: "in-use", false: "unused"}[inUse])
+	if network != "" {
+		fmt.Fprintf(c.Out, "Network: %s (data is stored on a remote server)\n", network)
+	}
+
+	if len(services) > 0 {
+		fmt.Fprintf(c.Out, "Services: %s\n", strings.Join(markReadOnly(services, readOnly), ", "))
+	}
 
 	if len(containers) > 0 {
-		fmt.Printf("Used by: %v\n", containers)
+		fmt.Fprintf(c.Out, "Used by: %v\n", containers)
 	}
 
+	printTableMap(c.Out, "Labels", vol.Labels)
+	printTableMap(c.Out, "Options", vol.Options)
+
 	if meta != nil {
 		if !meta.LastAccessed.IsZero() {
-			fmt.Printf("Last accessed: %s\n", FormatTimestamp(meta.LastAccessed))
+			fmt.Fprintf(c.Out, "Last accessed: %s\n", FormatTimestamp(meta.LastAccessed, c.useUTC()))
 		}
 		if !meta.LastBackup.IsZero() {
-			fmt.Printf("Last backup: %s\n", FormatTimestamp(meta.LastBackup))
+			fmt.Fprintf(c.Out, "Last backup: %s\n", FormatTimestamp(meta.LastBackup, c.useUTC()))
 		}
-		fmt.Printf("Backup count: %d\n", meta.BackupCount)
+		fmt.Fprintf(c.Out, "Backup count: %d\n", meta.BackupCount)
 	}
 
 	return nil
 }
 
-func (c *Context) inspectJSON(vol *volume.Volume, meta *database.VolumeMetadata, inUse bool, containers []string) error {
+func (c *Context) inspectJSON(vol *volume.Volume, meta *database.VolumeMetadata, inUse bool, containers, services, readOnly []string, network string) error {
 	data := map[string]interface{}{
-		"name":       vol.Name,
-		"driver":     vol.Driver,
-		"mountpoint": vol.Mountpoint,
-		"created":    vol.CreatedAt,
-		"in_use":     inUse,
-		"containers": containers,
+		"name":               vol.Name,
+		"driver":             vol.Driver,
+		"mountpoint":         vol.Mountpoint,
+		"created":            vol.CreatedAt,
+		"in_use":             inUse,
+		"containers":         containers,
+		"services":           services,
+		"read_only_services": nonNilSlice(readOnly),
+		"labels":             nonNilMap(vol.Labels),
+		"options":            nonNilMap(vol.Options),
+	}
+
+	if network != "" {
+		data["network"] = network
 	}
 
 	if meta != nil {
@@ -93,35 +196,124 @@ func (c *Context) inspectJSON(vol *volume.Volume, meta *database.VolumeMetadata,
 		data["backup_count"] = meta.BackupCount
 	}
 
-	encoder := json.NewEncoder(os.Stdout)
+	encoder := json.NewEncoder(c.Out)
 	encoder.SetIndent("", "  ")
 	return encoder.Encode(data)
 }
 
-func (c *Context) inspectYAML(vol *volume.Volume, meta *database.VolumeMetadata, inUse bool, containers []string) error {
+func (c *Context) inspectYAML(vol *volume.Volume, meta *database.VolumeMetadata, inUse bool, containers, services, readOnly []string, network string) error {
 	// Simple YAML output (not using yaml library to avoid import)
-	fmt.Printf("name: %s\n", vol.Name)
-	fmt.Printf("driver: %s\n", vol.Driver)
-	fmt.Printf("mountpoint: %s\n", vol.Mountpoint)
-	fmt.Printf("created: %s\n", vol.CreatedAt)
-	fmt.Printf("in_use: %v\n", inUse)
+	fmt.Fprintf(c.Out, "name: %s\n", vol.Name)
+	fmt.Fprintf(c.Out, "driver: %s\n", vol.Driver)
+	fmt.Fprintf(c.Out, "mountpoint: %s\n", vol.Mountpoint)
+	fmt.Fprintf(c.Out, "created: %s\n", vol.CreatedAt)
+	fmt.Fprintf(c.Out, "in_use: %v\n", inUse)
+	if network != "" {
+		fmt.Fprintf(c.Out, "network: %s\n", network)
+	}
+
+	if len(services) > 0 {
+		fmt.Fprintln(c.Out, "services:")
+		for _, name := range services {
+			fmt.Fprintf(c.Out, "  - %s\n", name)
+		}
+	}
+
+	if len(readOnly) > 0 {
+		fmt.Fprintln(c.Out, "read_only_services:")
+		for _, name := range readOnly {
+			fmt.Fprintf(c.Out, "  - %s\n", name)
+		}
+	}
 
 	if len(containers) > 0 {
-		fmt.Println("containers:")
-		for _, c := range containers {
-			fmt.Printf("  - %s\n", c)
+		fmt.Fprintln(c.Out, "containers:")
+		for _, name := range containers {
+			fmt.Fprintf(c.Out, "  - %s\n", name)
 		}
 	}
 
+	printYAMLMap(c.Out, "labels", vol.Labels)
+	printYAMLMap(c.Out, "options", vol.Options)
+
 	if meta != nil {
 		if !meta.LastAccessed.IsZero() {
-			fmt.Printf("last_accessed: %s\n", FormatTimestamp(meta.LastAccessed))
+			fmt.Fprintf(c.Out, "last_accessed: %s\n", FormatTimestamp(meta.LastAccessed, c.useUTC()))
 		}
 		if !meta.LastBackup.IsZero() {
-			fmt.Printf("last_backup: %s\n", FormatTimestamp(meta.LastBackup))
+			fmt.Fprintf(c.Out, "last_backup: %s\n", FormatTimestamp(meta.LastBackup, c.useUTC()))
 		}
-		fmt.Printf("backup_count: %d\n", meta.BackupCount)
+		fmt.Fprintf(c.Out, "backup_count: %d\n", meta.BackupCount)
 	}
 
 	return nil
 }
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// nonNilMap returns m, or an empty map if m is nil, so JSON output always
+// renders an object rather than null.
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+// nonNilSlice returns s, or an empty slice if s is nil, so JSON output
+// always renders an array rather than null.
+func nonNilSlice(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// markReadOnly returns services with " (read-only)" appended to those in
+// readOnly
+func markReadOnly(services, readOnly []string) []string {
+	marked := make([]string, len(services))
+	for i, name := range services {
+		marked[i] = name
+		for _, ro := range readOnly {
+			if ro == name {
+				marked[i] += " (read-only)"
+				break
+			}
+		}
+	}
+	return marked
+}
+
+// printTableMap writes a titled block of key=value lines, sorted by key.
+// Nothing is written for an empty map.
+func printTableMap(w io.Writer, title string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, k := range sortedKeys(m) {
+		fmt.Fprintf(w, "  %s=%s\n", k, m[k])
+	}
+}
+
+// printYAMLMap writes m as a YAML mapping under key, sorted by key. Values
+// are quoted since driver options such as "addr=10.0.0.1,rw" or mount
+// paths may contain characters with special meaning in YAML.
+func printYAMLMap(w io.Writer, key string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", key)
+	for _, k := range sortedKeys(m) {
+		fmt.Fprintf(w, "  %s: %s\n", k, strconv.Quote(m[k]))
+	}
+}
@@ -0,0 +1,218 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/compose"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+func nfsVolume() *volume.Volume {
+	return &volume.Volume{
+		Name:   "shop_media",
+		Driver: "local",
+		Labels: map[string]string{
+			"com.docker.compose.project": "shop",
+			"com.docker.compose.volume":  "media",
+		},
+		Options: map[string]string{
+			"type":   "nfs",
+			"o":      "addr=10.0.0.5,rw",
+			"device": ":/exports/media",
+		},
+	}
+}
+
+func TestInspectTableIncludesLabelsAndOptions(t *testing.T) {
+	var out bytes.Buffer
+	c := &Context{Out: &out}
+	if err := c.inspectTable(nfsVolume(), nil, false, nil, nil, nil, ""); err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+
+	want := "Labels:\n" +
+		"  com.docker.compose.project=shop\n" +
+		"  com.docker.compose.volume=media\n" +
+		"Options:\n" +
+		"  device=:/exports/media\n" +
+		"  o=addr=10.0.0.5,rw\n" +
+		"  type=nfs\n"
+	if !strings.Contains(out.String(), want) {
+		t.Fatalf("expected sorted labels and options, got:\n%s", out.String())
+	}
+}
+
+func TestInspectYAMLIncludesLabelsAndOptions(t *testing.T) {
+	var out bytes.Buffer
+	c := &Context{Out: &out}
+	if err := c.inspectYAML(nfsVolume(), nil, false, nil, nil, nil, ""); err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+
+	want := "labels:\n" +
+		"  com.docker.compose.project: \"shop\"\n" +
+		"  com.docker.compose.volume: \"media\"\n" +
+		"options:\n" +
+		"  device: \":/exports/media\"\n" +
+		"  o: \"addr=10.0.0.5,rw\"\n" +
+		"  type: \"nfs\"\n"
+	if !strings.Contains(out.String(), want) {
+		t.Fatalf("expected sorted labels and options, got:\n%s", out.String())
+	}
+}
+
+func TestInspectJSONIncludesLabelsAndOptions(t *testing.T) {
+	var out bytes.Buffer
+	c := &Context{Out: &out}
+	vol := nfsVolume()
+	if err := c.inspectJSON(vol, nil, false, nil, nil, nil, ""); err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+
+	var got struct {
+		Labels  map[string]string `json:"labels"`
+		Options map[string]string `json:"options"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	for k, v := range vol.Labels {
+		if got.Labels[k] != v {
+			t.Errorf("label %s: expected %q, got %q", k, v, got.Labels[k])
+		}
+	}
+	for k, v := range vol.Options {
+		if got.Options[k] != v {
+			t.Errorf("option %s: expected %q, got %q", k, v, got.Options[k])
+		}
+	}
+}
+
+func TestInspectJSONRendersEmptyMapsAsObjects(t *testing.T) {
+	var out bytes.Buffer
+	c := &Context{Out: &out}
+	if err := c.inspectJSON(&volume.Volume{Name: "plain", Driver: "local"}, nil, false, nil, nil, nil, ""); err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+	for _, want := range []string{`"labels": {}`, `"options": {}`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %s in output, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestNetworkTypeFromComposeDefinition(t *testing.T) {
+	cf, err := compose.LoadComposeFile(filepath.Join("..", "compose", "testdata", "nfs.yaml"))
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+	c := &Context{Compose: cf, ProjectName: "shop"}
+
+	if got := c.networkType("shop_media"); got != "nfs" {
+		t.Fatalf("expected shop_media to be nfs, got %q", got)
+	}
+	if got := c.networkType("shop_db_data"); got != "" {
+		t.Fatalf("expected shop_db_data to be local, got %q", got)
+	}
+
+	var out bytes.Buffer
+	c.Out = &out
+	if err := c.inspectTable(nfsVolume(), nil, false, nil, nil, nil, c.networkType("shop_media")); err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Network: nfs") {
+		t.Fatalf("expected network note, got:\n%s", out.String())
+	}
+}
+
+func TestInspectTableMarksReadOnlyServices(t *testing.T) {
+	var out bytes.Buffer
+	c := &Context{Out: &out}
+	if err := c.inspectTable(nfsVolume(), nil, false, nil, []string{"report", "web"}, []string{"report"}, ""); err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Services: report (read-only), web\n") {
+		t.Fatalf("expected read-only service to be marked, got:\n%s", out.String())
+	}
+}
+
+func TestInspectFormatTemplate(t *testing.T) {
+	vol := nfsVolume()
+	vol.Mountpoint = "/var/lib/docker/volumes/shop_media/_data"
+	docker := newFakeDocker(vol)
+	docker.use("shop_media", "web1")
+	store := newFakeStore()
+	store.meta["shop_media"] = &database.VolumeMetadata{VolumeName: "shop_media", BackupCount: 3}
+	c := &Context{Docker: docker, DB: store}
+
+	for format, want := range map[string]string{
+		"{{.Mountpoint}}": "/var/lib/docker/volumes/shop_media/_data\n",
+		`{{.Name}} in_use={{.InUse}} backups={{.BackupCount}} used_by={{join .Containers ","}}`: "shop_media in_use=true backups=3 used_by=web1\n",
+		`{{index .Options "type"}} {{json .Labels}}`:                                            `nfs {"com.docker.compose.project":"shop","com.docker.compose.volume":"media"}` + "\n",
+	} {
+		var out bytes.Buffer
+		c.Out = &out
+		if err := c.Inspect(InspectOptions{Service: "shop_media", Format: format}); err != nil {
+			t.Fatalf("inspect %q failed: %v", format, err)
+		}
+		if out.String() != want {
+			t.Errorf("format %q: expected %q, got %q", format, want, out.String())
+		}
+	}
+
+	// Bad templates and unknown names fail before Docker is asked
+	c.Docker = nil
+	for _, format := range []string{"{{.Name", "xml"} {
+		if err := c.Inspect(InspectOptions{Service: "shop_media", Format: format}); err == nil || errors.Is(err, ErrVolumeNotFound) {
+			t.Errorf("expected format %q to be rejected up front, got %v", format, err)
+		}
+	}
+}
+
+func TestContainersListedOncePerCommand(t *testing.T) {
+	daemon := &fakeDaemon{
+		volumes: map[string]bool{"app_data": true, "app_cache": true, "old_data": true},
+		containers: map[string][]string{
+			"app_data":  {"app1"},
+			"app_cache": {"app1", "cron1"},
+		},
+	}
+	c, dir := newDockerTestContext(t, daemon)
+	c.Config.Paths.Archives = filepath.Join(dir, "archives")
+
+	// The in-use status and the containers come from one listing
+	var out bytes.Buffer
+	c.Out = &out
+	if err := c.Inspect(InspectOptions{Service: "app_cache", Format: "json"}); err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+	if daemon.lists != 1 {
+		t.Fatalf("expected inspect to list containers once, got %d", daemon.lists)
+	}
+	var info map[string]any
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("invalid json output: %v", err)
+	}
+	if info["in_use"] != true || fmt.Sprint(info["containers"]) != "[app1 cron1]" {
+		t.Fatalf("expected app_cache in use by app1 and cron1, got %v", info)
+	}
+
+	// Each command lists afresh, but only once for all of its volumes
+	daemon.lists = 0
+	c.Out = io.Discard
+	err := c.Archive(ArchiveOptions{Services: []string{"app_data", "app_cache", "old_data"}, Force: true})
+	if err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	if daemon.lists != 1 {
+		t.Fatalf("expected archive to list containers once for 3 volumes, got %d", daemon.lists)
+	}
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+// DockerClient is the part of *docker.Client the commands use. Tests and
+// embedding programs can provide their own implementation.
+type DockerClient interface {
+	Close() error
+	ServerVersion() (string, error)
+	ImageAvailable(imageName string) bool
+	PullImage(imageName string) error
+
+	// Volumes
+	ListVolumes() ([]*volume.Volume, error)
+	ListVolumesByLabel(key, value string) ([]*volume.Volume, error)
+	GetVolume(name string) (*volume.Volume, error)
+	VolumeExists(name string) bool
+	CreateVolumeWithOptions(name, driver string, driverOpts, labels map[string]string) error
+	RemoveVolume(name string, force bool) error
+	GetVolumeSize(name string) (int64, error)
+	GetVolumeSizes() (map[string]int64, error)
+	VolumeChecksum(name string) (string, error)
+
+	// Containers using volumes
+	IsVolumeInUse(volumeName string) (bool, error)
+	GetVolumesInUse() (map[string]bool, error)
+	GetContainersUsingVolume(volumeName string) ([]string, error)
+	GetVolumeContainerMap() (map[string][]string, error)
+	GetRunningContainerIDsUsingVolume(volumeName string) ([]string, error)
+	StopContainers(ids []string) error
+	StartContainers(ids []string) error
+	RemoveContainers(ids []string) error
+	StopContainersUsingVolume(volumeName string) error
+	RestartContainersUsingVolume(volumeName string) error
+
+	// Data transfer through worker containers
+	BackupVolume(volumeName, outputPath string, compress bool, level int, tarOpts docker.TarOptions) error
+	BackupVolumeIncremental(volumeName, outputPath, baseSnapshot string, compress bool, level int, tarOpts docker.TarOptions) error
+	BackupBind(hostPath, outputPath string, compress bool, level int, tarOpts docker.TarOptions) error
+	RestoreVolume(volumeName, backupPath string, tarOpts docker.TarOptions, members ...string) error
+	RestoreVolumeAtomic(volumeName, backupPath string, tarOpts docker.TarOptions) error
+	RestoreVolumeChain(volumeName string, backupPaths []string, tarOpts docker.TarOptions) error
+	RestoreBind(hostPath, backupPath string, tarOpts docker.TarOptions, members ...string) error
+	ListArchiveContents(backupPath string) ([]docker.ArchiveEntry, error)
+	CopyVolume(sourceVolume, targetVolume string) error
+	MirrorVolume(sourceVolume, targetVolume string) error
+	CopyToVolume(volumeName, src, dst string) error
+	CopyFromVolume(volumeName, src, dst string) error
+	RunShell(volumeName, image string, readOnly bool) error
+}
+
+// MetaStore is the part of *database.DB the commands use: the record of
+// backups and volume metadata
+type MetaStore interface {
+	Close() error
+	CheckSchema() error
+
+	// Volume metadata
+	GetVolumeMetadata(volumeName string) (*database.VolumeMetadata, error)
+	UpdateLastAccessed(volumeName string) error
+	GetVolumesNotAccessedSince(t time.Time) ([]string, error)
+
+	// Backup records
+	AddBackupRecord(record *database.BackupRecord) error
+	RecordBackup(record *database.BackupRecord) error
+	SetBackupTag(id int, tag string) error
+	GetBackupRecords(volumeName string, limit int) ([]*database.BackupRecord, error)
+	GetAllBackupRecords(limit int) ([]*database.BackupRecord, error)
+	QueryBackupRecords(q database.BackupRecordQuery) ([]*database.BackupRecord, error)
+	GetBackupRecordByID(id int) (*database.BackupRecord, error)
+	GetBackupRecordByPath(path string) (*database.BackupRecord, error)
+	GetLatestBackupRecordByTag(volumeName, tag string) (*database.BackupRecord, error)
+	GetLatestBackupChecksum(volumeName string) (string, string, error)
+	GetBackupStats() ([]*database.VolumeBackupStats, error)
+
+	// Retention
+	PreviewCleanup(volumeName string, keepGenerations, keepDays int, protectedTags []string) ([]*database.BackupRecord, error)
+	CleanupOldBackups(volumeName string, keepGenerations, keepDays int, protectedTags []string) ([]*database.BackupRecord, error)
+}
+
+// The concrete clients must keep satisfying the interfaces
+var (
+	_ DockerClient = (*docker.Client)(nil)
+	_ MetaStore    = (*database.DB)(nil)
+)
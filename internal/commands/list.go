@@ -4,11 +4,14 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
+
+	"github.com/docker/docker/api/types/volume"
 )
 
 // ListOptions contains options for list command
@@ -16,7 +19,22 @@ type ListOptions struct {
 	All    bool
 	Unused bool
 	Stale  int
+	Driver string // only volumes using this driver
+	Label  string // only volumes with this label, as key or key=value
 	Format string
+	Output string // file path, or "" / "-" for stdout
+
+	// NamesOnly prints just the volume names, one per line. The global
+	// --quiet flag has the same effect on table output.
+	NamesOnly bool
+
+	// ProjectLabel selects the project's volumes by their Compose project
+	// label instead of by name prefix
+	ProjectLabel bool
+
+	// Backups adds the backup count and the time of the last backup to
+	// table, JSON and CSV output
+	Backups bool
 }
 
 // VolumeListItem represents a volume in the list
@@ -25,29 +43,61 @@ type VolumeListItem struct {
 	VolumeName string
 	LastUsed   time.Time
 	InUse      bool
+
+	BackupCount int
+	LastBackup  time.Time
+
+	// BackupInterval is the configured backup_interval (0 if none), and
+	// Overdue whether LastBackup is older than it
+	BackupInterval time.Duration
+	Overdue        bool
 }
 
 // List lists volumes
 func (c *Context) List(opts ListOptions) error {
-	volumes, err := c.Docker.ListVolumes()
+	items, err := c.ListVolumes(opts)
 	if err != nil {
 		return err
 	}
+	return c.renderList(items, opts)
+}
+
+// ListVolumes returns the volumes List would show, sorted by name. Only the
+// filtering fields of opts are used.
+func (c *Context) ListVolumes(opts ListOptions) ([]VolumeListItem, error) {
+	var volumes []*volume.Volume
+	var err error
+	if opts.ProjectLabel {
+		volumes, err = c.listProjectVolumesByLabel()
+	} else {
+		volumes, err = c.Docker.ListVolumes()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// One container listing answers for every volume; without it all are
+	// shown unused
+	inUseSet, err := c.Docker.GetVolumesInUse()
+	if err != nil {
+		c.Debug("failed to check which volumes are in use: %v", err)
+	}
 
 	var items []VolumeListItem
 
 	for _, vol := range volumes {
+		if !matchesVolumeFilters(vol, opts) {
+			continue
+		}
+
 		// Filter by project if compose is loaded and not --all
-		if !opts.All && c.Compose != nil && c.ProjectName != "" {
-			// Check if volume belongs to this project
-			// Volume should start with "projectname_"
-			prefix := c.ProjectName + "_"
-			if !strings.HasPrefix(vol.Name, prefix) {
+		if !opts.ProjectLabel && !opts.All && c.Compose != nil && c.ProjectName != "" {
+			if !c.belongsToProject(vol.Name) {
 				continue
 			}
 		}
 
-		inUse, _ := c.Docker.IsVolumeInUse(vol.Name)
+		inUse := inUseSet[vol.Name]
 
 		// Filter unused if requested
 		if opts.Unused && inUse {
@@ -75,7 +125,11 @@ func (c *Context) List(opts ListOptions) error {
 
 		if meta != nil {
 			item.LastUsed = meta.LastAccessed
+			item.BackupCount = meta.BackupCount
+			item.LastBackup = meta.LastBackup
 		}
+		item.BackupInterval = c.backupInterval(vol.Name, serviceName)
+		item.Overdue = isOverdue(item.LastBackup, item.BackupInterval, time.Now())
 
 		items = append(items, item)
 	}
@@ -85,22 +139,74 @@ func (c *Context) List(opts ListOptions) error {
 		return items[i].VolumeName < items[j].VolumeName
 	})
 
-	// Output
-	switch opts.Format {
-	case "json":
-		return c.outputJSON(items)
-	case "csv":
-		return c.outputCSV(items)
+	return items, nil
+}
+
+// matchesVolumeFilters reports whether vol passes the driver and label
+// filters in opts. Filters combine: a volume must match all that are set.
+func matchesVolumeFilters(vol *volume.Volume, opts ListOptions) bool {
+	if opts.Driver != "" && vol.Driver != opts.Driver {
+		return false
+	}
+
+	if opts.Label != "" {
+		key, value, hasValue := strings.Cut(opts.Label, "=")
+		got, ok := vol.Labels[key]
+		if !ok || (hasValue && got != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// renderList writes list items in the requested format to opts.Output
+func (c *Context) renderList(items []VolumeListItem, opts ListOptions) error {
+	w, closeOutput, err := c.openOutput(opts.Output)
+	if err != nil {
+		return fmt.Errorf("failed to open output: %w", err)
+	}
+
+	switch {
+	case opts.NamesOnly || (c.Quiet && (opts.Format == "" || opts.Format == "table")):
+		err = c.outputNames(w, items)
+	case opts.Format == "json":
+		err = c.outputJSON(w, items, opts.Backups)
+	case opts.Format == "csv":
+		err = c.outputCSV(w, items, opts.Backups)
 	default:
-		return c.outputTable(items)
+		err = c.outputTable(w, items, opts.Backups)
 	}
+
+	if closeErr := closeOutput(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-func (c *Context) outputTable(items []VolumeListItem) error {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	defer w.Flush()
+// outputNames writes one volume name per line, for use in shell loops
+func (c *Context) outputNames(w io.Writer, items []VolumeListItem) error {
+	for _, item := range items {
+		if _, err := fmt.Fprintln(w, item.VolumeName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	fmt.Fprintln(w, "SERVICE\tVOLUME\tLAST_USED\tSTATUS")
+// outputTable writes volumes as a table. On a terminal the status is colored:
+// green in use, grey unused and red overdue.
+func (c *Context) outputTable(out io.Writer, items []VolumeListItem, backups bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	color := c.colorEnabled(out)
+
+	// Every cell of the status column is painted, the header too, so that
+	// they all carry the same escape codes
+	header := "SERVICE\tVOLUME\tLAST_USED\t" + paint("STATUS", colorDefault, color)
+	if backups {
+		header += "\tBACKUPS\tLAST_BACKUP"
+	}
+	fmt.Fprintln(w, header)
 
 	for _, item := range items {
 		service := item.Service
@@ -108,24 +214,32 @@ func (c *Context) outputTable(items []VolumeListItem) error {
 			service = "-"
 		}
 
-		lastUsed := FormatTimestamp(item.LastUsed)
-		status := "unused"
+		lastUsed := FormatTimestamp(item.LastUsed, c.useUTC())
+		status, statusColor := "unused", colorGrey
 		if item.InUse {
-			status = "in-use"
+			status, statusColor = "in-use", colorGreen
+		}
+		if item.Overdue {
+			status += " OVERDUE"
+			statusColor = colorRed
 		}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s",
 			service,
 			item.VolumeName,
 			lastUsed,
-			status,
+			paint(status, statusColor, color),
 		)
+		if backups {
+			fmt.Fprintf(w, "\t%d\t%s", item.BackupCount, FormatTimestamp(item.LastBackup, c.useUTC()))
+		}
+		fmt.Fprintln(w)
 	}
 
-	return nil
+	return w.Flush()
 }
 
-func (c *Context) outputJSON(items []VolumeListItem) error {
+func (c *Context) outputJSON(w io.Writer, items []VolumeListItem, backups bool) error {
 	// Create a slice of map[string]string for JSON output
 	output := make([]map[string]string, len(items))
 	for i, item := range items {
@@ -137,22 +251,30 @@ func (c *Context) outputJSON(items []VolumeListItem) error {
 		output[i] = map[string]string{
 			"service":   item.Service,
 			"volume":    item.VolumeName,
-			"last_used": FormatTimestamp(item.LastUsed),
+			"last_used": FormatTimestamp(item.LastUsed, c.useUTC()),
 			"status":    status,
 		}
+		if backups {
+			output[i]["backups"] = strconv.Itoa(item.BackupCount)
+			output[i]["last_backup"] = FormatTimestamp(item.LastBackup, c.useUTC())
+			output[i]["overdue"] = strconv.FormatBool(item.Overdue)
+		}
 	}
 
-	encoder := json.NewEncoder(os.Stdout)
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 	return encoder.Encode(output)
 }
 
-func (c *Context) outputCSV(items []VolumeListItem) error {
-	w := csv.NewWriter(os.Stdout)
-	defer w.Flush()
+func (c *Context) outputCSV(out io.Writer, items []VolumeListItem, backups bool) error {
+	w := csv.NewWriter(out)
 
 	// Write header
-	if err := w.Write([]string{"service", "volume", "last_used", "status"}); err != nil {
+	header := []string{"service", "volume", "last_used", "status"}
+	if backups {
+		header = append(header, "backups", "last_backup", "overdue")
+	}
+	if err := w.Write(header); err != nil {
 		return err
 	}
 
@@ -163,15 +285,20 @@ func (c *Context) outputCSV(items []VolumeListItem) error {
 			status = "in-use"
 		}
 
-		if err := w.Write([]string{
+		record := []string{
 			item.Service,
 			item.VolumeName,
-			FormatTimestamp(item.LastUsed),
+			FormatTimestamp(item.LastUsed, c.useUTC()),
 			status,
-		}); err != nil {
+		}
+		if backups {
+			record = append(record, strconv.Itoa(item.BackupCount), FormatTimestamp(item.LastBackup, c.useUTC()), strconv.FormatBool(item.Overdue))
+		}
+		if err := w.Write(record); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	w.Flush()
+	return w.Error()
 }
@@ -0,0 +1,388 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+// utcContext returns a context displaying timestamps in UTC, so expected
+// output does not depend on the local zone
+func utcContext() *Context {
+	cfg := config.DefaultConfig()
+	cfg.Defaults.UseUTC = true
+	return &Context{Config: cfg}
+}
+
+func testListItems() []VolumeListItem {
+	return []VolumeListItem{
+		{Service: "db", VolumeName: "myproject_postgres_data", LastUsed: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), InUse: true},
+		{VolumeName: "orphan", InUse: false},
+	}
+}
+
+func TestListOutputFormats(t *testing.T) {
+	c := utcContext()
+	items := testListItems()
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := c.outputCSV(&buf, items, false); err != nil {
+			t.Fatalf("csv output failed: %v", err)
+		}
+		want := "service,volume,last_used,status\n" +
+			"db,myproject_postgres_data,2024-01-02 15:04:05Z,in-use\n" +
+			",orphan,-,unused\n"
+		if buf.String() != want {
+			t.Fatalf("unexpected csv output:\n%s", buf.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := c.outputJSON(&buf, items, false); err != nil {
+			t.Fatalf("json output failed: %v", err)
+		}
+		var got []map[string]string
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("invalid json output: %v", err)
+		}
+		if len(got) != 2 || got[0]["volume"] != "myproject_postgres_data" || got[1]["status"] != "unused" {
+			t.Fatalf("unexpected json output: %v", got)
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := c.outputTable(&buf, items, false); err != nil {
+			t.Fatalf("table output failed: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], "SERVICE") || !strings.Contains(lines[2], "orphan") {
+			t.Fatalf("unexpected table output:\n%s", buf.String())
+		}
+	})
+}
+
+func TestOpenOutputWritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "volumes.csv")
+
+	var stdout bytes.Buffer
+	c := &Context{Out: &stdout}
+
+	w, closeOutput, err := c.openOutput(path)
+	if err != nil {
+		t.Fatalf("open output failed: %v", err)
+	}
+	if err := c.outputCSV(w, testListItems(), false); err != nil {
+		t.Fatalf("csv output failed: %v", err)
+	}
+	if err := closeOutput(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("output file not written: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "service,volume,last_used,status\n") {
+		t.Fatalf("unexpected file content:\n%s", data)
+	}
+
+	if stdout.Len() != 0 {
+		t.Fatalf("expected nothing written to stdout, got %q", stdout.String())
+	}
+	if w, _, err := c.openOutput("-"); err != nil || w != c.Out {
+		t.Fatalf("expected c.Out for -, got %v, %v", w, err)
+	}
+
+	// ~ is expanded rather than taken as a directory name
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Chdir(t.TempDir())
+	if _, closeOutput, err := c.openOutput("~/volumes.csv"); err != nil {
+		t.Fatalf("open output failed: %v", err)
+	} else {
+		closeOutput()
+	}
+	if _, err := os.Stat(filepath.Join(home, "volumes.csv")); err != nil {
+		t.Fatalf("expected the output file in the home directory: %v", err)
+	}
+}
+
+func TestListRendersToContextOut(t *testing.T) {
+	var out bytes.Buffer
+	c := utcContext()
+	c.Out = &out
+
+	if err := c.renderList(testListItems(), ListOptions{}); err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and two rows, got:\n%s", out.String())
+	}
+	wantRows := [][]string{
+		{"SERVICE", "VOLUME", "LAST_USED", "STATUS"},
+		{"db", "myproject_postgres_data", "2024-01-02", "15:04:05Z", "in-use"},
+		{"-", "orphan", "-", "unused"},
+	}
+	for i, want := range wantRows {
+		got := strings.Fields(lines[i])
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("row %d: expected %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestMatchesVolumeFilters(t *testing.T) {
+	volumes := []*volume.Volume{
+		{Name: "local_plain", Driver: "local"},
+		{Name: "local_tier", Driver: "local", Labels: map[string]string{"tier": "db"}},
+		{Name: "nfs_tier", Driver: "nfs", Labels: map[string]string{"tier": "db"}},
+		{Name: "nfs_cache", Driver: "nfs", Labels: map[string]string{"tier": "cache"}},
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"noFilters", ListOptions{}, []string{"local_plain", "local_tier", "nfs_tier", "nfs_cache"}},
+		{"driver", ListOptions{Driver: "nfs"}, []string{"nfs_tier", "nfs_cache"}},
+		{"labelKey", ListOptions{Label: "tier"}, []string{"local_tier", "nfs_tier", "nfs_cache"}},
+		{"labelValue", ListOptions{Label: "tier=db"}, []string{"local_tier", "nfs_tier"}},
+		{"combined", ListOptions{Driver: "nfs", Label: "tier=db"}, []string{"nfs_tier"}},
+		{"noMatch", ListOptions{Driver: "local", Label: "tier=cache"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, vol := range volumes {
+				if matchesVolumeFilters(vol, tt.opts) {
+					got = append(got, vol.Name)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestListNamesOnly(t *testing.T) {
+	volumes := []*volume.Volume{
+		{Name: "shop_db", Driver: "local"},
+		{Name: "shop_cache", Driver: "nfs"},
+		{Name: "shop_media", Driver: "local"},
+	}
+
+	// Filtered items as List would hand them to renderList
+	var items []VolumeListItem
+	for _, vol := range volumes {
+		if matchesVolumeFilters(vol, ListOptions{Driver: "local"}) {
+			items = append(items, VolumeListItem{Service: "svc", VolumeName: vol.Name, InUse: true})
+		}
+	}
+
+	tests := []struct {
+		name  string
+		quiet bool
+		opts  ListOptions
+		want  string
+	}{
+		{"namesOnly", false, ListOptions{NamesOnly: true}, "shop_db\nshop_media\n"},
+		{"namesOnlyOverridesFormat", false, ListOptions{NamesOnly: true, Format: "json"}, "shop_db\nshop_media\n"},
+		{"globalQuiet", true, ListOptions{}, "shop_db\nshop_media\n"},
+		{"globalQuietKeepsExplicitFormat", true, ListOptions{Format: "csv"}, "service,volume,last_used,status\n" +
+			"svc,shop_db,-,in-use\nsvc,shop_media,-,in-use\n"},
+		{"empty", false, ListOptions{NamesOnly: true}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			c := &Context{Out: &out, Quiet: tt.quiet}
+			render := items
+			if tt.name == "empty" {
+				render = nil
+			}
+			if err := c.renderList(render, tt.opts); err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestListWithFakeClients(t *testing.T) {
+	cli := newFakeDocker(
+		&volume.Volume{Name: "shop_db_data", Driver: "local"},
+		&volume.Volume{Name: "shop_cache", Driver: "local"},
+		&volume.Volume{Name: "shared_nfs", Driver: "nfs"},
+	)
+	cli.use("shop_db_data", "c1")
+
+	store := newFakeStore()
+	store.meta["shop_cache"] = &database.VolumeMetadata{VolumeName: "shop_cache", LastAccessed: time.Now().AddDate(0, 0, -60)}
+	store.meta["shared_nfs"] = &database.VolumeMetadata{VolumeName: "shared_nfs", LastAccessed: time.Now()}
+
+	c, err := New(Options{Config: config.DefaultConfig(), Docker: cli, DB: store, Out: new(bytes.Buffer)})
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+
+	names := func(opts ListOptions) string {
+		t.Helper()
+		items, err := c.ListVolumes(opts)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		var got []string
+		for _, item := range items {
+			got = append(got, item.VolumeName)
+		}
+		return strings.Join(got, ",")
+	}
+
+	if got := names(ListOptions{}); got != "shared_nfs,shop_cache,shop_db_data" {
+		t.Fatalf("expected all volumes sorted by name, got %s", got)
+	}
+	if got := names(ListOptions{Unused: true}); got != "shared_nfs,shop_cache" {
+		t.Fatalf("expected the in-use volume to be filtered out, got %s", got)
+	}
+	if got := names(ListOptions{Stale: 30}); got != "shop_cache,shop_db_data" {
+		t.Fatalf("expected the recently used volume to be filtered out, got %s", got)
+	}
+	if got := names(ListOptions{Driver: "nfs"}); got != "shared_nfs" {
+		t.Fatalf("expected only the nfs volume, got %s", got)
+	}
+
+	var out bytes.Buffer
+	c.Out = &out
+	if err := c.List(ListOptions{Format: "json"}); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	var got []map[string]string
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json output: %v", err)
+	}
+	if len(got) != 3 || got[2]["volume"] != "shop_db_data" || got[2]["status"] != "in-use" {
+		t.Fatalf("unexpected json output: %v", got)
+	}
+}
+
+func TestListShowsBackups(t *testing.T) {
+	cli := newFakeDocker(
+		&volume.Volume{Name: "shop_db_data", Driver: "local"},
+		&volume.Volume{Name: "shop_cache", Driver: "local"},
+	)
+	store := newFakeStore()
+	store.meta["shop_db_data"] = &database.VolumeMetadata{
+		VolumeName:  "shop_db_data",
+		LastBackup:  time.Date(2024, 3, 4, 2, 0, 0, 0, time.UTC),
+		BackupCount: 7,
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Defaults.UseUTC = true
+	c, err := New(Options{Config: cfg, Docker: cli, DB: store, Out: new(bytes.Buffer)})
+	if err != nil {
+		t.Fatalf("new failed: %v", err)
+	}
+
+	render := func(opts ListOptions) string {
+		t.Helper()
+		var out bytes.Buffer
+		c.Out = &out
+		if err := c.List(opts); err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		return out.String()
+	}
+
+	if out := render(ListOptions{}); strings.Contains(out, "BACKUPS") {
+		t.Fatalf("expected no backup columns without --backups, got:\n%s", out)
+	}
+
+	lines := strings.Split(strings.TrimSpace(render(ListOptions{Backups: true})), "\n")
+	if len(lines) != 3 || strings.Join(strings.Fields(lines[0])[4:], " ") != "BACKUPS LAST_BACKUP" {
+		t.Fatalf("expected BACKUPS and LAST_BACKUP columns, got:\n%s", strings.Join(lines, "\n"))
+	}
+	if strings.Join(strings.Fields(lines[1])[4:], " ") != "0 -" || strings.Join(strings.Fields(lines[2])[4:], " ") != "7 2024-03-04 02:00:00Z" {
+		t.Fatalf("unexpected backup columns:\n%s", strings.Join(lines, "\n"))
+	}
+
+	var got []map[string]string
+	if err := json.Unmarshal([]byte(render(ListOptions{Backups: true, Format: "json"})), &got); err != nil {
+		t.Fatalf("invalid json output: %v", err)
+	}
+	if len(got) != 2 || got[1]["backups"] != "7" || got[1]["last_backup"] != "2024-03-04 02:00:00Z" || got[0]["backups"] != "0" {
+		t.Fatalf("unexpected json output: %v", got)
+	}
+
+	want := "service,volume,last_used,status,backups,last_backup,overdue\n" +
+		",shop_cache,-,unused,0,-,false\n" +
+		",shop_db_data,-,unused,7,2024-03-04 02:00:00Z,false\n"
+	if out := render(ListOptions{Backups: true, Format: "csv"}); out != want {
+		t.Fatalf("unexpected csv output:\n%s", out)
+	}
+}
+
+func TestInUseCheckedWithOneContainerListing(t *testing.T) {
+	daemon := &fakeDaemon{
+		volumes: map[string]bool{"app_data": true, "app_cache": true, "old_data": true, "old_logs": true},
+		containers: map[string][]string{
+			"app_data":  {"app1"},
+			"app_cache": {"app1", "worker1"},
+		},
+	}
+	c, _ := newDockerTestContext(t, daemon)
+
+	items, err := c.ListVolumes(ListOptions{All: true})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if daemon.lists != 1 {
+		t.Fatalf("expected one container listing for %d volumes, got %d", len(items), daemon.lists)
+	}
+	inUse := make(map[string]bool)
+	for _, item := range items {
+		inUse[item.VolumeName] = item.InUse
+	}
+	want := map[string]bool{"app_data": true, "app_cache": true, "old_data": false, "old_logs": false}
+	for name, wantInUse := range want {
+		if inUse[name] != wantInUse {
+			t.Errorf("expected %s in use %v, got %v", name, wantInUse, inUse[name])
+		}
+	}
+
+	daemon.lists = 0
+	if err := c.Clean(CleanOptions{Unused: true, DryRun: true}); err != nil {
+		t.Fatalf("clean failed: %v", err)
+	}
+	if daemon.lists != 1 {
+		t.Fatalf("expected clean to list containers once, got %d", daemon.lists)
+	}
+	var cleaned []string
+	for _, r := range c.LastSummary().Results {
+		cleaned = append(cleaned, r.Volume)
+	}
+	sort.Strings(cleaned)
+	if strings.Join(cleaned, ",") != "old_data,old_logs" {
+		t.Fatalf("expected the unused volumes to be cleaned, got %v", cleaned)
+	}
+}
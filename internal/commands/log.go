@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Log formats accepted by --log-format
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Level is the severity of a log message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the level name used in JSON events
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// Event is one line of the --log-format json stream on Err
+type Event struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	Operation string    `json:"operation,omitempty"`
+	Volume    string    `json:"volume,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// enabled reports whether messages at level are shown: debug only with
+// --verbose, info and warnings unless --quiet, errors always
+func (c *Context) enabled(level Level) bool {
+	switch level {
+	case LevelDebug:
+		return c.Verbose
+	case LevelInfo, LevelWarn:
+		return !c.Quiet
+	default:
+		return true
+	}
+}
+
+// logf writes a message at level. Progress (info) goes to Out; debug
+// output, warnings and errors go to Err so stdout stays usable in pipes.
+// With --log-format json, the Err messages are written as events instead.
+func (c *Context) logf(level Level, format string, args ...any) {
+	if !c.enabled(level) {
+		return
+	}
+	if c.LogFormat == LogFormatJSON && level != LevelInfo {
+		c.emit(level, fmt.Sprintf(format, args...))
+		return
+	}
+
+	w, prefix := c.Err, ""
+	switch level {
+	case LevelInfo:
+		w = c.Out
+	case LevelWarn:
+		prefix = "Warning: "
+	case LevelError:
+		prefix = "Error: "
+	}
+	if w == nil {
+		w = io.Discard
+	}
+	if level == LevelError {
+		prefix = paint(prefix, colorRed, c.colorEnabled(w))
+	}
+
+	fmt.Fprintf(w, prefix+format+"\n", args...)
+}
+
+// Debug logs diagnostic detail, shown only with --verbose
+func (c *Context) Debug(format string, args ...any) {
+	c.logf(LevelDebug, format, args...)
+}
+
+// Info logs progress, hidden with --quiet
+func (c *Context) Info(format string, args ...any) {
+	c.logf(LevelInfo, format, args...)
+}
+
+// Warn logs a problem the command recovered from, hidden with --quiet
+func (c *Context) Warn(format string, args ...any) {
+	c.logf(LevelWarn, format, args...)
+}
+
+// Error logs a failure, always shown
+func (c *Context) Error(format string, args ...any) {
+	c.logf(LevelError, format, args...)
+}
+
+// emit writes an event to Err, tagged with the operation in progress
+func (c *Context) emit(level Level, message string) {
+	w := c.Err
+	if w == nil {
+		w = io.Discard
+	}
+	json.NewEncoder(w).Encode(Event{
+		Time:      time.Now().UTC(),
+		Level:     level.String(),
+		Operation: c.operation,
+		Volume:    c.volume,
+		Message:   message,
+	})
+}
+
+// reportedError marks an error already emitted as an event
+type reportedError struct{ error }
+
+func (e *reportedError) Unwrap() error { return e.error }
+
+// Reported reports whether err was already emitted as an event, so it
+// should not be logged again. A *BatchError never is, even though the
+// per-volume errors it wraps were, and neither is a timeout.
+func Reported(err error) bool {
+	var batch *BatchError
+	if errors.As(err, &batch) || errors.Is(err, ErrTimeout) {
+		return false
+	}
+	var r *reportedError
+	return errors.As(err, &r)
+}
+
+// track runs one operation on a volume. With --log-format json it emits
+// start and finish events around fn, or an error event if fn fails;
+// events are written even with --quiet so scripts always get them.
+func (c *Context) track(operation, volume string, fn func() error) error {
+	if c.LogFormat != LogFormatJSON {
+		return fn()
+	}
+
+	prevOperation, prevVolume := c.operation, c.volume
+	c.operation, c.volume = operation, volume
+	defer func() { c.operation, c.volume = prevOperation, prevVolume }()
+
+	c.emit(LevelInfo, "start")
+	if err := fn(); err != nil {
+		c.emit(LevelError, err.Error())
+		return &reportedError{err}
+	}
+	c.emit(LevelInfo, "finish")
+	return nil
+}
+
+// reportError logs a per-volume failure unless track already emitted it
+func (c *Context) reportError(err error, format string, args ...any) {
+	if !Reported(err) {
+		c.Error(format, args...)
+	}
+}
@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+// logAll emits one message at every level
+func logAll(c *Context) {
+	c.Debug("debug %d", 1)
+	c.Info("info %d", 2)
+	c.Warn("warn %d", 3)
+	c.Error("error %d", 4)
+}
+
+func TestLoggerLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		verbose bool
+		quiet   bool
+		wantOut string
+		wantErr string
+	}{
+		{"default", false, false, "info 2\n", "Warning: warn 3\nError: error 4\n"},
+		{"quiet", false, true, "", "Error: error 4\n"},
+		{"verbose", true, false, "info 2\n", "debug 1\nWarning: warn 3\nError: error 4\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			c := &Context{Out: &out, Err: &errOut, Verbose: tt.verbose, Quiet: tt.quiet}
+			logAll(c)
+
+			if out.String() != tt.wantOut {
+				t.Errorf("expected stdout %q, got %q", tt.wantOut, out.String())
+			}
+			if errOut.String() != tt.wantErr {
+				t.Errorf("expected stderr %q, got %q", tt.wantErr, errOut.String())
+			}
+		})
+	}
+}
+
+func TestLoggerToleratesMissingWriters(t *testing.T) {
+	logAll(&Context{Verbose: true})
+}
+
+func TestBackupQuietEmitsOnlyErrors(t *testing.T) {
+	daemon := &fakeDaemon{
+		volumes:  map[string]bool{"app_data": true},
+		exitCode: 2,
+	}
+	c, _ := newDockerTestContext(t, daemon)
+	var out, errOut bytes.Buffer
+	c.Out, c.Err = &out, &errOut
+	c.Quiet = true
+
+	var batch *BatchError
+	if err := c.Backup(BackupOptions{Services: []string{"app_data", "missing"}}); !errors.As(err, &batch) {
+		t.Fatalf("expected a BatchError, got %v", err)
+	}
+
+	if out.Len() != 0 {
+		t.Fatalf("expected no stdout under --quiet, got %q", out.String())
+	}
+	lines := strings.Split(strings.TrimSpace(errOut.String()), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "Error: failed to back up app_data") {
+		t.Fatalf("expected a single error line, got %q", errOut.String())
+	}
+}
+
+func TestBackupVerboseEmitsDebug(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+	var out, errOut bytes.Buffer
+	c.Out, c.Err = &out, &errOut
+	c.Verbose = true
+	c.Config.Defaults.KeepGenerations = 1
+
+	// An older generation for the backup to prune
+	old := writeBackup(t, t.TempDir(), "app_data_2024-01-01_000000.tar.gz", time.Now().Add(-time.Hour))
+	if err := c.DB.AddBackupRecord(&database.BackupRecord{VolumeName: "app_data", FilePath: old}); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "Backing up app_data") {
+		t.Fatalf("expected progress on stdout, got %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "Cleaned up 1 old backup(s)") {
+		t.Fatalf("expected debug line on stderr, got %q", errOut.String())
+	}
+}
+
+// decodeEvents parses an NDJSON event stream
+func decodeEvents(t *testing.T, data []byte) []Event {
+	t.Helper()
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid event line %q: %v", line, err)
+		}
+		if e.Time.IsZero() || e.Level == "" || e.Message == "" {
+			t.Fatalf("incomplete event %q", line)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestBackupEmitsJSONEvents(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true, "app_cache": true}}
+	c, _ := newDockerTestContext(t, daemon)
+	var out, errOut bytes.Buffer
+	c.Out, c.Err = &out, &errOut
+	c.LogFormat = LogFormatJSON
+
+	if err := c.Backup(BackupOptions{Services: []string{"app_data", "app_cache"}}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	if !strings.Contains(out.String(), "Backing up app_data") {
+		t.Fatalf("expected human output on stdout, got %q", out.String())
+	}
+
+	var got []string
+	for _, e := range decodeEvents(t, errOut.Bytes()) {
+		if e.Operation != "backup" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		got = append(got, e.Volume+" "+e.Level+" "+e.Message)
+	}
+	want := []string{
+		"app_data info start", "app_data info finish",
+		"app_cache info start", "app_cache info finish",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected events %q, got %q", want, got)
+	}
+}
+
+func TestBackupJSONEventsReportFailures(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}, exitCode: 2}
+	c, _ := newDockerTestContext(t, daemon)
+	var errOut bytes.Buffer
+	c.Err = &errOut
+	c.LogFormat = LogFormatJSON
+	c.Quiet = true
+
+	var batch *BatchError
+	if err := c.Backup(BackupOptions{Services: []string{"app_data"}}); !errors.As(err, &batch) || !Reported(batch.Err) {
+		t.Fatalf("expected a BatchError wrapping the reported failure, got %v", err)
+	}
+
+	// The failure is reported once, as an event tagged with the volume
+	events := decodeEvents(t, errOut.Bytes())
+	if len(events) != 2 || events[0].Message != "start" {
+		t.Fatalf("expected start and error events, got %+v", events)
+	}
+	if e := events[1]; e.Level != "error" || e.Operation != "backup" || e.Volume != "app_data" {
+		t.Fatalf("expected error event for app_data, got %+v", e)
+	}
+}
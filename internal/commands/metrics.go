@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+// Metrics writes Prometheus text-format metrics about the recorded backups
+// of every volume, for node_exporter's textfile collector
+func (c *Context) Metrics() error {
+	stats, err := c.DB.GetBackupStats()
+	if err != nil {
+		return fmt.Errorf("failed to read backup stats: %w", err)
+	}
+	return writeMetrics(c.Out, stats)
+}
+
+// backupMetrics are the metrics written for each volume, in output order
+var backupMetrics = []struct {
+	name  string
+	help  string
+	value func(s *database.VolumeBackupStats) string
+}{
+	{
+		name:  "dvm_backups_total",
+		help:  "Number of recorded backups of the volume.",
+		value: func(s *database.VolumeBackupStats) string { return fmt.Sprint(s.Count) },
+	},
+	{
+		name:  "dvm_backup_size_bytes",
+		help:  "Total size of the recorded backups of the volume.",
+		value: func(s *database.VolumeBackupStats) string { return fmt.Sprint(s.TotalSize) },
+	},
+	{
+		name:  "dvm_last_backup_timestamp_seconds",
+		help:  "Unix time of the latest recorded backup of the volume.",
+		value: func(s *database.VolumeBackupStats) string { return fmt.Sprint(s.LastBackup.Unix()) },
+	},
+}
+
+// writeMetrics writes stats in the Prometheus exposition format. The
+// metrics are gauges: pruning removes backups, so none only grows.
+func writeMetrics(out io.Writer, stats []*database.VolumeBackupStats) error {
+	w := bufio.NewWriter(out)
+	for _, m := range backupMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", m.name)
+		for _, s := range stats {
+			fmt.Fprintf(w, "%s{project=\"%s\",volume=\"%s\"} %s\n",
+				m.name, escapeLabelValue(s.ProjectName), escapeLabelValue(s.VolumeName), m.value(s))
+		}
+	}
+	return w.Flush()
+}
+
+// escapeLabelValue escapes a Prometheus label value
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
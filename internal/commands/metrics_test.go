@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+func TestMetrics(t *testing.T) {
+	c, _ := newTestContext(t)
+	var out bytes.Buffer
+	c.Out = &out
+
+	for _, rec := range []*database.BackupRecord{
+		{ProjectName: "shop", VolumeName: "shop_db", FilePath: "/b/db1.tar.gz", Size: 100},
+		{ProjectName: "shop", VolumeName: "shop_db", FilePath: "/b/db2.tar.gz", Size: 250},
+		{ProjectName: `we"ird`, VolumeName: "media", FilePath: "/b/media.tar.gz", Size: 4096},
+	} {
+		if err := c.DB.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+	records, err := c.DB.GetBackupRecords("shop_db", 1)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("failed to read records: %v", err)
+	}
+	last := records[0].CreatedAt.Unix()
+
+	if err := c.Metrics(); err != nil {
+		t.Fatalf("metrics failed: %v", err)
+	}
+
+	want := []string{
+		"# HELP dvm_backups_total Number of recorded backups of the volume.",
+		"# TYPE dvm_backups_total gauge",
+		`dvm_backups_total{project="shop",volume="shop_db"} 2`,
+		`dvm_backups_total{project="we\"ird",volume="media"} 1`,
+		"# TYPE dvm_backup_size_bytes gauge",
+		`dvm_backup_size_bytes{project="shop",volume="shop_db"} 350`,
+		`dvm_backup_size_bytes{project="we\"ird",volume="media"} 4096`,
+		"# TYPE dvm_last_backup_timestamp_seconds gauge",
+		fmt.Sprintf(`dvm_last_backup_timestamp_seconds{project="shop",volume="shop_db"} %d`, last),
+	}
+	lines := strings.Split(out.String(), "\n")
+	for _, line := range want {
+		if !slices.Contains(lines, line) {
+			t.Errorf("expected line %q in output:\n%s", line, out.String())
+		}
+	}
+	if !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("expected output to end with a newline")
+	}
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+// MountOptions contains options for mount command
+type MountOptions struct {
+	Service  string
+	ReadOnly bool
+	Image    string // shell image, defaults to the worker image
+}
+
+// Mount opens an interactive shell with a volume mounted, for ad-hoc
+// inspection and fixes
+func (c *Context) Mount(opts MountOptions) error {
+	if opts.Service == "" {
+		return fmt.Errorf("service name is required")
+	}
+
+	volumeName, err := c.ResolveVolumeName(opts.Service)
+	if err != nil {
+		return err
+	}
+
+	image := opts.Image
+	if image == "" {
+		image = docker.AlpineImage
+	}
+
+	mode := "read-write"
+	if opts.ReadOnly {
+		mode = "read-only"
+	}
+	c.Info("Opening a shell in %s with %s mounted %s at %s (exit to return)...", image, volumeName, mode, docker.ShellMountPoint)
+
+	if err := c.Docker.RunShell(volumeName, image, opts.ReadOnly); err != nil {
+		return fmt.Errorf("shell failed: %w", err)
+	}
+
+	if err := c.DB.UpdateLastAccessed(volumeName); err != nil {
+		c.Debug("failed to update metadata: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+// PruneOptions contains options for prune command
+type PruneOptions struct {
+	Services []string
+	DryRun   bool
+	Force    bool
+}
+
+// Prune applies the keep_generations and keep_days retention policy to the
+// backups of the given services, or of every volume of the current project
+// with recorded backups. This is the same cleanup that runs after a backup,
+// and likewise never removes backups with a protected_tags tag.
+func (c *Context) Prune(opts PruneOptions) error {
+	volumes, err := c.pruneVolumes(opts.Services)
+	if err != nil {
+		return err
+	}
+
+	keepGenerations, keepDays := c.retention()
+	if keepGenerations <= 0 {
+		fmt.Fprintln(c.Out, "Retention is disabled (keep_generations is 0); nothing to prune")
+		return nil
+	}
+
+	candidates := make(map[string][]*database.BackupRecord)
+	var total int
+	var totalSize int64
+	for _, volumeName := range volumes {
+		records, err := c.DB.PreviewCleanup(volumeName, keepGenerations, keepDays, c.Config.Defaults.ProtectedTags)
+		if err != nil {
+			return fmt.Errorf("failed to preview cleanup of %s: %w", volumeName, err)
+		}
+		if len(records) == 0 {
+			continue
+		}
+		candidates[volumeName] = records
+		for _, record := range records {
+			total++
+			totalSize += record.Size
+		}
+	}
+
+	if total == 0 {
+		c.Info("No backups to prune")
+		return nil
+	}
+
+	verb := "Removing"
+	if opts.DryRun {
+		verb = "Would remove"
+	}
+	for _, volumeName := range volumes {
+		for _, record := range candidates[volumeName] {
+			fmt.Fprintf(c.Out, "%s %s (%s, %s)\n", verb, record.FilePath, FormatSize(record.Size), FormatTimestamp(record.CreatedAt, c.useUTC()))
+		}
+	}
+	fmt.Fprintf(c.Out, "%d backup(s), %s total\n", total, FormatSize(totalSize))
+
+	if opts.DryRun {
+		fmt.Fprintln(c.Out, "\n(Dry run - no changes made)")
+		return nil
+	}
+
+	if !opts.Force {
+		if !Confirm("\nProceed with pruning?") {
+			return fmt.Errorf("prune cancelled")
+		}
+	}
+
+	for _, volumeName := range volumes {
+		if _, ok := candidates[volumeName]; !ok {
+			continue
+		}
+		deleted, err := c.DB.CleanupOldBackups(volumeName, keepGenerations, keepDays, c.Config.Defaults.ProtectedTags)
+		c.removeBackupFiles(deleted)
+		if err != nil {
+			return fmt.Errorf("failed to prune backups of %s: %w", volumeName, err)
+		}
+	}
+
+	c.Info("✓ Pruned %d backup(s)", total)
+	return nil
+}
+
+// pruneVolumes returns the volumes named by services, or the volumes of the
+// current project (all volumes without a project) that have backup records
+func (c *Context) pruneVolumes(services []string) ([]string, error) {
+	if len(services) > 0 {
+		var volumes []string
+		for _, service := range services {
+			volumeNames, err := c.resolveVolumeNames(service)
+			if err != nil {
+				// Try as volume name directly
+				volumeName, err := c.resolveVolumeNameOrSelf(service)
+				if err != nil {
+					return nil, err
+				}
+				volumeNames = []string{volumeName}
+			}
+			volumes = append(volumes, volumeNames...)
+		}
+		return volumes, nil
+	}
+
+	records, err := c.DB.GetAllBackupRecords(0)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var volumes []string
+	for _, record := range records {
+		if c.ProjectName != "" && record.ProjectName != c.ProjectName {
+			continue
+		}
+		if !seen[record.VolumeName] {
+			seen[record.VolumeName] = true
+			volumes = append(volumes, record.VolumeName)
+		}
+	}
+	sort.Strings(volumes)
+	return volumes, nil
+}
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+func TestPruneDryRunMatchesPrune(t *testing.T) {
+	c, dir := newTestContext(t)
+	c.Config = config.DefaultConfig()
+	c.Config.Defaults.KeepGenerations = 2
+	c.Err = io.Discard
+
+	// Newest last, so the oldest backup is first in line for removal
+	var files []string
+	for i, name := range []string{
+		"app_data_2024-01-01_000000Z.tar.gz",
+		"app_data_2024-01-02_000000Z.tar.gz",
+		"app_data_2024-01-03_000000Z.tar.gz",
+	} {
+		path := writeBackup(t, dir, name, time.Now().Add(time.Duration(i)*time.Minute))
+		if err := c.DB.AddBackupRecord(&database.BackupRecord{VolumeName: "app_data", FilePath: path}); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+		files = append(files, path)
+	}
+
+	var out bytes.Buffer
+	c.Out = &out
+	if err := c.Prune(PruneOptions{DryRun: true}); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Would remove "+files[0]) || strings.Contains(out.String(), files[1]) {
+		t.Fatalf("expected only the oldest backup to be listed, got:\n%s", out.String())
+	}
+	for _, path := range files {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("dry run removed %s: %v", path, err)
+		}
+	}
+
+	out.Reset()
+	if err := c.Prune(PruneOptions{Force: true}); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", files[0], err)
+	}
+	for _, path := range files[1:] {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected %s to be kept: %v", path, err)
+		}
+	}
+	if records, err := c.DB.GetBackupRecords("app_data", 0); err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records left, got %d, %v", len(records), err)
+	}
+}
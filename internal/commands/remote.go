@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+// EnvRestoreToken names the environment variable holding a bearer token sent
+// when downloading a backup to restore from a URL
+const EnvRestoreToken = "DVM_RESTORE_TOKEN"
+
+// progressStep is how often a download of unknown size reports progress
+const progressStep = 64 << 20
+
+// isBackupURL reports whether a restore target is an http(s) URL
+func isBackupURL(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// restoreFromURL downloads a backup and restores it like a local backup
+// file, removing the download afterwards
+func (c *Context) restoreFromURL(rawURL string, opts RestoreOptions) error {
+	// Download below the backups directory, which workers can already mount
+	if err := os.MkdirAll(c.Config.Paths.Backups, 0755); err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(c.Config.Paths.Backups, ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	backupFile, err := c.downloadBackup(rawURL, dir)
+	if err != nil {
+		return err
+	}
+	return c.restoreFileInto(backupFile, opts.Into, opts)
+}
+
+// downloadBackup downloads the backup at rawURL into dir, keeping its file
+// name so the target volume can be inferred from it. The response must be
+// a complete archive, not an error page.
+func (c *Context) downloadBackup(rawURL, dir string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid backup URL: %w", err)
+	}
+	name := path.Base(u.Path)
+	if !hasBackupExtension(name) {
+		return "", fmt.Errorf("backup URL must name a %s file: %s", strings.Join(backupExtensions, ", "), rawURL)
+	}
+
+	// The request, body included, is cancelled with the command, so
+	// --timeout and Ctrl-C stop a stalled download
+	req, err := http.NewRequestWithContext(c.runContext(), http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid backup URL: %w", err)
+	}
+	if token := os.Getenv(EnvRestoreToken); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", ErrBackupNotFound, rawURL)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("failed to download backup: %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); strings.HasPrefix(mediaType, "text/") {
+		return "", fmt.Errorf("server returned %s instead of a backup archive", mediaType)
+	}
+
+	c.Info("Downloading %s (%s)...", rawURL, downloadSize(resp.ContentLength))
+
+	dest := filepath.Join(dir, name)
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	progress := &downloadProgress{c: c, total: resp.ContentLength}
+	n, err := io.Copy(io.MultiWriter(f, progress), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download backup: %w", err)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return "", fmt.Errorf("download truncated: got %s of %s", FormatSize(n), FormatSize(resp.ContentLength))
+	}
+	if err := checkArchive(dest); err != nil {
+		return "", err
+	}
+
+	return dest, nil
+}
+
+// hasBackupExtension reports whether name ends in one of backupExtensions
+func hasBackupExtension(name string) bool {
+	for _, ext := range backupExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArchive checks that a file starts like a compressed or plain tar
+// archive
+func checkArchive(path string) error {
+	compression, err := docker.DetectCompression(path)
+	if err != nil {
+		return err
+	}
+	if compression != docker.CompressionNone {
+		return nil
+	}
+
+	// A plain tar archive carries "ustar" at offset 257 of its first header
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := make([]byte, 262)
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header[257:], []byte("ustar")) {
+		return fmt.Errorf("%s is not a backup archive", filepath.Base(path))
+	}
+	return nil
+}
+
+// downloadSize formats the size of a download, which may be unknown (-1)
+func downloadSize(size int64) string {
+	if size < 0 {
+		return "unknown size"
+	}
+	return FormatSize(size)
+}
+
+// downloadProgress reports how much of a download has been written: at each
+// quarter of its size, or every progressStep bytes if the size is unknown
+type downloadProgress struct {
+	c     *Context
+	total int64
+	done  int64
+	next  int64
+}
+
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+
+	step := int64(progressStep)
+	if p.total > 0 {
+		step = (p.total + 3) / 4
+	}
+	if p.next == 0 {
+		p.next = step
+	}
+	if p.done >= p.next {
+		if p.total > 0 {
+			p.c.Info("  %s / %s (%d%%)", FormatSize(p.done), FormatSize(p.total), p.done*100/p.total)
+		} else {
+			p.c.Info("  %s", FormatSize(p.done))
+		}
+		for p.next <= p.done {
+			p.next += step
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tarGz returns a gzip-compressed tar archive holding one small file
+func tarGz(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := []byte("hello")
+	if err := tw.WriteHeader(&tar.Header{Name: "./data.txt", Mode: 0o644, Size: int64(len(content))}); err != nil {
+		t.Fatalf("tar header failed: %v", err)
+	}
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestRestoreFromURL(t *testing.T) {
+	archive := tarGz(t)
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/backups/db_2024-01-01_000000Z.tar.gz":
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(archive)
+		case "/backups/login_2024-01-01_000000Z.tar.gz":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>please log in</html>"))
+		case "/backups/junk_2024-01-01_000000Z.tar":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(bytes.Repeat([]byte("x"), 1024))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv(EnvRestoreToken, "s3cret")
+
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+
+	err := c.Restore(RestoreOptions{Target: srv.URL + "/backups/db_2024-01-01_000000Z.tar.gz", Into: "app_data", Force: true})
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if gotAuth != "Bearer s3cret" {
+		t.Fatalf("expected the bearer token to be sent, got %q", gotAuth)
+	}
+
+	// The worker restored the downloaded archive, which is gone afterwards
+	if len(daemon.workers) != 1 {
+		t.Fatalf("expected one restore worker, got %v", daemon.workers)
+	}
+	var downloadDir string
+	for _, m := range daemon.workers["worker1"].Mounts {
+		if m.Target == "/backup" {
+			downloadDir = m.Source
+		}
+	}
+	if !strings.HasPrefix(downloadDir, c.Config.Paths.Backups) {
+		t.Fatalf("expected the download below the backups directory, got %q", downloadDir)
+	}
+	if _, err := os.Stat(downloadDir); !os.IsNotExist(err) {
+		t.Fatalf("expected the download to be removed, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		path    string
+		wantErr string
+	}{
+		{"/backups/login_2024-01-01_000000Z.tar.gz", "text/html"},
+		{"/backups/junk_2024-01-01_000000Z.tar", "not a backup archive"},
+		{"/backups/missing_2024-01-01_000000Z.tar.gz", "backup not found"},
+		{"/backups/notes.txt", "must name a"},
+	} {
+		err := c.Restore(RestoreOptions{Target: srv.URL + tt.path, Into: "app_data", Force: true})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.path, tt.wantErr, err)
+		}
+	}
+	if len(daemon.workers) != 1 {
+		t.Fatalf("expected rejected downloads not to be restored, got %v", daemon.workers)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(c.Config.Paths.Backups, ".download-*")); len(leftovers) != 0 {
+		t.Fatalf("expected every download to be cleaned up, got %v", leftovers)
+	}
+}
+
+func TestRestoreFromURLStopsStalledDownload(t *testing.T) {
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/backups/headers_2024-01-01_000000Z.tar.gz":
+			// Never answers
+		case "/backups/body_2024-01-01_000000Z.tar.gz":
+			// Sends half of the archive, then nothing more
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Header().Set("Content-Length", "2048")
+			w.Write(bytes.Repeat([]byte{0x1f}, 1024))
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer srv.Close()
+	defer close(stop)
+
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, _ := newDockerTestContext(t, daemon)
+
+	for _, path := range []string{"/backups/headers_2024-01-01_000000Z.tar.gz", "/backups/body_2024-01-01_000000Z.tar.gz"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		c.ctx = ctx
+		done := make(chan error, 1)
+		go func() {
+			done <- c.Restore(RestoreOptions{Target: srv.URL + path, Into: "app_data", Force: true})
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("%s: expected the download to time out, got %v", path, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the stalled download was not stopped", path)
+		}
+		cancel()
+	}
+	if len(daemon.workers) != 0 {
+		t.Fatalf("expected stalled downloads not to be restored, got %v", daemon.workers)
+	}
+}
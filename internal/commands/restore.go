@@ -1,65 +1,242 @@
 package commands
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/koyashimano/docker-volume-manager/internal/compose"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
 )
 
 // RestoreOptions contains options for restore command
 type RestoreOptions struct {
-	Select  bool
-	List    bool
-	Force   bool
-	Restart bool
-	Target  string // service name or backup file path
+	Select       bool
+	List         bool
+	Force        bool
+	Restart      bool
+	Stop         bool // stop containers using the volume during the restore and start them afterwards
+	Hot          bool // restore while containers keep running, without the in-use confirmation
+	Recreate     bool // recreate a volume whose driver differs from the backup's without asking
+	Plain        bool // ignore the backup's driver, creating a missing volume as a plain local one
+	IncludeBinds bool
+	Sparse       bool   // write holes of sparse files back as holes; needed for --sparse backups
+	Xattrs       bool   // restore extended attributes and ACLs kept by --xattrs backups
+	Chown        string // numeric "uid:gid" to give restored files to, "" to keep the archived owners
+	Atomic       bool   // restore via a scratch volume, keeping the old data until success
+	Generation   int    // 0 = latest, 1 = previous, ...
+	Target       string // service name, bind mount name, backup file path or http(s) URL
+	Into         string // service, volume or bind mount to restore a file or URL into; "" infers it from the file name
+	Format       string // format of List: "" for text, "json"
+	Path         string // restore only this file or directory, relative to the volume root
+	IgnoreErrors bool   // when restoring every volume, return nil even if some fail
+}
+
+// members returns the archive members to restore, or nil for all
+func (opts RestoreOptions) members() []string {
+	if opts.Path == "" {
+		return nil
+	}
+	return []string{opts.Path}
 }
 
 // Restore restores volumes from backup
 func (c *Context) Restore(opts RestoreOptions) error {
+	if opts.Path != "" {
+		if opts.Target == "" {
+			return fmt.Errorf("--path requires a service, volume or backup file to restore")
+		}
+		cleaned, err := cleanRestorePath(opts.Path)
+		if err != nil {
+			return err
+		}
+		opts.Path = cleaned
+	}
+
+	if opts.Chown != "" && !validOwner(opts.Chown) {
+		return fmt.Errorf("--chown %s must be a numeric uid:gid or uid", opts.Chown)
+	}
+
 	// If no target specified, restore all volumes in project
 	if opts.Target == "" {
 		return c.restoreAll(opts)
 	}
 
+	// Download a backup given by URL, then restore it as a file
+	if isBackupURL(opts.Target) {
+		return c.restoreFromURL(opts.Target, opts)
+	}
+
 	// Check if target is a file path
-	if _, err := os.Stat(opts.Target); err == nil {
-		return c.restoreFromFile(opts.Target, "", opts)
+	file, err := config.ResolvePath(opts.Target)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(file); err == nil {
+		return c.restoreFileInto(file, opts.Into, opts)
 	}
 
 	// Otherwise, treat as service name
 	return c.restoreService(opts.Target, opts)
 }
 
+// cleanRestorePath validates a --path and returns it in the form tar
+// expects: relative to the volume root, without "./" or a trailing slash
+func cleanRestorePath(p string) (string, error) {
+	if strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("--path %s must be relative to the volume root", p)
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("--path %s must not contain ..", p)
+		}
+	}
+	cleaned := path.Clean(p)
+	if cleaned == "." {
+		return "", fmt.Errorf("--path %s names the whole volume; omit --path to restore everything", p)
+	}
+	return cleaned, nil
+}
+
+// validOwner reports whether owner is a numeric uid:gid or uid. Names are
+// not accepted, as the worker container does not know the host's users.
+func validOwner(owner string) bool {
+	uid, gid, hasGID := strings.Cut(owner, ":")
+	if _, err := strconv.ParseUint(uid, 10, 32); err != nil {
+		return false
+	}
+	if hasGID {
+		if _, err := strconv.ParseUint(gid, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// restoreTarOptions returns how a restore with opts extracts backups
+func (c *Context) restoreTarOptions(opts RestoreOptions) docker.TarOptions {
+	tarOpts := c.tarOptions(opts.Sparse, opts.Xattrs)
+	tarOpts.Owner = opts.Chown
+	return tarOpts
+}
+
 func (c *Context) restoreAll(opts RestoreOptions) error {
 	if c.Compose == nil {
 		return ErrComposeNotFound
 	}
 
-	volumes := c.Compose.GetAllFullVolumeNames(c.ProjectName)
-	if len(volumes) == 0 {
-		fmt.Println("No volumes found in project")
+	volumes := c.Compose.GetAllFullVolumeNames(c.ProjectName, c.Profiles)
+	var binds []compose.VolumeMapping
+	if opts.IncludeBinds {
+		binds = c.Compose.GetAllBindMounts(c.Profiles)
+	}
+	if opts.List && opts.Format == "json" {
+		return c.listAllBackups(volumes, binds, opts.Format)
+	}
+	if len(volumes) == 0 && len(binds) == 0 {
+		c.Info("No volumes found in project")
 		return nil
 	}
+	// Listing restores nothing, so there is nothing to tally
+	if opts.List {
+		return c.listAllBackups(volumes, binds, opts.Format)
+	}
 
+	s := newSummary("restore")
 	for _, volumeName := range volumes {
-		serviceName := c.GetServiceName(volumeName)
+		serviceName := c.volumeSelector(volumeName)
 		if err := c.restoreService(serviceName, opts); err != nil {
-			fmt.Printf("Error restoring %s: %v\n", volumeName, err)
+			c.reportError(err, "failed to restore %s: %v", volumeName, err)
+			s.fail(volumeName, err)
 			continue
 		}
+		s.ok(volumeName, "", 0, 0)
 	}
 
-	return nil
+	for _, bind := range binds {
+		if err := c.restoreService(bind.BindName(), opts); err != nil {
+			c.reportError(err, "failed to restore %s: %v", bind.VolumeName, err)
+			s.fail(bind.BindName(), err)
+			continue
+		}
+		s.ok(bind.BindName(), "", 0, 0)
+	}
+
+	// Always tally, as a failure is easy to miss among many volumes
+	if !c.Quiet {
+		fmt.Fprintf(c.Out, "\n%s\n", s.tally("Restored"))
+	}
+	return s.failure(opts.IgnoreErrors)
 }
 
 func (c *Context) restoreService(serviceName string, opts RestoreOptions) error {
-	// Resolve volume name
-	volumeName, err := c.ResolveVolumeName(serviceName)
+	volumeName, searchNames, err := c.backupSearchNames(serviceName)
+	if err != nil {
+		return err
+	}
+
+	// Get backup directory
+	backupDir := filepath.Join(c.Config.Paths.Backups, c.ProjectName)
+
+	// List backups if requested
+	if opts.List {
+		return c.listBackups(backupDir, opts.Format, searchNames...)
+	}
+
+	// Select backup
+	var backupFile string
+
+	if opts.Select {
+		backupFile, err = c.selectBackup(backupDir, searchNames...)
+		if err != nil {
+			return err
+		}
+	} else if opts.Generation > 0 {
+		// Use an older generation, counting back from the latest
+		backupFile, err = FindBackupGeneration(backupDir, opts.Generation, searchNames...)
+		if err != nil {
+			return fmt.Errorf("no backup found for %s: %w", serviceName, err)
+		}
+	} else {
+		// Use latest backup
+		backupFile, err = FindBackupFile(backupDir, searchNames...)
+		if err != nil {
+			target := serviceName
+			if target == "" && len(searchNames) > 0 {
+				target = searchNames[0]
+			}
+			if target == "" {
+				target = volumeName
+			}
+			return fmt.Errorf("no backup found for %s: %w", target, err)
+		}
+	}
+
+	if bind, ok := c.findBindMount(serviceName); ok {
+		return c.restoreBindFromFile(backupFile, bind, opts)
+	}
+
+	return c.restoreFromFile(backupFile, volumeName, opts)
+}
+
+// backupSearchNames resolves the volume of a service and the names its
+// backups may be filed under: the service, the full volume name and the
+// volume name without the project prefix
+func (c *Context) backupSearchNames(serviceName string) (string, []string, error) {
+	// Resolve volume name; an unknown one might be a volume to create
+	volumeName, err := c.resolveVolumeNameOrSelf(serviceName)
 	if err != nil {
-		volumeName = serviceName // Might be creating a new volume
+		return "", nil, err
 	}
 
 	// Get service name for backup lookup
@@ -92,37 +269,54 @@ func (c *Context) restoreService(serviceName string, opts RestoreOptions) error
 		addName(shortName)
 	}
 
-	// Get backup directory
-	backupDir := filepath.Join(c.Config.Paths.Backups, c.ProjectName)
+	return volumeName, searchNames, nil
+}
 
-	// List backups if requested
-	if opts.List {
-		return c.listBackups(backupDir, searchNames...)
+// findBindMount looks up a compose bind mount by its synthetic BindName
+func (c *Context) findBindMount(name string) (compose.VolumeMapping, bool) {
+	if c.Compose == nil {
+		return compose.VolumeMapping{}, false
 	}
+	return c.Compose.FindBindMount(name)
+}
 
-	// Select backup
-	var backupFile string
-
-	if opts.Select {
-		backupFile, err = c.selectBackup(backupDir, searchNames...)
-		if err != nil {
-			return err
-		}
-	} else {
-		// Use latest backup
-		backupFile, err = FindBackupFile(backupDir, searchNames...)
-		if err != nil {
-			target := serviceName
-			if target == "" && len(searchNames) > 0 {
-				target = searchNames[0]
-			}
-			if target == "" {
-				target = volumeName
-			}
-			return fmt.Errorf("no backup found for %s: %w", target, err)
+// restoreBindFromFile extracts a backup back into the host directory of a
+// compose bind mount
+func (c *Context) restoreBindFromFile(backupFile string, bind compose.VolumeMapping, opts RestoreOptions) error {
+	if !opts.Force {
+		if !Confirm(fmt.Sprintf("This will overwrite %shost directory %s. Continue?", pathOf(opts), bind.VolumeName)) {
+			return fmt.Errorf("restore cancelled")
 		}
 	}
 
+	c.Info("Restoring bind mount %s from %s...", bind.VolumeName, backupFile)
+
+	err := c.track("restore", bind.BindName(), func() error {
+		return c.Docker.RestoreBind(bind.VolumeName, backupFile, c.restoreTarOptions(opts), opts.members()...)
+	})
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	c.Info("✓ Restore complete: %s", bind.VolumeName)
+
+	return nil
+}
+
+// restoreFileInto restores a backup file into the service, volume or bind
+// mount named into, or into the one named by the file if into is empty
+func (c *Context) restoreFileInto(backupFile, into string, opts RestoreOptions) error {
+	if into == "" {
+		return c.restoreFromFile(backupFile, "", opts)
+	}
+	if bind, ok := c.findBindMount(into); ok {
+		return c.restoreBindFromFile(backupFile, bind, opts)
+	}
+
+	volumeName, err := c.resolveVolumeNameOrSelf(into)
+	if err != nil {
+		return err
+	}
 	return c.restoreFromFile(backupFile, volumeName, opts)
 }
 
@@ -130,27 +324,13 @@ func (c *Context) restoreFromFile(backupFile, volumeName string, opts RestoreOpt
 	// If volume name not specified, try to infer from backup filename
 	if volumeName == "" {
 		// Parse the filename to extract service name
-		// Expected format: servicename_YYYYMMDD_HHMMSS.tar.gz
-		// To handle service names with underscores, we look for a timestamp pattern
-		baseName := filepath.Base(backupFile)
-
-		// Remove extension(s)
-		baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
-		if strings.HasSuffix(baseName, ".tar") {
-			baseName = strings.TrimSuffix(baseName, ".tar")
-		}
-
-		// Try to find the last underscore followed by a timestamp (YYYYMMDD_HHMMSS format)
-		parts := strings.Split(baseName, "_")
-		if len(parts) < 3 {
-			return fmt.Errorf("backup filename %q does not match expected format (service_YYYYMMDD_HHMMSS.tar.gz). Please specify volume name explicitly with --target", filepath.Base(backupFile))
+		serviceName, ok := ParseBackupFilename(filepath.Base(backupFile))
+		if !ok {
+			return fmt.Errorf("backup filename %q does not match expected format (<name>_YYYY-MM-DD_HHMMSS.tar.gz); cannot determine target volume", filepath.Base(backupFile))
 		}
 
-		// Join all parts except the last two (which should be date and time)
-		// This assumes format: service_name_20060102_150405
-		serviceName := strings.Join(parts[:len(parts)-2], "_")
-		if serviceName == "" {
-			return fmt.Errorf("could not extract service name from backup filename %q. Please specify volume name explicitly with --target", filepath.Base(backupFile))
+		if bind, ok := c.findBindMount(serviceName); ok {
+			return c.restoreBindFromFile(backupFile, bind, opts)
 		}
 
 		var err error
@@ -161,86 +341,362 @@ func (c *Context) restoreFromFile(backupFile, volumeName string, opts RestoreOpt
 	}
 
 	if volumeName == "" {
-		return fmt.Errorf("cannot determine volume name from backup file. Please specify volume name explicitly with --target")
+		return fmt.Errorf("cannot determine volume name from backup file %q", filepath.Base(backupFile))
 	}
 
 	// Check if volume exists and is in use
-	if c.Docker.VolumeExists(volumeName) {
+	volumeExists := c.Docker.VolumeExists(volumeName)
+	if volumeExists {
 		inUse, _ := c.Docker.IsVolumeInUse(volumeName)
-		if inUse && !opts.Force {
+		if inUse && !opts.Force && !opts.Hot && !opts.Stop {
 			if !Confirm(fmt.Sprintf("Volume %s is in use. Continue?", volumeName)) {
 				return fmt.Errorf("restore cancelled")
 			}
 		}
+		if inUse && opts.Hot {
+			c.Warn("volume %s is in use; restoring while its containers keep running (--hot)", volumeName)
+		}
 
 		// Confirm overwrite
 		if !opts.Force {
-			if !Confirm(fmt.Sprintf("This will overwrite %s. Continue?", volumeName)) {
+			if !Confirm(fmt.Sprintf("This will overwrite %s%s. Continue?", pathOf(opts), volumeName)) {
 				return fmt.Errorf("restore cancelled")
 			}
 		}
 	}
 
-	if !c.Quiet {
-		fmt.Printf("Restoring %s from %s...\n", volumeName, backupFile)
+	// Stop containers so they don't see a half-restored volume
+	if opts.Stop && volumeExists {
+		containerIDs, err := c.stopVolumeContainers(volumeName)
+		if err != nil {
+			return err
+		}
+		if len(containerIDs) > 0 {
+			defer c.restartContainers(containerIDs)
+		}
+	}
+
+	if err := c.checkVolumeDriver(volumeName, backupFile, opts); err != nil {
+		return err
 	}
 
+	c.Info("Restoring %s%s from %s...", pathOf(opts), volumeName, backupFile)
+
 	// Perform restore
-	if err := c.Docker.RestoreVolume(volumeName, backupFile); err != nil {
+	err := c.track("restore", volumeName, func() error {
+		return c.restoreVolume(volumeName, backupFile, opts)
+	})
+	if err != nil {
 		return fmt.Errorf("restore failed: %w", err)
 	}
 
 	// Update metadata
 	if err := c.DB.UpdateLastAccessed(volumeName); err != nil {
-		fmt.Printf("Warning: failed to update metadata: %v\n", err)
+		c.Warn("failed to update metadata: %v", err)
 	}
 
-	if !c.Quiet {
-		fmt.Printf("✓ Restore complete: %s\n", volumeName)
+	c.Info("✓ Restore complete: %s", volumeName)
+
+	// Restart containers if requested; with --stop they are started again anyway
+	if opts.Restart && !opts.Stop {
+		c.Info("Restarting containers using %s...", volumeName)
+		if err := c.Docker.RestartContainersUsingVolume(volumeName); err != nil {
+			c.Warn("failed to restart containers: %v", err)
+		}
+		c.forgetContainers()
 	}
 
-	// Restart containers if requested
-	if opts.Restart {
-		if !c.Quiet {
-			fmt.Printf("Restarting containers using %s...\n", volumeName)
+	return nil
+}
+
+// checkVolumeDriver compares the target volume with the driver recorded for
+// backupFile. A missing volume is created with the recorded driver and
+// options rather than as a plain local volume. An existing volume on another
+// driver is reported and, with --recreate or after confirmation, recreated
+// to match, which Docker only allows once no container references it. With
+// --path it is never recreated. --plain skips all of this.
+func (c *Context) checkVolumeDriver(volumeName, backupFile string, opts RestoreOptions) error {
+	if opts.Plain {
+		return nil
+	}
+	record, err := c.DB.GetBackupRecordByPath(backupFile)
+	if err != nil || record == nil || record.Driver == "" {
+		return nil
+	}
+
+	vol, err := c.Docker.GetVolume(volumeName)
+	if err != nil {
+		c.Debug("Creating %s with driver %s", volumeName, record.Driver)
+		if err := c.Docker.CreateVolumeWithOptions(volumeName, record.Driver, record.DriverOpts, nil); err != nil {
+			return fmt.Errorf("failed to create %s: %w", volumeName, err)
 		}
-		if err := c.Docker.RestartContainersUsingVolume(volumeName); err != nil {
-			fmt.Printf("Warning: failed to restart containers: %v\n", err)
+		return nil
+	}
+	if vol.Driver == record.Driver {
+		return nil
+	}
+
+	c.Warn("volume %s uses driver %s, but the backup was taken from a %s volume", volumeName, vol.Driver, record.Driver)
+
+	// Only the path is restored, so recreating would lose everything else
+	if opts.Path != "" {
+		c.Warn("not recreating %s when restoring only %s; restoring into it as it is", volumeName, opts.Path)
+		return nil
+	}
+
+	// Stopped containers keep the volume from being removed too
+	containers, err := c.Docker.GetContainersUsingVolume(volumeName)
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	if len(containers) > 0 {
+		if opts.Recreate {
+			return fmt.Errorf("cannot recreate %s: containers %v still use it (remove them first, e.g. with docker compose down)", volumeName, containers)
 		}
+		c.Warn("not recreating %s while containers %v use it; restoring into it as it is", volumeName, containers)
+		return nil
+	}
+
+	recreate := opts.Recreate
+	if !recreate && !opts.Force {
+		recreate = Confirm(fmt.Sprintf("Recreate %s with driver %s and its original options?", volumeName, record.Driver))
+	}
+	if !recreate {
+		return nil
 	}
 
+	c.Info("Recreating %s with driver %s...", volumeName, record.Driver)
+	if err := c.Docker.RemoveVolume(volumeName, false); err != nil {
+		return fmt.Errorf("failed to remove %s for recreation: %w", volumeName, err)
+	}
+	// The driver changes back, but labels such as com.docker.compose.* stay
+	if err := c.Docker.CreateVolumeWithOptions(volumeName, record.Driver, record.DriverOpts, vol.Labels); err != nil {
+		return fmt.Errorf("failed to recreate %s: %w", volumeName, err)
+	}
 	return nil
 }
 
-func (c *Context) listBackups(backupDir string, names ...string) error {
+// restoreVolume extracts backupFile, or only opts.Path of it, into
+// volumeName, going through a scratch volume with opts.Atomic. Drivers that
+// cannot host a scratch copy fall back to an in-place restore. Incremental
+// backups are restored by replaying their chain from the full backup.
+func (c *Context) restoreVolume(volumeName, backupFile string, opts RestoreOptions) error {
+	chain, err := c.backupChain(backupFile)
+	if err != nil {
+		return err
+	}
+	if chain != nil && opts.Path != "" {
+		return fmt.Errorf("--path is not supported for incremental backups")
+	}
+	if chain != nil {
+		if opts.Atomic {
+			c.Warn("atomic restore is not supported for incremental backups; restoring in place")
+		}
+		c.Debug("Applying %d incremental backup(s)", len(chain))
+		return c.Docker.RestoreVolumeChain(volumeName, chain, c.restoreTarOptions(opts))
+	}
+
+	// Replacing the whole volume would drop everything outside the path
+	if opts.Atomic && opts.Path != "" {
+		c.Warn("atomic restore is not supported with --path; restoring in place")
+	}
+	if !opts.Atomic || opts.Path != "" {
+		return c.Docker.RestoreVolume(volumeName, backupFile, c.restoreTarOptions(opts), opts.members()...)
+	}
+
+	err = c.Docker.RestoreVolumeAtomic(volumeName, backupFile, c.restoreTarOptions(opts))
+	if errors.Is(err, docker.ErrAtomicUnsupported) {
+		c.Warn("%v; restoring in place", err)
+		return c.Docker.RestoreVolume(volumeName, backupFile, c.restoreTarOptions(opts))
+	}
+	return err
+}
+
+// pathOf describes the part of a volume a restore overwrites, as a prefix
+// for the volume name in messages
+func pathOf(opts RestoreOptions) string {
+	if opts.Path == "" {
+		return ""
+	}
+	return opts.Path + " in "
+}
+
+// backupChain returns the backups to apply, oldest first, to restore an
+// incremental backup: its level-0 backup followed by every increment up to
+// and including backupFile. It returns nil for a regular full backup.
+func (c *Context) backupChain(backupFile string) ([]string, error) {
+	record, err := c.DB.GetBackupRecordByPath(backupFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up backup record: %w", err)
+	}
+	if record == nil || (record.Level == 0 && !fileExists(docker.SnapshotPath(backupFile))) {
+		return nil, nil
+	}
+
+	chain := []string{backupFile}
+	for record.BaseID != 0 {
+		base, err := c.DB.GetBackupRecordByID(record.BaseID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up base backup: %w", err)
+		}
+		if base == nil {
+			return nil, fmt.Errorf("%w: base backup #%d of %s is no longer recorded", ErrBackupNotFound, record.BaseID, filepath.Base(record.FilePath))
+		}
+		if !fileExists(base.FilePath) {
+			return nil, fmt.Errorf("%w: base backup %s of %s is missing", ErrBackupNotFound, base.FilePath, filepath.Base(record.FilePath))
+		}
+		chain = append(chain, base.FilePath)
+		record = base
+	}
+
+	// Built newest first; apply oldest first
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// backupListEntry is a backup file as written by restore --list --format
+// json. The fields from its backup record are null if it has none.
+type backupListEntry struct {
+	Service   string     `json:"service"`
+	Filename  string     `json:"filename"`
+	Path      string     `json:"path"`
+	Size      int64      `json:"size"`
+	ModTime   time.Time  `json:"mtime"`
+	ID        *int       `json:"id"`
+	Tag       *string    `json:"tag"`
+	Checksum  *string    `json:"checksum"`
+	CreatedAt *time.Time `json:"created_at"`
+	Project   *string    `json:"project"`
+}
+
+// backupListEntries describes the backup files in backupDir filed under
+// names, with the records of those that have one
+func (c *Context) backupListEntries(backupDir string, names ...string) ([]backupListEntry, error) {
 	files, err := ListBackupFiles(backupDir, names...)
+	if err != nil {
+		return nil, err
+	}
+	records := c.backupRecordsByPath(names)
+
+	service := ""
+	if len(names) > 0 {
+		service = names[0]
+	}
+
+	entries := make([]backupListEntry, 0, len(files))
+	for _, file := range files {
+		entry := backupListEntry{Service: service, Filename: filepath.Base(file), Path: file}
+		if info, err := os.Stat(file); err == nil {
+			entry.Size = info.Size()
+			entry.ModTime = info.ModTime()
+		}
+		if rec, ok := records[file]; ok {
+			entry.ID = &rec.ID
+			entry.Tag = &rec.Tag
+			entry.Checksum = &rec.Checksum
+			entry.CreatedAt = &rec.CreatedAt
+			entry.Project = &rec.ProjectName
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// backupRecordsByPath indexes the backup records of the volumes filed under
+// names by file path
+func (c *Context) backupRecordsByPath(names []string) map[string]*database.BackupRecord {
+	records := make(map[string]*database.BackupRecord)
+	for _, name := range names {
+		recs, err := c.DB.GetBackupRecords(name, 0)
+		if err != nil {
+			continue
+		}
+		for _, rec := range recs {
+			records[rec.FilePath] = rec
+		}
+	}
+	return records
+}
+
+// listBackups lists the backups of a volume as text or, with format "json",
+// as a JSON array
+func (c *Context) listBackups(backupDir, format string, names ...string) error {
+	entries, err := c.backupListEntries(backupDir, names...)
 	if err != nil {
 		return err
 	}
 
+	if format == "json" {
+		return writeBackupListJSON(c.Out, entries)
+	}
+
 	displayName := "volume"
 	if len(names) > 0 && names[0] != "" {
 		displayName = names[0]
 	}
 
-	if len(files) == 0 {
-		fmt.Printf("No backups found for %s\n", displayName)
+	if len(entries) == 0 {
+		c.Info("No backups found for %s", displayName)
 		return nil
 	}
 
-	fmt.Printf("Available backups for %s:\n", displayName)
-	for i, file := range files {
-		info, _ := os.Stat(file)
-		size := int64(0)
-		if info != nil {
-			size = info.Size()
-		}
-		fmt.Printf("  %d. %s (%s)\n", i+1, filepath.Base(file), FormatSize(size))
+	fmt.Fprintf(c.Out, "Available backups for %s:\n", displayName)
+	for i, entry := range entries {
+		fmt.Fprintf(c.Out, "  %d. %s (%s)\n", i+1, entry.Filename, FormatSize(entry.Size))
 	}
 
 	return nil
 }
 
+// listAllBackups lists the backups of every volume and bind mount of the
+// project, one after another, or as one JSON array with format "json"
+func (c *Context) listAllBackups(volumes []string, binds []compose.VolumeMapping, format string) error {
+	backupDir := filepath.Join(c.Config.Paths.Backups, c.ProjectName)
+
+	var services []string
+	for _, volumeName := range volumes {
+		services = append(services, c.volumeSelector(volumeName))
+	}
+	for _, bind := range binds {
+		services = append(services, bind.BindName())
+	}
+
+	var entries []backupListEntry
+	for _, service := range services {
+		_, names, err := c.backupSearchNames(service)
+		if err != nil {
+			return err
+		}
+		if format != "json" {
+			if err := c.listBackups(backupDir, format, names...); err != nil {
+				return err
+			}
+			continue
+		}
+		found, err := c.backupListEntries(backupDir, names...)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, found...)
+	}
+	if format != "json" {
+		return nil
+	}
+	return writeBackupListJSON(c.Out, entries)
+}
+
+// writeBackupListJSON writes backup list entries as a JSON array
+func writeBackupListJSON(out io.Writer, entries []backupListEntry) error {
+	if entries == nil {
+		entries = []backupListEntry{}
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
 func (c *Context) selectBackup(backupDir string, names ...string) (string, error) {
 	files, err := ListBackupFiles(backupDir, names...)
 	if err != nil {
@@ -256,21 +712,71 @@ func (c *Context) selectBackup(backupDir string, names ...string) (string, error
 		return "", fmt.Errorf("no backups found for %s", displayName)
 	}
 
-	fmt.Printf("Available backups for %s:\n", displayName)
+	// Index known backup records by file path so the menu can show tags
+	records := c.backupRecordsByPath(names)
+
+	ctx, stop := c.promptContext()
+	defer stop()
+	selected, err := promptBackupSelection(ctx, os.Stdin, c.Out, displayName, files, records, c.useUTC())
+	if errors.Is(err, ErrCancelled) {
+		return "", fmt.Errorf("restore %w", ErrCancelled)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Verify the chosen backup against its recorded checksum
+	if rec, ok := records[selected]; ok && rec.Checksum != "" {
+		ok, err := VerifyChecksum(selected, rec.Checksum)
+		if err != nil {
+			return "", fmt.Errorf("failed to verify checksum: %w", err)
+		}
+		if !ok {
+			return "", fmt.Errorf("checksum mismatch for %s: backup may be corrupted", filepath.Base(selected))
+		}
+	}
+
+	return selected, nil
+}
+
+// promptBackupSelection prints a numbered menu of backup files annotated with
+// their recorded tag and checksum status, then reads the user's choice from in
+// until ctx is done.
+// The checksum column shows ✓ when a checksum is recorded, ✗ when the record
+// has none, and - when the file has no record.
+func promptBackupSelection(ctx context.Context, in io.Reader, out io.Writer, displayName string, files []string, records map[string]*database.BackupRecord, utc bool) (string, error) {
+	fmt.Fprintf(out, "Available backups for %s:\n", displayName)
 	for i, file := range files {
 		info, _ := os.Stat(file)
 		size := int64(0)
 		mtime := ""
 		if info != nil {
 			size = info.Size()
-			mtime = info.ModTime().Format("2006-01-02 15:04:05")
+			mtime = FormatTimestamp(info.ModTime(), utc)
 		}
-		fmt.Printf("  %d. %s (%s) - %s\n", i+1, filepath.Base(file), FormatSize(size), mtime)
+
+		tag := "-"
+		checksum := "-"
+		if rec, ok := records[file]; ok {
+			if rec.Tag != "" {
+				tag = rec.Tag
+			}
+			checksum = "✗"
+			if rec.Checksum != "" {
+				checksum = "✓"
+			}
+		}
+
+		fmt.Fprintf(out, "  %d. %s (%s) - %s  tag: %s  checksum: %s\n", i+1, filepath.Base(file), FormatSize(size), mtime, tag, checksum)
 	}
 
-	fmt.Print("\nSelect backup number: ")
-	var choice string
-	if _, err := fmt.Scanln(&choice); err != nil {
+	fmt.Fprint(out, "\nSelect backup number: ")
+	choice, err := readInput(ctx, in)
+	if errors.Is(err, ErrCancelled) {
+		fmt.Fprintln(out)
+		return "", err
+	}
+	if err != nil {
 		return "", fmt.Errorf("failed to read selection: %w", err)
 	}
 
@@ -0,0 +1,488 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koyashimano/docker-volume-manager/internal/compose"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+func TestPromptBackupSelectionAnnotatesMenu(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	tagged := writeBackup(t, dir, "db_2024-01-01_000000.tar.gz", now.Add(-2*time.Hour))
+	noChecksum := writeBackup(t, dir, "db_2024-01-02_000000.tar.gz", now.Add(-time.Hour))
+	untracked := writeBackup(t, dir, "db_2024-01-03_000000.tar.gz", now)
+
+	files := []string{tagged, noChecksum, untracked}
+	records := map[string]*database.BackupRecord{
+		tagged:     {FilePath: tagged, Tag: "pre-upgrade", Checksum: "abc123"},
+		noChecksum: {FilePath: noChecksum},
+	}
+
+	var out bytes.Buffer
+	got, err := promptBackupSelection(context.Background(), strings.NewReader("1\n"), &out, "db", files, records, false)
+	if err != nil {
+		t.Fatalf("selection failed: %v", err)
+	}
+	if got != tagged {
+		t.Fatalf("expected %s, got %s", tagged, got)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) < 4 {
+		t.Fatalf("unexpected menu output:\n%s", out.String())
+	}
+
+	checks := []struct {
+		line string
+		want []string
+	}{
+		{lines[1], []string{"1. db_2024-01-01_000000.tar.gz", "tag: pre-upgrade", "checksum: ✓"}},
+		{lines[2], []string{"2. db_2024-01-02_000000.tar.gz", "tag: -", "checksum: ✗"}},
+		{lines[3], []string{"3. db_2024-01-03_000000.tar.gz", "tag: -", "checksum: -"}},
+	}
+	for _, c := range checks {
+		for _, want := range c.want {
+			if !strings.Contains(c.line, want) {
+				t.Errorf("expected menu line %q to contain %q", c.line, want)
+			}
+		}
+	}
+}
+
+func TestPromptBackupSelectionRejectsInvalidChoice(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{writeBackup(t, dir, "db_2024-01-01_000000.tar.gz", time.Now())}
+
+	for _, input := range []string{"0\n", "2\n", "abc\n", ""} {
+		var out bytes.Buffer
+		if _, err := promptBackupSelection(context.Background(), strings.NewReader(input), &out, "db", files, nil, false); err == nil {
+			t.Errorf("expected error for input %q", input)
+		}
+	}
+}
+
+func TestPromptBackupSelectionCancels(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{writeBackup(t, dir, "db_2024-01-01_000000.tar.gz", time.Now())}
+
+	// Nothing is ever written, so the read blocks until cancelled
+	in, w := io.Pipe()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := promptBackupSelection(ctx, in, io.Discard, "db", files, nil, false)
+		errc <- err
+	}()
+	cancel()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrCancelled) {
+			t.Fatalf("expected ErrCancelled, got %v", err)
+		}
+		if GetExitCode(fmt.Errorf("restore %w", err)) != ExitCancelled {
+			t.Fatalf("expected the cancelled exit code")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("prompt did not return after cancellation")
+	}
+}
+
+func TestRestoreContainerLifecycle(t *testing.T) {
+	tests := []struct {
+		name        string
+		exitCode    int
+		opts        RestoreOptions
+		wantActions []string
+		wantErr     bool
+	}{
+		{
+			name:        "stopAndRestart",
+			opts:        RestoreOptions{Stop: true},
+			wantActions: []string{"stop app1", "stop app2", "start app1", "start app2"},
+		},
+		{
+			name:        "restartAfterFailure",
+			exitCode:    2,
+			opts:        RestoreOptions{Stop: true},
+			wantActions: []string{"stop app1", "stop app2", "start app1", "start app2"},
+			wantErr:     true,
+		},
+		{
+			name:        "hotLeavesContainersRunning",
+			opts:        RestoreOptions{Hot: true},
+			wantActions: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{
+				volumes:    map[string]bool{"app_data": true},
+				containers: map[string][]string{"app_data": {"app1", "app2"}},
+				exitCode:   tt.exitCode,
+			}
+			c, dir := newDockerTestContext(t, daemon)
+			backupFile := writeBackup(t, dir, "app_data_2024-01-01_000000Z.tar.gz", time.Now())
+
+			// --force skips the overwrite prompt; the in-use prompt is
+			// covered by --stop and --hot themselves
+			opts := tt.opts
+			opts.Force = true
+			err := c.restoreFromFile(backupFile, "app_data", opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if strings.Join(daemon.actions, ",") != strings.Join(tt.wantActions, ",") {
+				t.Fatalf("expected actions %v, got %v", tt.wantActions, daemon.actions)
+			}
+		})
+	}
+}
+
+func TestRestoreChecksVolumeDriver(t *testing.T) {
+	ebsOpts := map[string]string{"size": "10"}
+
+	tests := []struct {
+		name        string
+		volumes     map[string]bool
+		containers  map[string][]string
+		opts        RestoreOptions
+		wantWarning bool
+		wantCreated bool
+		wantErr     bool
+		wantActions []string
+	}{
+		{
+			name:        "mismatchWarns",
+			volumes:     map[string]bool{"app_data": true},
+			wantWarning: true,
+		},
+		{
+			name:        "recreateUsesStoredOptions",
+			volumes:     map[string]bool{"app_data": true},
+			opts:        RestoreOptions{Recreate: true},
+			wantWarning: true,
+			wantCreated: true,
+		},
+		{
+			name:        "pathRestoresInPlace",
+			volumes:     map[string]bool{"app_data": true},
+			opts:        RestoreOptions{Recreate: true, Path: "conf"},
+			wantWarning: true,
+		},
+		{
+			// Stopped containers still reference the volume, so the
+			// recreate is refused rather than attempted
+			name:        "recreateRefusedWhileReferenced",
+			volumes:     map[string]bool{"app_data": true},
+			containers:  map[string][]string{"app_data": {"app1"}},
+			opts:        RestoreOptions{Recreate: true, Stop: true},
+			wantWarning: true,
+			wantErr:     true,
+			wantActions: []string{"stop app1", "start app1"},
+		},
+		{
+			name:        "missingVolumeCreatedWithStoredOptions",
+			wantCreated: true,
+		},
+		{
+			name: "plainIgnoresStoredDriver",
+			opts: RestoreOptions{Plain: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{volumes: tt.volumes, containers: tt.containers}
+			c, dir := newDockerTestContext(t, daemon)
+			var errOut bytes.Buffer
+			c.Err = &errOut
+
+			backupFile := writeBackup(t, dir, "app_data_2024-01-01_000000Z.tar.gz", time.Now())
+			record := &database.BackupRecord{VolumeName: "app_data", FilePath: backupFile, Driver: "rexray/ebs", DriverOpts: ebsOpts}
+			if err := c.DB.AddBackupRecord(record); err != nil {
+				t.Fatalf("failed to add record: %v", err)
+			}
+
+			opts := tt.opts
+			opts.Force = true
+			if err := c.restoreFromFile(backupFile, "app_data", opts); (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if strings.Join(daemon.actions, ",") != strings.Join(tt.wantActions, ",") {
+				t.Fatalf("expected actions %v, got %v", tt.wantActions, daemon.actions)
+			}
+
+			warned := strings.Contains(errOut.String(), "Warning: volume app_data uses driver local, but the backup was taken from a rexray/ebs volume")
+			if warned != tt.wantWarning {
+				t.Fatalf("expected warning %v, got stderr %q", tt.wantWarning, errOut.String())
+			}
+
+			if tt.opts.Plain {
+				// The restore creates the missing volume without a driver
+				if len(daemon.created) != 1 || daemon.created[0].Driver != "" || len(daemon.created[0].DriverOpts) != 0 {
+					t.Fatalf("expected a plain local volume, got %+v", daemon.created)
+				}
+				return
+			}
+			if !tt.wantCreated {
+				if len(daemon.created) != 0 || len(daemon.removed) != 0 {
+					t.Fatalf("expected the volume to be left alone, created %+v, removed %v", daemon.created, daemon.removed)
+				}
+				return
+			}
+			if len(daemon.created) != 1 {
+				t.Fatalf("expected one volume to be created, got %+v", daemon.created)
+			}
+			got := daemon.created[0]
+			if got.Name != "app_data" || got.Driver != "rexray/ebs" || got.DriverOpts["size"] != "10" {
+				t.Fatalf("expected app_data with the stored driver and options, got %+v", got)
+			}
+			if wantRemoved := tt.volumes["app_data"]; (len(daemon.removed) == 1) != wantRemoved {
+				t.Fatalf("unexpected removals %v", daemon.removed)
+			}
+		})
+	}
+}
+
+func TestRestoreListAsJSON(t *testing.T) {
+	c, dir := newTestContext(t)
+	c.Config = config.DefaultConfig()
+	c.Config.Paths.Backups = dir
+	var out bytes.Buffer
+	c.Out = &out
+
+	now := time.Now()
+	recorded := writeBackup(t, dir, "app_data_2024-01-01_000000Z.tar.gz", now.Add(-time.Hour))
+	untracked := writeBackup(t, dir, "app_data_2024-01-02_000000Z.tar.gz", now)
+	rec := &database.BackupRecord{VolumeName: "app_data", ProjectName: "shop", FilePath: recorded, Tag: "pre-upgrade", Checksum: "sha256:abc"}
+	if err := c.DB.AddBackupRecord(rec); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	if err := c.Restore(RestoreOptions{Target: "app_data", List: true, Format: "json"}); err != nil {
+		t.Fatalf("restore --list failed: %v", err)
+	}
+
+	var entries []backupListEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out.String())
+	}
+	if len(entries) != 2 || entries[0].Path != recorded || entries[1].Path != untracked {
+		t.Fatalf("expected both backups, got %+v", entries)
+	}
+	if entries[0].Tag == nil || *entries[0].Tag != "pre-upgrade" || entries[0].Project == nil || *entries[0].Project != "shop" ||
+		entries[0].ID == nil || *entries[0].ID != rec.ID || entries[0].CreatedAt == nil {
+		t.Fatalf("expected the recorded backup to carry its record, got %+v", entries[0])
+	}
+	if entries[1].Filename != "app_data_2024-01-02_000000Z.tar.gz" || entries[1].ModTime.IsZero() {
+		t.Fatalf("expected file details for the untracked backup, got %+v", entries[1])
+	}
+
+	// Files without a record have null record fields
+	var raw []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &raw); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	for _, key := range []string{"id", "tag", "checksum", "created_at", "project"} {
+		if value, ok := raw[1][key]; !ok || value != nil {
+			t.Fatalf("expected %s to be null for the untracked backup, got %v", key, raw[1])
+		}
+	}
+
+	out.Reset()
+	if err := c.Restore(RestoreOptions{Target: "other_data", List: true, Format: "json"}); err != nil {
+		t.Fatalf("restore --list failed: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "[]" {
+		t.Fatalf("expected an empty JSON array, got %q", out.String())
+	}
+}
+
+func TestRestorePath(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, dir := newDockerTestContext(t, daemon)
+	var errOut bytes.Buffer
+	c.Err = &errOut
+	backupFile := writeBackup(t, dir, "app_data_2024-01-01_000000Z.tar.gz", time.Now())
+
+	// --atomic would replace the whole volume, so the path is restored in place
+	opts := RestoreOptions{Target: backupFile, Into: "app_data", Path: "./data/uploads/", Force: true, Atomic: true}
+	if err := c.Restore(opts); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if len(daemon.workers) != 1 {
+		t.Fatalf("expected a single in-place restore worker, got %d", len(daemon.workers))
+	}
+	cmd := daemon.workers["worker1"].Cmd
+	if cmd[len(cmd)-1] != "./data/uploads" {
+		t.Fatalf("expected tar to extract only ./data/uploads, got %v", cmd)
+	}
+	if !strings.Contains(errOut.String(), "not supported with --path") {
+		t.Fatalf("expected a warning about --atomic, got %q", errOut.String())
+	}
+
+	for _, bad := range []string{"/data/uploads", "../uploads", "data/../../etc", "."} {
+		opts.Path = bad
+		if err := c.Restore(opts); err == nil {
+			t.Errorf("expected --path %q to be rejected", bad)
+		}
+	}
+	if len(daemon.workers) != 1 {
+		t.Fatalf("expected invalid paths to be rejected before restoring, got %d workers", len(daemon.workers))
+	}
+}
+
+func TestRestoreChown(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, dir := newDockerTestContext(t, daemon)
+	backupFile := writeBackup(t, dir, "app_data_2024-01-01_000000Z.tar.gz", time.Now())
+
+	// Owners are restored by number, and kept unless --chown is given
+	if err := c.Restore(RestoreOptions{Target: backupFile, Force: true}); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if len(daemon.workers) != 1 {
+		t.Fatalf("expected a single restore worker, got %d", len(daemon.workers))
+	}
+	if cmd := strings.Join(daemon.workers["worker1"].Cmd, " "); !strings.Contains(cmd, "--numeric-owner") {
+		t.Fatalf("expected tar to restore numeric owners, got %q", cmd)
+	}
+
+	if err := c.Restore(RestoreOptions{Target: backupFile, Force: true, Chown: "1000:1000"}); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if len(daemon.workers) != 3 {
+		t.Fatalf("expected a restore and a chown worker, got %d workers", len(daemon.workers))
+	}
+	if cmd := strings.Join(daemon.workers["worker3"].Cmd, " "); cmd != "chown -R -h 1000:1000 /target" {
+		t.Fatalf("expected the restored volume to be chowned, got %q", cmd)
+	}
+
+	for _, bad := range []string{"postgres", "1000:", ":1000", "-1:0", "1000:1000:1"} {
+		if err := c.Restore(RestoreOptions{Target: backupFile, Force: true, Chown: bad}); err == nil {
+			t.Errorf("expected --chown %q to be rejected", bad)
+		}
+	}
+	if len(daemon.workers) != 3 {
+		t.Fatalf("expected invalid owners to be rejected before restoring, got %d workers", len(daemon.workers))
+	}
+}
+
+// failingMetadataStore fails to record volume access
+type failingMetadataStore struct {
+	MetaStore
+}
+
+func (s *failingMetadataStore) UpdateLastAccessed(volumeName string) error {
+	return fmt.Errorf("database is locked")
+}
+
+func TestRestoreMetadataWarningHonorsQuiet(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, dir := newDockerTestContext(t, daemon)
+	c.DB = &failingMetadataStore{MetaStore: c.DB}
+	backupFile := writeBackup(t, dir, "app_data_2024-01-01_000000Z.tar.gz", time.Now())
+	opts := RestoreOptions{Target: backupFile, Into: "app_data", Force: true}
+
+	var out, errOut bytes.Buffer
+	c.Out, c.Err = &out, &errOut
+	if err := c.Restore(opts); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if strings.Contains(out.String(), "metadata") || !strings.Contains(errOut.String(), "Warning: failed to update metadata") {
+		t.Fatalf("expected the warning on stderr only, got stdout %q, stderr %q", out.String(), errOut.String())
+	}
+
+	out.Reset()
+	errOut.Reset()
+	c.Quiet = true
+	if err := c.Restore(opts); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if out.Len() != 0 || errOut.Len() != 0 {
+		t.Fatalf("expected no output under --quiet, got stdout %q, stderr %q", out.String(), errOut.String())
+	}
+}
+
+func TestRestoreAllTalliesFailures(t *testing.T) {
+	daemon := &fakeDaemon{
+		volumes: map[string]bool{"shop_db_data": true, "shop_cache": true, "shop_logs": true},
+		failing: map[string]bool{"shop_cache": true},
+	}
+	c, dir := newDockerTestContext(t, daemon)
+
+	path := filepath.Join(dir, "compose.yaml")
+	writeFile(t, path, `services:
+  db:
+    volumes:
+      - db_data:/data
+  cache:
+    volumes:
+      - cache:/data
+  logs:
+    volumes:
+      - logs:/data
+volumes:
+  db_data:
+  cache:
+  logs:
+`)
+	cf, err := compose.LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	c.Compose, c.ProjectName = cf, "shop"
+
+	// logs has no backup, and the worker restoring cache fails
+	backupDir := filepath.Join(c.Config.Paths.Backups, "shop")
+	if err := os.MkdirAll(backupDir, 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	writeBackup(t, backupDir, "shop_db_data_2024-01-01_000000Z.tar.gz", time.Now())
+	writeBackup(t, backupDir, "shop_cache_2024-01-01_000000Z.tar.gz", time.Now())
+
+	var out bytes.Buffer
+	c.Out = &out
+	var batch *BatchError
+	if err := c.Restore(RestoreOptions{Force: true}); !errors.As(err, &batch) || batch.Succeeded != 1 || batch.Failed != 2 {
+		t.Fatalf("expected 1 volume restored and 2 failed, got %v", err)
+	}
+	if !strings.Contains(out.String(), "! Restored 1/3 volume(s), 2 failed") {
+		t.Fatalf("expected a tally of the restore, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := c.Restore(RestoreOptions{Force: true, IgnoreErrors: true}); err != nil {
+		t.Fatalf("expected --ignore-errors to succeed, got %v", err)
+	}
+	if !strings.Contains(out.String(), "! Restored 1/3 volume(s), 2 failed") {
+		t.Fatalf("expected the tally with --ignore-errors too, got %q", out.String())
+	}
+	// --list restores nothing, so it has nothing to tally
+	out.Reset()
+	if err := c.Restore(RestoreOptions{List: true}); err != nil {
+		t.Fatalf("restore --list failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Available backups for db:") || strings.Contains(out.String(), "Restored") {
+		t.Fatalf("expected the backups listed without a tally, got %q", out.String())
+	}
+}
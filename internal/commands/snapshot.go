@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// snapshotInfix joins a volume name and a snapshot name into the name of
+// the volume holding the snapshot
+const snapshotInfix = "__snap_"
+
+// SnapshotOptions contains options for snapshot command
+type SnapshotOptions struct {
+	Service string
+	Name    string // snapshot to take
+	List    bool   // list the snapshots of Service instead
+	Force   bool   // replace an existing snapshot of the same name
+}
+
+// RollbackOptions contains options for rollback command
+type RollbackOptions struct {
+	Service string
+	Name    string // snapshot to roll back to
+	Force   bool   // skip the overwrite confirmation
+}
+
+// snapshotVolumeName returns the name of the volume holding snapshot name of
+// volumeName, checking that it makes a valid volume name
+func snapshotVolumeName(volumeName, name string) (string, error) {
+	if err := validateVolumeName(name); err != nil {
+		return "", fmt.Errorf("invalid snapshot name: %w", err)
+	}
+	snapshot := volumeName + snapshotInfix + name
+	if err := validateVolumeName(snapshot); err != nil {
+		return "", fmt.Errorf("invalid snapshot name: %w", err)
+	}
+	return snapshot, nil
+}
+
+// Snapshot copies a volume into a snapshot volume next to it, named
+// <volume>__snap_<name>. Snapshots are plain volumes, separate from the
+// backup catalog, that Rollback copies back.
+func (c *Context) Snapshot(opts SnapshotOptions) error {
+	if opts.Service == "" {
+		return fmt.Errorf("service name is required")
+	}
+
+	volumeName, err := c.ResolveVolumeName(opts.Service)
+	if err != nil {
+		return err
+	}
+
+	if opts.List {
+		return c.listSnapshots(volumeName)
+	}
+
+	if opts.Name == "" {
+		return fmt.Errorf("snapshot name is required")
+	}
+	snapshot, err := snapshotVolumeName(volumeName, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	exists := c.Docker.VolumeExists(snapshot)
+	if exists && !opts.Force {
+		return fmt.Errorf("snapshot %s of %s already exists (use --force to replace it)", opts.Name, volumeName)
+	}
+
+	c.Info("Snapshotting %s to %s...", volumeName, snapshot)
+
+	err = c.track("snapshot", volumeName, func() error {
+		if exists {
+			return c.Docker.MirrorVolume(volumeName, snapshot)
+		}
+		// Without the source's labels, Compose does not take the snapshot
+		// for one of the project's volumes
+		if err := c.createCloneTarget(volumeName, snapshot, CloneOptions{NoLabels: true}); err != nil {
+			return err
+		}
+		return c.Docker.CopyVolume(volumeName, snapshot)
+	})
+	if err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	c.Info("✓ Snapshot complete: %s", opts.Name)
+	return nil
+}
+
+// listSnapshots prints the snapshots of volumeName, found by their volume
+// names
+func (c *Context) listSnapshots(volumeName string) error {
+	volumes, err := c.Docker.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	prefix := volumeName + snapshotInfix
+	type snapshotRow struct{ name, volume, created string }
+	var rows []snapshotRow
+	for _, vol := range volumes {
+		if name, ok := strings.CutPrefix(vol.Name, prefix); ok && name != "" {
+			rows = append(rows, snapshotRow{name, vol.Name, vol.CreatedAt})
+		}
+	}
+	if len(rows) == 0 {
+		c.Info("No snapshots of %s", volumeName)
+		return nil
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].name < rows[j].name })
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SNAPSHOT\tVOLUME\tCREATED")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", row.name, row.volume, row.created)
+	}
+	return w.Flush()
+}
+
+// Rollback replaces the contents of a volume with one of its snapshots.
+// Running containers using the volume are stopped during the copy and
+// started again afterwards. The snapshot is kept.
+func (c *Context) Rollback(opts RollbackOptions) error {
+	if opts.Service == "" {
+		return fmt.Errorf("service name is required")
+	}
+	if opts.Name == "" {
+		return fmt.Errorf("snapshot name is required")
+	}
+
+	volumeName, err := c.ResolveVolumeName(opts.Service)
+	if err != nil {
+		return err
+	}
+	snapshot, err := snapshotVolumeName(volumeName, opts.Name)
+	if err != nil {
+		return err
+	}
+	if !c.Docker.VolumeExists(snapshot) {
+		return fmt.Errorf("%w: no snapshot %s of %s", ErrVolumeNotFound, opts.Name, volumeName)
+	}
+
+	if !c.confirmDestructive(fmt.Sprintf("This will overwrite %s with snapshot %s. Continue?", volumeName, opts.Name), volumeName, opts.Force, false) {
+		return fmt.Errorf("rollback cancelled")
+	}
+
+	containerIDs, err := c.stopVolumeContainers(volumeName)
+	if err != nil {
+		return err
+	}
+	if len(containerIDs) > 0 {
+		defer c.restartContainers(containerIDs)
+	}
+
+	c.Info("Rolling back %s to snapshot %s...", volumeName, opts.Name)
+
+	err = c.track("rollback", volumeName, func() error {
+		return c.Docker.MirrorVolume(snapshot, volumeName)
+	})
+	if err != nil {
+		return fmt.Errorf("rollback failed: %w", err)
+	}
+
+	if err := c.DB.UpdateLastAccessed(volumeName); err != nil {
+		c.Warn("failed to update metadata: %v", err)
+	}
+
+	c.Info("✓ Rollback complete: %s", volumeName)
+	return nil
+}
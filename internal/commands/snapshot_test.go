@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/volume"
+)
+
+func TestSnapshotAndRollback(t *testing.T) {
+	labels := map[string]string{"com.docker.compose.project": "app"}
+	daemon := &fakeDaemon{
+		volumes:    map[string]bool{"app_data": true, "app_data_other": true},
+		specs:      map[string]volume.Volume{"app_data": {Name: "app_data", Driver: "local", Labels: labels}},
+		containers: map[string][]string{"app_data": {"app1"}},
+	}
+	c, _ := newDockerTestContext(t, daemon)
+
+	// lastWorker returns the command and volume mounts of the latest worker
+	lastWorker := func() (string, map[string]string) {
+		spec := daemon.workers[fmt.Sprintf("worker%d", len(daemon.workers))]
+		mounts := make(map[string]string)
+		for _, m := range spec.Mounts {
+			mounts[m.Target] = m.Source
+		}
+		return strings.Join(spec.Cmd, " "), mounts
+	}
+
+	t.Run("create", func(t *testing.T) {
+		if err := c.Snapshot(SnapshotOptions{Service: "app_data", Name: "before"}); err != nil {
+			t.Fatalf("snapshot failed: %v", err)
+		}
+		if len(daemon.created) != 1 || daemon.created[0].Name != "app_data__snap_before" || len(daemon.created[0].Labels) != 0 {
+			t.Fatalf("expected app_data__snap_before without the source's labels, got %+v", daemon.created)
+		}
+		cmd, mounts := lastWorker()
+		if !strings.Contains(cmd, "cp -a /source/. /target/") || mounts["/source"] != "app_data" || mounts["/target"] != "app_data__snap_before" {
+			t.Fatalf("expected app_data to be copied into the snapshot, got %q with %v", cmd, mounts)
+		}
+		if len(daemon.actions) != 0 {
+			t.Fatalf("expected containers to keep running during a snapshot, got %v", daemon.actions)
+		}
+	})
+
+	t.Run("existingNeedsForce", func(t *testing.T) {
+		if err := c.Snapshot(SnapshotOptions{Service: "app_data", Name: "before"}); err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Fatalf("expected an existing snapshot to be refused, got %v", err)
+		}
+		if err := c.Snapshot(SnapshotOptions{Service: "app_data", Name: "before", Force: true}); err != nil {
+			t.Fatalf("snapshot --force failed: %v", err)
+		}
+		if cmd, mounts := lastWorker(); !strings.Contains(cmd, "rm -rf") || mounts["/target"] != "app_data__snap_before" {
+			t.Fatalf("expected the snapshot to be replaced, got %q with %v", cmd, mounts)
+		}
+	})
+
+	t.Run("invalidName", func(t *testing.T) {
+		for _, name := range []string{"../etc", "-x", "a/b"} {
+			if err := c.Snapshot(SnapshotOptions{Service: "app_data", Name: name}); err == nil || !strings.Contains(err.Error(), "invalid snapshot name") {
+				t.Errorf("expected snapshot name %q to be refused, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		daemon.volumes["app_data__snap_after"] = true
+		var out bytes.Buffer
+		c.Out = &out
+		defer func() { c.Out = io.Discard }()
+		if err := c.Snapshot(SnapshotOptions{Service: "app_data", List: true}); err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[1], "after ") || !strings.HasPrefix(lines[2], "before ") ||
+			!strings.Contains(lines[2], "app_data__snap_before") {
+			t.Fatalf("expected the two snapshots of app_data, got\n%s", out.String())
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		if err := c.Rollback(RollbackOptions{Service: "app_data", Name: "before", Force: true}); err != nil {
+			t.Fatalf("rollback failed: %v", err)
+		}
+		cmd, mounts := lastWorker()
+		if !strings.Contains(cmd, "rm -rf") || !strings.Contains(cmd, "cp -a") || mounts["/source"] != "app_data__snap_before" || mounts["/target"] != "app_data" {
+			t.Fatalf("expected app_data to be replaced by the snapshot, got %q with %v", cmd, mounts)
+		}
+		if strings.Join(daemon.actions, ",") != "stop app1,start app1" {
+			t.Fatalf("expected app1 to be stopped and started again, got %v", daemon.actions)
+		}
+		if !daemon.volumes["app_data__snap_before"] {
+			t.Fatalf("expected the snapshot to be kept")
+		}
+
+		if err := c.Rollback(RollbackOptions{Service: "app_data", Name: "missing", Force: true}); !errors.Is(err, ErrVolumeNotFound) {
+			t.Fatalf("expected ErrVolumeNotFound for a missing snapshot, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Statuses of a single volume in a Summary
+const (
+	StatusOK      = "ok"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Result is the outcome of an operation on a single volume
+type Result struct {
+	Volume  string `json:"volume"`
+	Status  string `json:"status"`
+	Path    string `json:"path,omitempty"`    // backup or archive file written
+	Size    int64  `json:"size"`              // bytes written to Path
+	Freed   int64  `json:"freed,omitempty"`   // bytes reclaimed by removing the volume
+	Message string `json:"message,omitempty"` // reason for a skip or failure
+}
+
+// Summary collects the per-volume outcome of backup, clean and archive
+type Summary struct {
+	Command string   `json:"command"`
+	DryRun  bool     `json:"dry_run,omitempty"`
+	Results []Result `json:"results"`
+	OK      int      `json:"ok"`
+	Skipped int      `json:"skipped"`
+	Failed  int      `json:"failed"`
+	Written int64    `json:"bytes_written"`
+	Freed   int64    `json:"bytes_freed"`
+
+	errs []error // errors of the failed volumes, in order
+}
+
+// BatchError is returned by backup, restore, clean and archive when some of
+// the volumes they process fail. The per-volume errors, already reported as
+// they happened, are joined with errors.Join and can be checked with
+// errors.Is and errors.As.
+type BatchError struct {
+	Command   string
+	Succeeded int
+	Failed    int
+	Err       error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%s: %d succeeded, %d failed", e.Command, e.Succeeded, e.Failed)
+}
+
+func (e *BatchError) Unwrap() error { return e.Err }
+
+// LastSummary returns the per-volume outcome of the most recent Backup,
+// Clean or Archive, or nil if none has run. It is filled in even when the
+// command returns an error partway.
+func (c *Context) LastSummary() *Summary {
+	return c.summary
+}
+
+// newSummary creates an empty summary for command
+func newSummary(command string) *Summary {
+	return &Summary{Command: command, Results: []Result{}}
+}
+
+// ok records a volume that was processed, the file written for it (if any)
+// and the bytes freed by removing it
+func (s *Summary) ok(volume, path string, size, freed int64) {
+	s.Results = append(s.Results, Result{Volume: volume, Status: StatusOK, Path: path, Size: size, Freed: freed})
+	s.OK++
+	s.Written += size
+	s.Freed += freed
+}
+
+// skip records a volume that was deliberately left alone
+func (s *Summary) skip(volume, reason string) {
+	s.Results = append(s.Results, Result{Volume: volume, Status: StatusSkipped, Message: reason})
+	s.Skipped++
+}
+
+// fail records a volume whose operation failed
+func (s *Summary) fail(volume string, err error) {
+	s.Results = append(s.Results, Result{Volume: volume, Status: StatusFailed, Message: err.Error()})
+	s.Failed++
+	s.errs = append(s.errs, err)
+}
+
+// failure returns a *BatchError if any volume failed, or nil if none did
+// or ignoreErrors is set
+func (s *Summary) failure(ignoreErrors bool) error {
+	if s.Failed == 0 || ignoreErrors {
+		return nil
+	}
+	return &BatchError{Command: s.Command, Succeeded: s.OK, Failed: s.Failed, Err: errors.Join(s.errs...)}
+}
+
+// line returns a one-line description of the outcome, e.g.
+// "✓ Removed 2 volume(s), freed 1.5 GB"
+func (s *Summary) line(verb string) string {
+	return s.format(verb, fmt.Sprint(s.OK))
+}
+
+// tally is line with the volumes processed out of all of them, such as
+// "! Restored 8/10 volume(s), 2 failed"
+func (s *Summary) tally(verb string) string {
+	return s.format(verb, fmt.Sprintf("%d/%d", s.OK, len(s.Results)))
+}
+
+// format builds line and tally around count, the volumes processed
+func (s *Summary) format(verb, count string) string {
+	mark := "✓"
+	if s.Skipped > 0 || s.Failed > 0 {
+		mark = "!"
+	}
+
+	line := fmt.Sprintf("%s %s %s volume(s)", mark, verb, count)
+	if s.Written > 0 {
+		line += fmt.Sprintf(", wrote %s", FormatSize(s.Written))
+	}
+	if s.Freed > 0 {
+		line += fmt.Sprintf(", freed %s", FormatSize(s.Freed))
+	}
+	if s.Skipped > 0 {
+		line += fmt.Sprintf(", skipped %d", s.Skipped)
+	}
+	if s.Failed > 0 {
+		line += fmt.Sprintf(", %d failed", s.Failed)
+	}
+	return line
+}
+
+// withSummary runs fn with a fresh Summary for command. With format "json"
+// the human-readable output fn writes to c.Out is discarded, and the summary
+// is written to c.Out as a single JSON object instead, also when fn returns
+// a *BatchError.
+func (c *Context) withSummary(command, format string, fn func(*Summary) error) error {
+	s := newSummary(command)
+	c.summary = s
+	if format != "json" {
+		return fn(s)
+	}
+
+	out := c.Out
+	c.Out = io.Discard
+	err := fn(s)
+	c.Out = out
+	var batch *BatchError
+	if err != nil && !errors.As(err, &batch) {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if encErr := encoder.Encode(s); encErr != nil {
+		return encErr
+	}
+	return err
+}
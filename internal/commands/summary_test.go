@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSummaryLine(t *testing.T) {
+	tests := []struct {
+		verb string
+		fill func(s *Summary)
+		want string
+	}{
+		{"Removed", func(s *Summary) {
+			s.ok("a", "", 0, 0)
+			s.ok("b", "", 0, 0)
+		}, "✓ Removed 2 volume(s)"},
+		{"Removed", func(s *Summary) {
+			s.ok("a", "", 0, 0)
+			s.skip("b", "in use")
+			s.skip("c", "in use")
+		}, "! Removed 1 volume(s), skipped 2"},
+		{"Removed", func(s *Summary) {
+			s.skip("b", "in use")
+			s.fail("c", errors.New("boom"))
+		}, "! Removed 0 volume(s), skipped 1, 1 failed"},
+		{"Removed", func(s *Summary) {
+			s.ok("a", "", 0, 1024)
+			s.ok("b", "", 0, 2048)
+			s.ok("unknown", "", 0, 0)
+		}, "✓ Removed 3 volume(s), freed 3.0 KB"},
+		{"Archived", func(s *Summary) {
+			s.ok("a", "/archives/a.tar.gz", 1024, 4096)
+			s.ok("b", "/archives/b.tar.gz", 512, 8192)
+			s.fail("c", errors.New("boom"))
+		}, "! Archived 2 volume(s), wrote 1.5 KB, freed 12.0 KB, 1 failed"},
+	}
+
+	for _, tt := range tests {
+		s := newSummary("test")
+		tt.fill(s)
+		if got := s.line(tt.verb); got != tt.want {
+			t.Errorf("line() = %q, want %q", got, tt.want)
+		}
+	}
+
+	s := newSummary("restore")
+	s.ok("a", "", 0, 0)
+	s.fail("b", errors.New("boom"))
+	if got, want := s.tally("Restored"), "! Restored 1/2 volume(s), 1 failed"; got != want {
+		t.Errorf("tally() = %q, want %q", got, want)
+	}
+}
+
+func TestWithSummaryJSON(t *testing.T) {
+	var out bytes.Buffer
+	c := &Context{Out: &out}
+
+	err := c.withSummary("backup", "json", func(s *Summary) error {
+		fmt.Fprintln(c.Out, "Backing up app_data...")
+		s.ok("app_data", "/backups/app_data_2024-01-01_000000.tar.gz", 2048, 0)
+		s.skip("missing", "not found")
+		s.fail("app_cache", errors.New("backup failed: boom"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withSummary failed: %v", err)
+	}
+	if strings.Contains(out.String(), "Backing up") {
+		t.Fatalf("human output leaked into JSON mode:\n%s", out.String())
+	}
+	if c.Out != &out {
+		t.Fatalf("output writer was not restored")
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output is not a single JSON object: %v\n%s", err, out.String())
+	}
+
+	want := map[string]any{
+		"command":       "backup",
+		"ok":            float64(1),
+		"skipped":       float64(1),
+		"failed":        float64(1),
+		"bytes_written": float64(2048),
+		"bytes_freed":   float64(0),
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+
+	results, ok := got["results"].([]any)
+	if !ok || len(results) != 3 {
+		t.Fatalf("expected 3 results, got %v", got["results"])
+	}
+
+	checks := []map[string]any{
+		{"volume": "app_data", "status": "ok", "path": "/backups/app_data_2024-01-01_000000.tar.gz", "size": float64(2048)},
+		{"volume": "missing", "status": "skipped", "message": "not found"},
+		{"volume": "app_cache", "status": "failed", "message": "backup failed: boom"},
+	}
+	for i, check := range checks {
+		result := results[i].(map[string]any)
+		for key, value := range check {
+			if result[key] != value {
+				t.Errorf("results[%d].%s = %v, want %v", i, key, result[key], value)
+			}
+		}
+	}
+}
+
+func TestWithSummaryTextKeepsOutput(t *testing.T) {
+	var out bytes.Buffer
+	c := &Context{Out: &out}
+
+	err := c.withSummary("clean", "", func(s *Summary) error {
+		fmt.Fprintln(c.Out, "Deleting app_data...")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withSummary failed: %v", err)
+	}
+	if out.String() != "Deleting app_data...\n" {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
+
+func TestWithSummaryEmptyResults(t *testing.T) {
+	var out bytes.Buffer
+	c := &Context{Out: &out}
+
+	if err := c.withSummary("archive", "json", func(s *Summary) error { return nil }); err != nil {
+		t.Fatalf("withSummary failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"results": []`) {
+		t.Fatalf("expected empty results array, got:\n%s", out.String())
+	}
+}
@@ -4,18 +4,24 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/koyashimano/docker-volume-manager/internal/database"
 )
 
+// swapBackupTag tags the backups swap takes of the volume it replaces
+const swapBackupTag = "swap-backup"
+
 // SwapOptions contains options for swap command
 type SwapOptions struct {
 	Empty    bool
 	NoBackup bool
 	Restart  bool
+	Rollback bool // swap back to the most recent swap backup
 	Service  string
 	Source   string // backup file path or empty
+
+	// SkipConfirm skips the typed confirmation of require_name_confirmation
+	SkipConfirm bool
 }
 
 // Swap swaps a volume with another
@@ -30,11 +36,36 @@ func (c *Context) Swap(opts SwapOptions) error {
 		return err
 	}
 
+	// Swap replaces the contents without asking unless the name must be
+	// typed out
+	if !c.confirmDestructive("", volumeName, true, opts.SkipConfirm) {
+		return fmt.Errorf("swap cancelled")
+	}
+
+	return c.track("swap", volumeName, func() error {
+		return c.swapVolume(volumeName, opts)
+	})
+}
+
+// swapVolume backs up volumeName and replaces its contents with opts.Source
+// or an empty volume
+func (c *Context) swapVolume(volumeName string, opts SwapOptions) error {
+	var err error
+
 	// Get service name for metadata
 	serviceName := c.GetServiceName(volumeName)
 
-	// Check if volume exists
-	if !c.Docker.VolumeExists(volumeName) {
+	if opts.Rollback {
+		opts.Source, err = c.rollbackSource(volumeName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check if volume exists; its driver, options and labels are kept for
+	// the replacement volume
+	current, err := c.Docker.GetVolume(volumeName)
+	if err != nil {
 		return ErrVolumeNotFound
 	}
 
@@ -46,56 +77,63 @@ func (c *Context) Swap(opts SwapOptions) error {
 			return fmt.Errorf("failed to create backup directory: %w", err)
 		}
 
-		// Generate filename using volume name (not service name)
-		// This ensures uniqueness even when multiple services share the same volume
-		filename := GenerateBackupFilename(volumeName+"_swap_backup", c.Config.Defaults.CompressFormat)
-		backupPath = filepath.Join(backupDir, filename)
-
-		if !c.Quiet {
-			fmt.Printf("Backing up current volume to %s...\n", backupPath)
+		// Name the backup after the volume (not the service) so services
+		// sharing a volume don't collide, and reserve the file so swaps
+		// running in the same second each get their own copy
+		backupPath, err = ReserveBackupPath(backupDir, volumeName+"_swap_backup", c.Config.Defaults.CompressFormat, c.useUTC())
+		if err != nil {
+			return fmt.Errorf("failed to create backup file: %w", err)
 		}
 
-		if err := c.Docker.BackupVolume(volumeName, backupPath, true); err != nil {
+		c.Info("Backing up current volume to %s...", backupPath)
+
+		if err := c.Docker.BackupVolume(volumeName, backupPath, true, c.Config.Defaults.CompressLevel, c.tarOptions(false, false)); err != nil {
+			os.Remove(backupPath)
 			return fmt.Errorf("backup failed: %w", err)
 		}
 
 		// Save backup record
 		size, _ := GetFileSize(backupPath)
-		checksum, _ := CalculateChecksum(backupPath)
+		checksum, algo, _ := c.checksum(backupPath)
 		record := &database.BackupRecord{
-			VolumeName:  volumeName,
-			ServiceName: serviceName,
-			ProjectName: c.ProjectName,
-			FilePath:    backupPath,
-			Size:        size,
-			Tag:         "swap-backup",
-			Checksum:    checksum,
+			VolumeName:   volumeName,
+			ServiceName:  serviceName,
+			ProjectName:  c.ProjectName,
+			FilePath:     backupPath,
+			Size:         size,
+			Tag:          swapBackupTag,
+			Checksum:     checksum,
+			ChecksumAlgo: algo,
 		}
-		if err := c.DB.AddBackupRecord(record); err != nil && !c.Quiet {
-			fmt.Fprintf(os.Stderr, "Warning: failed to save swap backup record: %v\n", err)
+		c.recordVolumeDriver(record)
+		if err := c.DB.AddBackupRecord(record); err != nil {
+			c.Warn("failed to save swap backup record: %v", err)
 		}
 	}
 
-	// Stop containers using the volume
-	containers, _ := c.Docker.GetContainersUsingVolume(volumeName)
-	containersStopped := false
-	if len(containers) > 0 {
-		if !c.Quiet {
-			fmt.Printf("Stopping containers: %v\n", containers)
-		}
-		if err := c.Docker.StopContainersUsingVolume(volumeName); err != nil {
+	// Snapshot the running containers using the volume so exactly these are
+	// stopped now and started again later, even though the volume is recreated
+	containerIDs, err := c.Docker.GetRunningContainerIDsUsingVolume(volumeName)
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	if len(containerIDs) > 0 {
+		defer c.forgetContainers()
+		c.Info("Stopping %d container(s)...", len(containerIDs))
+		if err := c.Docker.StopContainers(containerIDs); err != nil {
+			// Bring back any containers that were already stopped
+			if startErr := c.Docker.StartContainers(containerIDs); startErr != nil {
+				return fmt.Errorf("failed to stop containers: %w (also failed to restart containers: %v)", err, startErr)
+			}
 			return fmt.Errorf("failed to stop containers: %w", err)
 		}
-		containersStopped = true
 	}
 
 	// Helper function to restart containers on error
 	restartOnError := func(err error) error {
-		if containersStopped && len(containers) > 0 {
-			if !c.Quiet {
-				fmt.Fprintf(os.Stderr, "Error occurred, restarting containers...\n")
-			}
-			if restartErr := c.Docker.RestartContainersUsingVolume(volumeName); restartErr != nil {
+		if len(containerIDs) > 0 {
+			c.Warn("error occurred, restarting containers...")
+			if restartErr := c.Docker.StartContainers(containerIDs); restartErr != nil {
 				return fmt.Errorf("%w (also failed to restart containers: %v)", err, restartErr)
 			}
 		}
@@ -103,63 +141,63 @@ func (c *Context) Swap(opts SwapOptions) error {
 	}
 
 	// Delete current volume
-	if !c.Quiet {
-		fmt.Printf("Removing current volume...\n")
-	}
+	c.Info("Removing current volume...")
 
 	if err := c.Docker.RemoveVolume(volumeName, true); err != nil {
 		return restartOnError(fmt.Errorf("failed to remove volume: %w", err))
 	}
 
 	// Create new volume
-	if !c.Quiet {
-		fmt.Printf("Creating new volume...\n")
-	}
+	c.Info("Creating new volume...")
 
-	if err := c.Docker.CreateVolume(volumeName); err != nil {
+	if err := c.Docker.CreateVolumeWithOptions(volumeName, current.Driver, current.Options, current.Labels); err != nil {
 		return restartOnError(fmt.Errorf("failed to create volume: %w", err))
 	}
 
 	// Restore from source if provided
 	if opts.Source != "" && !opts.Empty {
-		if !c.Quiet {
-			fmt.Printf("Restoring from %s...\n", opts.Source)
-		}
+		c.Info("Restoring from %s...", opts.Source)
 
-		if err := c.Docker.RestoreVolume(volumeName, opts.Source); err != nil {
+		if err := c.Docker.RestoreVolume(volumeName, opts.Source, c.tarOptions(false, false)); err != nil {
 			return restartOnError(fmt.Errorf("restore failed: %w", err))
 		}
 	}
 
 	// Restart containers if requested
-	if opts.Restart && len(containers) > 0 {
-		if !c.Quiet {
-			fmt.Printf("Restarting containers...\n")
-		}
+	if opts.Restart && len(containerIDs) > 0 {
+		c.Info("Restarting containers...")
 
-		for _, containerName := range containers {
-			containerName = strings.TrimPrefix(containerName, "/")
-			if c.Verbose {
-				fmt.Printf("Starting %s\n", containerName)
-			}
-		}
-
-		if err := c.Docker.RestartContainersUsingVolume(volumeName); err != nil {
-			fmt.Printf("Warning: failed to restart some containers: %v\n", err)
+		if err := c.Docker.StartContainers(containerIDs); err != nil {
+			c.Warn("failed to restart some containers: %v", err)
 		}
 	}
 
-	if !c.Quiet {
-		if opts.Empty {
-			fmt.Printf("✓ Swapped to empty volume: %s\n", volumeName)
-		} else if opts.Source != "" {
-			fmt.Printf("✓ Swapped to volume from: %s\n", opts.Source)
-		}
+	if opts.Empty {
+		c.Info("✓ Swapped to empty volume: %s", volumeName)
+	} else if opts.Rollback {
+		c.Info("✓ Rolled back %s to: %s", volumeName, opts.Source)
+	} else if opts.Source != "" {
+		c.Info("✓ Swapped to volume from: %s", opts.Source)
+	}
 
-		if !opts.NoBackup {
-			fmt.Printf("Previous data backed up to: %s\n", backupPath)
-		}
+	if !opts.NoBackup {
+		c.Info("Previous data backed up to: %s", backupPath)
 	}
 
 	return nil
 }
+
+// rollbackSource returns the most recent swap backup recorded for volumeName
+func (c *Context) rollbackSource(volumeName string) (string, error) {
+	record, err := c.DB.GetLatestBackupRecordByTag(volumeName, swapBackupTag)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up swap backups: %w", err)
+	}
+	if record == nil {
+		return "", fmt.Errorf("%w: no %s record for %s", ErrBackupNotFound, swapBackupTag, volumeName)
+	}
+	if _, err := os.Stat(record.FilePath); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrBackupNotFound, record.FilePath)
+	}
+	return record.FilePath, nil
+}
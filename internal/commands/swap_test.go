@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/volume"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+func TestRollbackSourceUsesLatestSwapBackup(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDB(filepath.Join(dir, "meta.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c := &Context{DB: db}
+
+	if _, err := c.rollbackSource("app_data"); !errors.Is(err, ErrBackupNotFound) {
+		t.Fatalf("expected ErrBackupNotFound before any swap, got %v", err)
+	}
+
+	now := time.Now()
+	first := writeBackup(t, dir, "app_data_swap_backup_2024-01-01_000000.tar.gz", now.Add(-time.Hour))
+	second := writeBackup(t, dir, "app_data_swap_backup_2024-01-02_000000.tar.gz", now)
+	manual := writeBackup(t, dir, "app_data_2024-01-03_000000.tar.gz", now)
+
+	// Two swaps, followed by a regular backup
+	for _, rec := range []*database.BackupRecord{
+		{VolumeName: "app_data", FilePath: first, Tag: swapBackupTag},
+		{VolumeName: "app_data", FilePath: second, Tag: swapBackupTag},
+		{VolumeName: "app_data", FilePath: manual},
+	} {
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	got, err := c.rollbackSource("app_data")
+	if err != nil {
+		t.Fatalf("rollback lookup failed: %v", err)
+	}
+	if got != second {
+		t.Fatalf("expected %s, got %s", second, got)
+	}
+}
+
+func TestRollbackSourceRequiresBackupFile(t *testing.T) {
+	dir := t.TempDir()
+	db, err := database.NewDB(filepath.Join(dir, "meta.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c := &Context{DB: db}
+
+	missing := filepath.Join(dir, "app_data_swap_backup_2024-01-01_000000.tar.gz")
+	if err := db.AddBackupRecord(&database.BackupRecord{VolumeName: "app_data", FilePath: missing, Tag: swapBackupTag}); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	if _, err := c.rollbackSource("app_data"); !errors.Is(err, ErrBackupNotFound) {
+		t.Fatalf("expected ErrBackupNotFound for missing file, got %v", err)
+	}
+}
+
+func TestSwapRecreatesVolumeWithDriverOptionsAndLabels(t *testing.T) {
+	source := volume.Volume{
+		Name:    "app_data",
+		Driver:  "local",
+		Options: map[string]string{"type": "nfs", "o": "addr=10.0.0.1,rw", "device": ":/exports/app"},
+		Labels:  map[string]string{"com.docker.compose.project": "app", "com.docker.compose.volume": "data"},
+	}
+	daemon := &fakeDaemon{
+		volumes: map[string]bool{"app_data": true},
+		specs:   map[string]volume.Volume{"app_data": source},
+	}
+	c, _ := newDockerTestContext(t, daemon)
+
+	if err := c.Swap(SwapOptions{Service: "app_data", Empty: true, NoBackup: true}); err != nil {
+		t.Fatalf("swap failed: %v", err)
+	}
+
+	if len(daemon.removed) != 1 || len(daemon.created) != 1 {
+		t.Fatalf("expected the volume to be removed and recreated, removed %v, created %+v", daemon.removed, daemon.created)
+	}
+	got := daemon.created[0]
+	if got.Name != "app_data" || got.Driver != "local" || got.DriverOpts["device"] != ":/exports/app" || len(got.DriverOpts) != 3 {
+		t.Fatalf("expected driver and options to be preserved, got %+v", got)
+	}
+	if got.Labels["com.docker.compose.project"] != "app" || len(got.Labels) != 2 {
+		t.Fatalf("expected labels to be preserved, got %+v", got.Labels)
+	}
+}
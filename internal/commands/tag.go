@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+// TagOptions contains options for tag command
+type TagOptions struct {
+	Service   string
+	Tags      []string // tags to add
+	Replace   bool     // replace the existing tags with Tags, none to clear them
+	BackupIDs []int    // backups to tag, empty for the latest backup of Service
+}
+
+// Tag adds tags to the latest backup of a service, or to the given backups
+// of it. Existing tags, such as swap-backup which swap --rollback looks for,
+// are kept unless opts.Replace is set. Backups with a tag listed in
+// protected_tags are never removed by retention.
+func (c *Context) Tag(opts TagOptions) error {
+	for _, tag := range opts.Tags {
+		if err := database.ValidateTag(tag); err != nil {
+			return err
+		}
+	}
+	if !opts.Replace && database.JoinTags(opts.Tags) == "" {
+		return fmt.Errorf("no tags to add")
+	}
+
+	// Unknown names are tried as volume names directly
+	volumeName, err := c.resolveVolumeNameOrSelf(opts.Service)
+	if err != nil {
+		return err
+	}
+
+	records, err := c.tagTargets(volumeName, opts.BackupIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		tags := database.JoinTags(opts.Tags)
+		if !opts.Replace {
+			tags = database.JoinTags(append(record.Tags(), opts.Tags...))
+		}
+		if err := c.DB.SetBackupTag(record.ID, tags); err != nil {
+			return fmt.Errorf("failed to tag backup #%d: %w", record.ID, err)
+		}
+		if tags == "" {
+			c.Info("✓ Cleared tags of %s", record.FilePath)
+		} else {
+			c.Info("✓ Tagged %s as %s", record.FilePath, tags)
+		}
+	}
+
+	for _, tag := range opts.Tags {
+		if c.isProtectedTag(tag) {
+			c.Info("Backups tagged %s are kept by retention", tag)
+		}
+	}
+	return nil
+}
+
+// tagTargets looks up the backups of volumeName with the given IDs, or its
+// latest backup if ids is empty. Every ID must belong to the volume.
+func (c *Context) tagTargets(volumeName string, ids []int) ([]*database.BackupRecord, error) {
+	if len(ids) == 0 {
+		records, err := c.DB.GetBackupRecords(volumeName, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("%w: no backups of %s", ErrBackupNotFound, volumeName)
+		}
+		return records, nil
+	}
+
+	var records []*database.BackupRecord
+	for _, id := range ids {
+		record, err := c.DB.GetBackupRecordByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil || record.VolumeName != volumeName {
+			return nil, fmt.Errorf("%w: no backup #%d of %s", ErrBackupNotFound, id, volumeName)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// isProtectedTag reports whether tag is listed in protected_tags
+func (c *Context) isProtectedTag(tag string) bool {
+	for _, protected := range c.Config.Defaults.ProtectedTags {
+		if protected == tag {
+			return true
+		}
+	}
+	return false
+}
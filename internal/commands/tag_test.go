@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+)
+
+func TestTagProtectsBackupsFromPrune(t *testing.T) {
+	c, dir := newTestContext(t)
+	c.Config = config.DefaultConfig()
+	c.Config.Defaults.KeepGenerations = 1
+	c.Out = io.Discard
+	c.Err = io.Discard
+
+	var records []*database.BackupRecord
+	for i, name := range []string{
+		"app_data_2024-01-01_000000Z.tar.gz",
+		"app_data_2024-01-02_000000Z.tar.gz",
+		"app_data_2024-01-03_000000Z.tar.gz",
+	} {
+		rec := &database.BackupRecord{VolumeName: "app_data", FilePath: writeBackup(t, dir, name, time.Now().Add(time.Duration(i)*time.Minute))}
+		if err := c.DB.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+		records = append(records, rec)
+	}
+
+	if err := c.Tag(TagOptions{Service: "app_data", Tags: []string{"nightly", "keep-forever"}, BackupIDs: []int{records[0].ID}}); err != nil {
+		t.Fatalf("tag failed: %v", err)
+	}
+	if err := c.Tag(TagOptions{Service: "app_data", Tags: []string{"latest"}}); err != nil {
+		t.Fatalf("tag failed: %v", err)
+	}
+	if latest, err := c.DB.GetBackupRecordByID(records[2].ID); err != nil || latest.Tag != "latest" {
+		t.Fatalf("expected the latest backup to be tagged, got %+v, %v", latest, err)
+	}
+
+	err := c.Tag(TagOptions{Service: "other_data", Tags: []string{"keep-forever"}, BackupIDs: []int{records[1].ID}})
+	if !errors.Is(err, ErrBackupNotFound) {
+		t.Fatalf("expected ErrBackupNotFound for a backup of another volume, got %v", err)
+	}
+
+	if err := c.Prune(PruneOptions{Force: true}); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if _, err := os.Stat(records[0].FilePath); err != nil {
+		t.Fatalf("expected protected backup to survive: %v", err)
+	}
+	if _, err := os.Stat(records[1].FilePath); !os.IsNotExist(err) {
+		t.Fatalf("expected unprotected backup to be removed, got %v", err)
+	}
+	left, err := c.DB.GetBackupRecords("app_data", 0)
+	if err != nil || len(left) != 2 {
+		t.Fatalf("expected 2 records left, got %d, %v", len(left), err)
+	}
+}
+
+func TestTagKeepsSwapBackupForRollback(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+	c, dir := newDockerTestContext(t, daemon)
+
+	swapped := writeBackup(t, dir, "app_data_swap_backup_2024-01-01_000000.tar.gz", time.Now())
+	record := &database.BackupRecord{VolumeName: "app_data", FilePath: swapped, Tag: swapBackupTag}
+	if err := c.DB.AddBackupRecord(record); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	if err := c.Tag(TagOptions{Service: "app_data", Tags: []string{"keep-forever"}}); err != nil {
+		t.Fatalf("tag failed: %v", err)
+	}
+	got, err := c.DB.GetBackupRecordByID(record.ID)
+	if err != nil || got.Tag != "swap-backup,keep-forever" {
+		t.Fatalf("expected the tag to be added, got %+v, %v", got, err)
+	}
+
+	if err := c.Swap(SwapOptions{Service: "app_data", Rollback: true, NoBackup: true, SkipConfirm: true}); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	restored := false
+	for _, w := range daemon.workers {
+		for _, m := range w.Mounts {
+			if m.Source == filepath.Dir(swapped) {
+				restored = true
+			}
+		}
+	}
+	if !restored {
+		t.Fatalf("expected the tagged swap backup to be restored, got workers %+v", daemon.workers)
+	}
+}
+
+func TestTagReplaceAndClear(t *testing.T) {
+	c, dir := newTestContext(t)
+	c.Config = config.DefaultConfig()
+	c.Out = io.Discard
+	c.Err = io.Discard
+
+	record := &database.BackupRecord{VolumeName: "app_data", FilePath: writeBackup(t, dir, "app_data_2024-01-01_000000Z.tar.gz", time.Now()), Tag: "nightly"}
+	if err := c.DB.AddBackupRecord(record); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    TagOptions
+		want    string
+		wantErr bool
+	}{
+		{name: "add", opts: TagOptions{Tags: []string{"prod", "nightly"}}, want: "nightly,prod"},
+		{name: "replace", opts: TagOptions{Tags: []string{"keep-forever"}, Replace: true}, want: "keep-forever"},
+		{name: "nothingToAdd", opts: TagOptions{Tags: []string{""}}, want: "keep-forever", wantErr: true},
+		{name: "clear", opts: TagOptions{Replace: true}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Service = "app_data"
+			if err := c.Tag(tt.opts); (err != nil) != tt.wantErr {
+				t.Fatalf("tag error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, err := c.DB.GetBackupRecordByID(record.ID)
+			if err != nil || got.Tag != tt.want {
+				t.Fatalf("expected tags %q, got %+v, %v", tt.want, got, err)
+			}
+		})
+	}
+}
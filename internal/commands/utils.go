@@ -1,15 +1,41 @@
 package commands
 
 import (
+	"bufio"
+	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
 )
 
+// backupFilenamePattern matches filenames produced by GenerateBackupFilename
+// or ReserveBackupPath, capturing the name that precedes the timestamp.
+// Timestamps written before zones were recorded have no zone suffix.
+var backupFilenamePattern = regexp.MustCompile(`^(.+)_\d{4}-\d{2}-\d{2}_\d{6}(Z|[+-]\d{4})?(_\d+)?(\.tar(\.gz|\.zst)?|\.tgz)?$`)
+
+// Timestamp layouts. Z0700 renders "Z" for UTC and an explicit offset such
+// as +0900 otherwise, so times stay unambiguous across zones and DST changes.
+const (
+	filenameTimeLayout = "2006-01-02_150405Z0700"
+	displayTimeLayout  = "2006-01-02 15:04:05Z07:00"
+)
+
+// backupExtensions lists the file extensions recognized as backups
+var backupExtensions = []string{".tar.gz", ".tgz", ".tar.zst", ".tar"}
+
 // FormatSize formats a size in bytes to human-readable format
 func FormatSize(bytes int64) string {
 	const unit = 1024
@@ -26,26 +52,132 @@ func FormatSize(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// FormatTimestamp formats a timestamp
-func FormatTimestamp(t time.Time) string {
+// CompressionRatio returns the size of a backup as a fraction of the size of
+// the data it holds, and false if that size is unknown
+func CompressionRatio(size, uncompressedSize int64) (float64, bool) {
+	if uncompressedSize <= 0 {
+		return 0, false
+	}
+	return float64(size) / float64(uncompressedSize), true
+}
+
+// FormatBackupSize formats the size of a backup, preceded by the size of the
+// data it holds and followed by the ratio between them when that is known,
+// as in "4.2 GB → 900.0 MB (21%)"
+func FormatBackupSize(size, uncompressedSize int64) string {
+	ratio, ok := CompressionRatio(size, uncompressedSize)
+	if !ok {
+		return FormatSize(size)
+	}
+	return fmt.Sprintf("%s → %s (%.0f%%)", FormatSize(uncompressedSize), FormatSize(size), ratio*100)
+}
+
+// inZone returns t in UTC, or in local time with utc false
+func inZone(t time.Time, utc bool) time.Time {
+	if utc {
+		return t.UTC()
+	}
+	return t.Local()
+}
+
+// FormatTimestamp formats a timestamp for display in UTC or local time,
+// with the zone offset
+func FormatTimestamp(t time.Time, utc bool) string {
 	if t.IsZero() {
 		return "-"
 	}
-	return t.Format("2006-01-02 15:04:05")
+	return inZone(t, utc).Format(displayTimeLayout)
+}
+
+// GenerateBackupFilename generates a backup filename timestamped in UTC or
+// local time, with the zone offset
+func GenerateBackupFilename(serviceName, format string, utc bool) string {
+	timestamp := inZone(time.Now(), utc).Format(filenameTimeLayout)
+	return fmt.Sprintf("%s_%s%s", serviceName, timestamp, backupExtension(format))
 }
 
-// GenerateBackupFilename generates a backup filename
-func GenerateBackupFilename(serviceName, format string) string {
-	timestamp := time.Now().Format("2006-01-02_150405")
-	extension := ".tar.gz"
+// backupExtension returns the file extension for a compress format
+func backupExtension(format string) string {
+	switch format {
+	case "tgz":
+		return ".tgz"
+	case "tar.zst":
+		return ".tar.zst"
+	case "tar":
+		return ".tar"
+	default:
+		return ".tar.gz"
+	}
+}
 
-	if format == "tar.zst" {
-		extension = ".tar.zst"
-	} else if format == "tar" {
-		extension = ".tar"
+// namedBackupFilename returns the file name given with --name for a backup
+// in format, adding the format's extension if it has none. It must be a
+// plain file name, and an extension it has must be the format's.
+func namedBackupFilename(name, format string) (string, error) {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("backup name %s must be a file name, not a path", name)
 	}
 
-	return fmt.Sprintf("%s_%s%s", serviceName, timestamp, extension)
+	ext := backupExtension(format)
+	switch {
+	case name == ext:
+		return "", fmt.Errorf("backup name %s has nothing before the extension", name)
+	case strings.HasSuffix(name, ext):
+		return name, nil
+	case hasBackupExtension(name):
+		return "", fmt.Errorf("backup name %s does not match format %s (use a %s extension)", name, format, ext)
+	}
+	return name + ext, nil
+}
+
+// maxReserveAttempts bounds the numeric suffixes tried by ReserveBackupPath
+const maxReserveAttempts = 1000
+
+// ReserveBackupPath generates a backup filename for name in dir and creates
+// the file exclusively, so concurrent callers never end up sharing a path.
+// If the timestamped name is already taken, a numeric suffix is appended
+// (<name>_YYYY-MM-DD_HHMMSSZ_2.<ext>). The caller owns the returned file and
+// should remove it if the backup is not written.
+func ReserveBackupPath(dir, name, format string, utc bool) (string, error) {
+	ext := backupExtension(format)
+	base := strings.TrimSuffix(GenerateBackupFilename(name, format, utc), ext)
+
+	for i := 1; i <= maxReserveAttempts; i++ {
+		filename := base + ext
+		if i > 1 {
+			filename = fmt.Sprintf("%s_%d%s", base, i, ext)
+		}
+
+		path := filepath.Join(dir, filename)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return path, f.Close()
+	}
+
+	return "", fmt.Errorf("no free backup filename for %s in %s", base+ext, dir)
+}
+
+// ParseBackupFilename extracts the service or volume name from a backup
+// filename in the <name>_YYYY-MM-DD_HHMMSS[zone][_N].<ext> form, where zone
+// is Z, an offset such as +0900, or absent in older backups. Only the timestamp,
+// collision suffix and extension are stripped, so names containing underscores stay intact.
+func ParseBackupFilename(filename string) (string, bool) {
+	m := backupFilenamePattern.FindStringSubmatch(filename)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// fileExists reports whether a file exists at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
 
 // GetFileSize returns the size of a file
@@ -57,25 +189,101 @@ func GetFileSize(path string) (int64, error) {
 	return info.Size(), nil
 }
 
-// CalculateChecksum calculates SHA256 checksum of a file
-func CalculateChecksum(path string) (string, error) {
+// Checksum algorithms accepted by CalculateChecksum
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumXXH64  = "xxh64"
+)
+
+// CalculateChecksum calculates the checksum of a file with the given
+// algorithm and returns it as "algo:hex"
+func CalculateChecksum(path, algo string) (string, error) {
+	var h hash.Hash
+	switch algo {
+	case ChecksumSHA256:
+		h = sha256.New()
+	case ChecksumXXH64:
+		h = xxhash.New()
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	if _, err := io.Copy(h, file); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	return algo + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParseDate parses a date given on the command line: a day such as
+// 2024-01-15, meaning its start in local time (UTC if utc is set), or an
+// RFC 3339 time such as 2024-01-15T09:00:00Z
+func ParseDate(value string, utc bool) (time.Time, error) {
+	loc := time.Local
+	if utc {
+		loc = time.UTC
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD or RFC 3339)", value)
+	}
+	return t, nil
+}
+
+// ParseChecksum splits a stored checksum into its algorithm and hex digest.
+// Checksums recorded before the algorithm was stored are bare SHA256 hex.
+func ParseChecksum(checksum string) (algo, digest string) {
+	if algo, digest, ok := strings.Cut(checksum, ":"); ok {
+		return algo, digest
+	}
+	return ChecksumSHA256, checksum
+}
+
+// VerifyChecksum reports whether the file at path matches a stored checksum,
+// using the algorithm the checksum was recorded with
+func VerifyChecksum(path, checksum string) (bool, error) {
+	algo, want := ParseChecksum(checksum)
+	got, err := CalculateChecksum(path, algo)
+	if err != nil {
+		return false, err
+	}
+	_, digest := ParseChecksum(got)
+	return strings.EqualFold(digest, want), nil
+}
+
+// sameChecksum reports whether two stored checksums were calculated with the
+// same algorithm and have the same digest
+func sameChecksum(a, b string) bool {
+	algoA, digestA := ParseChecksum(a)
+	algoB, digestB := ParseChecksum(b)
+	return a != "" && b != "" && algoA == algoB && strings.EqualFold(digestA, digestB)
+}
+
+// checksum calculates the checksum of a backup file with the configured
+// algorithm, returning it along with the algorithm used. Both are empty on
+// error.
+func (c *Context) checksum(path string) (string, string, error) {
+	algo := c.Config.Defaults.ChecksumAlgo
+	sum, err := CalculateChecksum(path, algo)
+	if err != nil {
+		return "", "", err
+	}
+	return sum, algo, nil
 }
 
-// Confirm asks user for confirmation
+// Confirm asks user for confirmation. The prompt goes to stderr so that
+// stdout stays machine-readable.
 func Confirm(prompt string) bool {
-	fmt.Printf("%s [y/N]: ", prompt)
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
 	var response string
 	if _, err := fmt.Scanln(&response); err != nil {
 		// If there's an error reading input (EOF, I/O error), default to "no"
@@ -86,38 +294,156 @@ func Confirm(prompt string) bool {
 	return response == "y" || response == "yes"
 }
 
+// ConfirmName asks the user to type expected out to confirm, as kubectl
+// does before deleting. The prompt goes to stderr; anything but exactly
+// expected, no input included, declines.
+func ConfirmName(expected string) bool {
+	return confirmName(os.Stdin, os.Stderr, expected)
+}
+
+// confirmName reads a line from in after prompting on out, see ConfirmName
+func confirmName(in io.Reader, out io.Writer, expected string) bool {
+	fmt.Fprintf(out, "Type %q to confirm: ", expected)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(out, "\nFailed to read input, not confirming")
+		return false
+	}
+	if strings.TrimSpace(line) != expected {
+		fmt.Fprintln(out, "The name does not match")
+		return false
+	}
+	return true
+}
+
+// confirmDestructive confirms an operation destroying the data of volumes.
+// With require_name_confirmation configured, name must be typed out:
+// force does not skip that, only skipName (--i-know-what-im-doing) does.
+// Otherwise prompt is answered with y unless force is set.
+func (c *Context) confirmDestructive(prompt, name string, force, skipName bool) bool {
+	if c.Config != nil && c.Config.Defaults.RequireNameConfirmation {
+		return skipName || ConfirmName(name)
+	}
+	return force || Confirm(prompt)
+}
+
+// confirmationName returns the name to type out to confirm an operation on
+// volumes: the volume itself if there is one, else the project, else the
+// number of volumes
+func (c *Context) confirmationName(volumes []string) string {
+	switch {
+	case len(volumes) == 1:
+		return volumes[0]
+	case c.ProjectName != "":
+		return c.ProjectName
+	default:
+		return fmt.Sprintf("%d volumes", len(volumes))
+	}
+}
+
+// containersUsing returns the names of the containers using a volume. The
+// containers are listed once and reused until forgetContainers, so that a
+// command working on many volumes does not list them for each.
+func (c *Context) containersUsing(volumeName string) ([]string, error) {
+	if c.volumeContainers == nil {
+		users, err := c.Docker.GetVolumeContainerMap()
+		if err != nil {
+			return nil, err
+		}
+		c.volumeContainers = users
+	}
+	return c.volumeContainers[volumeName], nil
+}
+
+// forgetContainers drops the containers listed by containersUsing. Commands
+// call it as they start, so each lists containers afresh, and after
+// stopping or restarting containers.
+func (c *Context) forgetContainers() {
+	c.volumeContainers = nil
+}
+
+// dropContainers removes deleted containers from the listing kept by
+// containersUsing
+func (c *Context) dropContainers(names []string) {
+	removed := make(map[string]bool, len(names))
+	for _, name := range names {
+		removed[name] = true
+	}
+	for volumeName, users := range c.volumeContainers {
+		var kept []string
+		for _, name := range users {
+			if !removed[name] {
+				kept = append(kept, name)
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.volumeContainers, volumeName)
+		} else {
+			c.volumeContainers[volumeName] = kept
+		}
+	}
+}
+
+// promptContext returns a context for an interactive prompt that is done
+// when the context of c is cancelled or on SIGINT or SIGTERM. Call stop once
+// the prompt is answered to restore the default signal handling.
+func (c *Context) promptContext() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(c.runContext(), os.Interrupt, syscall.SIGTERM)
+}
+
+// runContext returns the context commands run under, see Options.Context
+func (c *Context) runContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// readInput reads a word of input from in like fmt.Fscanln, failing with
+// ErrCancelled as soon as ctx is done. A read already blocked on in cannot
+// be interrupted and is left to finish in the background.
+func readInput(ctx context.Context, in io.Reader) (string, error) {
+	type result struct {
+		input string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var input string
+		_, err := fmt.Fscanln(in, &input)
+		done <- result{input, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.input, r.err
+	case <-ctx.Done():
+		return "", ErrCancelled
+	}
+}
+
 // FindBackupFile finds the latest backup file for any of the given names.
 // This supports both service names and full volume names to stay compatible
-// with how backup files are generated.
+// with how backup files are generated. Backups of every supported format are
+// considered together and the newest by modification time wins.
 func FindBackupFile(backupDir string, names ...string) (string, error) {
-	extensions := []string{".tar.gz", ".tar.zst", ".tar"}
+	files, err := ListBackupFiles(backupDir, names...)
+	if err != nil {
+		return "", err
+	}
 
 	var latest string
 	var latestTime time.Time
 
-	for _, name := range names {
-		if name == "" {
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
 			continue
 		}
 
-		for _, ext := range extensions {
-			pattern := filepath.Join(backupDir, fmt.Sprintf("%s_*%s", name, ext))
-			matches, err := filepath.Glob(pattern)
-			if err != nil {
-				return "", err
-			}
-
-			for _, match := range matches {
-				info, err := os.Stat(match)
-				if err != nil {
-					continue
-				}
-
-				if latest == "" || info.ModTime().After(latestTime) {
-					latest = match
-					latestTime = info.ModTime()
-				}
-			}
+		if latest == "" || info.ModTime().After(latestTime) {
+			latest = file
+			latestTime = info.ModTime()
 		}
 	}
 
@@ -128,10 +454,50 @@ func FindBackupFile(backupDir string, names ...string) (string, error) {
 	return latest, nil
 }
 
+// FindBackupGeneration returns the backup that is n generations older than
+// the latest one for any of the given names (0 = latest, 1 = previous, ...).
+func FindBackupGeneration(backupDir string, n int, names ...string) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("generation must not be negative, got %d", n)
+	}
+
+	files, err := ListBackupFiles(backupDir, names...)
+	if err != nil {
+		return "", err
+	}
+
+	type backupFile struct {
+		path    string
+		modTime time.Time
+	}
+
+	var backups []backupFile
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: file, modTime: info.ModTime()})
+	}
+
+	if len(backups) == 0 {
+		return "", ErrBackupNotFound
+	}
+
+	// Newest first
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+
+	if n >= len(backups) {
+		return "", fmt.Errorf("generation %d out of range: only %d backup(s) available", n, len(backups))
+	}
+
+	return backups[n].path, nil
+}
+
 // ListBackupFiles lists all backup files for any of the given names
 func ListBackupFiles(backupDir string, names ...string) ([]string, error) {
-	extensions := []string{".tar.gz", ".tar.zst", ".tar"}
-
 	var all []string
 	seen := make(map[string]bool)
 
@@ -140,7 +506,7 @@ func ListBackupFiles(backupDir string, names ...string) ([]string, error) {
 			continue
 		}
 
-		for _, ext := range extensions {
+		for _, ext := range backupExtensions {
 			pattern := filepath.Join(backupDir, fmt.Sprintf("%s_*%s", name, ext))
 			matches, err := filepath.Glob(pattern)
 			if err != nil {
@@ -160,6 +526,64 @@ func ListBackupFiles(backupDir string, names ...string) ([]string, error) {
 	return all, nil
 }
 
+// openOutput returns a writer for command output. An empty path or "-"
+// selects c.Out; any other path is created or truncated. The returned close
+// function must be called once writing is complete.
+func (c *Context) openOutput(path string) (io.Writer, func() error, error) {
+	if path == "" || path == "-" {
+		return c.Out, func() error { return nil }, nil
+	}
+
+	path, err := config.ResolvePath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// sanitizeOutputDir validates an output directory given by the user. A path
+// with ".." components is always rejected and a leading "~" is expanded.
+// Unless allowOutside is set, a relative dir is taken relative to root and
+// an absolute one must lie inside root; with allowOutside a relative dir is
+// taken relative to the working directory. An empty dir is returned
+// unchanged, so the caller's default applies.
+func sanitizeOutputDir(dir, root string, allowOutside bool) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	dir, err := config.ExpandHome(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("output directory %s must not contain ..", dir)
+		}
+	}
+
+	if allowOutside {
+		return filepath.Abs(dir)
+	}
+	if !filepath.IsAbs(dir) {
+		return filepath.Join(root, dir), nil
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, filepath.Clean(dir))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("output directory %s is outside %s (use --allow-outside to write there)", dir, root)
+	}
+	return filepath.Clean(dir), nil
+}
+
 // EnsureDirectory ensures a directory exists
 func EnsureDirectory(path string) error {
 	return os.MkdirAll(path, 0755)
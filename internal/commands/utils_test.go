@@ -0,0 +1,457 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+)
+
+// writeBackup creates an empty backup file in dir with the given modification time.
+func writeBackup(t *testing.T, dir, name string, mtime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("failed to write backup file: %v", err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+	return path
+}
+
+func TestBackupDiscoveryAllFormats(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+
+	files := []string{
+		writeBackup(t, dir, "db_2024-01-01_000000.tar", base),
+		writeBackup(t, dir, "db_2024-01-02_000000.tgz", base.Add(time.Minute)),
+		writeBackup(t, dir, "db_2024-01-03_000000.tar.gz", base.Add(2*time.Minute)),
+		writeBackup(t, dir, "db_2024-01-04_000000.tar.zst", base.Add(3*time.Minute)),
+	}
+
+	t.Run("listFindsAll", func(t *testing.T) {
+		got, err := ListBackupFiles(dir, "db")
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		sort.Strings(got)
+		want := append([]string(nil), files...)
+		sort.Strings(want)
+		if len(got) != len(want) {
+			t.Fatalf("expected %d backups, got %v", len(want), got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+	})
+
+	t.Run("findSelectsNewest", func(t *testing.T) {
+		got, err := FindBackupFile(dir, "db")
+		if err != nil {
+			t.Fatalf("find failed: %v", err)
+		}
+		if got != files[3] {
+			t.Fatalf("expected %s, got %s", files[3], got)
+		}
+	})
+
+	t.Run("findSelectsNewestUncompressed", func(t *testing.T) {
+		newest := writeBackup(t, dir, "db_2024-01-05_000000.tar", base.Add(4*time.Minute))
+		got, err := FindBackupFile(dir, "db")
+		if err != nil {
+			t.Fatalf("find failed: %v", err)
+		}
+		if got != newest {
+			t.Fatalf("expected %s, got %s", newest, got)
+		}
+	})
+}
+
+func TestFindBackupFilePrefersNewestAcrossFormats(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeBackup(t, dir, "db_2024-01-01_000000.tar.gz", now.Add(-2*time.Hour))
+	zst := writeBackup(t, dir, "db_2024-01-02_000000.tar.zst", now.Add(-time.Hour))
+
+	got, err := FindBackupFile(dir, "db")
+	if err != nil {
+		t.Fatalf("find failed: %v", err)
+	}
+	if got != zst {
+		t.Fatalf("expected newer zstd backup %s, got %s", zst, got)
+	}
+}
+
+func TestParseBackupFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+		ok       bool
+	}{
+		{"my_service_2024-01-02_150405.tar.gz", "my_service", true},
+		{"db_2024-01-02_150405.tar.zst", "db", true},
+		{"myproject_postgres_data_2024-01-02_150405.tar", "myproject_postgres_data", true},
+		{"db_2024-01-02_150405.tgz", "db", true},
+		{"app_data_swap_backup_2024-01-02_150405_2.tar.gz", "app_data_swap_backup", true},
+		{"db_2024-01-02_150405Z.tar.gz", "db", true},
+		{"db_2024-01-02_150405+0900.tar.gz", "db", true},
+		{"app_data_swap_backup_2024-01-02_150405-0500_2.tar.gz", "app_data_swap_backup", true},
+		{"db_2024-01-02_150405+09.tar.gz", "", false},
+		{"db_20240102_150405.tar.gz", "", false},
+		{"backup.tar.gz", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseBackupFilename(tt.filename)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseBackupFilename(%q) = %q, %v; want %q, %v", tt.filename, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSanitizeOutputDir(t *testing.T) {
+	root := "/srv/dvm/backups"
+	t.Setenv("HOME", "/home/me")
+	wd := t.TempDir()
+	t.Chdir(wd)
+	tests := []struct {
+		name         string
+		dir          string
+		allowOutside bool
+		want         string
+		ok           bool
+	}{
+		{name: "empty", dir: "", want: "", ok: true},
+		{name: "relativeUnderRoot", dir: "nightly/db", want: "/srv/dvm/backups/nightly/db", ok: true},
+		{name: "absoluteUnderRoot", dir: "/srv/dvm/backups/nightly/", want: "/srv/dvm/backups/nightly", ok: true},
+		{name: "rootItself", dir: "/srv/dvm/backups", want: "/srv/dvm/backups", ok: true},
+		{name: "absoluteOutside", dir: "/etc", ok: false},
+		{name: "siblingWithRootPrefix", dir: "/srv/dvm/backups-old", ok: false},
+		{name: "relativeTraversal", dir: "../../etc", ok: false},
+		{name: "nestedTraversal", dir: "nightly/../../etc", ok: false},
+		{name: "absoluteTraversal", dir: "/srv/dvm/backups/../../../etc", ok: false},
+		{name: "traversalAllowedOutside", dir: "../backups", allowOutside: true, ok: false},
+		{name: "absoluteAllowedOutside", dir: "/mnt/usb/", allowOutside: true, want: "/mnt/usb", ok: true},
+		{name: "relativeAllowedOutside", dir: "out", allowOutside: true, want: filepath.Join(wd, "out"), ok: true},
+		{name: "homeOutside", dir: "~/backups", ok: false},
+		{name: "homeAllowedOutside", dir: "~/backups", allowOutside: true, want: "/home/me/backups", ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeOutputDir(tt.dir, root, tt.allowOutside)
+			if (err == nil) != tt.ok {
+				t.Fatalf("sanitizeOutputDir(%q) error = %v, want ok %v", tt.dir, err, tt.ok)
+			}
+			if got != tt.want {
+				t.Fatalf("sanitizeOutputDir(%q) = %q, want %q", tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamedBackupFilename(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   string
+		ok     bool
+	}{
+		{name: "release-2024.tar.gz", format: "tar.gz", want: "release-2024.tar.gz", ok: true},
+		{name: "release-2024", format: "tar.gz", want: "release-2024.tar.gz", ok: true},
+		{name: "release-2024", format: "tar.zst", want: "release-2024.tar.zst", ok: true},
+		{name: "release-2024.tgz", format: "tgz", want: "release-2024.tgz", ok: true},
+		{name: "release-2024.tar", format: "tar", want: "release-2024.tar", ok: true},
+		{name: "release-2024.tar.gz", format: "tar", ok: false},
+		{name: "release-2024.tar", format: "tar.gz", ok: false},
+		{name: "release-2024.tgz", format: "tar.gz", ok: false},
+		{name: ".tar.gz", format: "tar.gz", ok: false},
+		{name: "../release.tar.gz", format: "tar.gz", ok: false},
+		{name: "nightly/release.tar.gz", format: "tar.gz", ok: false},
+		{name: "..", format: "tar.gz", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.format, func(t *testing.T) {
+			got, err := namedBackupFilename(tt.name, tt.format)
+			if (err == nil) != tt.ok {
+				t.Fatalf("namedBackupFilename(%q, %q) error = %v, want ok %v", tt.name, tt.format, err, tt.ok)
+			}
+			if got != tt.want {
+				t.Fatalf("namedBackupFilename(%q, %q) = %q, want %q", tt.name, tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindBackupGeneration(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	oldest := writeBackup(t, dir, "db_2024-01-01_000000.tar.gz", now.Add(-3*time.Hour))
+	middle := writeBackup(t, dir, "db_2024-01-02_000000.tar.gz", now.Add(-2*time.Hour))
+	latest := writeBackup(t, dir, "db_2024-01-03_000000.tar.gz", now.Add(-time.Hour))
+
+	for n, want := range []string{latest, middle, oldest} {
+		got, err := FindBackupGeneration(dir, n, "db")
+		if err != nil {
+			t.Fatalf("generation %d: %v", n, err)
+		}
+		if got != want {
+			t.Fatalf("generation %d: expected %s, got %s", n, want, got)
+		}
+	}
+
+	if _, err := FindBackupGeneration(dir, 3, "db"); err == nil {
+		t.Fatalf("expected error for out-of-range generation")
+	}
+	if _, err := FindBackupGeneration(dir, -1, "db"); err == nil {
+		t.Fatalf("expected error for negative generation")
+	}
+}
+
+func TestBindBackupFilenameRoundTrip(t *testing.T) {
+	name := "web_bind_usr_share_nginx_html"
+	for _, format := range []string{"tar.gz", "tar.zst", "tar"} {
+		got, ok := ParseBackupFilename(GenerateBackupFilename(name, format, false))
+		if !ok || got != name {
+			t.Fatalf("format %s: expected %s, got %q (ok=%v)", format, name, got, ok)
+		}
+	}
+}
+
+func TestGenerateBackupFilenameZones(t *testing.T) {
+	utcName := GenerateBackupFilename("db", "tar.gz", true)
+	if !regexp.MustCompile(`^db_\d{4}-\d{2}-\d{2}_\d{6}Z\.tar\.gz$`).MatchString(utcName) {
+		t.Fatalf("expected a UTC timestamp ending in Z, got %s", utcName)
+	}
+
+	localName := GenerateBackupFilename("db", "tar.gz", false)
+	if !regexp.MustCompile(`^db_\d{4}-\d{2}-\d{2}_\d{6}(Z|[+-]\d{4})\.tar\.gz$`).MatchString(localName) {
+		t.Fatalf("expected a local timestamp with an offset, got %s", localName)
+	}
+
+	for _, name := range []string{utcName, localName} {
+		if got, ok := ParseBackupFilename(name); !ok || got != "db" {
+			t.Fatalf("expected %s to parse back to db, got %q (ok=%v)", name, got, ok)
+		}
+	}
+}
+
+func TestFormatBackupSize(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		size, uncompressed int64
+		wantRatio          float64
+		wantOK             bool
+		want               string
+	}{
+		{900 * mb, 4300 * mb, 900.0 / 4300, true, "4.2 GB → 900.0 MB (21%)"},
+		{512, 1024, 0.5, true, "1.0 KB → 512 B (50%)"},
+		{2048, 1024, 2, true, "1.0 KB → 2.0 KB (200%)"},
+		{900 * mb, 0, 0, false, "900.0 MB"},
+	}
+	for _, tt := range tests {
+		ratio, ok := CompressionRatio(tt.size, tt.uncompressed)
+		if ok != tt.wantOK || ratio != tt.wantRatio {
+			t.Errorf("CompressionRatio(%d, %d) = %v, %v; expected %v, %v", tt.size, tt.uncompressed, ratio, ok, tt.wantRatio, tt.wantOK)
+		}
+		if got := FormatBackupSize(tt.size, tt.uncompressed); got != tt.want {
+			t.Errorf("FormatBackupSize(%d, %d) = %q; expected %q", tt.size, tt.uncompressed, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTimestampZones(t *testing.T) {
+	zone := time.FixedZone("JST", 9*60*60)
+	ts := time.Date(2024, 3, 10, 2, 30, 0, 0, zone)
+
+	if got := FormatTimestamp(ts, true); got != "2024-03-09 17:30:00Z" {
+		t.Fatalf("expected UTC display, got %s", got)
+	}
+	if got, want := FormatTimestamp(ts, false), ts.Local().Format("2006-01-02 15:04:05Z07:00"); got != want {
+		t.Fatalf("expected local display %s, got %s", want, got)
+	}
+	if got := FormatTimestamp(time.Time{}, true); got != "-" {
+		t.Fatalf("expected - for zero time, got %s", got)
+	}
+}
+
+func TestReserveBackupPathIsUnique(t *testing.T) {
+	dir := t.TempDir()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		path, err := ReserveBackupPath(dir, "app_data_swap_backup", "tar.gz", false)
+		if err != nil {
+			t.Fatalf("reserve failed: %v", err)
+		}
+		if seen[path] {
+			t.Fatalf("path %s was reserved twice", path)
+		}
+		seen[path] = true
+
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("reserved path was not created: %v", err)
+		}
+		if name, ok := ParseBackupFilename(filepath.Base(path)); !ok || name != "app_data_swap_backup" {
+			t.Fatalf("reserved filename %s does not parse back (got %q, %v)", path, name, ok)
+		}
+	}
+
+	files, err := ListBackupFiles(dir, "app_data_swap_backup")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(files) != len(seen) {
+		t.Fatalf("expected %d backups to be discoverable, got %v", len(seen), files)
+	}
+}
+
+func TestChecksumRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_2024-01-01_000000.tar.gz")
+	if err := os.WriteFile(path, []byte("backup contents"), 0o644); err != nil {
+		t.Fatalf("failed to write backup file: %v", err)
+	}
+
+	for _, algo := range []string{ChecksumSHA256, ChecksumXXH64} {
+		t.Run(algo, func(t *testing.T) {
+			sum, err := CalculateChecksum(path, algo)
+			if err != nil {
+				t.Fatalf("checksum failed: %v", err)
+			}
+			if gotAlgo, digest := ParseChecksum(sum); gotAlgo != algo || digest == "" {
+				t.Fatalf("expected %s:<hex>, got %q", algo, sum)
+			}
+
+			ok, err := VerifyChecksum(path, sum)
+			if err != nil || !ok {
+				t.Fatalf("expected checksum to verify, got %v, %v", ok, err)
+			}
+
+			other := filepath.Join(filepath.Dir(path), "other.tar.gz")
+			if err := os.WriteFile(other, []byte("different contents"), 0o644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			if ok, err := VerifyChecksum(other, sum); err != nil || ok {
+				t.Fatalf("expected mismatch for different contents, got %v, %v", ok, err)
+			}
+		})
+	}
+
+	t.Run("legacyBareHex", func(t *testing.T) {
+		// Checksums recorded before the algorithm prefix are plain SHA256
+		sum := sha256.Sum256([]byte("backup contents"))
+		legacy := hex.EncodeToString(sum[:])
+
+		ok, err := VerifyChecksum(path, legacy)
+		if err != nil || !ok {
+			t.Fatalf("expected legacy checksum to verify as sha256, got %v, %v", ok, err)
+		}
+	})
+
+	t.Run("unsupportedAlgo", func(t *testing.T) {
+		if _, err := CalculateChecksum(path, "md5"); err == nil {
+			t.Fatalf("expected error for unsupported algorithm")
+		}
+		if _, err := VerifyChecksum(path, "md5:abc"); err == nil {
+			t.Fatalf("expected error verifying unsupported algorithm")
+		}
+	})
+}
+
+func TestConfirmName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"typedName", "myproject_db_data\n", true},
+		{"surroundingSpace", "  myproject_db_data \r\n", true},
+		{"noNewline", "myproject_db_data", true},
+		{"otherName", "myproject_db\n", false},
+		{"yes", "y\n", false},
+		{"caseDiffers", "MYPROJECT_DB_DATA\n", false},
+		{"noInput", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prompt bytes.Buffer
+			if got := confirmName(strings.NewReader(tt.input), &prompt, "myproject_db_data"); got != tt.want {
+				t.Fatalf("confirmName(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if !strings.HasPrefix(prompt.String(), `Type "myproject_db_data" to confirm: `) {
+				t.Fatalf("unexpected prompt %q", prompt.String())
+			}
+		})
+	}
+}
+
+func TestConfirmDestructiveWithoutPrompting(t *testing.T) {
+	c := &Context{Config: config.DefaultConfig()}
+
+	// Neither case reads input, which would fail and decline
+	if !c.confirmDestructive("Continue?", "db", true, false) {
+		t.Fatal("expected --force to confirm without require_name_confirmation")
+	}
+	c.Config.Defaults.RequireNameConfirmation = true
+	if !c.confirmDestructive("Continue?", "db", false, true) {
+		t.Fatal("expected --i-know-what-im-doing to skip typing the name")
+	}
+}
+
+func TestConfirmationName(t *testing.T) {
+	c := &Context{ProjectName: "myproject"}
+	if got := c.confirmationName([]string{"myproject_db"}); got != "myproject_db" {
+		t.Fatalf("expected the volume name, got %q", got)
+	}
+	if got := c.confirmationName([]string{"myproject_db", "myproject_cache"}); got != "myproject" {
+		t.Fatalf("expected the project name, got %q", got)
+	}
+	c.ProjectName = ""
+	if got := c.confirmationName([]string{"a", "b"}); got != "2 volumes" {
+		t.Fatalf("expected the volume count, got %q", got)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		utc     bool
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2024-01-15", utc: true, want: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-15", want: time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)},
+		{value: "2024-01-15T09:00:00+09:00", want: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{value: "15/01/2024", wantErr: true},
+		{value: "2024-13-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDate(tt.value, tt.utc)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDate(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q, %v) = %v, %v, want %v", tt.value, tt.utc, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// volumeState is what watch mode compares between polls to notice that a
+// volume changed
+type volumeState struct {
+	Size     int64  // disk usage in bytes, -1 if the driver does not report it
+	Checksum string // checksum of the file listing, "" if it could not be taken
+}
+
+// volumeChanged reports whether a volume changed between two polls. The
+// checksum is compared when both polls have one, since it also catches
+// edits that keep the size; otherwise the sizes are. With neither
+// available the change cannot be ruled out, so the volume counts as changed.
+func volumeChanged(prev, cur volumeState) bool {
+	if prev.Checksum != "" && cur.Checksum != "" {
+		return prev.Checksum != cur.Checksum
+	}
+	if prev.Size >= 0 && cur.Size >= 0 {
+		return prev.Size != cur.Size
+	}
+	return true
+}
+
+// probeVolume takes the current state of a volume for watch mode
+func (c *Context) probeVolume(volumeName string) volumeState {
+	state := volumeState{Size: -1}
+	if size, err := c.Docker.GetVolumeSize(volumeName); err == nil {
+		state.Size = size
+	}
+	if checksum, err := c.Docker.VolumeChecksum(volumeName); err == nil {
+		state.Checksum = checksum
+	} else {
+		c.Debug("could not checksum %s: %v", volumeName, err)
+	}
+	return state
+}
+
+// watch backs up volumes into outputDir once, then again whenever a poll
+// every opts.Interval finds them changed, until SIGINT or SIGTERM or until
+// the context of c is done. A backup in progress is finished before
+// returning on a signal.
+func (c *Context) watch(volumes []string, outputDir string, opts BackupOptions, s *Summary) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	c.watchVolumes(volumes, outputDir, opts, s, c.probeVolume, stop)
+}
+
+// watchVolumes runs the watch loop, taking volume states with probe and
+// returning once stop receives a value or the context of c is done
+func (c *Context) watchVolumes(volumes []string, outputDir string, opts BackupOptions, s *Summary, probe func(string) volumeState, stop <-chan os.Signal) {
+	// State of each volume at its last successful backup
+	backedUp := make(map[string]volumeState)
+
+	poll := func() {
+		for _, volumeName := range volumes {
+			state := probe(volumeName)
+			if prev, ok := backedUp[volumeName]; ok && !volumeChanged(prev, state) {
+				c.Debug("%s unchanged", volumeName)
+				continue
+			}
+
+			failed := s.Failed
+			c.backupVolumes([]string{volumeName}, outputDir, opts, s)
+			if s.Failed == failed {
+				backedUp[volumeName] = state
+			}
+		}
+	}
+
+	c.Info("Watching %s every %s (Ctrl+C to stop)", strings.Join(volumes, ", "), opts.Interval)
+	poll()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			c.Info("Stopped watching")
+			return
+		case <-c.runContext().Done():
+			c.Info("Stopped watching")
+			return
+		case <-ticker.C:
+			poll()
+		}
+	}
+}
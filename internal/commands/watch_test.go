@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVolumeChanged(t *testing.T) {
+	tests := []struct {
+		name string
+		prev volumeState
+		cur  volumeState
+		want bool
+	}{
+		{"sameChecksum", volumeState{Size: 10, Checksum: "a"}, volumeState{Size: 10, Checksum: "a"}, false},
+		{"checksumChangedSameSize", volumeState{Size: 10, Checksum: "a"}, volumeState{Size: 10, Checksum: "b"}, true},
+		{"sizeOnlyUnchanged", volumeState{Size: 10}, volumeState{Size: 10}, false},
+		{"sizeOnlyChanged", volumeState{Size: 10}, volumeState{Size: 12}, true},
+		{"checksumLostFallsBackToSize", volumeState{Size: 10, Checksum: "a"}, volumeState{Size: 10}, false},
+		{"noSignals", volumeState{Size: -1}, volumeState{Size: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := volumeChanged(tt.prev, tt.cur); got != tt.want {
+				t.Fatalf("volumeChanged(%+v, %+v) = %v, want %v", tt.prev, tt.cur, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchBacksUpOnlyOnChange(t *testing.T) {
+	tests := []struct {
+		name        string
+		states      []volumeState
+		wantBackups int
+	}{
+		{
+			name:        "unchanged",
+			states:      []volumeState{{Size: 10, Checksum: "a"}, {Size: 10, Checksum: "a"}, {Size: 10, Checksum: "a"}},
+			wantBackups: 1,
+		},
+		{
+			name:        "editKeepingSize",
+			states:      []volumeState{{Size: 10, Checksum: "a"}, {Size: 10, Checksum: "a"}, {Size: 10, Checksum: "b"}, {Size: 10, Checksum: "b"}},
+			wantBackups: 2,
+		},
+		{
+			name:        "growingWithoutChecksum",
+			states:      []volumeState{{Size: 10}, {Size: 20}, {Size: 20}, {Size: 30}},
+			wantBackups: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+			c, dir := newDockerTestContext(t, daemon)
+			outputDir := filepath.Join(dir, "backups")
+			if err := EnsureDirectory(outputDir); err != nil {
+				t.Fatalf("failed to create output directory: %v", err)
+			}
+
+			// Replay the states, then stop; polls racing the stop see the
+			// last state again
+			stop := make(chan os.Signal, 1)
+			polls := 0
+			probe := func(string) volumeState {
+				state := tt.states[min(polls, len(tt.states)-1)]
+				polls++
+				if polls == len(tt.states) {
+					stop <- os.Interrupt
+				}
+				return state
+			}
+
+			s := newSummary("backup")
+			c.watchVolumes([]string{"app_data"}, outputDir, BackupOptions{Interval: time.Millisecond}, s, probe, stop)
+
+			if len(daemon.workers) != tt.wantBackups || s.OK != tt.wantBackups {
+				t.Fatalf("expected %d backups, got %d workers and %+v", tt.wantBackups, len(daemon.workers), s)
+			}
+		})
+	}
+}
+
+func TestWatchRejectsShortInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second, 500 * time.Millisecond} {
+		daemon := &fakeDaemon{volumes: map[string]bool{"app_data": true}}
+		c, _ := newDockerTestContext(t, daemon)
+
+		err := c.Backup(BackupOptions{Services: []string{"app_data"}, Watch: true, Interval: interval})
+		if err == nil || !strings.Contains(err.Error(), "--interval") {
+			t.Fatalf("interval %s: expected an --interval error, got %v", interval, err)
+		}
+		if len(daemon.workers) != 0 {
+			t.Fatalf("interval %s: expected no backup, got %d workers", interval, len(daemon.workers))
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -146,22 +148,99 @@ type ComposeFile struct {
 	Services map[string]Service     `yaml:"services"`
 	Volumes  map[string]interface{} `yaml:"volumes,omitempty"`
 	path     string
+	dir      string // project directory overriding the compose file's directory
 }
 
+// Environment variables Compose uses to locate the project
+const (
+	EnvComposeFile             = "COMPOSE_FILE"
+	EnvComposePathSeparator    = "COMPOSE_PATH_SEPARATOR"
+	EnvComposeProjectDirectory = "COMPOSE_PROJECT_DIRECTORY"
+	EnvComposeProfiles         = "COMPOSE_PROFILES"
+)
+
+// AllProfiles activates every profile, like `docker compose --profile "*"`
+var AllProfiles = []string{"*"}
+
 // Service represents a service in compose file
 type Service struct {
-	Image   string        `yaml:"image,omitempty"`
-	Volumes []interface{} `yaml:"volumes,omitempty"`
+	Image    string        `yaml:"image,omitempty"`
+	Profiles []string      `yaml:"profiles,omitempty"`
+	Volumes  []interface{} `yaml:"volumes,omitempty"`
+}
+
+// Enabled reports whether the service runs with activeProfiles: services
+// without profiles always do, others need one of their profiles active
+func (s Service) Enabled(activeProfiles []string) bool {
+	if len(s.Profiles) == 0 {
+		return true
+	}
+	for _, active := range activeProfiles {
+		if active == "*" {
+			return true
+		}
+		for _, profile := range s.Profiles {
+			if profile == active {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // VolumeMapping represents a parsed volume mapping
 type VolumeMapping struct {
-	VolumeName string
+	VolumeName string // named volume, or absolute host path for bind mounts
 	MountPath  string
 	Service    string
+	IsBind     bool
+	ReadOnly   bool // mounted with :ro or read_only: true
+}
+
+// VolumeConfig is the top-level definition of a named volume
+type VolumeConfig struct {
+	Name       string // Docker volume name set with name:, "" for the default
+	External   bool   // created outside Compose, so used under its own name
+	Driver     string
+	DriverOpts map[string]string
+}
+
+// networkFSTypes are the local driver mount types that keep data on a
+// remote server
+var networkFSTypes = map[string]bool{
+	"nfs":  true,
+	"nfs4": true,
+	"cifs": true,
+	"smb":  true,
+}
+
+// NetworkType returns the filesystem type of a volume whose data lives on a
+// remote server, such as "nfs" for a local driver volume mounting an NFS
+// export, or "" for a volume stored on the Docker host. Volumes using a
+// driver other than local are reported by driver name.
+func (v VolumeConfig) NetworkType() string {
+	if v.Driver != "" && v.Driver != "local" {
+		return v.Driver
+	}
+	if fsType := v.DriverOpts["type"]; networkFSTypes[fsType] {
+		return fsType
+	}
+	return ""
+}
+
+// bindNameSanitizer matches characters not allowed in synthetic bind names
+var bindNameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// BindName returns the synthetic name that identifies a bind mount in backup
+// filenames and records, e.g. "web_bind_var_www" for web's /var/www mount.
+func (m VolumeMapping) BindName() string {
+	target := strings.Trim(bindNameSanitizer.ReplaceAllString(m.MountPath, "_"), "_")
+	return fmt.Sprintf("%s_bind_%s", m.Service, target)
 }
 
-func normalizeProjectName(name string) string {
+// NormalizeProjectName lowercases name and drops characters Compose does not
+// allow in project names
+func NormalizeProjectName(name string) string {
 	normalized := strings.ToLower(name)
 
 	var b strings.Builder
@@ -197,8 +276,218 @@ func FindComposeFile(dir string) (string, error) {
 	return "", fmt.Errorf("compose file not found in %s", dir)
 }
 
-// LoadComposeFile loads a Docker Compose file
+// FindComposeFileUpward searches for a compose file in dir and then in each
+// parent directory up to the filesystem root, returning the first match as
+// an absolute path. This mirrors how docker compose locates the project when
+// run from a subdirectory.
+func FindComposeFileUpward(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+
+	start, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for current := start; ; {
+		if path, err := FindComposeFile(current); err == nil {
+			return path, nil
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			break
+		}
+		current = parent
+	}
+
+	return "", fmt.Errorf("compose file not found in %s or any parent directory", start)
+}
+
+// FilesFromEnv returns the compose files listed in COMPOSE_FILE, split on
+// COMPOSE_PATH_SEPARATOR or the OS path list separator (":" on Unix, ";" on
+// Windows) like Compose does. Relative entries are resolved against
+// COMPOSE_PROJECT_DIRECTORY when it is set.
+func FilesFromEnv() []string {
+	value := os.Getenv(EnvComposeFile)
+	if value == "" {
+		return nil
+	}
+
+	sep := os.Getenv(EnvComposePathSeparator)
+	if sep == "" {
+		sep = string(os.PathListSeparator)
+	}
+	projectDir := os.Getenv(EnvComposeProjectDirectory)
+
+	var files []string
+	for _, file := range strings.Split(value, sep) {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		if projectDir != "" && !filepath.IsAbs(file) {
+			file = filepath.Join(projectDir, file)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// ProfilesFromEnv returns the profiles listed in COMPOSE_PROFILES, which
+// Compose separates with commas
+func ProfilesFromEnv() []string {
+	var profiles []string
+	for _, profile := range strings.Split(os.Getenv(EnvComposeProfiles), ",") {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// LoadComposeFiles loads compose files and merges them in order, as
+// `docker compose -f a.yaml -f b.yaml` does: later files set the project
+// name, add services and volumes, and replace a service's mounts that share
+// a target path. Relative paths resolve against the first file's directory.
+func LoadComposeFiles(paths []string) (*ComposeFile, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no compose files given")
+	}
+
+	cf, err := LoadComposeFile(paths[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths[1:] {
+		// Override files may only add volumes or set the name
+		override, err := loadComposeFile(path, false)
+		if err != nil {
+			return nil, err
+		}
+		cf.merge(override)
+	}
+
+	return cf, nil
+}
+
+// merge applies other on top of cf
+func (cf *ComposeFile) merge(other *ComposeFile) {
+	if other.Name != "" {
+		cf.Name = other.Name
+	}
+
+	if cf.Services == nil {
+		cf.Services = make(map[string]Service)
+	}
+	for name, service := range other.Services {
+		existing, ok := cf.Services[name]
+		if !ok {
+			cf.Services[name] = service
+			continue
+		}
+		if service.Image != "" {
+			existing.Image = service.Image
+		}
+		if len(service.Profiles) > 0 {
+			existing.Profiles = service.Profiles
+		}
+		existing.Volumes = mergeVolumeSpecs(existing.Volumes, service.Volumes)
+		cf.Services[name] = existing
+	}
+
+	if len(other.Volumes) > 0 && cf.Volumes == nil {
+		cf.Volumes = make(map[string]interface{})
+	}
+	for name, vol := range other.Volumes {
+		cf.Volumes[name] = vol
+	}
+}
+
+// mergeVolumeSpecs appends overrides to base, replacing base entries that
+// mount the same target path
+func mergeVolumeSpecs(base, overrides []interface{}) []interface{} {
+	merged := append([]interface{}(nil), base...)
+	for _, spec := range overrides {
+		target := volumeSpecTarget(spec)
+		replaced := false
+		for i, existing := range merged {
+			if target != "" && volumeSpecTarget(existing) == target {
+				merged[i] = spec
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, spec)
+		}
+	}
+	return merged
+}
+
+// volumeSpecTarget returns the container path of a short- or long-form
+// volume entry, or "" if it has none
+func volumeSpecTarget(spec interface{}) string {
+	switch v := spec.(type) {
+	case string:
+		if parts := strings.Split(v, ":"); len(parts) >= 2 {
+			return parts[1]
+		}
+	default:
+		if fields, ok := stringMap(v); ok {
+			if target, ok := fields["target"].(string); ok {
+				return target
+			}
+		}
+	}
+	return ""
+}
+
+// stringMap returns a YAML mapping decoded into an interface{} with string
+// keys. yaml.v3 produces map[string]interface{} for most mappings but falls
+// back to map[interface{}]interface{} when a key is not a string, which can
+// happen once anchors are merged in with "<<".
+func stringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		fields := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			fields[fmt.Sprint(k)] = val
+		}
+		return fields, true
+	}
+	return nil, false
+}
+
+// SetProjectDir makes dir the project directory, used instead of the compose
+// file's directory for the default project name and relative bind paths
+func (cf *ComposeFile) SetProjectDir(dir string) {
+	cf.dir = dir
+}
+
+// projectDir returns the directory relative paths and the default project
+// name are based on
+func (cf *ComposeFile) projectDir() string {
+	if cf.dir != "" {
+		return cf.dir
+	}
+	return filepath.Dir(cf.path)
+}
+
+// LoadComposeFile loads a Docker Compose file. A file that is empty or has
+// no services section is an error; an explicitly empty one (services: {})
+// is not.
 func LoadComposeFile(path string) (*ComposeFile, error) {
+	return loadComposeFile(path, true)
+}
+
+// loadComposeFile loads a compose file, requiring a services section if
+// requireServices is set
+func loadComposeFile(path string, requireServices bool) (*ComposeFile, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -208,48 +497,191 @@ func LoadComposeFile(path string) (*ComposeFile, error) {
 	// constructs like ${VAR:-default} are resolved.
 	expanded := expandEnvVars(string(data))
 
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(expanded), &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := checkServicesNode(&doc, requireServices); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
 	var cf ComposeFile
-	if err := yaml.Unmarshal([]byte(expanded), &cf); err != nil {
-		return nil, err
+	if err := doc.Decode(&cf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
 
 	cf.path = path
 	return &cf, nil
 }
 
+// checkServicesNode checks that a parsed compose document is a mapping with
+// a services mapping, so that a structurally wrong file is reported instead
+// of decoding to a project without services
+func checkServicesNode(doc *yaml.Node, requireServices bool) error {
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		return fmt.Errorf("compose file is empty")
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: compose file must be a mapping of top-level keys such as services", root.Line)
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "services" {
+			continue
+		}
+		services := root.Content[i+1]
+		if services.Kind == yaml.AliasNode {
+			services = services.Alias
+		}
+		switch {
+		case services.Kind == yaml.MappingNode:
+			return nil
+		case services.Kind == yaml.ScalarNode && services.Tag == "!!null":
+			if !requireServices {
+				return nil
+			}
+			return fmt.Errorf("line %d: services is empty (use services: {} for a project without services)", root.Content[i].Line)
+		default:
+			return fmt.Errorf("line %d: services must be a mapping of service names to their definitions", services.Line)
+		}
+	}
+
+	if !requireServices {
+		return nil
+	}
+	return fmt.Errorf("no services section")
+}
+
 // GetProjectName determines the project name based on priority
 func (cf *ComposeFile) GetProjectName(override string) string {
 	// 1. Command line override
 	if override != "" {
-		return normalizeProjectName(override)
+		return NormalizeProjectName(override)
 	}
 
 	// 2. name field in compose file
 	if cf.Name != "" {
-		return normalizeProjectName(cf.Name)
+		return NormalizeProjectName(cf.Name)
 	}
 
 	// 3. COMPOSE_PROJECT_NAME env var
 	if env := os.Getenv("COMPOSE_PROJECT_NAME"); env != "" {
-		return normalizeProjectName(env)
+		return NormalizeProjectName(env)
 	}
 
 	// 4. Directory name
-	dir := filepath.Dir(cf.path)
+	dir := cf.projectDir()
 
 	// If the compose file is in the current directory (dir is "."),
 	// use the actual current working directory name
 	if dir == "." {
 		if cwd, err := os.Getwd(); err == nil {
-			return normalizeProjectName(filepath.Base(cwd))
+			return NormalizeProjectName(filepath.Base(cwd))
 		}
 	}
 
-	return normalizeProjectName(filepath.Base(dir))
+	return NormalizeProjectName(filepath.Base(dir))
 }
 
-// GetVolumeMapping returns volume mapping for a service
+// GetVolumeMapping returns named volume mappings for a service.
+// Bind mounts are excluded; use GetBindMounts for those.
 func (cf *ComposeFile) GetVolumeMapping(serviceName string) ([]VolumeMapping, error) {
+	all, err := cf.getMappings(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []VolumeMapping
+	for _, m := range all {
+		if !m.IsBind {
+			mappings = append(mappings, m)
+		}
+	}
+	return mappings, nil
+}
+
+// GetBindMounts returns the bind mounts of a service with host paths
+// resolved relative to the project directory
+func (cf *ComposeFile) GetBindMounts(serviceName string) ([]VolumeMapping, error) {
+	all, err := cf.getMappings(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []VolumeMapping
+	for _, m := range all {
+		if m.IsBind {
+			m.VolumeName = cf.resolveHostPath(m.VolumeName)
+			mappings = append(mappings, m)
+		}
+	}
+	return mappings, nil
+}
+
+// GetAllBindMounts returns the bind mounts of every service enabled by
+// activeProfiles, sorted by BindName
+func (cf *ComposeFile) GetAllBindMounts(activeProfiles []string) []VolumeMapping {
+	var mappings []VolumeMapping
+	for serviceName, service := range cf.Services {
+		if !service.Enabled(activeProfiles) {
+			continue
+		}
+		if m, err := cf.GetBindMounts(serviceName); err == nil {
+			mappings = append(mappings, m...)
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].BindName() < mappings[j].BindName()
+	})
+	return mappings
+}
+
+// FindBindMount returns the bind mount whose BindName matches name
+func (cf *ComposeFile) FindBindMount(name string) (VolumeMapping, bool) {
+	for _, m := range cf.GetAllBindMounts(AllProfiles) {
+		if m.BindName() == name {
+			return m, true
+		}
+	}
+	return VolumeMapping{}, false
+}
+
+// resolveHostPath expands ~ and makes a bind source absolute relative to the
+// project directory
+func (cf *ComposeFile) resolveHostPath(source string) string {
+	if source == "~" || strings.HasPrefix(source, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			source = filepath.Join(home, source[1:])
+		}
+	}
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(cf.projectDir(), source)
+	}
+	if abs, err := filepath.Abs(source); err == nil {
+		return abs
+	}
+	return source
+}
+
+// isHostPath reports whether a volume source refers to a host path
+func isHostPath(source string) bool {
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~")
+}
+
+// hasMountOption reports whether a comma-separated short-form mode such as
+// "ro,z" contains option
+func hasMountOption(mode, option string) bool {
+	for _, opt := range strings.Split(mode, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// getMappings parses every volume entry of a service, including bind mounts
+func (cf *ComposeFile) getMappings(serviceName string) ([]VolumeMapping, error) {
 	service, ok := cf.Services[serviceName]
 	if !ok {
 		return nil, fmt.Errorf("service %s not found", serviceName)
@@ -268,19 +700,27 @@ func (cf *ComposeFile) GetVolumeMapping(serviceName string) ([]VolumeMapping, er
 			source := parts[0]
 			target := parts[1]
 
-			// Only named volumes (not bind mounts)
-			if !strings.HasPrefix(source, "/") && !strings.HasPrefix(source, ".") && !strings.HasPrefix(source, "~") {
-				mappings = append(mappings, VolumeMapping{
-					VolumeName: source,
-					MountPath:  target,
-					Service:    serviceName,
-				})
+			readOnly := false
+			if len(parts) >= 3 {
+				readOnly = hasMountOption(parts[2], "ro")
 			}
 
-		case map[string]interface{}:
+			mappings = append(mappings, VolumeMapping{
+				VolumeName: source,
+				MountPath:  target,
+				Service:    serviceName,
+				IsBind:     isHostPath(source),
+				ReadOnly:   readOnly,
+			})
+
+		default:
 			// Long-form syntax: {type: volume, source: name, target: /path, ...}
-			srcVal, okSrc := v["source"]
-			tgtVal, okTgt := v["target"]
+			fields, ok := stringMap(volSpec)
+			if !ok {
+				continue
+			}
+			srcVal, okSrc := fields["source"]
+			tgtVal, okTgt := fields["target"]
 			if !okSrc || !okTgt {
 				continue
 			}
@@ -291,31 +731,88 @@ func (cf *ComposeFile) GetVolumeMapping(serviceName string) ([]VolumeMapping, er
 				continue
 			}
 
-			// Check if type is explicitly set to something other than "volume"
-			if typeVal, okType := v["type"]; okType {
-				if typeStr, okTypeStr := typeVal.(string); okTypeStr && typeStr != "volume" {
-					continue
+			isBind := isHostPath(source)
+
+			// Only volume and bind types are backed by persistent data
+			if typeVal, okType := fields["type"]; okType {
+				typeStr, okTypeStr := typeVal.(string)
+				if okTypeStr {
+					switch typeStr {
+					case "volume":
+						if isBind {
+							continue
+						}
+					case "bind":
+						isBind = true
+					default:
+						continue
+					}
 				}
 			}
 
-			// Only named volumes (not bind mounts)
-			if !strings.HasPrefix(source, "/") && !strings.HasPrefix(source, ".") && !strings.HasPrefix(source, "~") {
-				mappings = append(mappings, VolumeMapping{
-					VolumeName: source,
-					MountPath:  target,
-					Service:    serviceName,
-				})
-			}
+			// Sub-options under volume: (nocopy, subpath) and bind: do not
+			// change which data is mounted, so only read_only is kept
+			readOnly, _ := fields["read_only"].(bool)
+
+			mappings = append(mappings, VolumeMapping{
+				VolumeName: source,
+				MountPath:  target,
+				Service:    serviceName,
+				IsBind:     isBind,
+				ReadOnly:   readOnly,
+			})
 		}
 	}
 
 	return mappings, nil
 }
 
-// GetAllVolumeMappings returns all volume mappings in the compose file
-func (cf *ComposeFile) GetAllVolumeMappings() []VolumeMapping {
+// GetVolumeConfig returns the top-level definition of the named volume. A
+// volume declared without options, or not declared at all, has the zero
+// VolumeConfig; ok reports whether it is declared.
+func (cf *ComposeFile) GetVolumeConfig(name string) (VolumeConfig, bool) {
+	def, ok := cf.Volumes[name]
+	if !ok {
+		return VolumeConfig{}, false
+	}
+
+	var cfg VolumeConfig
+	fields, _ := stringMap(def)
+	if name, ok := fields["name"].(string); ok {
+		cfg.Name = name
+	}
+	switch external := fields["external"].(type) {
+	case bool:
+		cfg.External = external
+	default:
+		// Legacy syntax: external: {name: actual_name}
+		if ext, ok := stringMap(external); ok {
+			cfg.External = true
+			if name, ok := ext["name"].(string); ok && cfg.Name == "" {
+				cfg.Name = name
+			}
+		}
+	}
+	if driver, ok := fields["driver"].(string); ok {
+		cfg.Driver = driver
+	}
+	if opts, ok := stringMap(fields["driver_opts"]); ok {
+		cfg.DriverOpts = make(map[string]string, len(opts))
+		for k, v := range opts {
+			cfg.DriverOpts[k] = fmt.Sprint(v)
+		}
+	}
+	return cfg, true
+}
+
+// GetAllVolumeMappings returns the volume mappings of every service enabled
+// by activeProfiles
+func (cf *ComposeFile) GetAllVolumeMappings(activeProfiles []string) []VolumeMapping {
 	var mappings []VolumeMapping
-	for serviceName := range cf.Services {
+	for serviceName, service := range cf.Services {
+		if !service.Enabled(activeProfiles) {
+			continue
+		}
 		if m, err := cf.GetVolumeMapping(serviceName); err == nil {
 			mappings = append(mappings, m...)
 		}
@@ -335,17 +832,76 @@ func (cf *ComposeFile) GetFullVolumeName(serviceName, projectName string) (strin
 	}
 
 	// If multiple volumes, return the first one (common case: one volume per service)
-	return fmt.Sprintf("%s_%s", projectName, mappings[0].VolumeName), nil
+	return cf.FullVolumeName(mappings[0].VolumeName, projectName), nil
+}
+
+// GetVolumeKeys returns the keys of the named volumes a service mounts, in
+// the order they are listed, without duplicates
+func (cf *ComposeFile) GetVolumeKeys(serviceName string) ([]string, error) {
+	mappings, err := cf.GetVolumeMapping(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		if !seen[m.VolumeName] {
+			keys = append(keys, m.VolumeName)
+			seen[m.VolumeName] = true
+		}
+	}
+	return keys, nil
+}
+
+// FullVolumeName returns the Docker volume name Compose uses for the volume
+// declared as key: its name: override, the key itself for an external
+// volume, or "<project>_<key>" otherwise
+func (cf *ComposeFile) FullVolumeName(key, projectName string) string {
+	cfg, _ := cf.GetVolumeConfig(key)
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	if cfg.External {
+		return key
+	}
+	return fmt.Sprintf("%s_%s", projectName, key)
 }
 
-// GetAllFullVolumeNames returns all full volume names for the project
-func (cf *ComposeFile) GetAllFullVolumeNames(projectName string) []string {
-	mappings := cf.GetAllVolumeMappings()
+// VolumeKey returns the key a volume is declared under in the compose file,
+// given its Docker name. Volumes with a name: override or declared external
+// are matched by that name; others by stripping the project prefix. ok
+// reports whether the volume belongs to the compose file.
+func (cf *ComposeFile) VolumeKey(volumeName, projectName string) (key string, ok bool) {
+	keys := make([]string, 0, len(cf.Volumes))
+	for key := range cf.Volumes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if cf.FullVolumeName(key, projectName) == volumeName {
+			return key, true
+		}
+	}
+
+	if shortName, found := strings.CutPrefix(volumeName, projectName+"_"); found {
+		if cfg, declared := cf.GetVolumeConfig(shortName); !declared || (cfg.Name == "" && !cfg.External) {
+			return shortName, true
+		}
+	}
+	return "", false
+}
+
+// GetAllFullVolumeNames returns the full volume names of the services
+// enabled by activeProfiles; pass AllProfiles for every service
+func (cf *ComposeFile) GetAllFullVolumeNames(projectName string, activeProfiles []string) []string {
+	mappings := cf.GetAllVolumeMappings(activeProfiles)
 	var names []string
 	seen := make(map[string]bool)
 
 	for _, m := range mappings {
-		fullName := fmt.Sprintf("%s_%s", projectName, m.VolumeName)
+		fullName := cf.FullVolumeName(m.VolumeName, projectName)
 		if !seen[fullName] {
 			names = append(names, fullName)
 			seen[fullName] = true
@@ -357,12 +913,7 @@ func (cf *ComposeFile) GetAllFullVolumeNames(projectName string) []string {
 
 // GetServiceByVolumeName finds the service using a volume
 func (cf *ComposeFile) GetServiceByVolumeName(volumeName, projectName string) (string, error) {
-	// Strip project prefix if present
-	shortName := volumeName
-	prefix := projectName + "_"
-	if strings.HasPrefix(volumeName, prefix) {
-		shortName = strings.TrimPrefix(volumeName, prefix)
-	}
+	shortName := cf.shortVolumeName(volumeName, projectName)
 
 	for serviceName := range cf.Services {
 		mappings, err := cf.GetVolumeMapping(serviceName)
@@ -379,3 +930,63 @@ func (cf *ComposeFile) GetServiceByVolumeName(volumeName, projectName string) (s
 
 	return "", fmt.Errorf("no service found using volume %s", volumeName)
 }
+
+// GetServicesByVolumeName returns every service that mounts the volume, sorted by name
+func (cf *ComposeFile) GetServicesByVolumeName(volumeName, projectName string) []string {
+	shortName := cf.shortVolumeName(volumeName, projectName)
+
+	var services []string
+	for serviceName := range cf.Services {
+		mappings, err := cf.GetVolumeMapping(serviceName)
+		if err != nil {
+			continue
+		}
+
+		for _, m := range mappings {
+			if m.VolumeName == shortName {
+				services = append(services, serviceName)
+				break
+			}
+		}
+	}
+
+	sort.Strings(services)
+	return services
+}
+
+// GetReadOnlyServicesByVolumeName returns the services that mount the volume
+// only read-only, sorted by name
+func (cf *ComposeFile) GetReadOnlyServicesByVolumeName(volumeName, projectName string) []string {
+	shortName := cf.shortVolumeName(volumeName, projectName)
+
+	var services []string
+	for serviceName := range cf.Services {
+		mappings, err := cf.GetVolumeMapping(serviceName)
+		if err != nil {
+			continue
+		}
+
+		mounted, writable := false, false
+		for _, m := range mappings {
+			if m.VolumeName == shortName {
+				mounted = true
+				writable = writable || !m.ReadOnly
+			}
+		}
+		if mounted && !writable {
+			services = append(services, serviceName)
+		}
+	}
+
+	sort.Strings(services)
+	return services
+}
+
+// shortVolumeName returns the key services refer to a volume by, accepting
+// a Docker volume name or a key that is already short
+func (cf *ComposeFile) shortVolumeName(volumeName, projectName string) string {
+	if key, ok := cf.VolumeKey(volumeName, projectName); ok {
+		return key
+	}
+	return volumeName
+}
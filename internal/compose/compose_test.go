@@ -3,6 +3,8 @@ package compose
 import (
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -241,3 +243,646 @@ func TestGetProjectNamePriorityAndNormalization(t *testing.T) {
 		}
 	})
 }
+
+func writeComposeFile(t *testing.T, dir, content string) *ComposeFile {
+	t.Helper()
+	path := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	cf, err := LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	return cf
+}
+
+func TestBindMounts(t *testing.T) {
+	tmp := t.TempDir()
+	cf := writeComposeFile(t, tmp, `services:
+  web:
+    image: nginx
+    volumes:
+      - web_data:/data
+      - ./html:/usr/share/nginx/html:ro
+      - type: bind
+        source: /srv/uploads
+        target: /var/uploads
+      - type: tmpfs
+        target: /tmp
+`)
+
+	t.Run("namedVolumesExcludeBinds", func(t *testing.T) {
+		mappings, err := cf.GetVolumeMapping("web")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(mappings) != 1 || mappings[0].VolumeName != "web_data" || mappings[0].IsBind {
+			t.Fatalf("expected only web_data, got %+v", mappings)
+		}
+	})
+
+	t.Run("bindsParsedAndResolved", func(t *testing.T) {
+		binds, err := cf.GetBindMounts("web")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(binds) != 2 {
+			t.Fatalf("expected 2 bind mounts, got %+v", binds)
+		}
+		if !binds[0].IsBind || binds[0].VolumeName != filepath.Join(tmp, "html") || binds[0].MountPath != "/usr/share/nginx/html" {
+			t.Fatalf("unexpected short-form bind: %+v", binds[0])
+		}
+		if !binds[1].IsBind || binds[1].VolumeName != "/srv/uploads" {
+			t.Fatalf("unexpected long-form bind: %+v", binds[1])
+		}
+	})
+
+	t.Run("bindNameRoundTrip", func(t *testing.T) {
+		binds, _ := cf.GetBindMounts("web")
+		name := binds[0].BindName()
+		if name != "web_bind_usr_share_nginx_html" {
+			t.Fatalf("unexpected bind name %s", name)
+		}
+
+		found, ok := cf.FindBindMount(name)
+		if !ok {
+			t.Fatalf("bind mount %s not found by name", name)
+		}
+		if found.VolumeName != binds[0].VolumeName || found.MountPath != binds[0].MountPath {
+			t.Fatalf("round trip mismatch: %+v vs %+v", found, binds[0])
+		}
+
+		if _, ok := cf.FindBindMount("web_data"); ok {
+			t.Fatalf("named volume should not resolve as a bind mount")
+		}
+	})
+}
+
+func TestGetServicesByVolumeName(t *testing.T) {
+	cf := writeComposeFile(t, t.TempDir(), `services:
+  web:
+    image: app
+    volumes:
+      - shared:/data
+  worker:
+    image: app
+    volumes:
+      - type: volume
+        source: shared
+        target: /data
+  db:
+    image: postgres
+    volumes:
+      - db_data:/var/lib/postgresql/data
+`)
+
+	got := cf.GetServicesByVolumeName("myproject_shared", "myproject")
+	if len(got) != 2 || got[0] != "web" || got[1] != "worker" {
+		t.Fatalf("expected [web worker], got %v", got)
+	}
+
+	if got := cf.GetServicesByVolumeName("shared", "myproject"); len(got) != 2 {
+		t.Fatalf("expected short volume name to match, got %v", got)
+	}
+
+	if got := cf.GetServicesByVolumeName("myproject_db_data", "myproject"); len(got) != 1 || got[0] != "db" {
+		t.Fatalf("expected [db], got %v", got)
+	}
+
+	if got := cf.GetServicesByVolumeName("myproject_missing", "myproject"); len(got) != 0 {
+		t.Fatalf("expected no services, got %v", got)
+	}
+}
+
+func TestGetVolumeMappingReadOnly(t *testing.T) {
+	cf := writeComposeFile(t, t.TempDir(), `services:
+  web:
+    image: app
+    volumes:
+      - shared:/data:ro
+      - cache:/cache:rw
+      - ./static:/srv/static:ro,z
+  worker:
+    image: app
+    volumes:
+      - type: volume
+        source: shared
+        target: /data
+        read_only: true
+        volume:
+          nocopy: true
+      - type: volume
+        source: cache
+        target: /cache
+`)
+
+	web, err := cf.GetVolumeMapping("web")
+	if err != nil {
+		t.Fatalf("failed to get web mappings: %v", err)
+	}
+	if len(web) != 2 || web[0].VolumeName != "shared" || !web[0].ReadOnly || web[1].VolumeName != "cache" || web[1].ReadOnly {
+		t.Fatalf("expected read-only shared and writable cache, got %+v", web)
+	}
+	binds, err := cf.GetBindMounts("web")
+	if err != nil {
+		t.Fatalf("failed to get web bind mounts: %v", err)
+	}
+	if len(binds) != 1 || !binds[0].ReadOnly {
+		t.Fatalf("expected a read-only bind mount, got %+v", binds)
+	}
+
+	worker, err := cf.GetVolumeMapping("worker")
+	if err != nil {
+		t.Fatalf("failed to get worker mappings: %v", err)
+	}
+	if len(worker) != 2 || worker[0].VolumeName != "shared" || !worker[0].ReadOnly || worker[1].ReadOnly {
+		t.Fatalf("expected long-form read_only to be kept, got %+v", worker)
+	}
+
+	if got := cf.GetServicesByVolumeName("myproject_shared", "myproject"); len(got) != 2 {
+		t.Fatalf("expected read-only mounts to still be found, got %v", got)
+	}
+	if got := cf.GetReadOnlyServicesByVolumeName("myproject_shared", "myproject"); len(got) != 2 || got[0] != "web" || got[1] != "worker" {
+		t.Fatalf("expected [web worker] to mount shared read-only, got %v", got)
+	}
+	if got := cf.GetReadOnlyServicesByVolumeName("myproject_cache", "myproject"); len(got) != 0 {
+		t.Fatalf("expected no read-only services for cache, got %v", got)
+	}
+}
+
+func TestFilesFromEnv(t *testing.T) {
+	t.Run("unset", func(t *testing.T) {
+		t.Setenv(EnvComposeFile, "")
+		if files := FilesFromEnv(); files != nil {
+			t.Fatalf("expected no files, got %v", files)
+		}
+	})
+
+	t.Run("single", func(t *testing.T) {
+		t.Setenv(EnvComposeFile, "/srv/app/compose.yaml")
+		files := FilesFromEnv()
+		if len(files) != 1 || files[0] != "/srv/app/compose.yaml" {
+			t.Fatalf("unexpected files: %v", files)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		t.Setenv(EnvComposeFile, "/srv/app/compose.yaml"+string(os.PathListSeparator)+"/srv/app/compose.prod.yaml")
+		files := FilesFromEnv()
+		if len(files) != 2 || files[1] != "/srv/app/compose.prod.yaml" {
+			t.Fatalf("unexpected files: %v", files)
+		}
+	})
+
+	t.Run("customSeparator", func(t *testing.T) {
+		t.Setenv(EnvComposeFile, "a.yaml,b.yaml")
+		t.Setenv(EnvComposePathSeparator, ",")
+		files := FilesFromEnv()
+		if len(files) != 2 || files[0] != "a.yaml" || files[1] != "b.yaml" {
+			t.Fatalf("unexpected files: %v", files)
+		}
+	})
+
+	t.Run("relativeToProjectDirectory", func(t *testing.T) {
+		t.Setenv(EnvComposeFile, "compose.yaml")
+		t.Setenv(EnvComposeProjectDirectory, "/srv/app")
+		files := FilesFromEnv()
+		if len(files) != 1 || files[0] != filepath.Join("/srv/app", "compose.yaml") {
+			t.Fatalf("unexpected files: %v", files)
+		}
+	})
+}
+
+func TestLoadComposeFilesMerges(t *testing.T) {
+	tmp := t.TempDir()
+	base := filepath.Join(tmp, "compose.yaml")
+	override := filepath.Join(tmp, "compose.override.yaml")
+
+	if err := os.WriteFile(base, []byte(`services:
+  db:
+    image: postgres:15
+    volumes:
+      - db_data:/var/lib/postgresql/data
+      - logs:/var/log
+volumes:
+  db_data:
+  logs:
+`), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	if err := os.WriteFile(override, []byte(`name: merged
+services:
+  db:
+    image: postgres:16
+    volumes:
+      - prod_data:/var/lib/postgresql/data
+  cache:
+    image: redis
+    volumes:
+      - cache_data:/data
+volumes:
+  prod_data:
+  cache_data:
+`), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	cf, err := LoadComposeFiles([]string{base, override})
+	if err != nil {
+		t.Fatalf("failed to load compose files: %v", err)
+	}
+
+	if got := cf.GetProjectName(""); got != "merged" {
+		t.Fatalf("expected project name from override, got %s", got)
+	}
+	if cf.Services["db"].Image != "postgres:16" {
+		t.Fatalf("expected overridden image, got %s", cf.Services["db"].Image)
+	}
+
+	mappings, err := cf.GetVolumeMapping("db")
+	if err != nil {
+		t.Fatalf("failed to get db mappings: %v", err)
+	}
+	if len(mappings) != 2 || mappings[0].VolumeName != "prod_data" || mappings[1].VolumeName != "logs" {
+		t.Fatalf("expected data mount replaced and logs kept, got %+v", mappings)
+	}
+
+	if _, ok := cf.Services["cache"]; !ok {
+		t.Fatalf("expected cache service from override")
+	}
+	for _, name := range []string{"db_data", "logs", "prod_data", "cache_data"} {
+		if _, ok := cf.Volumes[name]; !ok {
+			t.Errorf("expected top-level volume %s", name)
+		}
+	}
+}
+
+func TestSetProjectDir(t *testing.T) {
+	tmp := t.TempDir()
+	cf := writeComposeFile(t, tmp, `services:
+  web:
+    image: nginx
+    volumes:
+      - ./html:/usr/share/nginx/html
+`)
+	t.Setenv("COMPOSE_PROJECT_NAME", "")
+
+	projectDir := filepath.Join(tmp, "MyApp")
+	cf.SetProjectDir(projectDir)
+
+	if got := cf.GetProjectName(""); got != "myapp" {
+		t.Fatalf("expected project name from project directory, got %s", got)
+	}
+	binds, err := cf.GetBindMounts("web")
+	if err != nil {
+		t.Fatalf("failed to get bind mounts: %v", err)
+	}
+	if len(binds) != 1 || binds[0].VolumeName != filepath.Join(projectDir, "html") {
+		t.Fatalf("expected bind resolved against project directory, got %+v", binds)
+	}
+}
+
+func TestFindComposeFileUpward(t *testing.T) {
+	root := t.TempDir()
+	composePath := filepath.Join(root, "docker-compose.yml")
+	if err := os.WriteFile(composePath, []byte("services: {}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	deep := filepath.Join(root, "src", "app", "internal")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatalf("failed to create subdirectories: %v", err)
+	}
+
+	got, err := FindComposeFileUpward(deep)
+	if err != nil {
+		t.Fatalf("expected compose file to be found: %v", err)
+	}
+	if got != composePath {
+		t.Fatalf("expected %s, got %s", composePath, got)
+	}
+
+	t.Run("nearestWins", func(t *testing.T) {
+		nearer := filepath.Join(root, "src", "compose.yaml")
+		if err := os.WriteFile(nearer, []byte("services: {}\n"), 0o644); err != nil {
+			t.Fatalf("failed to write compose file: %v", err)
+		}
+		t.Cleanup(func() { os.Remove(nearer) })
+
+		got, err := FindComposeFileUpward(deep)
+		if err != nil || got != nearer {
+			t.Fatalf("expected %s, got %s (%v)", nearer, got, err)
+		}
+	})
+
+	t.Run("relativeStart", func(t *testing.T) {
+		t.Chdir(deep)
+		got, err := FindComposeFileUpward(".")
+		if err != nil || got != composePath {
+			t.Fatalf("expected %s, got %s (%v)", composePath, got, err)
+		}
+
+		cf, err := LoadComposeFile(got)
+		if err != nil {
+			t.Fatalf("failed to load compose file: %v", err)
+		}
+		t.Setenv("COMPOSE_PROJECT_NAME", "")
+		if want := NormalizeProjectName(filepath.Base(root)); cf.GetProjectName("") != want {
+			t.Fatalf("expected project name %s from the compose file's directory, got %s", want, cf.GetProjectName(""))
+		}
+	})
+}
+
+func TestGetVolumeConfigParsesNFSVolume(t *testing.T) {
+	cf, err := LoadComposeFile(filepath.Join("testdata", "nfs.yaml"))
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	media, ok := cf.GetVolumeConfig("media")
+	if !ok {
+		t.Fatalf("expected media to be declared")
+	}
+	if media.Driver != "local" {
+		t.Fatalf("expected local driver, got %q", media.Driver)
+	}
+	wantOpts := map[string]string{
+		"type":   "nfs",
+		"o":      "addr=10.0.0.5,nfsvers=4,rw",
+		"device": ":/exports/media",
+	}
+	if len(media.DriverOpts) != len(wantOpts) {
+		t.Fatalf("expected driver_opts %v, got %v", wantOpts, media.DriverOpts)
+	}
+	for k, v := range wantOpts {
+		if media.DriverOpts[k] != v {
+			t.Fatalf("expected driver_opts %v, got %v", wantOpts, media.DriverOpts)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		declared bool
+		network  string
+	}{
+		{"media", true, "nfs"},
+		{"cache", true, "rexray/ebs"},
+		{"db_data", true, ""},
+		{"undeclared", false, ""},
+	}
+	for _, tt := range tests {
+		cfg, ok := cf.GetVolumeConfig(tt.name)
+		if ok != tt.declared || cfg.NetworkType() != tt.network {
+			t.Errorf("%s: got declared=%v network=%q, want declared=%v network=%q", tt.name, ok, cfg.NetworkType(), tt.declared, tt.network)
+		}
+	}
+
+	// The long-form mapping still resolves to the project-scoped name
+	if got, err := cf.GetFullVolumeName("web", "shop"); err != nil || got != "shop_media" {
+		t.Fatalf("expected shop_media, got %q, %v", got, err)
+	}
+}
+
+func TestFullVolumeNameHonorsNameAndExternal(t *testing.T) {
+	cf, err := LoadComposeFile(filepath.Join("testdata", "custom_names.yaml"))
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	tests := []struct {
+		service string
+		key     string
+		want    string
+	}{
+		{"db", "db_data", "shop-postgres"},
+		{"media", "uploads", "uploads"},
+		{"legacy", "archive", "old_archive"},
+		{"cache", "cache_data", "shop_cache_data"},
+	}
+	for _, tt := range tests {
+		if got, err := cf.GetFullVolumeName(tt.service, "shop"); err != nil || got != tt.want {
+			t.Errorf("%s: expected %s, got %q, %v", tt.service, tt.want, got, err)
+		}
+		if key, ok := cf.VolumeKey(tt.want, "shop"); !ok || key != tt.key {
+			t.Errorf("%s: expected key %s, got %q (ok=%v)", tt.want, tt.key, key, ok)
+		}
+		if got, err := cf.GetServiceByVolumeName(tt.want, "shop"); err != nil || got != tt.service {
+			t.Errorf("%s: expected service %s, got %q, %v", tt.want, tt.service, got, err)
+		}
+	}
+
+	// The prefixed name of a volume with a name: override is not that volume
+	if key, ok := cf.VolumeKey("shop_db_data", "shop"); ok {
+		t.Errorf("expected shop_db_data not to belong to the project, got key %q", key)
+	}
+	if _, ok := cf.VolumeKey("unrelated", "shop"); ok {
+		t.Errorf("expected an unrelated volume not to belong to the project")
+	}
+
+	got := cf.GetAllFullVolumeNames("shop", AllProfiles)
+	sort.Strings(got)
+	want := []string{"old_archive", "shop-postgres", "shop_cache_data", "uploads"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestGetVolumeMappingResolvesAnchorsAndMergeKeys(t *testing.T) {
+	cf, err := LoadComposeFile(filepath.Join("testdata", "anchors.yaml"))
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	tests := []struct {
+		service string
+		want    []VolumeMapping
+	}{
+		{"api", []VolumeMapping{
+			{VolumeName: "cache", MountPath: "/var/cache/app", Service: "api"},
+			{VolumeName: "shared", MountPath: "/srv/data", Service: "api"},
+		}},
+		{"worker", []VolumeMapping{
+			{VolumeName: "shared", MountPath: "/work/data", Service: "worker"},
+			{VolumeName: "logs", MountPath: "/var/log/app", Service: "worker"},
+		}},
+		{"cron", []VolumeMapping{
+			{VolumeName: "shared", MountPath: "/srv/data", Service: "cron"},
+		}},
+	}
+
+	for _, tt := range tests {
+		got, err := cf.GetVolumeMapping(tt.service)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.service, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.service, tt.want, got)
+		}
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Fatalf("%s: expected %v, got %v", tt.service, tt.want, got)
+			}
+		}
+	}
+
+	binds, err := cf.GetBindMounts("cron")
+	if err != nil || len(binds) != 1 || binds[0].MountPath != "/scripts" {
+		t.Fatalf("expected the cron bind mount to survive alongside a merged entry, got %v, %v", binds, err)
+	}
+
+	if cfg, _ := cf.GetVolumeConfig("shared"); cfg.NetworkType() != "nfs" {
+		t.Fatalf("expected merged volume definition to be nfs, got %+v", cfg)
+	}
+}
+
+func TestMergeVolumeSpecsMatchesNonStringKeyedMaps(t *testing.T) {
+	base := []interface{}{map[interface{}]interface{}{"source": "data", "target": "/data", 1: "x"}}
+	override := []interface{}{"other:/data"}
+
+	merged := mergeVolumeSpecs(base, override)
+	if len(merged) != 1 || merged[0] != "other:/data" {
+		t.Fatalf("expected override to replace the entry mounted at /data, got %v", merged)
+	}
+}
+
+func TestGetAllFullVolumeNamesFiltersByProfile(t *testing.T) {
+	cf, err := LoadComposeFile(filepath.Join("testdata", "profiles.yaml"))
+	if err != nil {
+		t.Fatalf("failed to load fixture: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		profiles []string
+		want     []string
+	}{
+		{"noProfiles", nil, []string{"app_db_data"}},
+		{"oneProfile", []string{"backup"}, []string{"app_db_data", "app_restic_cache"}},
+		{"anyOfServiceProfiles", []string{"tools"}, []string{"app_db_data", "app_debug_home"}},
+		{"severalProfiles", []string{"backup", "debug"}, []string{"app_db_data", "app_debug_home", "app_restic_cache"}},
+		{"unknownProfile", []string{"other"}, []string{"app_db_data"}},
+		{"allProfiles", AllProfiles, []string{"app_db_data", "app_debug_home", "app_restic_cache"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cf.GetAllFullVolumeNames("app", tt.profiles)
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if binds := cf.GetAllBindMounts(nil); len(binds) != 0 {
+		t.Fatalf("expected bind mounts of inactive services to be skipped, got %v", binds)
+	}
+	if binds := cf.GetAllBindMounts([]string{"debug"}); len(binds) != 1 || binds[0].MountPath != "/captures" {
+		t.Fatalf("expected the debug bind mount, got %v", binds)
+	}
+	if _, ok := cf.FindBindMount("debug_bind_captures"); !ok {
+		t.Fatalf("expected FindBindMount to find bind mounts regardless of profiles")
+	}
+}
+
+func TestProfilesFromEnv(t *testing.T) {
+	t.Setenv(EnvComposeProfiles, "backup, debug,,")
+	if got := ProfilesFromEnv(); strings.Join(got, ",") != "backup,debug" {
+		t.Fatalf("expected [backup debug], got %v", got)
+	}
+
+	t.Setenv(EnvComposeProfiles, "")
+	if got := ProfilesFromEnv(); len(got) != 0 {
+		t.Fatalf("expected no profiles, got %v", got)
+	}
+}
+
+func TestLoadComposeFileReportsMissingServices(t *testing.T) {
+	tmp := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"empty", "# nothing here\n", "compose file is empty"},
+		{"noServicesKey", "service:\n  web:\n    image: nginx\n", "no services section"},
+		{"nullServices", "name: app\nservices:\n", "services is empty"},
+		{"servicesList", "services:\n  - web\n", "services must be a mapping"},
+		{"notMapping", "- services\n", "must be a mapping of top-level keys"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmp, tt.name+".yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("failed to write compose file: %v", err)
+			}
+			_, err := LoadComposeFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), path) {
+				t.Fatalf("expected error naming %s and containing %q, got %v", path, tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadComposeFileEmptyServices(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "compose.yaml")
+	if err := os.WriteFile(path, []byte("name: app\nservices: {}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	cf, err := LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("expected an empty services section to load, got %v", err)
+	}
+	if len(cf.Services) != 0 {
+		t.Fatalf("expected no services, got %v", cf.Services)
+	}
+	if names := cf.GetAllFullVolumeNames("app", AllProfiles); len(names) != 0 {
+		t.Fatalf("expected no volumes, got %v", names)
+	}
+
+	// An override without services still merges into the base file
+	override := filepath.Join(tmp, "compose.override.yaml")
+	if err := os.WriteFile(override, []byte("name: other\n"), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	cf, err = LoadComposeFiles([]string{path, override})
+	if err != nil {
+		t.Fatalf("expected an override without services to load, got %v", err)
+	}
+	if got := cf.GetProjectName(""); got != "other" {
+		t.Fatalf("expected project name from override, got %s", got)
+	}
+}
+
+func TestGetVolumeMappingServiceWithoutVolumes(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "compose.yaml")
+	if err := os.WriteFile(path, []byte(`services:
+  web:
+    image: nginx
+  placeholder:
+`), 0o644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	cf, err := LoadComposeFile(path)
+	if err != nil {
+		t.Fatalf("failed to load compose file: %v", err)
+	}
+	for _, service := range []string{"web", "placeholder"} {
+		mappings, err := cf.GetVolumeMapping(service)
+		if err != nil {
+			t.Fatalf("GetVolumeMapping(%s): %v", service, err)
+		}
+		if len(mappings) != 0 {
+			t.Fatalf("expected no mappings for %s, got %+v", service, mappings)
+		}
+	}
+	if binds := cf.GetAllBindMounts(AllProfiles); len(binds) != 0 {
+		t.Fatalf("expected no bind mounts, got %+v", binds)
+	}
+}
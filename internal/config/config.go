@@ -1,13 +1,64 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// SupportedFormats lists the backup formats dvm can produce
+var SupportedFormats = []string{"tar.gz", "tgz", "tar.zst", "tar"}
+
+// SupportedChecksumAlgos lists the checksum algorithms dvm can record for
+// backups. xxh64 is much faster than sha256 on large archives but is not a
+// cryptographic hash.
+var SupportedChecksumAlgos = []string{"sha256", "xxh64"}
+
+// ErrConfigExists is returned by Init when the config file already exists
+var ErrConfigExists = errors.New("config file already exists")
+
+// fieldComments documents each config key in files written by Save.
+// Keys are dotted YAML paths.
+var fieldComments = map[string]string{
+	"defaults":                           "Default settings",
+	"defaults.compress_format":           "Backup format: tar.gz | tgz | tar.zst | tar",
+	"defaults.compress_level":            "Compression level for compressed formats: 1-9, or 1-19 for tar.zst (0 uses the compressor's default)",
+	"defaults.keep_generations":          "Number of backup generations to keep per volume (0 keeps all)",
+	"defaults.keep_days":                 "Also keep backups younger than this many days beyond keep_generations (0 disables)",
+	"defaults.protected_tags":            "Backups with one of these tags are never removed by retention",
+	"defaults.stop_before_backup":        "Stop containers using a volume before backing it up",
+	"defaults.sparse":                    "Keep holes in sparse files when backing up and restoring (uses a GNU tar worker image)",
+	"defaults.xattrs":                    "Keep extended attributes, POSIX ACLs and SELinux labels when backing up and restoring (uses a GNU tar worker image)",
+	"defaults.require_name_confirmation": "Make archive, clean and swap ask for the volume or project name to be typed out, even with --force",
+	"defaults.checksum_algo":             "Checksum algorithm recorded for backups: sha256 | xxh64",
+	"defaults.retry_attempts":            "Attempts for Docker operations failing with transient errors (1 disables retries)",
+	"defaults.use_utc":                   "Use UTC instead of local time in backup filenames and output",
+	"defaults.backup_interval":           "Expected time between backups of a volume, e.g. 24h or 7d; older backups are overdue (empty disables)",
+	"paths":                              "Path settings (~ expands to $HOME)",
+	"paths.backups":                      "Directory where backups are stored, one subdirectory per project",
+	"paths.archives":                     "Directory where archived volumes are stored",
+	"paths.database":                     "Metadata database file, or :memory: for one that is not saved (default: meta.db next to this file)",
+	"projects":                           "Project-specific settings",
+}
+
+// projectsExample is appended to files written by Save when no
+// project-specific settings are configured.
+const projectsExample = `Project-specific settings (optional):
+projects:
+  myproject:
+    keep_generations: 10
+    backup_interval: 24h
+    volumes:
+      db:
+        backup_interval: 6h`
+
 // Config represents the global configuration
 type Config struct {
 	Defaults Defaults          `yaml:"defaults"`
@@ -17,20 +68,40 @@ type Config struct {
 
 // Defaults contains default settings
 type Defaults struct {
-	CompressFormat    string `yaml:"compress_format"`
-	KeepGenerations   int    `yaml:"keep_generations"`
-	StopBeforeBackup  bool   `yaml:"stop_before_backup"`
+	CompressFormat          string   `yaml:"compress_format"`
+	CompressLevel           int      `yaml:"compress_level"`
+	KeepGenerations         int      `yaml:"keep_generations"`
+	KeepDays                int      `yaml:"keep_days"`
+	ProtectedTags           []string `yaml:"protected_tags"`
+	StopBeforeBackup        bool     `yaml:"stop_before_backup"`
+	Sparse                  bool     `yaml:"sparse"`
+	Xattrs                  bool     `yaml:"xattrs"`
+	RequireNameConfirmation bool     `yaml:"require_name_confirmation"`
+	ChecksumAlgo            string   `yaml:"checksum_algo"`
+	RetryAttempts           int      `yaml:"retry_attempts"`
+	UseUTC                  bool     `yaml:"use_utc"`
+	BackupInterval          string   `yaml:"backup_interval"`
 }
 
 // Paths contains path settings
 type Paths struct {
 	Backups  string `yaml:"backups"`
 	Archives string `yaml:"archives"`
+	Database string `yaml:"database,omitempty"` // "" for meta.db next to the config file
 }
 
 // Project contains project-specific settings
 type Project struct {
-	KeepGenerations int `yaml:"keep_generations,omitempty"`
+	KeepGenerations int               `yaml:"keep_generations,omitempty"`
+	KeepDays        int               `yaml:"keep_days,omitempty"`
+	BackupInterval  string            `yaml:"backup_interval,omitempty"`
+	Volumes         map[string]Volume `yaml:"volumes,omitempty"`
+}
+
+// Volume contains settings for one volume of a project, keyed by service,
+// compose volume key or full volume name
+type Volume struct {
+	BackupInterval string `yaml:"backup_interval,omitempty"`
 }
 
 // DefaultConfig returns the default configuration
@@ -40,7 +111,12 @@ func DefaultConfig() *Config {
 		Defaults: Defaults{
 			CompressFormat:   "tar.gz",
 			KeepGenerations:  5,
+			KeepDays:         0,
+			ProtectedTags:    []string{"keep-forever"},
 			StopBeforeBackup: false,
+			ChecksumAlgo:     "sha256",
+			RetryAttempts:    3,
+			UseUTC:           false,
 		},
 		Paths: Paths{
 			Backups:  filepath.Join(home, ".dvm", "backups"),
@@ -50,7 +126,19 @@ func DefaultConfig() *Config {
 	}
 }
 
-// Load loads configuration from a file
+// Environment variables that override configuration values
+const (
+	EnvBackupsDir      = "DVM_BACKUPS_DIR"
+	EnvCompressFormat  = "DVM_COMPRESS_FORMAT"
+	EnvKeepGenerations = "DVM_KEEP_GENERATIONS"
+	EnvDBPath          = "DVM_DB_PATH"
+)
+
+// Load loads configuration from a file.
+//
+// Values are resolved with the following precedence: environment variables
+// (DVM_BACKUPS_DIR, DVM_COMPRESS_FORMAT, DVM_KEEP_GENERATIONS, DVM_DB_PATH), then the
+// config file, then DefaultConfig.
 func Load(path string) (*Config, error) {
 	// Expand ~ to home directory
 	if len(path) > 0 && path[0] == '~' {
@@ -61,29 +149,257 @@ func Load(path string) (*Config, error) {
 		path = filepath.Join(home, path[1:])
 	}
 
-	// If file doesn't exist, return default config
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return DefaultConfig(), nil
-	}
+	cfg := DefaultConfig()
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+	// Overlay the config file on the defaults if it exists
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	cfg := DefaultConfig()
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	if err := applyEnvOverrides(cfg); err != nil {
 		return nil, err
 	}
 
 	// Expand ~ in paths
 	cfg.Paths.Backups = expandPath(cfg.Paths.Backups)
 	cfg.Paths.Archives = expandPath(cfg.Paths.Archives)
+	cfg.Paths.Database = expandPath(cfg.Paths.Database)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
 
 	return cfg, nil
 }
 
-// Save saves configuration to a file
+// applyEnvOverrides overrides config values with DVM_* environment variables
+func applyEnvOverrides(cfg *Config) error {
+	if dir := os.Getenv(EnvBackupsDir); dir != "" {
+		cfg.Paths.Backups = dir
+	}
+
+	if format := os.Getenv(EnvCompressFormat); format != "" {
+		if err := ValidateFormat(format); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvCompressFormat, err)
+		}
+		cfg.Defaults.CompressFormat = format
+	}
+
+	if path := os.Getenv(EnvDBPath); path != "" {
+		cfg.Paths.Database = path
+	}
+
+	if keep := os.Getenv(EnvKeepGenerations); keep != "" {
+		n, err := strconv.Atoi(keep)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s %q: must be a non-negative integer", EnvKeepGenerations, keep)
+		}
+		cfg.Defaults.KeepGenerations = n
+	}
+
+	return nil
+}
+
+// Validate checks that configuration values are usable
+func (c *Config) Validate() error {
+	if err := ValidateFormat(c.Defaults.CompressFormat); err != nil {
+		return fmt.Errorf("invalid compress_format: %w", err)
+	}
+	if err := ValidateCompressLevel(c.Defaults.CompressFormat, c.Defaults.CompressLevel); err != nil {
+		return fmt.Errorf("invalid compress_level: %w", err)
+	}
+	if !IsSupportedChecksumAlgo(c.Defaults.ChecksumAlgo) {
+		return fmt.Errorf("unsupported checksum_algo %q (supported: %s)",
+			c.Defaults.ChecksumAlgo, strings.Join(SupportedChecksumAlgos, ", "))
+	}
+	if c.Defaults.RetryAttempts < 1 {
+		return fmt.Errorf("retry_attempts must be at least 1, got %d", c.Defaults.RetryAttempts)
+	}
+	if c.Defaults.KeepGenerations < 0 {
+		return fmt.Errorf("keep_generations must not be negative, got %d", c.Defaults.KeepGenerations)
+	}
+	if c.Defaults.KeepDays < 0 {
+		return fmt.Errorf("keep_days must not be negative, got %d", c.Defaults.KeepDays)
+	}
+	for _, tag := range c.Defaults.ProtectedTags {
+		if tag == "" {
+			return fmt.Errorf("protected_tags must not contain an empty tag")
+		}
+	}
+	if c.Paths.Backups == "" {
+		return fmt.Errorf("paths.backups must not be empty")
+	}
+	if c.Paths.Archives == "" {
+		return fmt.Errorf("paths.archives must not be empty")
+	}
+	if err := validateInterval("backup_interval", c.Defaults.BackupInterval); err != nil {
+		return err
+	}
+	for name, project := range c.Projects {
+		if project.KeepGenerations < 0 {
+			return fmt.Errorf("projects.%s.keep_generations must not be negative, got %d", name, project.KeepGenerations)
+		}
+		if project.KeepDays < 0 {
+			return fmt.Errorf("projects.%s.keep_days must not be negative, got %d", name, project.KeepDays)
+		}
+		if err := validateInterval("projects."+name+".backup_interval", project.BackupInterval); err != nil {
+			return err
+		}
+		for volume, settings := range project.Volumes {
+			if err := validateInterval("projects."+name+".volumes."+volume+".backup_interval", settings.BackupInterval); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateInterval checks an optional interval setting named key
+func validateInterval(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := ParseInterval(value); err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+// ParseInterval parses a positive duration such as "90m" or "24h", or a
+// number of days such as "7d"
+func ParseInterval(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("interval must be positive, got %q", s)
+	}
+	return d, nil
+}
+
+// BackupInterval returns the expected time between backups of a volume of
+// project, or 0 if none is configured. names identify the volume (service,
+// compose volume key or full name); the first with a volume setting wins,
+// then the project's interval, then the default.
+func (c *Config) BackupInterval(project string, names ...string) time.Duration {
+	value := c.Defaults.BackupInterval
+	if projectCfg, ok := c.Projects[project]; ok {
+		if projectCfg.BackupInterval != "" {
+			value = projectCfg.BackupInterval
+		}
+		for _, name := range names {
+			if settings, ok := projectCfg.Volumes[name]; ok && settings.BackupInterval != "" {
+				value = settings.BackupInterval
+				break
+			}
+		}
+	}
+	if value == "" {
+		return 0
+	}
+	// Validate has already rejected unparsable intervals
+	d, _ := ParseInterval(value)
+	return d
+}
+
+// IsSupportedFormat reports whether format is one of SupportedFormats
+func IsSupportedFormat(format string) bool {
+	for _, f := range SupportedFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateFormat checks that format is one of SupportedFormats, listing
+// them if it is not
+func ValidateFormat(format string) error {
+	if !IsSupportedFormat(format) {
+		return fmt.Errorf("unsupported format %q (supported: %s)", format, strings.Join(SupportedFormats, ", "))
+	}
+	return nil
+}
+
+// IsCompressedFormat reports whether backups in format are compressed.
+// tgz is tar.gz under the shorter extension.
+func IsCompressedFormat(format string) bool {
+	return format == "tar.gz" || format == "tgz" || format == "tar.zst"
+}
+
+// CompressLevelRange returns the compression levels accepted for format,
+// and false if format is not compressed: zstd's 1-19 for tar.zst, gzip's
+// 1-9 for the others.
+func CompressLevelRange(format string) (min, max int, ok bool) {
+	if format == "tar.zst" {
+		return 1, 19, true
+	}
+	if IsCompressedFormat(format) {
+		return 1, 9, true
+	}
+	return 0, 0, false
+}
+
+// ValidateCompressLevel checks that level can be used for backups in
+// format. Level 0 selects the compressor's default and is always valid.
+func ValidateCompressLevel(format string, level int) error {
+	if level == 0 {
+		return nil
+	}
+	min, max, ok := CompressLevelRange(format)
+	if !ok {
+		return fmt.Errorf("%s backups are not compressed and take no compression level", format)
+	}
+	if level < min || level > max {
+		return fmt.Errorf("compression level for %s must be between %d and %d, got %d", format, min, max, level)
+	}
+	return nil
+}
+
+// IsSupportedChecksumAlgo reports whether algo is one of SupportedChecksumAlgos
+func IsSupportedChecksumAlgo(algo string) bool {
+	for _, a := range SupportedChecksumAlgos {
+		if a == algo {
+			return true
+		}
+	}
+	return false
+}
+
+// Init writes a documented default configuration to path.
+// An existing file is only overwritten when force is true.
+func Init(path string, force bool) error {
+	path = expandPath(path)
+
+	if _, err := os.Stat(path); err == nil {
+		if !force {
+			return fmt.Errorf("%w: %s (use --force to overwrite)", ErrConfigExists, path)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return DefaultConfig().Save(path)
+}
+
+// Save saves configuration to a file, annotating each field with a comment
 func (c *Config) Save(path string) error {
 	path = expandPath(path)
 
@@ -93,12 +409,60 @@ func (c *Config) Save(path string) error {
 		return err
 	}
 
-	data, err := yaml.Marshal(c)
-	if err != nil {
+	var doc yaml.Node
+	if err := doc.Encode(c); err != nil {
 		return err
 	}
+	annotate(&doc, "")
+	if len(c.Projects) == 0 {
+		doc.FootComment = projectsExample
+	}
 
-	return os.WriteFile(path, data, 0644)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// annotate attaches fieldComments to the keys of a mapping node, recursing
+// into nested mappings. prefix is the dotted path of node.
+func annotate(node *yaml.Node, prefix string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		path := key.Value
+		if prefix != "" {
+			path = prefix + "." + key.Value
+		}
+		if comment, ok := fieldComments[path]; ok {
+			if value.Kind == yaml.MappingNode {
+				key.HeadComment = comment
+			} else {
+				key.LineComment = comment
+			}
+		}
+		annotate(value, path)
+	}
+}
+
+// DatabasePath returns the path of the metadata database used with the
+// config file at configPath: paths.database if set, otherwise meta.db in
+// the directory of the config file
+func (c *Config) DatabasePath(configPath string) string {
+	if c.Paths.Database != "" {
+		return c.Paths.Database
+	}
+	return filepath.Join(filepath.Dir(configPath), "meta.db")
 }
 
 // GetConfigPath returns the default config path
@@ -133,6 +497,35 @@ func expandPath(path string) string {
 	return path
 }
 
+// ExpandHome expands a path given by the user that is "~" or starts with
+// "~/" against the current user's home directory. Other paths, including
+// "~user" forms, are returned unchanged.
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to expand %s: %w", path, err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// ResolvePath turns a path given on the command line into an absolute one:
+// a leading "~" is expanded with ExpandHome and a relative path is taken
+// relative to the working directory. An empty path is returned unchanged,
+// so the caller's default still applies.
+func ResolvePath(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	expanded, err := ExpandHome(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(expanded)
+}
+
 // EnsureDirectories ensures all necessary directories exist
 func (c *Config) EnsureDirectories() error {
 	dirs := []string{
@@ -0,0 +1,349 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitWritesValidDocumentedConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := Init(path, false); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("config file was not created: %v", err)
+	}
+	if !strings.Contains(string(data), "# Backup format") {
+		t.Fatalf("expected field comments in config file, got:\n%s", data)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load written config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("written config is invalid: %v", err)
+	}
+
+	def := DefaultConfig()
+	if !reflect.DeepEqual(cfg.Defaults, def.Defaults) || cfg.Paths != def.Paths {
+		t.Fatalf("expected default values, got %+v", cfg)
+	}
+}
+
+func TestInitRequiresForceToOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("custom: true\n"), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	if err := Init(path, false); !errors.Is(err, ErrConfigExists) {
+		t.Fatalf("expected ErrConfigExists, got %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "custom: true\n" {
+		t.Fatalf("existing config was modified without --force")
+	}
+
+	if err := Init(path, true); err != nil {
+		t.Fatalf("init with force failed: %v", err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Fatalf("failed to load overwritten config: %v", err)
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	if err := ValidateFormat("tar.zst"); err != nil {
+		t.Fatalf("expected tar.zst to be valid, got %v", err)
+	}
+	err := ValidateFormat("zip")
+	if err == nil || !strings.Contains(err.Error(), "tar.gz, tgz, tar.zst, tar") {
+		t.Fatalf("expected an error listing the supported formats, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("defaultsAreValid", func(t *testing.T) {
+		if err := DefaultConfig().Validate(); err != nil {
+			t.Fatalf("expected default config to be valid, got %v", err)
+		}
+	})
+
+	t.Run("unsupportedFormat", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Defaults.CompressFormat = "zip"
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected error for unsupported format")
+		}
+	})
+
+	t.Run("compressLevel", func(t *testing.T) {
+		tests := []struct {
+			format  string
+			level   int
+			wantErr bool
+		}{
+			{"tar.gz", 0, false},
+			{"tar.gz", 1, false},
+			{"tar.gz", 9, false},
+			{"tar.gz", 10, true},
+			{"tar.gz", -1, true},
+			{"tgz", 9, false},
+			{"tar.zst", 9, false},
+			{"tar.zst", 19, false},
+			{"tar.zst", 20, true},
+			{"tar", 0, false},
+			{"tar", 6, true},
+		}
+		for _, tt := range tests {
+			cfg := DefaultConfig()
+			cfg.Defaults.CompressFormat = tt.format
+			cfg.Defaults.CompressLevel = tt.level
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("%s level %d: expected error %v, got %v", tt.format, tt.level, tt.wantErr, err)
+			}
+		}
+	})
+
+	t.Run("unsupportedChecksumAlgo", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Defaults.ChecksumAlgo = "md5"
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected error for unsupported checksum_algo")
+		}
+	})
+
+	t.Run("zeroRetryAttempts", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Defaults.RetryAttempts = 0
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected error for retry_attempts below 1")
+		}
+	})
+
+	t.Run("negativeKeepDays", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Defaults.KeepDays = -1
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected error for negative keep_days")
+		}
+	})
+
+	t.Run("emptyProtectedTag", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Defaults.ProtectedTags = []string{"keep-forever", ""}
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected error for an empty protected tag")
+		}
+	})
+
+	t.Run("backupInterval", func(t *testing.T) {
+		for value, wantErr := range map[string]bool{"": false, "24h": false, "7d": false, "90m": false, "0h": true, "-1d": true, "daily": true} {
+			cfg := DefaultConfig()
+			cfg.Projects["shop"] = Project{Volumes: map[string]Volume{"db": {BackupInterval: value}}}
+			if err := cfg.Validate(); (err != nil) != wantErr {
+				t.Errorf("backup_interval %q: expected error %v, got %v", value, wantErr, err)
+			}
+		}
+	})
+
+	t.Run("negativeKeepGenerations", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Defaults.KeepGenerations = -1
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected error for negative keep_generations")
+		}
+	})
+}
+
+func TestDatabasePath(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("customConfigName", func(t *testing.T) {
+		path := filepath.Join(dir, "my.yml")
+		if err := os.WriteFile(path, []byte("defaults:\n  keep_generations: 3\n"), 0o644); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if got, want := cfg.DatabasePath(path), filepath.Join(dir, "meta.db"); got != want {
+			t.Fatalf("expected %s, got %s", want, got)
+		}
+	})
+
+	t.Run("override", func(t *testing.T) {
+		t.Setenv("HOME", dir)
+		path := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(path, []byte("paths:\n  database: ~/state/dvm.db\n"), 0o644); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if got, want := cfg.DatabasePath(path), filepath.Join(dir, "state", "dvm.db"); got != want {
+			t.Fatalf("expected %s, got %s", want, got)
+		}
+	})
+}
+
+func TestLoadAppliesEnvOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `defaults:
+  compress_format: tar.gz
+  keep_generations: 3
+paths:
+  backups: /from/file
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	t.Run("backupsDir", func(t *testing.T) {
+		t.Setenv(EnvBackupsDir, "/from/env")
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if cfg.Paths.Backups != "/from/env" {
+			t.Fatalf("expected /from/env, got %s", cfg.Paths.Backups)
+		}
+	})
+
+	t.Run("compressFormat", func(t *testing.T) {
+		t.Setenv(EnvCompressFormat, "tar.zst")
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if cfg.Defaults.CompressFormat != "tar.zst" {
+			t.Fatalf("expected tar.zst, got %s", cfg.Defaults.CompressFormat)
+		}
+	})
+
+	t.Run("keepGenerations", func(t *testing.T) {
+		t.Setenv(EnvKeepGenerations, "12")
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if cfg.Defaults.KeepGenerations != 12 {
+			t.Fatalf("expected 12, got %d", cfg.Defaults.KeepGenerations)
+		}
+	})
+
+	t.Run("dbPath", func(t *testing.T) {
+		t.Setenv(EnvDBPath, ":memory:")
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if got := cfg.DatabasePath(path); got != ":memory:" {
+			t.Fatalf("expected :memory:, got %s", got)
+		}
+	})
+
+	t.Run("appliesWithoutConfigFile", func(t *testing.T) {
+		t.Setenv(EnvKeepGenerations, "7")
+		cfg, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if cfg.Defaults.KeepGenerations != 7 {
+			t.Fatalf("expected 7, got %d", cfg.Defaults.KeepGenerations)
+		}
+	})
+
+	t.Run("fileUsedWhenEnvUnset", func(t *testing.T) {
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("load failed: %v", err)
+		}
+		if cfg.Paths.Backups != "/from/file" || cfg.Defaults.KeepGenerations != 3 {
+			t.Fatalf("expected file values, got %+v", cfg)
+		}
+	})
+
+	t.Run("invalidKeepGenerations", func(t *testing.T) {
+		t.Setenv(EnvKeepGenerations, "many")
+		if _, err := Load(path); err == nil {
+			t.Fatalf("expected error for invalid %s", EnvKeepGenerations)
+		}
+	})
+
+	t.Run("invalidCompressFormat", func(t *testing.T) {
+		t.Setenv(EnvCompressFormat, "zip")
+		if _, err := Load(path); err == nil {
+			t.Fatalf("expected error for invalid %s", EnvCompressFormat)
+		}
+	})
+}
+
+func TestBackupInterval(t *testing.T) {
+	cfg := DefaultConfig()
+	if got := cfg.BackupInterval("shop", "db"); got != 0 {
+		t.Fatalf("expected no interval by default, got %v", got)
+	}
+
+	cfg.Defaults.BackupInterval = "7d"
+	cfg.Projects["shop"] = Project{
+		BackupInterval: "24h",
+		Volumes:        map[string]Volume{"db": {BackupInterval: "6h"}},
+	}
+	tests := []struct {
+		project string
+		names   []string
+		want    time.Duration
+	}{
+		{"shop", []string{"db", "shop_db"}, 6 * time.Hour},
+		{"shop", []string{"", "shop_db"}, 24 * time.Hour},
+		{"other", []string{"db"}, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := cfg.BackupInterval(tt.project, tt.names...); got != tt.want {
+			t.Errorf("%s %v: expected %v, got %v", tt.project, tt.names, tt.want, got)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	wd := t.TempDir()
+	t.Chdir(wd)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"~", home},
+		{"~/x", filepath.Join(home, "x")},
+		{"~/backups/../x", filepath.Join(home, "x")},
+		{"x", filepath.Join(wd, "x")},
+		{"./a/b/", filepath.Join(wd, "a", "b")},
+		{"~user/x", filepath.Join(wd, "~user", "x")},
+		{"/srv/dvm", "/srv/dvm"},
+	}
+	for _, tt := range tests {
+		got, err := ResolvePath(tt.path)
+		if err != nil {
+			t.Fatalf("ResolvePath(%q): %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("ResolvePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // DB wraps SQLite database
@@ -32,16 +34,58 @@ type BackupRecord struct {
 	FilePath     string
 	Size         int64
 	CreatedAt    time.Time
-	Tag          string
+	Tag          string // comma-separated tags, see Tags
 	Checksum     string
+	ChecksumAlgo string
+
+	// BaseID is the ID of the backup an incremental backup builds on, or 0
+	// for a full backup. Level counts the increments since the full backup.
+	BaseID int
+	Level  int
+
+	// Driver and DriverOpts describe the volume the backup was taken from,
+	// so a restore can recreate it the same way. Both are empty for bind
+	// mounts and backups recorded by older versions.
+	Driver     string
+	DriverOpts map[string]string
+
+	// SourceHost is the hostname of the machine that took the backup, empty
+	// for backups recorded by older versions
+	SourceHost string
+
+	// UncompressedSize is the disk usage of the volume when it was backed
+	// up, or 0 if unknown, as for bind mounts, increments and backups
+	// recorded by older versions
+	UncompressedSize int64
 }
 
-// NewDB creates a new database connection
+// VolumeBackupStats summarizes the recorded backups of one volume
+type VolumeBackupStats struct {
+	ProjectName string
+	VolumeName  string
+	Count       int
+	TotalSize   int64
+	LastBackup  time.Time
+}
+
+// IsMemoryPath reports whether dbPath names an in-memory SQLite database,
+// such as ":memory:" or "file::memory:?cache=shared", which writes no files
+func IsMemoryPath(dbPath string) bool {
+	return dbPath == ":memory:" ||
+		strings.HasPrefix(dbPath, "file::memory:") ||
+		(strings.HasPrefix(dbPath, "file:") && strings.Contains(dbPath, "mode=memory"))
+}
+
+// NewDB creates a new database connection. dbPath is a file, created with
+// its directory if missing, or an in-memory database (see IsMemoryPath)
+// that lasts until Close.
 func NewDB(dbPath string) (*DB, error) {
 	// Ensure directory exists
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, err
+	if !IsMemoryPath(dbPath) {
+		dir := filepath.Dir(dbPath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
 	}
 
 	conn, err := sql.Open("sqlite3", dbPath)
@@ -103,7 +147,14 @@ func (db *DB) initialize() error {
 		size INTEGER,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		tag TEXT,
-		checksum TEXT
+		checksum TEXT,
+		checksum_algo TEXT,
+		base_id INTEGER,
+		level INTEGER DEFAULT 0,
+		driver TEXT,
+		driver_opts TEXT,
+		source_host TEXT,
+		uncompressed_size INTEGER
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_volume_name ON backup_records(volume_name);
@@ -111,10 +162,95 @@ func (db *DB) initialize() error {
 	CREATE INDEX IF NOT EXISTS idx_created_at ON backup_records(created_at);
 	`
 
-	_, err := db.conn.Exec(schema)
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	return db.migrate()
+}
+
+// migrate adds columns introduced after the initial schema to databases
+// created by older versions
+func (db *DB) migrate() error {
+	columns := []struct{ name, definition string }{
+		{"checksum_algo", "TEXT"},
+		{"base_id", "INTEGER"},
+		{"level", "INTEGER DEFAULT 0"},
+		{"driver", "TEXT"},
+		{"driver_opts", "TEXT"},
+		{"source_host", "TEXT"},
+		{"uncompressed_size", "INTEGER"},
+	}
+	for _, col := range columns {
+		if err := db.addColumnIfMissing("backup_records", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to table unless it already exists
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	columns, err := db.columns(table)
+	if err != nil {
+		return err
+	}
+	if columns[column] {
+		return nil
+	}
+
+	_, err = db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
+// columns returns the names of the columns of table
+func (db *DB) columns(table string) (map[string]bool, error) {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// schemaColumns lists the columns the current schema has in each table
+var schemaColumns = map[string][]string{
+	"volume_metadata": {"volume_name", "last_accessed", "last_backup", "backup_count"},
+	"backup_records": {
+		"id", "volume_name", "service_name", "project_name", "file_path", "size", "created_at",
+		"tag", "checksum", "checksum_algo", "base_id", "level", "driver", "driver_opts",
+		"source_host", "uncompressed_size",
+	},
+}
+
+// CheckSchema verifies that every table has the columns of the current
+// schema, reporting the first one missing
+func (db *DB) CheckSchema() error {
+	for _, table := range []string{"volume_metadata", "backup_records"} {
+		columns, err := db.columns(table)
+		if err != nil {
+			return err
+		}
+		for _, column := range schemaColumns[table] {
+			if !columns[column] {
+				return fmt.Errorf("table %s is missing column %s", table, column)
+			}
+		}
+	}
+	return nil
+}
+
 // UpdateLastAccessed updates the last accessed time for a volume
 func (db *DB) UpdateLastAccessed(volumeName string) error {
 	query := `
@@ -127,8 +263,57 @@ func (db *DB) UpdateLastAccessed(volumeName string) error {
 	return err
 }
 
+// execer is implemented by both *sql.DB and *sql.Tx, so statements can run
+// on their own or as part of a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// WithTx runs fn in a transaction, committing it if fn returns nil and
+// rolling it back otherwise. fn must run every statement on tx: the
+// database has a single connection, which the transaction holds.
+func (db *DB) WithTx(fn func(*sql.Tx) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordBackup adds the record of a new backup and updates the volume's
+// last backup time and count in one transaction, so an interrupted or
+// failed write leaves neither behind
+func (db *DB) RecordBackup(record *BackupRecord) error {
+	err := db.WithTx(func(tx *sql.Tx) error {
+		if err := addBackupRecord(tx, record); err != nil {
+			return err
+		}
+		return updateLastBackup(tx, record.VolumeName)
+	})
+	if err != nil {
+		// The ID was never committed
+		record.ID = 0
+	}
+	return err
+}
+
 // UpdateLastBackup updates the last backup time for a volume
 func (db *DB) UpdateLastBackup(volumeName string) error {
+	return updateLastBackup(db.conn, volumeName)
+}
+
+func updateLastBackup(ex execer, volumeName string) error {
 	query := `
 	INSERT INTO volume_metadata (volume_name, last_backup, backup_count)
 	VALUES (?, ?, 1)
@@ -137,7 +322,7 @@ func (db *DB) UpdateLastBackup(volumeName string) error {
 		backup_count = backup_count + 1
 	`
 	now := time.Now()
-	_, err := db.conn.Exec(query, volumeName, now, now)
+	_, err := ex.Exec(query, volumeName, now, now)
 	return err
 }
 
@@ -179,14 +364,91 @@ func (db *DB) GetVolumeMetadata(volumeName string) (*VolumeMetadata, error) {
 	return &meta, nil
 }
 
-// AddBackupRecord adds a backup record
+// AddBackupRecord adds a backup record and sets record.ID to its new ID.
+// A record without a SourceHost is stamped with this machine's hostname.
 func (db *DB) AddBackupRecord(record *BackupRecord) error {
+	return addBackupRecord(db.conn, record)
+}
+
+// tagSeparator separates the tags of a backup in the tag column
+const tagSeparator = ","
+
+// JoinTags joins tags into the value of BackupRecord.Tag, dropping empty
+// and repeated tags
+func JoinTags(tags []string) string {
+	var kept []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		kept = append(kept, tag)
+	}
+	return strings.Join(kept, tagSeparator)
+}
+
+// ValidateTag checks that tag can be stored as one of the tags of a backup.
+// Empty tags are allowed and dropped by JoinTags.
+func ValidateTag(tag string) error {
+	if strings.Contains(tag, tagSeparator) {
+		return fmt.Errorf("tag %q must not contain %q", tag, tagSeparator)
+	}
+	return nil
+}
+
+// Tags returns the tags of the backup
+func (r *BackupRecord) Tags() []string {
+	if r.Tag == "" {
+		return nil
+	}
+	return strings.Split(r.Tag, tagSeparator)
+}
+
+// HasTag reports whether tag is one of the tags of the backup
+func (r *BackupRecord) HasTag(tag string) bool {
+	for _, t := range r.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// tagMatchSQL matches a row whose tag column contains the tag bound to the
+// placeholder as a whole element, so "prod" does not match "preprod"
+const tagMatchSQL = "instr(',' || tag || ',', ',' || ? || ',') > 0"
+
+func addBackupRecord(ex execer, record *BackupRecord) error {
+	record.Tag = JoinTags(strings.Split(record.Tag, tagSeparator))
+	if record.SourceHost == "" {
+		if host, err := os.Hostname(); err == nil {
+			record.SourceHost = host
+		}
+	}
+
 	query := `
-	INSERT INTO backup_records (volume_name, service_name, project_name, file_path, size, tag, checksum)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO backup_records (volume_name, service_name, project_name, file_path, size, tag, checksum, checksum_algo, base_id, level, driver, driver_opts, source_host, uncompressed_size)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := db.conn.Exec(query,
+	var baseID sql.NullInt64
+	if record.BaseID != 0 {
+		baseID = sql.NullInt64{Int64: int64(record.BaseID), Valid: true}
+	}
+
+	// Driver options are stored as a JSON object
+	var driverOpts sql.NullString
+	if len(record.DriverOpts) > 0 {
+		data, err := json.Marshal(record.DriverOpts)
+		if err != nil {
+			return err
+		}
+		driverOpts = sql.NullString{String: string(data), Valid: true}
+	}
+
+	result, err := ex.Exec(query,
 		record.VolumeName,
 		record.ServiceName,
 		record.ProjectName,
@@ -194,42 +456,194 @@ func (db *DB) AddBackupRecord(record *BackupRecord) error {
 		record.Size,
 		record.Tag,
 		record.Checksum,
+		record.ChecksumAlgo,
+		baseID,
+		record.Level,
+		record.Driver,
+		driverOpts,
+		record.SourceHost,
+		record.UncompressedSize,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	if id, err := result.LastInsertId(); err == nil {
+		record.ID = int(id)
+	}
+	return nil
 }
 
 // GetBackupRecords gets backup records for a volume
 func (db *DB) GetBackupRecords(volumeName string, limit int) ([]*BackupRecord, error) {
+	return db.QueryBackupRecords(BackupRecordQuery{VolumeName: volumeName, Limit: limit})
+}
+
+// GetAllBackupRecords gets all backup records
+func (db *DB) GetAllBackupRecords(limit int) ([]*BackupRecord, error) {
+	return db.QueryBackupRecords(BackupRecordQuery{Limit: limit})
+}
+
+// BackupRecordQuery selects backup records for QueryBackupRecords. Empty
+// fields do not filter.
+type BackupRecordQuery struct {
+	VolumeName string
+	Project    string
+	ByProject  bool // filter on Project even when it is empty
+	Tag        string
+	SourceHost string
+
+	// A page of the matching records, newest first
+	Limit  int // 0 for no limit
+	Offset int
+}
+
+// QueryBackupRecords gets the backup records matching q, newest first. The
+// filtering and paging happen in SQL, so only the records returned are read.
+func (db *DB) QueryBackupRecords(q BackupRecordQuery) ([]*BackupRecord, error) {
+	query, args := backupRecordsSQL(q)
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanBackupRecords(rows)
+}
+
+// backupRecordsSQL builds the statement of QueryBackupRecords and its
+// arguments
+func backupRecordsSQL(q BackupRecordQuery) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if q.VolumeName != "" {
+		where = append(where, "volume_name = ?")
+		args = append(args, q.VolumeName)
+	}
+	// Plain comparisons on project_name, unlike COALESCE, can use its index
+	if q.Project != "" {
+		where = append(where, "project_name = ?")
+		args = append(args, q.Project)
+	} else if q.ByProject {
+		where = append(where, "(project_name IS NULL OR project_name = '')")
+	}
+	if q.Tag != "" {
+		where = append(where, tagMatchSQL)
+		args = append(args, q.Tag)
+	}
+	if q.SourceHost != "" {
+		where = append(where, "source_host = ?")
+		args = append(args, q.SourceHost)
+	}
+
 	query := `
-	SELECT id, volume_name, service_name, project_name, file_path, size, created_at, tag, checksum
+	SELECT id, volume_name, service_name, project_name, file_path, size, created_at, tag, checksum, checksum_algo, base_id, level, driver, driver_opts, source_host, uncompressed_size
 	FROM backup_records
-	WHERE volume_name = ?
-	ORDER BY created_at DESC
 	`
+	if len(where) > 0 {
+		query += "WHERE " + strings.Join(where, " AND ") + "\n"
+	}
+	query += "ORDER BY created_at DESC, id DESC"
 
-	if limit > 0 {
-		query += " LIMIT ?"
+	// SQLite only takes an offset after a limit, where -1 means none
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, max(q.Offset, 0))
 	}
 
-	var rows *sql.Rows
-	var err error
+	return query, args
+}
 
-	if limit > 0 {
-		rows, err = db.conn.Query(query, volumeName, limit)
-	} else {
-		rows, err = db.conn.Query(query, volumeName)
+// GetLatestBackupRecordByTag gets the most recent backup record for a volume
+// carrying the given tag among its tags. It returns nil if there is none.
+func (db *DB) GetLatestBackupRecordByTag(volumeName, tag string) (*BackupRecord, error) {
+	query := `
+	SELECT id, volume_name, service_name, project_name, file_path, size, created_at, tag, checksum, checksum_algo, base_id, level, driver, driver_opts, source_host, uncompressed_size
+	FROM backup_records
+	WHERE volume_name = ? AND ` + tagMatchSQL + `
+	ORDER BY created_at DESC, id DESC
+	LIMIT 1
+	`
+
+	rows, err := db.conn.Query(query, volumeName, tag)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
+	records, err := scanBackupRecords(rows)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// GetLatestBackupChecksum gets the checksum and file path of the most recent
+// backup of a volume. Both are empty if the volume has no backups.
+func (db *DB) GetLatestBackupChecksum(volumeName string) (string, string, error) {
+	query := `
+	SELECT COALESCE(checksum, ''), file_path
+	FROM backup_records
+	WHERE volume_name = ?
+	ORDER BY created_at DESC, id DESC
+	LIMIT 1
+	`
+
+	var checksum, filePath string
+	err := db.conn.QueryRow(query, volumeName).Scan(&checksum, &filePath)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	return checksum, filePath, err
+}
+
+// GetBackupRecordByID gets a backup record by ID. It returns nil if there
+// is none.
+func (db *DB) GetBackupRecordByID(id int) (*BackupRecord, error) {
+	return db.getBackupRecord("id = ?", id)
+}
+
+// GetBackupRecordByPath gets the most recent backup record for a backup
+// file. It returns nil if the file is not recorded.
+func (db *DB) GetBackupRecordByPath(path string) (*BackupRecord, error) {
+	return db.getBackupRecord("file_path = ?", path)
+}
+
+// getBackupRecord gets the newest backup record matching where
+func (db *DB) getBackupRecord(where string, args ...interface{}) (*BackupRecord, error) {
+	query := `
+	SELECT id, volume_name, service_name, project_name, file_path, size, created_at, tag, checksum, checksum_algo, base_id, level, driver, driver_opts, source_host, uncompressed_size
+	FROM backup_records
+	WHERE ` + where + `
+	ORDER BY id DESC
+	LIMIT 1
+	`
+
+	rows, err := db.conn.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	records, err := scanBackupRecords(rows)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// scanBackupRecords reads backup records from rows selected with the column
+// list used by the backup record queries
+func scanBackupRecords(rows *sql.Rows) ([]*BackupRecord, error) {
 	var records []*BackupRecord
 	for rows.Next() {
 		var record BackupRecord
-		var serviceName, projectName, tag, checksum sql.NullString
+		var serviceName, projectName, tag, checksum, checksumAlgo, driver, driverOpts, sourceHost sql.NullString
+		var baseID, level, uncompressedSize sql.NullInt64
 
 		err := rows.Scan(
 			&record.ID,
@@ -241,6 +655,13 @@ func (db *DB) GetBackupRecords(volumeName string, limit int) ([]*BackupRecord, e
 			&record.CreatedAt,
 			&tag,
 			&checksum,
+			&checksumAlgo,
+			&baseID,
+			&level,
+			&driver,
+			&driverOpts,
+			&sourceHost,
+			&uncompressedSize,
 		)
 		if err != nil {
 			return nil, err
@@ -258,6 +679,29 @@ func (db *DB) GetBackupRecords(volumeName string, limit int) ([]*BackupRecord, e
 		if checksum.Valid {
 			record.Checksum = checksum.String
 		}
+		if checksumAlgo.Valid {
+			record.ChecksumAlgo = checksumAlgo.String
+		}
+		if baseID.Valid {
+			record.BaseID = int(baseID.Int64)
+		}
+		if level.Valid {
+			record.Level = int(level.Int64)
+		}
+		if driver.Valid {
+			record.Driver = driver.String
+		}
+		if driverOpts.Valid && driverOpts.String != "" {
+			if err := json.Unmarshal([]byte(driverOpts.String), &record.DriverOpts); err != nil {
+				return nil, fmt.Errorf("invalid driver options for backup record %d: %w", record.ID, err)
+			}
+		}
+		if sourceHost.Valid {
+			record.SourceHost = sourceHost.String
+		}
+		if uncompressedSize.Valid {
+			record.UncompressedSize = uncompressedSize.Int64
+		}
 
 		records = append(records, &record)
 	}
@@ -265,69 +709,51 @@ func (db *DB) GetBackupRecords(volumeName string, limit int) ([]*BackupRecord, e
 	return records, rows.Err()
 }
 
-// GetAllBackupRecords gets all backup records
-func (db *DB) GetAllBackupRecords(limit int) ([]*BackupRecord, error) {
+// GetBackupStats returns the number, total size and latest creation time of
+// the recorded backups of each volume, by project and volume name
+func (db *DB) GetBackupStats() ([]*VolumeBackupStats, error) {
 	query := `
-	SELECT id, volume_name, service_name, project_name, file_path, size, created_at, tag, checksum
+	SELECT COALESCE(project_name, ''), volume_name, COUNT(*), COALESCE(SUM(size), 0), MAX(created_at)
 	FROM backup_records
-	ORDER BY created_at DESC
+	GROUP BY COALESCE(project_name, ''), volume_name
+	ORDER BY 1, 2
 	`
 
-	if limit > 0 {
-		query += " LIMIT ?"
-	}
-
-	var rows *sql.Rows
-	var err error
-
-	if limit > 0 {
-		rows, err = db.conn.Query(query, limit)
-	} else {
-		rows, err = db.conn.Query(query)
-	}
-
+	rows, err := db.conn.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var records []*BackupRecord
+	var stats []*VolumeBackupStats
 	for rows.Next() {
-		var record BackupRecord
-		var serviceName, projectName, tag, checksum sql.NullString
-
-		err := rows.Scan(
-			&record.ID,
-			&record.VolumeName,
-			&serviceName,
-			&projectName,
-			&record.FilePath,
-			&record.Size,
-			&record.CreatedAt,
-			&tag,
-			&checksum,
-		)
-		if err != nil {
+		var s VolumeBackupStats
+		var lastBackup sql.NullString
+		if err := rows.Scan(&s.ProjectName, &s.VolumeName, &s.Count, &s.TotalSize, &lastBackup); err != nil {
 			return nil, err
 		}
-
-		if serviceName.Valid {
-			record.ServiceName = serviceName.String
-		}
-		if projectName.Valid {
-			record.ProjectName = projectName.String
-		}
-		if tag.Valid {
-			record.Tag = tag.String
-		}
-		if checksum.Valid {
-			record.Checksum = checksum.String
+		if lastBackup.Valid {
+			if s.LastBackup, err = parseTimestamp(lastBackup.String); err != nil {
+				return nil, err
+			}
 		}
-
-		records = append(records, &record)
+		stats = append(stats, &s)
 	}
 
-	return records, rows.Err()
+	return stats, rows.Err()
+}
+
+// parseTimestamp parses a TIMESTAMP value returned by an SQL expression,
+// which the driver passes through as text rather than converting like a
+// column
+func parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
 }
 
 // GetStaleVolumes gets volumes not accessed for the specified number of days
@@ -356,6 +782,39 @@ func (db *DB) GetStaleVolumes(days int) ([]string, error) {
 	return volumes, rows.Err()
 }
 
+// GetVolumesNotAccessedSince gets volumes last accessed before t. Volumes
+// never accessed are not included.
+func (db *DB) GetVolumesNotAccessedSince(t time.Time) ([]string, error) {
+	query := `
+	SELECT volume_name, last_accessed
+	FROM volume_metadata
+	WHERE last_accessed IS NOT NULL
+	ORDER BY volume_name
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Times are stored as text with their zone offset, which SQL would
+	// compare as strings, so the comparison happens here
+	var volumes []string
+	for rows.Next() {
+		var volumeName string
+		var lastAccessed time.Time
+		if err := rows.Scan(&volumeName, &lastAccessed); err != nil {
+			return nil, err
+		}
+		if lastAccessed.Before(t) {
+			volumes = append(volumes, volumeName)
+		}
+	}
+
+	return volumes, rows.Err()
+}
+
 // DeleteBackupRecord deletes a backup record
 func (db *DB) DeleteBackupRecord(id int) error {
 	query := `DELETE FROM backup_records WHERE id = ?`
@@ -363,42 +822,142 @@ func (db *DB) DeleteBackupRecord(id int) error {
 	return err
 }
 
-// CleanupOldBackups deletes old backup records beyond keep_generations
-func (db *DB) CleanupOldBackups(volumeName string, keepGenerations int) ([]*BackupRecord, error) {
-	// Get all records for this volume
-	records, err := db.GetBackupRecords(volumeName, 0)
+// SetBackupTag replaces the tags of a backup record with tag, a value as
+// made by JoinTags. An empty tag clears them.
+func (db *DB) SetBackupTag(id int, tag string) error {
+	var value sql.NullString
+	if tag != "" {
+		value = sql.NullString{String: tag, Valid: true}
+	}
+
+	result, err := db.conn.Exec(`UPDATE backup_records SET tag = ? WHERE id = ?`, value, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("backup record %d not found", id)
+	}
+	return nil
+}
+
+// CleanupOldBackups deletes the backup records of a volume that fall outside
+// the retention policy, as reported by PreviewCleanup, and returns them
+func (db *DB) CleanupOldBackups(volumeName string, keepGenerations, keepDays int, protectedTags []string) ([]*BackupRecord, error) {
+	toDelete, err := db.PreviewCleanup(volumeName, keepGenerations, keepDays, protectedTags)
 	if err != nil {
 		return nil, err
 	}
 
-	// If we have more than keepGenerations, delete the oldest
-	if len(records) > keepGenerations {
-		toDelete := records[keepGenerations:]
-		var deleted []*BackupRecord
-		var errs []error
+	var deleted []*BackupRecord
+	var errs []error
+	for _, record := range toDelete {
+		if err := db.DeleteBackupRecord(record.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete backup record %d (file: %s): %w", record.ID, record.FilePath, err))
+		} else {
+			deleted = append(deleted, record)
+		}
+	}
 
-		for _, record := range toDelete {
-			if err := db.DeleteBackupRecord(record.ID); err != nil {
-				errs = append(errs, fmt.Errorf("failed to delete backup record %d (file: %s): %w", record.ID, record.FilePath, err))
-			} else {
-				deleted = append(deleted, record)
+	// Return errors if any occurred
+	if len(errs) > 0 {
+		var errMsg string
+		for i, e := range errs {
+			if i > 0 {
+				errMsg += "; "
 			}
+			errMsg += e.Error()
 		}
+		return deleted, fmt.Errorf("cleanup errors: %s", errMsg)
+	}
 
-		// Return errors if any occurred
-		if len(errs) > 0 {
-			var errMsg string
-			for i, e := range errs {
-				if i > 0 {
-					errMsg += "; "
-				}
-				errMsg += e.Error()
-			}
-			return deleted, fmt.Errorf("cleanup errors: %s", errMsg)
+	return deleted, nil
+}
+
+// PreviewCleanup returns the backup records of a volume that
+// CleanupOldBackups would delete, without deleting them. The newest
+// keepGenerations backups are kept (0 keeps all), as are backups younger
+// than keepDays days (0 disables the age limit) and the bases that kept
+// incremental backups build on. Backups with any tag in protectedTags
+// are always kept and do not count towards keepGenerations.
+func (db *DB) PreviewCleanup(volumeName string, keepGenerations, keepDays int, protectedTags []string) ([]*BackupRecord, error) {
+	if keepGenerations <= 0 {
+		return nil, nil
+	}
+
+	records, err := db.GetBackupRecords(volumeName, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) <= keepGenerations {
+		return nil, nil
+	}
+
+	protected := make(map[string]bool, len(protectedTags))
+	for _, tag := range protectedTags {
+		protected[tag] = true
+	}
+
+	var kept, candidates []*BackupRecord
+	cutoff := time.Now().AddDate(0, 0, -keepDays)
+	generations := 0
+	for _, record := range records {
+		switch {
+		case hasProtectedTag(record, protected):
+			kept = append(kept, record)
+		case generations < keepGenerations || (keepDays > 0 && record.CreatedAt.After(cutoff)):
+			generations++
+			kept = append(kept, record)
+		default:
+			generations++
+			candidates = append(candidates, record)
 		}
+	}
+
+	// Backups that kept incremental backups build on must survive, or
+	// the kept backups could no longer be restored
+	required := requiredBases(records, kept)
 
-		return deleted, nil
+	var toDelete []*BackupRecord
+	for _, record := range candidates {
+		if !required[record.ID] {
+			toDelete = append(toDelete, record)
+		}
 	}
+	return toDelete, nil
+}
 
-	return nil, nil
+// hasProtectedTag reports whether any of the tags of record is protected
+func hasProtectedTag(record *BackupRecord, protected map[string]bool) bool {
+	for _, tag := range record.Tags() {
+		if protected[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredBases returns the IDs of the records in all that the kept records
+// build on, directly or through other incremental backups
+func requiredBases(all, kept []*BackupRecord) map[int]bool {
+	byID := make(map[int]*BackupRecord, len(all))
+	for _, record := range all {
+		byID[record.ID] = record
+	}
+
+	required := make(map[int]bool)
+	for _, record := range kept {
+		for id := record.BaseID; id != 0 && !required[id]; {
+			required[id] = true
+			base, ok := byID[id]
+			if !ok {
+				break
+			}
+			id = base.BaseID
+		}
+	}
+	return required
 }
@@ -0,0 +1,701 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "meta.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestNewDBInMemory(t *testing.T) {
+	for path, want := range map[string]bool{
+		":memory:":                          true,
+		"file::memory:?cache=shared":        true,
+		"file:dvm?mode=memory&cache=shared": true,
+		"/var/lib/dvm/meta.db":              false,
+		"memory.db":                         false,
+	} {
+		if got := IsMemoryPath(path); got != want {
+			t.Errorf("IsMemoryPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	// Opening must not create a directory named after the DSN
+	t.Chdir(t.TempDir())
+	db, err := NewDB("file::memory:?cache=shared")
+	if err != nil {
+		t.Fatalf("failed to open in-memory database: %v", err)
+	}
+	defer db.Close()
+
+	rec := &BackupRecord{VolumeName: "app_data", FilePath: "/b/app.tar.gz", Size: 42, Tag: "ci"}
+	if err := db.AddBackupRecord(rec); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+	got, err := db.GetBackupRecordByID(rec.ID)
+	if err != nil || got == nil || got.FilePath != rec.FilePath || got.Size != 42 || got.Tag != "ci" {
+		t.Fatalf("expected the record back, got %+v, %v", got, err)
+	}
+
+	if entries, err := os.ReadDir("."); err != nil || len(entries) != 0 {
+		t.Fatalf("expected no files to be written, got %v, %v", entries, err)
+	}
+}
+
+func TestGetLatestBackupRecordByTag(t *testing.T) {
+	db := newTestDB(t)
+
+	records := []*BackupRecord{
+		{VolumeName: "app_data", FilePath: "/b/first_swap.tar.gz", Tag: "swap-backup"},
+		{VolumeName: "app_data", FilePath: "/b/second_swap.tar.gz", Tag: "swap-backup"},
+		{VolumeName: "app_data", FilePath: "/b/manual.tar.gz"},
+		{VolumeName: "other_data", FilePath: "/b/other_swap.tar.gz", Tag: "swap-backup"},
+	}
+	for _, rec := range records {
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	got, err := db.GetLatestBackupRecordByTag("app_data", "swap-backup")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if got == nil || got.FilePath != "/b/second_swap.tar.gz" {
+		t.Fatalf("expected second swap backup, got %+v", got)
+	}
+
+	got, err = db.GetLatestBackupRecordByTag("app_data", "archive")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("expected no record, got %+v", got)
+	}
+}
+
+func TestBackupRecordStoresChecksumAlgo(t *testing.T) {
+	db := newTestDB(t)
+
+	rec := &BackupRecord{VolumeName: "app_data", FilePath: "/b/app.tar.gz", Checksum: "xxh64:0123456789abcdef", ChecksumAlgo: "xxh64"}
+	if err := db.AddBackupRecord(rec); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	records, err := db.GetBackupRecords("app_data", 0)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Checksum != rec.Checksum || records[0].ChecksumAlgo != "xxh64" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+}
+
+func TestBackupRecordStoresVolumeDriver(t *testing.T) {
+	db := newTestDB(t)
+
+	rec := &BackupRecord{
+		VolumeName: "app_data",
+		FilePath:   "/b/app.tar.gz",
+		Driver:     "local",
+		DriverOpts: map[string]string{"type": "nfs", "o": "addr=10.0.0.1,rw", "device": ":/exports/app"},
+	}
+	if err := db.AddBackupRecord(rec); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+	if err := db.AddBackupRecord(&BackupRecord{VolumeName: "app_data", FilePath: "/b/bind.tar.gz"}); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	got, err := db.GetBackupRecordByPath("/b/app.tar.gz")
+	if err != nil || got == nil {
+		t.Fatalf("lookup failed: %v, %v", got, err)
+	}
+	if got.Driver != "local" || len(got.DriverOpts) != 3 || got.DriverOpts["o"] != "addr=10.0.0.1,rw" {
+		t.Fatalf("expected driver and options to round-trip, got %+v", got)
+	}
+
+	plain, err := db.GetBackupRecordByPath("/b/bind.tar.gz")
+	if err != nil || plain == nil || plain.Driver != "" || plain.DriverOpts != nil {
+		t.Fatalf("expected no driver for a record without one, got %+v, %v", plain, err)
+	}
+}
+
+func TestBackupRecordStoresSourceHost(t *testing.T) {
+	db := newTestDB(t)
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skipf("hostname unavailable: %v", err)
+	}
+
+	if err := db.AddBackupRecord(&BackupRecord{VolumeName: "app_data", FilePath: "/b/local.tar.gz"}); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+	if err := db.AddBackupRecord(&BackupRecord{VolumeName: "app_data", FilePath: "/b/remote.tar.gz", SourceHost: "build-01"}); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	local, err := db.GetBackupRecordByPath("/b/local.tar.gz")
+	if err != nil || local == nil || local.SourceHost != host {
+		t.Fatalf("expected source host %q, got %+v, %v", host, local, err)
+	}
+	remote, err := db.GetBackupRecordByPath("/b/remote.tar.gz")
+	if err != nil || remote == nil || remote.SourceHost != "build-01" {
+		t.Fatalf("expected explicit source host to be kept, got %+v, %v", remote, err)
+	}
+}
+
+func TestRecordBackupIsAtomic(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.RecordBackup(&BackupRecord{VolumeName: "app_data", FilePath: "/b/first.tar.gz"}); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+
+	// Fail the metadata update, which runs after the record is inserted
+	if _, err := db.conn.Exec(`
+	CREATE TRIGGER fail_metadata BEFORE UPDATE ON volume_metadata
+	BEGIN
+		SELECT RAISE(ABORT, 'injected failure');
+	END;
+	`); err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	rec := &BackupRecord{VolumeName: "app_data", FilePath: "/b/second.tar.gz"}
+	err := db.RecordBackup(rec)
+	if err == nil || !strings.Contains(err.Error(), "injected failure") {
+		t.Fatalf("expected injected failure, got %v", err)
+	}
+	if rec.ID != 0 {
+		t.Fatalf("expected ID of the rolled back record to be reset, got %d", rec.ID)
+	}
+
+	records, err := db.GetBackupRecords("app_data", 0)
+	if err != nil || len(records) != 1 || records[0].FilePath != "/b/first.tar.gz" {
+		t.Fatalf("expected only the first record to be committed, got %+v, %v", records, err)
+	}
+	meta, err := db.GetVolumeMetadata("app_data")
+	if err != nil || meta == nil || meta.BackupCount != 1 {
+		t.Fatalf("expected backup count to stay at 1, got %+v, %v", meta, err)
+	}
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	db := newTestDB(t)
+
+	injected := errors.New("injected failure")
+	err := db.WithTx(func(tx *sql.Tx) error {
+		if err := addBackupRecord(tx, &BackupRecord{VolumeName: "app_data", FilePath: "/b/app.tar.gz"}); err != nil {
+			return err
+		}
+		return injected
+	})
+	if !errors.Is(err, injected) {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+
+	records, err := db.GetBackupRecords("app_data", 0)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("expected no committed records, got %+v, %v", records, err)
+	}
+
+	// The connection must be usable again after the rollback
+	if err := db.AddBackupRecord(&BackupRecord{VolumeName: "app_data", FilePath: "/b/app.tar.gz"}); err != nil {
+		t.Fatalf("add after rollback failed: %v", err)
+	}
+}
+
+func TestNewDBMigratesLegacySchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta.db")
+
+	// Create a database with the schema used before checksum_algo existed
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = conn.Exec(`
+	CREATE TABLE backup_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		volume_name TEXT NOT NULL,
+		service_name TEXT,
+		project_name TEXT,
+		file_path TEXT NOT NULL,
+		size INTEGER,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		tag TEXT,
+		checksum TEXT
+	);
+	INSERT INTO backup_records (volume_name, file_path, size, checksum) VALUES ('app_data', '/b/old.tar.gz', 42, 'abc123');
+	`)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("failed to open legacy database: %v", err)
+	}
+	defer db.Close()
+
+	records, err := db.GetBackupRecords("app_data", 0)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 1 || records[0].Checksum != "abc123" || records[0].ChecksumAlgo != "" || records[0].Driver != "" || records[0].SourceHost != "" {
+		t.Fatalf("unexpected legacy records: %+v", records)
+	}
+}
+
+func TestCleanupOldBackupsKeepsIncrementalBases(t *testing.T) {
+	db := newTestDB(t)
+
+	// An old full backup, then a level-0 backup with two increments
+	old := &BackupRecord{VolumeName: "app_data", FilePath: "/b/old.tar.gz"}
+	base := &BackupRecord{VolumeName: "app_data", FilePath: "/b/base.tar.gz"}
+	for _, rec := range []*BackupRecord{old, base} {
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+	delta1 := &BackupRecord{VolumeName: "app_data", FilePath: "/b/delta1.tar.gz", BaseID: base.ID, Level: 1}
+	if err := db.AddBackupRecord(delta1); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+	delta2 := &BackupRecord{VolumeName: "app_data", FilePath: "/b/delta2.tar.gz", BaseID: delta1.ID, Level: 2}
+	if err := db.AddBackupRecord(delta2); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	got, err := db.GetBackupRecordByPath("/b/delta2.tar.gz")
+	if err != nil || got == nil || got.BaseID != delta1.ID || got.Level != 2 {
+		t.Fatalf("expected base and level to round-trip, got %+v, %v", got, err)
+	}
+
+	deleted, err := db.CleanupOldBackups("app_data", 1, 0, nil)
+	if err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != old.ID {
+		t.Fatalf("expected only the unrelated full backup to be deleted, got %+v", deleted)
+	}
+
+	for _, rec := range []*BackupRecord{base, delta1, delta2} {
+		if got, err := db.GetBackupRecordByID(rec.ID); err != nil || got == nil {
+			t.Fatalf("expected %s to be kept, got %v, %v", rec.FilePath, got, err)
+		}
+	}
+}
+
+func TestPreviewCleanupMatchesCleanup(t *testing.T) {
+	tests := []struct {
+		name            string
+		keepGenerations int
+		keepDays        int
+		protectedTags   []string
+		want            []string
+	}{
+		{name: "keepAll", keepGenerations: 0, want: nil},
+		{name: "singleGeneration", keepGenerations: 1, want: []string{"recent", "delta", "base", "old"}},
+		{name: "generationsOnly", keepGenerations: 2, want: []string{"delta", "base", "old"}},
+		{name: "keptDeltaPinsBase", keepGenerations: 3, want: []string{"old"}},
+		{name: "daysExtendGenerations", keepGenerations: 1, keepDays: 7, want: []string{"delta", "base", "old"}},
+		{name: "daysPinBase", keepGenerations: 1, keepDays: 15, want: []string{"old"}},
+		{name: "protectedTagKept", keepGenerations: 1, protectedTags: []string{"keep-forever"}, want: []string{"recent", "delta", "base"}},
+		{name: "protectedDeltaPinsBase", keepGenerations: 1, protectedTags: []string{"milestone"}, want: []string{"recent", "old"}},
+		{name: "protectedNotCountedAsGeneration", keepGenerations: 1, protectedTags: []string{"pinned"}, want: []string{"delta", "base", "old"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+
+			// Oldest first: a full backup, a level-0 base with one increment,
+			// then two recent full backups
+			ages := []struct {
+				name string
+				days int
+				base string
+				tag  string
+			}{
+				{"old", 30, "", "keep-forever"},
+				{"base", 20, "", ""},
+				{"delta", 10, "base", "milestone"},
+				{"recent", 3, "", ""},
+				{"latest", 0, "", "pinned"},
+			}
+			ids := make(map[string]int)
+			names := make(map[int]string)
+			for _, a := range ages {
+				rec := &BackupRecord{VolumeName: "app_data", FilePath: "/b/" + a.name + ".tar.gz", Tag: a.tag}
+				if a.base != "" {
+					rec.BaseID = ids[a.base]
+					rec.Level = 1
+				}
+				if err := db.AddBackupRecord(rec); err != nil {
+					t.Fatalf("failed to add record: %v", err)
+				}
+				createdAt := time.Now().UTC().AddDate(0, 0, -a.days).Add(-time.Hour)
+				if _, err := db.conn.Exec("UPDATE backup_records SET created_at = ? WHERE id = ?", createdAt, rec.ID); err != nil {
+					t.Fatalf("failed to backdate record: %v", err)
+				}
+				ids[a.name] = rec.ID
+				names[rec.ID] = a.name
+			}
+
+			preview, err := db.PreviewCleanup("app_data", tt.keepGenerations, tt.keepDays, tt.protectedTags)
+			if err != nil {
+				t.Fatalf("preview failed: %v", err)
+			}
+			var previewed []string
+			for _, rec := range preview {
+				previewed = append(previewed, names[rec.ID])
+			}
+			if strings.Join(previewed, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected preview %v, got %v", tt.want, previewed)
+			}
+
+			// The preview must not delete anything
+			if records, err := db.GetBackupRecords("app_data", 0); err != nil || len(records) != len(ages) {
+				t.Fatalf("expected preview to keep all %d records, got %d, %v", len(ages), len(records), err)
+			}
+
+			deleted, err := db.CleanupOldBackups("app_data", tt.keepGenerations, tt.keepDays, tt.protectedTags)
+			if err != nil {
+				t.Fatalf("cleanup failed: %v", err)
+			}
+			var removed []string
+			for _, rec := range deleted {
+				removed = append(removed, names[rec.ID])
+			}
+			if strings.Join(removed, ",") != strings.Join(previewed, ",") {
+				t.Fatalf("cleanup removed %v, but preview reported %v", removed, previewed)
+			}
+		})
+	}
+}
+
+func TestSetBackupTag(t *testing.T) {
+	db := newTestDB(t)
+
+	rec := &BackupRecord{VolumeName: "app_data", FilePath: "/b/app.tar.gz", Tag: "daily"}
+	if err := db.AddBackupRecord(rec); err != nil {
+		t.Fatalf("failed to add record: %v", err)
+	}
+
+	if err := db.SetBackupTag(rec.ID, "keep-forever"); err != nil {
+		t.Fatalf("set tag failed: %v", err)
+	}
+	got, err := db.GetBackupRecordByID(rec.ID)
+	if err != nil || got == nil || got.Tag != "keep-forever" {
+		t.Fatalf("expected tag keep-forever, got %+v, %v", got, err)
+	}
+
+	if err := db.SetBackupTag(rec.ID, ""); err != nil {
+		t.Fatalf("clear tag failed: %v", err)
+	}
+	got, err = db.GetBackupRecordByID(rec.ID)
+	if err != nil || got == nil || got.Tag != "" {
+		t.Fatalf("expected tag to be cleared, got %+v, %v", got, err)
+	}
+
+	if err := db.SetBackupTag(rec.ID+1, "keep-forever"); err == nil {
+		t.Fatalf("expected error for a missing record")
+	}
+}
+
+func TestBackupRecordMultipleTags(t *testing.T) {
+	db := newTestDB(t)
+
+	records := []*BackupRecord{
+		{VolumeName: "app_data", FilePath: "/b/old.tar.gz", Tag: JoinTags([]string{"nightly", "prod", "nightly", " "})},
+		{VolumeName: "app_data", FilePath: "/b/preprod.tar.gz", Tag: "preprod"},
+		{VolumeName: "app_data", FilePath: "/b/new.tar.gz", Tag: "nightly"},
+	}
+	for _, rec := range records {
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	got, err := db.GetBackupRecordByID(records[0].ID)
+	if err != nil || got == nil {
+		t.Fatalf("failed to get record: %v", err)
+	}
+	if got.Tag != "nightly,prod" || strings.Join(got.Tags(), " ") != "nightly prod" || !got.HasTag("prod") || got.HasTag("pro") {
+		t.Fatalf("unexpected tags %q", got.Tag)
+	}
+
+	for tag, want := range map[string]string{
+		"prod":    "/b/old.tar.gz",
+		"nightly": "/b/new.tar.gz,/b/old.tar.gz",
+		"preprod": "/b/preprod.tar.gz",
+		"pro":     "",
+	} {
+		found, err := db.QueryBackupRecords(BackupRecordQuery{VolumeName: "app_data", Tag: tag})
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		var paths []string
+		for _, rec := range found {
+			paths = append(paths, rec.FilePath)
+		}
+		if strings.Join(paths, ",") != want {
+			t.Errorf("tag %s: expected %q, got %q", tag, want, strings.Join(paths, ","))
+		}
+	}
+
+	latest, err := db.GetLatestBackupRecordByTag("app_data", "prod")
+	if err != nil || latest == nil || latest.FilePath != "/b/old.tar.gz" {
+		t.Fatalf("expected the backup tagged prod among others, got %+v, %v", latest, err)
+	}
+
+	// A protected tag that is not the first still keeps the backup
+	toDelete, err := db.PreviewCleanup("app_data", 1, 0, []string{"prod"})
+	if err != nil {
+		t.Fatalf("preview failed: %v", err)
+	}
+	if len(toDelete) != 1 || toDelete[0].FilePath != "/b/preprod.tar.gz" {
+		t.Fatalf("expected only the preprod backup to be removed, got %+v", toDelete)
+	}
+
+	if err := ValidateTag("nightly,prod"); err == nil {
+		t.Fatalf("expected an error for a tag containing a comma")
+	}
+}
+
+func TestGetLatestBackupChecksum(t *testing.T) {
+	db := newTestDB(t)
+
+	checksum, path, err := db.GetLatestBackupChecksum("app_data")
+	if err != nil || checksum != "" || path != "" {
+		t.Fatalf("expected nothing for a volume without backups, got %q, %q, %v", checksum, path, err)
+	}
+
+	for _, rec := range []*BackupRecord{
+		{VolumeName: "app_data", FilePath: "/b/first.tar.gz", Checksum: "sha256:aaa"},
+		{VolumeName: "app_data", FilePath: "/b/second.tar.gz", Checksum: "sha256:bbb"},
+		{VolumeName: "other_data", FilePath: "/b/other.tar.gz", Checksum: "sha256:ccc"},
+	} {
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	checksum, path, err = db.GetLatestBackupChecksum("app_data")
+	if err != nil || checksum != "sha256:bbb" || path != "/b/second.tar.gz" {
+		t.Fatalf("expected latest app_data backup, got %q, %q, %v", checksum, path, err)
+	}
+}
+
+func TestGetBackupStats(t *testing.T) {
+	db := newTestDB(t)
+
+	records := []*BackupRecord{
+		{ProjectName: "shop", VolumeName: "shop_db", FilePath: "/b/db1.tar.gz", Size: 100},
+		{ProjectName: "shop", VolumeName: "shop_db", FilePath: "/b/db2.tar.gz", Size: 250},
+		{ProjectName: "shop", VolumeName: "shop_media", FilePath: "/b/media.tar.gz", Size: 4096},
+		{VolumeName: "loose", FilePath: "/b/loose.tar.gz", Size: 7},
+	}
+	for _, rec := range records {
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+	latest := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	if _, err := db.conn.Exec("UPDATE backup_records SET created_at = ? WHERE id = ?", latest, records[1].ID); err != nil {
+		t.Fatalf("failed to set created_at: %v", err)
+	}
+	if _, err := db.conn.Exec("UPDATE backup_records SET created_at = '2024-05-01 00:00:00' WHERE id = ?", records[0].ID); err != nil {
+		t.Fatalf("failed to set created_at: %v", err)
+	}
+
+	stats, err := db.GetBackupStats()
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 volumes, got %d", len(stats))
+	}
+	if s := stats[0]; s.ProjectName != "" || s.VolumeName != "loose" || s.Count != 1 || s.TotalSize != 7 || s.LastBackup.IsZero() {
+		t.Fatalf("unexpected stats for loose: %+v", s)
+	}
+	if s := stats[1]; s.ProjectName != "shop" || s.VolumeName != "shop_db" || s.Count != 2 || s.TotalSize != 350 || !s.LastBackup.Equal(latest) {
+		t.Fatalf("unexpected stats for shop_db: %+v", s)
+	}
+	if s := stats[2]; s.VolumeName != "shop_media" || s.Count != 1 || s.TotalSize != 4096 {
+		t.Fatalf("unexpected stats for shop_media: %+v", s)
+	}
+}
+
+func TestGetVolumesNotAccessedSince(t *testing.T) {
+	db := newTestDB(t)
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	accessed := map[string]time.Time{
+		"old":      cutoff.Add(-time.Second),
+		"boundary": cutoff,
+		"recent":   cutoff.Add(time.Second),
+		// Later as text, but 30 minutes before the cutoff
+		"zoned": time.Date(2024, 1, 1, 8, 30, 0, 0, tokyo),
+	}
+	for name, at := range accessed {
+		if err := db.UpdateLastAccessed(name); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+		if _, err := db.conn.Exec("UPDATE volume_metadata SET last_accessed = ? WHERE volume_name = ?", at, name); err != nil {
+			t.Fatalf("failed to backdate access: %v", err)
+		}
+	}
+	// Backed up but never accessed
+	if err := db.UpdateLastBackup("never"); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if _, err := db.conn.Exec("UPDATE volume_metadata SET last_accessed = NULL WHERE volume_name = 'never'"); err != nil {
+		t.Fatalf("failed to clear access: %v", err)
+	}
+
+	got, err := db.GetVolumesNotAccessedSince(cutoff)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if strings.Join(got, ",") != "old,zoned" {
+		t.Fatalf("expected [old zoned], got %v", got)
+	}
+}
+
+func TestQueryBackupRecords(t *testing.T) {
+	db := newTestDB(t)
+
+	// Ten backups of shop, newest last, and a few of other projects
+	for i := 0; i < 10; i++ {
+		rec := &BackupRecord{VolumeName: "shop_db", ProjectName: "shop", FilePath: fmt.Sprintf("/b/shop_%d.tar.gz", i), SourceHost: "web1"}
+		if i%3 == 0 {
+			rec.Tag = "daily"
+		}
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+	for _, rec := range []*BackupRecord{
+		{VolumeName: "blog_db", ProjectName: "blog", FilePath: "/b/blog.tar.gz", Tag: "daily", SourceHost: "web2"},
+		{VolumeName: "scratch", FilePath: "/b/scratch.tar.gz", SourceHost: "web1"},
+	} {
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	paths := func(records []*BackupRecord) string {
+		var names []string
+		for _, rec := range records {
+			names = append(names, strings.TrimSuffix(filepath.Base(rec.FilePath), ".tar.gz"))
+		}
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct {
+		name string
+		q    BackupRecordQuery
+		want string
+	}{
+		{"firstPage", BackupRecordQuery{Project: "shop", Limit: 3}, "shop_9,shop_8,shop_7"},
+		{"secondPage", BackupRecordQuery{Project: "shop", Limit: 3, Offset: 3}, "shop_6,shop_5,shop_4"},
+		{"lastPartialPage", BackupRecordQuery{Project: "shop", Limit: 3, Offset: 9}, "shop_0"},
+		{"pastTheEnd", BackupRecordQuery{Project: "shop", Limit: 3, Offset: 12}, ""},
+		{"offsetWithoutLimit", BackupRecordQuery{Project: "shop", Offset: 8}, "shop_1,shop_0"},
+		{"noProject", BackupRecordQuery{ByProject: true}, "scratch"},
+		{"tag", BackupRecordQuery{Tag: "daily", Limit: 3}, "blog,shop_9,shop_6"},
+		{"tagInProject", BackupRecordQuery{Project: "shop", Tag: "daily", Limit: 2, Offset: 2}, "shop_3,shop_0"},
+		{"host", BackupRecordQuery{SourceHost: "web2"}, "blog"},
+		{"volume", BackupRecordQuery{VolumeName: "shop_db", Limit: 1}, "shop_9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.QueryBackupRecords(tt.q)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if paths(got) != tt.want {
+				t.Fatalf("expected [%s], got [%s]", tt.want, paths(got))
+			}
+		})
+	}
+}
+
+// TestQueryBackupRecordsByProject runs the query History makes for the
+// current project
+func TestQueryBackupRecordsByProject(t *testing.T) {
+	db := newTestDB(t)
+	for _, rec := range []*BackupRecord{
+		{VolumeName: "shop_db", ProjectName: "shop", FilePath: "/b/shop_1.tar.gz"},
+		{VolumeName: "blog_db", ProjectName: "blog", FilePath: "/b/blog.tar.gz"},
+		{VolumeName: "shop_db", ProjectName: "shop", FilePath: "/b/shop_2.tar.gz"},
+		{VolumeName: "shop_cache", ProjectName: "shop", FilePath: "/b/shop_3.tar.gz"},
+		{VolumeName: "scratch", FilePath: "/b/scratch.tar.gz"},
+	} {
+		if err := db.AddBackupRecord(rec); err != nil {
+			t.Fatalf("failed to add record: %v", err)
+		}
+	}
+
+	records, err := db.QueryBackupRecords(BackupRecordQuery{Project: "shop", ByProject: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 2 || records[0].FilePath != "/b/shop_3.tar.gz" || records[1].FilePath != "/b/shop_2.tar.gz" {
+		t.Fatalf("expected the 2 newest shop backups, got %+v", records)
+	}
+
+	records, err = db.QueryBackupRecords(BackupRecordQuery{ByProject: true})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 1 || records[0].FilePath != "/b/scratch.tar.gz" {
+		t.Fatalf("expected only the backup without a project, got %+v", records)
+	}
+
+	// The project filter and the limit are part of the statement, and the
+	// project is looked up through its index
+	for _, q := range []BackupRecordQuery{{Project: "shop", ByProject: true, Limit: 2, Offset: 2}, {ByProject: true, Limit: 2}} {
+		query, args := backupRecordsSQL(q)
+		if !strings.Contains(query, "LIMIT ?") {
+			t.Fatalf("expected the limit in the statement, got:\n%s", query)
+		}
+		rows, err := db.conn.Query("EXPLAIN QUERY PLAN "+query, args...)
+		if err != nil {
+			t.Fatalf("explain failed: %v", err)
+		}
+		var plan []string
+		for rows.Next() {
+			var id, parent, notused int
+			var detail string
+			if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+				t.Fatalf("scan failed: %v", err)
+			}
+			plan = append(plan, detail)
+		}
+		rows.Close()
+		if !strings.Contains(strings.Join(plan, "\n"), "idx_project_name") {
+			t.Fatalf("expected %+v to use idx_project_name, got plan:\n%s", q, strings.Join(plan, "\n"))
+		}
+	}
+}
@@ -1,22 +1,34 @@
 package docker
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/build"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/term"
 )
 
 const (
@@ -25,12 +37,108 @@ const (
 	// AlpineImage is the image used for volume operations
 	// Pinned to a specific version for consistency
 	AlpineImage = "alpine:3.19"
+	// GNUTarImage is the image used for incremental backups and restores,
+	// which need GNU tar's --listed-incremental support (busybox tar in
+	// AlpineImage lacks it), and for backups and restores with TarOptions
+	GNUTarImage = "debian:12-slim"
+	// ZstdImage is the image used for zstd-compressed backups and restores.
+	// No official image ships zstd on every architecture, so it is built
+	// locally from AlpineImage with GNU tar and zstd (see zstdDockerfile)
+	// the first time it is needed.
+	ZstdImage = "dvm-zstd:alpine3.19"
+)
+
+// zstdDockerfile builds ZstdImage
+const zstdDockerfile = "FROM " + AlpineImage + "\nRUN apk add --no-cache tar zstd\n"
+
+// TarOptions selects how a backup is archived or restored. busybox tar
+// supports neither Sparse nor Xattrs, so either runs the worker in
+// GNUTarImage. A backup taken with one must be restored with it to benefit
+// from it.
+type TarOptions struct {
+	Sparse bool // archive holes in sparse files as holes and write them back as holes
+	Xattrs bool // keep extended attributes, including POSIX ACLs and SELinux labels
+
+	// FollowSymlinks archives the files symbolic links point to in place
+	// of the links (tar -h); by default links are stored as links. Links
+	// are resolved inside the worker, which mounts only the volume, so a
+	// link to a missing target fails the backup. Busybox tar supports it.
+	FollowSymlinks bool
+
+	// Owner is a numeric "uid:gid" (or "uid") that restored files are
+	// given instead of the owners recorded in the archive, for moving
+	// volumes between hosts with different users
+	Owner string
+}
+
+// gnu reports whether any option needs GNU tar
+func (o TarOptions) gnu() bool {
+	return o.Sparse || o.Xattrs
+}
+
+// createFlags returns the tar flags archiving with the options
+func (o TarOptions) createFlags() []string {
+	var flags []string
+	if o.FollowSymlinks {
+		flags = append(flags, "-h")
+	}
+	if o.Sparse {
+		flags = append(flags, "--sparse")
+	}
+	if o.Xattrs {
+		flags = append(flags, "--xattrs", "--acls")
+	}
+	return flags
+}
+
+// extractFlags returns the tar flags extracting with the options. Owners
+// are always restored by their numeric IDs, as the worker's user database
+// knows nothing of the volume's users. GNU tar writes holes back by itself,
+// but only extracts user.* attributes unless told to include the rest.
+func (o TarOptions) extractFlags() []string {
+	flags := []string{"--numeric-owner"}
+	if o.Xattrs {
+		flags = append(flags, "--xattrs", "--xattrs-include=*", "--acls")
+	}
+	return flags
+}
+
+// chownCmd returns the command giving the restored paths under target to
+// Owner, or nil if the archived owners are kept. paths are the restored
+// members, or nil for the whole target.
+func (o TarOptions) chownCmd(target string, paths []string) []string {
+	if o.Owner == "" {
+		return nil
+	}
+	cmd := []string{"chown", "-R", "-h", o.Owner}
+	if len(paths) == 0 {
+		return append(cmd, target)
+	}
+	for _, p := range paths {
+		cmd = append(cmd, path.Join(target, p))
+	}
+	return cmd
+}
+
+// LabelComposeProject is the label Compose sets on volumes it creates,
+// holding the project name
+const LabelComposeProject = "com.docker.compose.project"
+
+// Compression formats detected in backup archives
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
 )
 
 // Client wraps Docker client
 type Client struct {
 	cli *client.Client
 	ctx context.Context
+
+	retry    RetryPolicy
+	retryLog io.Writer
+	warnf    func(format string, args ...any) // cleanup problems; nil drops them
 }
 
 // VolumeInfo contains volume information
@@ -43,44 +151,75 @@ type VolumeInfo struct {
 	InUse      bool
 }
 
-// NewClient creates a new Docker client
+// ErrDockerUnavailable is returned when the Docker daemon cannot be reached
+var ErrDockerUnavailable = errors.New("cannot connect to Docker daemon")
+
+// pingTimeout bounds how long NewClient waits for the daemon to respond
+const pingTimeout = 5 * time.Second
+
+// NewClient creates a new Docker client and verifies the daemon is reachable
 func NewClient() (*Client, error) {
 	ctx := context.Background()
 
+	var host string
+	var lastErr error
+
 	// Try to create client from environment variables first
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err == nil {
 		// Test if the connection actually works
-		if _, pingErr := cli.Ping(ctx); pingErr == nil {
+		pingErr := ping(ctx, cli)
+		if pingErr == nil {
 			return &Client{
-				cli: cli,
-				ctx: ctx,
+				cli:   cli,
+				ctx:   ctx,
+				retry: DefaultRetryPolicy,
+				warnf: warnStderr,
 			}, nil
 		}
 		// Connection failed, close and try context
+		host, lastErr = cli.DaemonHost(), pingErr
 		cli.Close()
+	} else {
+		lastErr = err
 	}
 
 	// If FromEnv fails, try to get Docker host from current context
 	dockerHost := getDockerHostFromContext()
-	if dockerHost != "" {
+	if dockerHost != "" && dockerHost != host {
 		cli, err = client.NewClientWithOpts(
 			client.WithHost(dockerHost),
 			client.WithAPIVersionNegotiation(),
 		)
 		if err == nil {
 			// Test if the connection works
-			if _, pingErr := cli.Ping(ctx); pingErr == nil {
+			pingErr := ping(ctx, cli)
+			if pingErr == nil {
 				return &Client{
-					cli: cli,
-					ctx: ctx,
+					cli:   cli,
+					ctx:   ctx,
+					retry: DefaultRetryPolicy,
+					warnf: warnStderr,
 				}, nil
 			}
+			host, lastErr = dockerHost, pingErr
 			cli.Close()
 		}
 	}
 
-	return nil, fmt.Errorf("failed to connect to Docker daemon. Please ensure Docker is running")
+	if host == "" {
+		host = client.DefaultDockerHost
+	}
+
+	return nil, fmt.Errorf("%w at %s; is it running? (%v)", ErrDockerUnavailable, host, lastErr)
+}
+
+// ping checks that the daemon behind cli responds within pingTimeout
+func ping(ctx context.Context, cli *client.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	_, err := cli.Ping(ctx)
+	return err
 }
 
 // getDockerHostFromContext uses docker CLI to get the current context endpoint
@@ -118,6 +257,22 @@ func (c *Client) Close() error {
 	return c.cli.Close()
 }
 
+// ServerVersion returns the version of the Docker daemon and the API version
+// it speaks, e.g. "28.5.2 (API 1.51)"
+func (c *Client) ServerVersion() (string, error) {
+	v, err := c.cli.ServerVersion(c.ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s (API %s)", v.Version, v.APIVersion), nil
+}
+
+// ImageAvailable reports whether the image is present locally
+func (c *Client) ImageAvailable(imageName string) bool {
+	_, _, err := c.cli.ImageInspectWithRaw(c.ctx, imageName)
+	return err == nil
+}
+
 // ensureImage ensures the specified image is available locally, pulling it if necessary
 func (c *Client) ensureImage(imageName string) error {
 	// Check if image exists locally
@@ -127,6 +282,10 @@ func (c *Client) ensureImage(imageName string) error {
 		return nil
 	}
 
+	if imageName == ZstdImage {
+		return c.buildZstdImage()
+	}
+
 	// Image doesn't exist, pull it
 	reader, err := c.cli.ImagePull(c.ctx, imageName, image.PullOptions{})
 	if err != nil {
@@ -143,6 +302,36 @@ func (c *Client) ensureImage(imageName string) error {
 	return nil
 }
 
+// buildZstdImage builds ZstdImage from zstdDockerfile
+func (c *Client) buildZstdImage() error {
+	var buildContext bytes.Buffer
+	tw := tar.NewWriter(&buildContext)
+	if err := tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0o644, Size: int64(len(zstdDockerfile))}); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(tw, zstdDockerfile); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	resp, err := c.cli.ImageBuild(c.ctx, &buildContext, build.ImageBuildOptions{
+		Tags:   []string{ZstdImage},
+		Remove: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build image %s: %w", ZstdImage, err)
+	}
+	defer resp.Body.Close()
+
+	// Build errors arrive in the output stream rather than as a status
+	if err := jsonmessage.DisplayJSONMessagesStream(resp.Body, io.Discard, 0, false, nil); err != nil {
+		return fmt.Errorf("failed to build image %s: %w", ZstdImage, err)
+	}
+	return nil
+}
+
 // ListVolumes lists all volumes
 func (c *Client) ListVolumes() ([]*volume.Volume, error) {
 	vols, err := c.cli.VolumeList(c.ctx, volume.ListOptions{})
@@ -152,6 +341,23 @@ func (c *Client) ListVolumes() ([]*volume.Volume, error) {
 	return vols.Volumes, nil
 }
 
+// ListVolumesByLabel lists volumes carrying the label key=value, filtered by
+// the daemon. An empty value matches any volume that has the key.
+func (c *Client) ListVolumesByLabel(key, value string) ([]*volume.Volume, error) {
+	label := key
+	if value != "" {
+		label += "=" + value
+	}
+
+	vols, err := c.cli.VolumeList(c.ctx, volume.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vols.Volumes, nil
+}
+
 // GetVolume gets information about a specific volume
 func (c *Client) GetVolume(name string) (*volume.Volume, error) {
 	vol, err := c.cli.VolumeInspect(c.ctx, name)
@@ -167,28 +373,52 @@ func (c *Client) VolumeExists(name string) bool {
 	return err == nil
 }
 
-// IsVolumeInUse checks if a volume is in use by any container
+// IsVolumeInUse checks if a volume is in use by any container. To check
+// many volumes, use GetVolumesInUse, which lists containers only once.
 func (c *Client) IsVolumeInUse(volumeName string) (bool, error) {
+	inUse, err := c.GetVolumesInUse()
+	if err != nil {
+		return false, err
+	}
+	return inUse[volumeName], nil
+}
+
+// GetVolumesInUse returns the names of the volumes mounted by any container,
+// running or not, from a single container listing
+func (c *Client) GetVolumesInUse() (map[string]bool, error) {
 	containers, err := c.cli.ContainerList(c.ctx, container.ListOptions{
 		All: true,
 	})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
+	inUse := make(map[string]bool)
 	for _, cont := range containers {
 		for _, mnt := range cont.Mounts {
-			if mnt.Name == volumeName {
-				return true, nil
+			if mnt.Name != "" {
+				inUse[mnt.Name] = true
 			}
 		}
 	}
 
-	return false, nil
+	return inUse, nil
 }
 
-// GetContainersUsingVolume returns containers using the volume
+// GetContainersUsingVolume returns containers using the volume. To look up
+// many volumes, use GetVolumeContainerMap, which lists containers only once.
 func (c *Client) GetContainersUsingVolume(volumeName string) ([]string, error) {
+	users, err := c.GetVolumeContainerMap()
+	if err != nil {
+		return nil, err
+	}
+	return users[volumeName], nil
+}
+
+// GetVolumeContainerMap returns the names of the containers, running or
+// not, using each volume, from a single container listing. Volumes no
+// container uses are absent.
+func (c *Client) GetVolumeContainerMap() (map[string][]string, error) {
 	containers, err := c.cli.ContainerList(c.ctx, container.ListOptions{
 		All: true,
 	})
@@ -196,27 +426,120 @@ func (c *Client) GetContainersUsingVolume(volumeName string) ([]string, error) {
 		return nil, err
 	}
 
-	var result []string
+	users := make(map[string][]string)
 	for _, cont := range containers {
+		if len(cont.Names) == 0 {
+			continue
+		}
+		// Remove leading "/" from container name
+		containerName := strings.TrimPrefix(cont.Names[0], "/")
+		seen := make(map[string]bool)
 		for _, mnt := range cont.Mounts {
-			if mnt.Name == volumeName {
-				if len(cont.Names) > 0 {
-					// Remove leading "/" from container name
-					containerName := strings.TrimPrefix(cont.Names[0], "/")
-					result = append(result, containerName)
-				}
-				break
+			if mnt.Name != "" && !seen[mnt.Name] {
+				seen[mnt.Name] = true
+				users[mnt.Name] = append(users[mnt.Name], containerName)
 			}
 		}
 	}
 
-	return result, nil
+	return users, nil
+}
+
+// GetRunningContainerIDsUsingVolume returns the IDs of running containers
+// that mount the volume
+func (c *Client) GetRunningContainerIDsUsingVolume(volumeName string) ([]string, error) {
+	containers, err := c.cli.ContainerList(c.ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("volume", volumeName)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(containers))
+	for _, cont := range containers {
+		ids = append(ids, cont.ID)
+	}
+
+	return ids, nil
+}
+
+// GetVolumeSizes returns the disk usage of every volume in bytes, keyed by
+// volume name. Volumes whose driver does not report usage are omitted.
+func (c *Client) GetVolumeSizes() (map[string]int64, error) {
+	du, err := c.cli.DiskUsage(c.ctx, types.DiskUsageOptions{
+		Types: []types.DiskUsageObject{types.VolumeObject},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64, len(du.Volumes))
+	for _, vol := range du.Volumes {
+		if vol.UsageData == nil || vol.UsageData.Size < 0 {
+			continue
+		}
+		sizes[vol.Name] = vol.UsageData.Size
+	}
+
+	return sizes, nil
+}
+
+// GetVolumeSize returns the disk usage of a volume in bytes
+func (c *Client) GetVolumeSize(name string) (int64, error) {
+	sizes, err := c.GetVolumeSizes()
+	if err != nil {
+		return 0, err
+	}
+
+	size, ok := sizes[name]
+	if !ok {
+		return 0, fmt.Errorf("size of volume %s is not available", name)
+	}
+	return size, nil
+}
+
+// volumeChecksumScript hashes the path, size and modification time of every
+// entry in /volume. It reads metadata only, so it is much cheaper than
+// hashing the contents and still changes whenever a file is written.
+const volumeChecksumScript = `cd /volume && find . -exec stat -c '%n %s %Y' {} + | sort | sha256sum`
+
+// VolumeChecksum returns a cheap checksum of a volume's file listing, for
+// detecting changes between polls. Equal checksums mean no file was added,
+// removed, resized or modified (at one-second resolution).
+func (c *Client) VolumeChecksum(name string) (string, error) {
+	out, err := c.runWorkerOutput(AlpineImage, "checksum", []string{"sh", "-c", volumeChecksumScript}, []mount.Mount{
+		{
+			Type:     mount.TypeVolume,
+			Source:   name,
+			Target:   "/volume",
+			ReadOnly: true,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("checksum of volume %s produced no output", name)
+	}
+	return fields[0], nil
 }
 
 // CreateVolume creates a new volume
 func (c *Client) CreateVolume(name string) error {
+	return c.CreateVolumeWithOptions(name, "", nil, nil)
+}
+
+// CreateVolumeWithOptions creates a volume with the given driver, driver
+// options and labels, so NFS, tmpfs and custom-driver volumes can be
+// recreated faithfully. An empty driver uses the daemon default (local).
+func (c *Client) CreateVolumeWithOptions(name, driver string, driverOpts, labels map[string]string) error {
 	_, err := c.cli.VolumeCreate(c.ctx, volume.CreateOptions{
-		Name: name,
+		Name:       name,
+		Driver:     driver,
+		DriverOpts: driverOpts,
+		Labels:     labels,
 	})
 	return err
 }
@@ -226,13 +549,38 @@ func (c *Client) RemoveVolume(name string, force bool) error {
 	return c.cli.VolumeRemove(c.ctx, name, force)
 }
 
-// BackupVolume backs up a volume to a tar.gz file
-func (c *Client) BackupVolume(volumeName, outputPath string, compress bool) error {
-	// Ensure the alpine image is available
-	if err := c.ensureImage(AlpineImage); err != nil {
+// BackupVolume backs up a volume to a tar.gz file, or with zstd if
+// outputPath ends in .tar.zst. level is the compression level, 0 for the
+// compressor's default.
+func (c *Client) BackupVolume(volumeName, outputPath string, compress bool, level int, tarOpts TarOptions) error {
+	return c.backupMount(mount.Mount{
+		Type:     mount.TypeVolume,
+		Source:   volumeName,
+		Target:   "/source",
+		ReadOnly: true,
+	}, outputPath, compress, level, tarOpts)
+}
+
+// BackupBind backs up a host directory (a compose bind mount) to a tar file
+func (c *Client) BackupBind(hostPath, outputPath string, compress bool, level int, tarOpts TarOptions) error {
+	info, err := os.Stat(hostPath)
+	if err != nil {
 		return err
 	}
+	if !info.IsDir() {
+		return fmt.Errorf("bind mount source is not a directory: %s", hostPath)
+	}
+
+	return c.backupMount(mount.Mount{
+		Type:     mount.TypeBind,
+		Source:   hostPath,
+		Target:   "/source",
+		ReadOnly: true,
+	}, outputPath, compress, level, tarOpts)
+}
 
+// backupMount archives the contents of source, mounted at /source, to outputPath
+func (c *Client) backupMount(source mount.Mount, outputPath string, compress bool, level int, tarOpts TarOptions) error {
 	// Create output directory if it doesn't exist
 	outputDir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
@@ -249,75 +597,26 @@ func (c *Client) BackupVolume(volumeName, outputPath string, compress bool) erro
 	// Generate unique temp filename using timestamp and random component
 	tempFilename := fmt.Sprintf(".backup-temp-%d.tar.gz", time.Now().UnixNano())
 
-	// Build tar command with explicit flags to avoid ambiguous option concatenation
-	cmd := []string{"tar", "-c"}
-	if compress {
-		cmd = append(cmd, "-z")
+	image := tarImage(tarOpts)
+	cmd := backupCmd(filepath.Join("/backup", tempFilename), "/source", compress, level, tarOpts)
+	if compress && isZstdPath(outputPath) {
+		image = ZstdImage
+		cmd = zstdBackupCmd(filepath.Join("/backup", tempFilename), "/source", level, tarOpts)
 	}
-	cmd = append(cmd, "-f", filepath.Join("/backup", tempFilename), "-C", "/source", ".")
 
 	// Run a temporary container to create the backup
-	resp, err := c.cli.ContainerCreate(c.ctx, &container.Config{
-		Image: AlpineImage,
-		Cmd:   cmd,
-	}, &container.HostConfig{
-		Mounts: []mount.Mount{
-			{
-				Type:     mount.TypeVolume,
-				Source:   volumeName,
-				Target:   "/source",
-				ReadOnly: true,
-			},
-			{
-				Type:   mount.TypeBind,
-				Source: outputDir,
-				Target: "/backup",
-			},
+	if err := c.runWorker(image, "backup", cmd, []mount.Mount{
+		source,
+		{
+			Type:   mount.TypeBind,
+			Source: outputDir,
+			Target: "/backup",
 		},
-	}, nil, nil, "")
-	if err != nil {
-		return err
-	}
-
-	// Ensure container cleanup
-	defer func() {
-		if err := c.cli.ContainerRemove(c.ctx, resp.ID, container.RemoveOptions{Force: true}); err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to remove temporary container %s: %v\n", resp.ID, err)
-		}
-	}()
-
-	// Start the container
-	if err := c.cli.ContainerStart(c.ctx, resp.ID, container.StartOptions{}); err != nil {
+	}); err != nil {
+		os.Remove(filepath.Join(outputDir, tempFilename))
 		return err
 	}
 
-	// Wait for completion
-	statusCh, errCh := c.cli.ContainerWait(c.ctx, resp.ID, container.WaitConditionNotRunning)
-	select {
-	case err := <-errCh:
-		if err != nil {
-			return err
-		}
-	case status := <-statusCh:
-		if status.StatusCode != 0 {
-			// Get logs for debugging
-			logs, err := c.cli.ContainerLogs(c.ctx, resp.ID, container.LogsOptions{
-				ShowStdout: true,
-				ShowStderr: true,
-			})
-			if err != nil {
-				return fmt.Errorf("backup failed with status %d and could not retrieve logs: %w", status.StatusCode, err)
-			}
-			defer logs.Close()
-
-			logData, err := io.ReadAll(logs)
-			if err != nil {
-				return fmt.Errorf("backup failed with status %d and error reading logs: %w", status.StatusCode, err)
-			}
-			return fmt.Errorf("backup failed with status %d: %s", status.StatusCode, string(logData))
-		}
-	}
-
 	// Rename the output file
 	tempPath := filepath.Join(outputDir, tempFilename)
 	if err := os.Rename(tempPath, outputPath); err != nil {
@@ -327,25 +626,48 @@ func (c *Client) BackupVolume(volumeName, outputPath string, compress bool) erro
 	return nil
 }
 
-// RestoreVolume restores a volume from a backup file
-func (c *Client) RestoreVolume(volumeName, backupPath string) error {
-	// Ensure the alpine image is available
-	if err := c.ensureImage(AlpineImage); err != nil {
-		return err
+// DetectCompression inspects the leading magic bytes of a backup archive and
+// returns its compression format. The file extension is only used as a
+// fallback for files too short to carry a magic number.
+func DetectCompression(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
 	}
+	defer f.Close()
 
-	// Check if backup file exists
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		return fmt.Errorf("backup file not found: %s", backupPath)
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	magic = magic[:n]
+
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return CompressionGzip, nil
+	case len(magic) >= 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd:
+		return CompressionZstd, nil
+	case len(magic) >= 2:
+		return CompressionNone, nil
 	}
 
-	backupDir := filepath.Dir(backupPath)
-	backupFile := filepath.Base(backupPath)
+	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+		return CompressionGzip, nil
+	}
+	if strings.HasSuffix(path, ".tar.zst") {
+		return CompressionZstd, nil
+	}
+	return CompressionNone, nil
+}
 
-	// Detect compression format from file extension
-	compressed := false
-	if strings.HasSuffix(backupPath, ".tar.gz") || strings.HasSuffix(backupPath, ".tgz") {
-		compressed = true
+// RestoreVolume restores a volume from a backup file. Given members, paths
+// relative to the volume root, only those subtrees are extracted and the
+// rest of the volume is left as it is.
+func (c *Client) RestoreVolume(volumeName, backupPath string, tarOpts TarOptions, members ...string) error {
+	// Check if backup file exists before touching the volume
+	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+		return fmt.Errorf("backup file not found: %s", backupPath)
 	}
 
 	// Create volume if it doesn't exist
@@ -355,140 +677,1101 @@ func (c *Client) RestoreVolume(volumeName, backupPath string) error {
 		}
 	}
 
-	// Build tar command with explicit flags to avoid ambiguous option concatenation
-	cmd := []string{"tar", "-x"}
-	if compressed {
-		cmd = append(cmd, "-z")
+	return c.restoreMount(mount.Mount{
+		Type:   mount.TypeVolume,
+		Source: volumeName,
+		Target: "/target",
+	}, backupPath, tarOpts, members)
+}
+
+// RestoreBind extracts a backup into a host directory (a compose bind
+// mount), or only the given members of it as RestoreVolume does
+func (c *Client) RestoreBind(hostPath, backupPath string, tarOpts TarOptions, members ...string) error {
+	if err := os.MkdirAll(hostPath, 0755); err != nil {
+		return err
 	}
-	cmd = append(cmd, "-f", filepath.Join("/backup", backupFile), "-C", "/target")
 
-	// Run a temporary container to restore the backup
-	resp, err := c.cli.ContainerCreate(c.ctx, &container.Config{
-		Image: AlpineImage,
-		Cmd:   cmd,
-	}, &container.HostConfig{
-		Mounts: []mount.Mount{
-			{
-				Type:   mount.TypeVolume,
-				Source: volumeName,
-				Target: "/target",
-			},
-			{
-				Type:     mount.TypeBind,
-				Source:   backupDir,
-				Target:   "/backup",
-				ReadOnly: true,
-			},
-		},
-	}, nil, nil, "")
+	return c.restoreMount(mount.Mount{
+		Type:   mount.TypeBind,
+		Source: hostPath,
+		Target: "/target",
+	}, backupPath, tarOpts, members)
+}
+
+// restoreMount extracts backupPath, or only members of it, into target,
+// mounted at /target
+func (c *Client) restoreMount(target mount.Mount, backupPath string, tarOpts TarOptions, members []string) error {
+	// Check if backup file exists
+	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+		return fmt.Errorf("backup file not found: %s", backupPath)
+	}
+
+	backupDir := filepath.Dir(backupPath)
+	backupFile := filepath.Base(backupPath)
+
+	// Detect compression format from file contents
+	compression, err := DetectCompression(backupPath)
 	if err != nil {
 		return err
 	}
 
-	// Ensure container cleanup
-	defer func() {
-		if err := c.cli.ContainerRemove(c.ctx, resp.ID, container.RemoveOptions{Force: true}); err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to remove temporary container %s: %v\n", resp.ID, err)
-		}
-	}()
+	image := tarImage(tarOpts)
+	if compression == CompressionZstd {
+		image = ZstdImage
+	}
+	cmd := restoreCmd(filepath.Join("/backup", backupFile), "/target", compression, tarOpts, members)
 
-	// Start the container
-	if err := c.cli.ContainerStart(c.ctx, resp.ID, container.StartOptions{}); err != nil {
+	// Run a temporary container to restore the backup
+	if err := c.runWorker(image, "restore", cmd, []mount.Mount{
+		target,
+		{
+			Type:     mount.TypeBind,
+			Source:   backupDir,
+			Target:   "/backup",
+			ReadOnly: true,
+		},
+	}); err != nil {
 		return err
 	}
 
-	// Wait for completion
-	statusCh, errCh := c.cli.ContainerWait(c.ctx, resp.ID, container.WaitConditionNotRunning)
-	select {
-	case err := <-errCh:
-		if err != nil {
-			return err
+	if chown := tarOpts.chownCmd("/target", members); chown != nil {
+		if err := c.runWorker(AlpineImage, "chown", chown, []mount.Mount{target}); err != nil {
+			return fmt.Errorf("restored, but failed to change owners: %w", err)
 		}
-	case status := <-statusCh:
-		if status.StatusCode != 0 {
-			logs, err := c.cli.ContainerLogs(c.ctx, resp.ID, container.LogsOptions{
-				ShowStdout: true,
-				ShowStderr: true,
-			})
-			if err != nil {
-				return fmt.Errorf("restore failed with status %d and could not retrieve logs: %w", status.StatusCode, err)
-			}
-			defer logs.Close()
+	}
+	return nil
+}
 
-			logData, err := io.ReadAll(logs)
-			if err != nil {
-				return fmt.Errorf("restore failed with status %d and could not read logs: %w", status.StatusCode, err)
-			}
-			return fmt.Errorf("restore failed with status %d: %s", status.StatusCode, string(logData))
-		}
+// restoreCmd builds the tar command extracting archive, compressed as
+// compression, into target, with explicit flags to avoid ambiguous option
+// concatenation. Backups archive the volume root as ".", so members are
+// named "./<path>"; a directory member extracts its whole subtree.
+func restoreCmd(archive, target, compression string, tarOpts TarOptions, members []string) []string {
+	cmd := append([]string{"tar", "-x"}, tarOpts.extractFlags()...)
+	switch compression {
+	case CompressionGzip:
+		cmd = append(cmd, "-z")
+	case CompressionZstd:
+		cmd = append(cmd, "-I", "zstd")
 	}
+	cmd = append(cmd, "-f", archive, "-C", target)
+	for _, member := range members {
+		cmd = append(cmd, "./"+member)
+	}
+	return cmd
+}
 
-	return nil
+// ArchiveEntry is a member of a backup archive
+type ArchiveEntry struct {
+	Name string // as stored, usually "./<path>"; directories end in "/"
+	Size int64
+	Dir  bool
 }
 
-// CopyVolume copies data from one volume to another
-func (c *Client) CopyVolume(sourceVolume, targetVolume string) error {
-	// Ensure the alpine image is available
-	if err := c.ensureImage(AlpineImage); err != nil {
-		return err
+// ListArchiveContents lists the members of a backup archive in a worker
+// container, which mounts the archive's directory read-only
+func (c *Client) ListArchiveContents(backupPath string) ([]ArchiveEntry, error) {
+	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("backup file not found: %s", backupPath)
 	}
 
-	// Create target volume if it doesn't exist
-	if !c.VolumeExists(targetVolume) {
-		if err := c.CreateVolume(targetVolume); err != nil {
-			return err
-		}
+	compression, err := DetectCompression(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	image := AlpineImage
+	if compression == CompressionZstd {
+		image = ZstdImage
 	}
 
-	// Run a temporary container to copy data
-	resp, err := c.cli.ContainerCreate(c.ctx, &container.Config{
-		Image: AlpineImage,
-		Cmd:   []string{"sh", "-c", "cp -a /source/. /target/"},
-	}, &container.HostConfig{
-		Mounts: []mount.Mount{
-			{
-				Type:     mount.TypeVolume,
-				Source:   sourceVolume,
-				Target:   "/source",
-				ReadOnly: true,
-			},
-			{
-				Type:   mount.TypeVolume,
-				Source: targetVolume,
-				Target: "/target",
-			},
+	cmd := listArchiveCmd(filepath.Join("/backup", filepath.Base(backupPath)), compression)
+	out, err := c.runWorkerOutput(image, "list contents", cmd, []mount.Mount{
+		{
+			Type:     mount.TypeBind,
+			Source:   filepath.Dir(backupPath),
+			Target:   "/backup",
+			ReadOnly: true,
 		},
-	}, nil, nil, "")
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return parseTarListing(out)
+}
 
-	// Ensure container cleanup
-	defer func() {
-		if err := c.cli.ContainerRemove(c.ctx, resp.ID, container.RemoveOptions{Force: true}); err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to remove temporary container %s: %v\n", resp.ID, err)
-		}
-	}()
-
-	if err := c.cli.ContainerStart(c.ctx, resp.ID, container.StartOptions{}); err != nil {
-		return err
+// listArchiveCmd builds the tar command listing archive, compressed as
+// compression, verbosely
+func listArchiveCmd(archive, compression string) []string {
+	cmd := []string{"tar", "-t", "-v"}
+	switch compression {
+	case CompressionGzip:
+		cmd = append(cmd, "-z")
+	case CompressionZstd:
+		cmd = append(cmd, "-I", "zstd")
 	}
+	return append(cmd, "-f", archive)
+}
 
-	statusCh, errCh := c.cli.ContainerWait(c.ctx, resp.ID, container.WaitConditionNotRunning)
-	select {
-	case err := <-errCh:
-		if err != nil {
+// parseTarListing parses the output of tar -tv, as written by busybox
+// ("-rw-r--r-- root/root 12 2024-01-01 00:00:00 ./a") and GNU tar (the
+// same without seconds). Names may contain spaces; link targets are dropped.
+func parseTarListing(out string) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// mode, owner, size, date and time precede the name
+		rest := line
+		var fields []string
+		for i := 0; i < 5; i++ {
+			rest = strings.TrimLeft(rest, " ")
+			end := strings.IndexByte(rest, ' ')
+			if end < 0 {
+				return nil, fmt.Errorf("unexpected tar listing line: %q", line)
+			}
+			fields = append(fields, rest[:end])
+			rest = rest[end:]
+		}
+		name := strings.TrimLeft(rest, " ")
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if fields[0][0] == 'c' || fields[0][0] == 'b' {
+			size, err = 0, nil // devices show "major,minor" instead of a size
+		}
+		if err != nil || name == "" {
+			return nil, fmt.Errorf("unexpected tar listing line: %q", line)
+		}
+
+		switch fields[0][0] {
+		case 'l':
+			name, _, _ = strings.Cut(name, " -> ")
+		case 'h':
+			name, _, _ = strings.Cut(name, " link to ")
+		}
+		entries = append(entries, ArchiveEntry{Name: name, Size: size, Dir: fields[0][0] == 'd'})
+	}
+	return entries, nil
+}
+
+// ErrAtomicUnsupported is returned by RestoreVolumeAtomic when the target
+// volume's driver cannot host a scratch copy alongside it
+var ErrAtomicUnsupported = errors.New("atomic restore is not supported for this volume driver")
+
+// replaceScript swaps the contents of /scratch into /target. The previous
+// contents are parked in a hidden directory on the same volume and only
+// deleted once the copy succeeded; on failure they are moved back.
+const replaceScript = `set -e
+cd /target
+old=.dvm-restore-old
+if [ -e "$old" ]; then
+	echo "$old already exists; an earlier restore may have been interrupted" >&2
+	exit 1
+fi
+mkdir "$old"
+find . -mindepth 1 -maxdepth 1 ! -name "$old" -exec mv {} "$old"/ \;
+if cp -a /scratch/. /target/; then
+	rm -rf "$old"
+else
+	find . -mindepth 1 -maxdepth 1 ! -name "$old" -exec rm -rf {} +
+	find "$old" -mindepth 1 -maxdepth 1 -exec mv {} . \;
+	rmdir "$old"
+	exit 1
+fi`
+
+// RestoreVolumeAtomic restores a volume through a scratch volume: the backup
+// is extracted into the scratch volume first and the target's contents are
+// only replaced once extraction succeeded, so a corrupt or truncated archive
+// leaves the target untouched. Volumes that do not exist yet are restored
+// directly, and ErrAtomicUnsupported is returned for non-local drivers.
+// tarOpts also applies to replacing the target's contents.
+func (c *Client) RestoreVolumeAtomic(volumeName, backupPath string, tarOpts TarOptions) error {
+	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+		return fmt.Errorf("backup file not found: %s", backupPath)
+	}
+
+	vol, err := c.GetVolume(volumeName)
+	if err != nil {
+		// Nothing to protect yet
+		return c.RestoreVolume(volumeName, backupPath, tarOpts)
+	}
+	if vol.Driver != "local" {
+		return fmt.Errorf("%w: %s uses driver %q", ErrAtomicUnsupported, volumeName, vol.Driver)
+	}
+
+	scratch := fmt.Sprintf("%s_dvm_restore_%d", volumeName, time.Now().UnixNano())
+	if err := c.CreateVolume(scratch); err != nil {
+		return fmt.Errorf("failed to create scratch volume: %w", err)
+	}
+	defer func() {
+		if err := c.cli.VolumeRemove(c.cleanupCtx(), scratch, true); err != nil {
+			c.warn("failed to remove scratch volume %s: %v", scratch, err)
+		}
+	}()
+
+	if err := c.restoreMount(mount.Mount{
+		Type:   mount.TypeVolume,
+		Source: scratch,
+		Target: "/target",
+	}, backupPath, tarOpts, nil); err != nil {
+		return fmt.Errorf("%w (%s was left untouched)", err, volumeName)
+	}
+
+	// GNU cp -a keeps holes and extended attributes; busybox cp drops them
+	return c.runWorker(tarImage(tarOpts), "replace", []string{"sh", "-c", replaceScript}, []mount.Mount{
+		{
+			Type:     mount.TypeVolume,
+			Source:   scratch,
+			Target:   "/scratch",
+			ReadOnly: true,
+		},
+		{
+			Type:   mount.TypeVolume,
+			Source: volumeName,
+			Target: "/target",
+		},
+	})
+}
+
+// ExitError reports a worker container that exited with a non-zero status.
+// The command's failure is deterministic, so it is never retried.
+type ExitError struct {
+	Op     string
+	Status int64
+	Logs   string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%s failed with status %d: %s", e.Op, e.Status, e.Logs)
+}
+
+// runWorker runs cmd in a temporary container of image with the given mounts
+// and waits for it to exit. op names the operation in error messages.
+// Transient daemon errors are retried according to the client's RetryPolicy.
+func (c *Client) runWorker(image, op string, cmd []string, mounts []mount.Mount) error {
+	return c.withRetry(op, func() error {
+		if err := c.ensureImage(image); err != nil {
+			return err
+		}
+		return c.runWorkerOnce(image, op, cmd, mounts, nil)
+	})
+}
+
+// runWorkerOutput runs a worker like runWorker and returns its standard output
+func (c *Client) runWorkerOutput(image, op string, cmd []string, mounts []mount.Mount) (string, error) {
+	var stdout strings.Builder
+	err := c.withRetry(op, func() error {
+		if err := c.ensureImage(image); err != nil {
+			return err
+		}
+		stdout.Reset()
+		return c.runWorkerOnce(image, op, cmd, mounts, &stdout)
+	})
+	return stdout.String(), err
+}
+
+// runWorkerOnce makes a single attempt at running a worker container. If
+// stdout is not nil, the output of a successful run is copied to it.
+func (c *Client) runWorkerOnce(image, op string, cmd []string, mounts []mount.Mount, stdout io.Writer) error {
+	resp, err := c.cli.ContainerCreate(c.ctx, &container.Config{
+		Image: image,
+		Cmd:   cmd,
+	}, &container.HostConfig{
+		Mounts: mounts,
+	}, nil, nil, "")
+	if err != nil {
+		return err
+	}
+
+	// Ensure container cleanup
+	defer func() {
+		if err := c.cli.ContainerRemove(c.cleanupCtx(), resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			c.warn("failed to remove temporary container %s: %v", resp.ID, err)
+		}
+	}()
+
+	if err := c.cli.ContainerStart(c.ctx, resp.ID, container.StartOptions{}); err != nil {
+		return err
+	}
+
+	statusCh, errCh := c.cli.ContainerWait(c.ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
 			return err
 		}
 	case status := <-statusCh:
 		if status.StatusCode != 0 {
-			return fmt.Errorf("copy failed with status code %d", status.StatusCode)
+			return &ExitError{Op: op, Status: status.StatusCode, Logs: c.workerLogs(resp.ID)}
+		}
+	}
+
+	if stdout != nil {
+		logs, err := c.cli.ContainerLogs(c.ctx, resp.ID, container.LogsOptions{ShowStdout: true})
+		if err != nil {
+			return err
+		}
+		defer logs.Close()
+		if _, err := stdcopy.StdCopy(stdout, io.Discard, logs); err != nil {
+			return fmt.Errorf("failed to read %s output: %w", op, err)
 		}
 	}
 
 	return nil
 }
 
+// maxWorkerLogBytes bounds the output of a failed worker kept in an
+// ExitError
+const maxWorkerLogBytes = 8 << 10
+
+// workerLogs returns the end of the combined output of a worker container,
+// or a note explaining why it could not be read
+func (c *Client) workerLogs(id string) string {
+	logs, err := c.tailContainerLogs(id, maxWorkerLogBytes)
+	if err != nil {
+		return fmt.Sprintf("(could not retrieve logs: %v)", err)
+	}
+	return logs
+}
+
+// tailContainerLogs returns the last max bytes of the combined output of a
+// container, without the stream headers Docker multiplexes it with and with
+// runs of identical lines collapsed. Output dropped from the front is noted.
+func (c *Client) tailContainerLogs(id string, max int) (string, error) {
+	logs, err := c.cli.ContainerLogs(c.ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer logs.Close()
+
+	tail := &tailBuffer{max: max}
+	r := bufio.NewReader(logs)
+	if isMultiplexed(r) {
+		_, err = stdcopy.StdCopy(tail, tail, r)
+	} else {
+		_, err = io.Copy(tail, r)
+	}
+	if err != nil {
+		return "", err
+	}
+	return tail.String(), nil
+}
+
+// isMultiplexed reports whether a log stream starts with the 8-byte header
+// of a stdout or stderr frame. Containers with a TTY write raw output.
+func isMultiplexed(r *bufio.Reader) bool {
+	header, err := r.Peek(8)
+	if err != nil {
+		return false
+	}
+	stream := header[0]
+	return (stream == byte(stdcopy.Stdout) || stream == byte(stdcopy.Stderr)) &&
+		header[1] == 0 && header[2] == 0 && header[3] == 0
+}
+
+// tailBuffer is a writer keeping only the last max bytes written to it
+type tailBuffer struct {
+	max     int
+	buf     []byte
+	dropped int64
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.max; over > 0 {
+		t.dropped += int64(over)
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the kept output, starting at a line boundary if the front
+// was dropped, with runs of identical lines collapsed
+func (t *tailBuffer) String() string {
+	text := string(t.buf)
+	if t.dropped > 0 {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			t.dropped += int64(i + 1)
+			text = text[i+1:]
+		}
+	}
+
+	var b strings.Builder
+	if t.dropped > 0 {
+		fmt.Fprintf(&b, "(%d bytes of earlier output omitted)\n", t.dropped)
+	}
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i := 0; i < len(lines); {
+		n := 1
+		for i+n < len(lines) && lines[i+n] == lines[i] {
+			n++
+		}
+		b.WriteString(lines[i])
+		if n > 1 {
+			fmt.Fprintf(&b, " (repeated %d times)", n)
+		}
+		b.WriteByte('\n')
+		i += n
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// RetryPolicy controls how often transient Docker errors are retried.
+// Attempts counts the first try; the delay before each retry starts at
+// Backoff and doubles every time.
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created with NewClient
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: time.Second}
+
+// SetRetryPolicy sets the retry policy for worker containers. Each retry is
+// reported to log unless it is nil.
+func (c *Client) SetRetryPolicy(policy RetryPolicy, log io.Writer) {
+	c.retry = policy
+	c.retryLog = log
+}
+
+// SetContext sets the context Docker operations run under. Once it is
+// done, running operations are aborted and new ones fail, but temporary
+// containers and volumes are still removed.
+func (c *Client) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// cleanupCtx returns the context for undoing what an operation set up,
+// which must happen even if the operation was aborted
+func (c *Client) cleanupCtx() context.Context {
+	return context.WithoutCancel(c.ctx)
+}
+
+// SetWarningHandler sets the function told about problems cleaning up after
+// an operation, such as a temporary container that could not be removed.
+// They go to stderr by default; nil discards them.
+func (c *Client) SetWarningHandler(warnf func(format string, args ...any)) {
+	c.warnf = warnf
+}
+
+// warnStderr is the default warning handler
+func warnStderr(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+}
+
+// warn reports a problem the operation recovered from
+func (c *Client) warn(format string, args ...any) {
+	if c.warnf != nil {
+		c.warnf(format, args...)
+	}
+}
+
+// withRetry calls fn until it succeeds, fails with an error that is not
+// transient, or runs out of attempts
+func (c *Client) withRetry(op string, fn func() error) error {
+	delay := c.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= c.retry.Attempts || !isTransient(err) {
+			return err
+		}
+
+		if c.retryLog != nil {
+			fmt.Fprintf(c.retryLog, "%s: attempt %d/%d failed: %v; retrying in %s\n", op, attempt, c.retry.Attempts, err, delay)
+		}
+		select {
+		case <-time.After(delay):
+		case <-c.ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// isTransient reports whether err is a daemon error worth retrying: the
+// daemon being unreachable, overloaded or timing out, or a registry rate
+// limit during an image pull. A worker exiting non-zero is never transient.
+func isTransient(err error) bool {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return false
+	}
+
+	if cerrdefs.IsUnavailable(err) || cerrdefs.IsResourceExhausted(err) || cerrdefs.IsDeadlineExceeded(err) {
+		return true
+	}
+	if client.IsErrConnectionFailed(err) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "toomanyrequests") || strings.Contains(msg, "rate limit")
+}
+
+// SnapshotPath returns the path of the GNU tar snapshot file stored next to
+// an incremental backup. A backup with a snapshot file can serve as the base
+// of the next incremental backup.
+func SnapshotPath(backupPath string) string {
+	return backupPath + ".snar"
+}
+
+// tarImage returns the worker image archiving or extracting volumes with
+// tarOpts: GNUTarImage if they need GNU tar, the smaller AlpineImage
+// otherwise
+func tarImage(tarOpts TarOptions) string {
+	if tarOpts.gnu() {
+		return GNUTarImage
+	}
+	return AlpineImage
+}
+
+// backupCmd builds the command that archives source into archive. busybox
+// tar cannot pass a level to gzip, so with a level tar's output is piped
+// through gzip instead. tarOpts need GNU tar, which takes the level itself.
+func backupCmd(archive, source string, compress bool, level int, tarOpts TarOptions) []string {
+	if tarOpts.gnu() {
+		cmd := append([]string{"tar", "-c"}, tarOpts.createFlags()...)
+		if compress && level > 0 {
+			cmd = append(cmd, "-I", fmt.Sprintf("gzip -%d", level))
+		} else if compress {
+			cmd = append(cmd, "-z")
+		}
+		return append(cmd, "-f", archive, "-C", source, ".")
+	}
+	if compress && level > 0 {
+		tar := strings.Join(append([]string{"tar", "-c"}, tarOpts.createFlags()...), " ")
+		script := fmt.Sprintf("set -o pipefail; %s -f - -C '%s' . | gzip -%d > '%s'", tar, source, level, archive)
+		return []string{"sh", "-c", script}
+	}
+
+	// Build tar command with explicit flags to avoid ambiguous option concatenation
+	cmd := append([]string{"tar", "-c"}, tarOpts.createFlags()...)
+	if compress {
+		cmd = append(cmd, "-z")
+	}
+	return append(cmd, "-f", archive, "-C", source, ".")
+}
+
+// isZstdPath reports whether a backup at path is to be compressed with zstd
+func isZstdPath(path string) bool {
+	return strings.HasSuffix(path, ".tar.zst")
+}
+
+// zstdBackupCmd builds the command that archives source into archive
+// compressed with zstd, passing the level (1-19, 0 for zstd's default) to
+// zstd through GNU tar in ZstdImage, which also supports every TarOptions
+func zstdBackupCmd(archive, source string, level int, tarOpts TarOptions) []string {
+	cmd := append([]string{"tar", "-c"}, tarOpts.createFlags()...)
+	program := "zstd"
+	if level > 0 {
+		program = fmt.Sprintf("zstd -%d", level)
+	}
+	return append(cmd, "-I", program, "-f", archive, "-C", source, ".")
+}
+
+// incrementalBackupCmd builds the tar command that archives source into
+// archive, recording file state in snapshot. If snapshot already holds the
+// state of a previous backup only changes since then are archived.
+func incrementalBackupCmd(snapshot, archive, source string, compress bool, level int, tarOpts TarOptions) []string {
+	cmd := append([]string{"tar", "-c"}, tarOpts.createFlags()...)
+	if compress && level > 0 {
+		cmd = append(cmd, "-I", fmt.Sprintf("gzip -%d", level))
+	} else if compress {
+		cmd = append(cmd, "-z")
+	}
+	return append(cmd, "-g", snapshot, "-f", archive, "-C", source, ".")
+}
+
+// chainRestoreScript builds a shell script that extracts archives into
+// target in order. Extracting with an empty snapshot makes GNU tar replay
+// each increment, including deleting files removed since the previous one.
+// With an Owner every file is then given to it.
+func chainRestoreScript(archives []string, target string, tarOpts TarOptions) string {
+	var flags string
+	for _, flag := range tarOpts.extractFlags() {
+		flags += fmt.Sprintf(" '%s'", flag)
+	}
+
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	for _, archive := range archives {
+		fmt.Fprintf(&b, "tar -x -g /dev/null%s -f '%s' -C '%s'\n", flags, archive, target)
+	}
+	if tarOpts.Owner != "" {
+		fmt.Fprintf(&b, "chown -R -h '%s' '%s'\n", tarOpts.Owner, target)
+	}
+	return b.String()
+}
+
+// BackupVolumeIncremental backs up a volume with GNU tar's listed-incremental
+// mode, writing the snapshot file to SnapshotPath(outputPath). If
+// baseSnapshot is non-empty it is the snapshot of the previous backup in the
+// chain and only changes since that backup are archived; otherwise a full
+// level-0 backup is taken. level is the gzip compression level, 0 for
+// gzip's default.
+func (c *Client) BackupVolumeIncremental(volumeName, outputPath, baseSnapshot string, compress bool, level int, tarOpts TarOptions) error {
+	outputDir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	stamp := time.Now().UnixNano()
+	tempArchive := fmt.Sprintf(".backup-temp-%d.tar", stamp)
+	tempSnapshot := fmt.Sprintf(".backup-temp-%d.snar", stamp)
+	tempArchivePath := filepath.Join(outputDir, tempArchive)
+	tempSnapshotPath := filepath.Join(outputDir, tempSnapshot)
+
+	// tar updates the snapshot in place, so work on a copy of the base
+	if baseSnapshot != "" {
+		if err := copyFile(baseSnapshot, tempSnapshotPath); err != nil {
+			return fmt.Errorf("failed to read base snapshot: %w", err)
+		}
+	}
+
+	cmd := incrementalBackupCmd(
+		filepath.Join("/backup", tempSnapshot),
+		filepath.Join("/backup", tempArchive),
+		"/source",
+		compress,
+		level,
+		tarOpts,
+	)
+	err := c.runWorker(GNUTarImage, "backup", cmd, []mount.Mount{
+		{
+			Type:     mount.TypeVolume,
+			Source:   volumeName,
+			Target:   "/source",
+			ReadOnly: true,
+		},
+		{
+			Type:   mount.TypeBind,
+			Source: outputDir,
+			Target: "/backup",
+		},
+	})
+	if err != nil {
+		os.Remove(tempArchivePath)
+		os.Remove(tempSnapshotPath)
+		return err
+	}
+
+	if err := os.Rename(tempSnapshotPath, SnapshotPath(outputPath)); err != nil {
+		os.Remove(tempArchivePath)
+		return err
+	}
+	return os.Rename(tempArchivePath, outputPath)
+}
+
+// RestoreVolumeChain restores a volume from an incremental backup chain:
+// the level-0 backup followed by each increment, oldest first
+func (c *Client) RestoreVolumeChain(volumeName string, backupPaths []string, tarOpts TarOptions) error {
+	if len(backupPaths) == 0 {
+		return fmt.Errorf("no backups to restore")
+	}
+
+	mounts := []mount.Mount{{
+		Type:   mount.TypeVolume,
+		Source: volumeName,
+		Target: "/target",
+	}}
+	var archives []string
+	for i, path := range backupPaths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return fmt.Errorf("backup file not found: %s", path)
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		archive := fmt.Sprintf("/backup/%d.tar", i)
+		archives = append(archives, archive)
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   abs,
+			Target:   archive,
+			ReadOnly: true,
+		})
+	}
+
+	// Create volume if it doesn't exist
+	if !c.VolumeExists(volumeName) {
+		if err := c.CreateVolume(volumeName); err != nil {
+			return err
+		}
+	}
+
+	return c.runWorker(GNUTarImage, "restore", []string{"sh", "-c", chainRestoreScript(archives, "/target", tarOpts)}, mounts)
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ShellMountPoint is where RunShell mounts the volume inside the container
+const ShellMountPoint = "/data"
+
+// shellContainerConfig builds the spec of an interactive shell container
+// with volumeName mounted at ShellMountPoint, like
+// `docker run -it --rm -v <volume>:/data <image> sh`
+func shellContainerConfig(volumeName, image string, readOnly bool) (*container.Config, *container.HostConfig) {
+	return &container.Config{
+		Image:        image,
+		Cmd:          []string{"sh"},
+		WorkingDir:   ShellMountPoint,
+		Tty:          true,
+		OpenStdin:    true,
+		StdinOnce:    true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{{
+			Type:     mount.TypeVolume,
+			Source:   volumeName,
+			Target:   ShellMountPoint,
+			ReadOnly: readOnly,
+		}},
+	}
+}
+
+// createShellContainer creates the container for RunShell, returning its ID
+func (c *Client) createShellContainer(volumeName, image string, readOnly bool) (string, error) {
+	if err := c.ensureImage(image); err != nil {
+		return "", err
+	}
+
+	config, hostConfig := shellContainerConfig(volumeName, image, readOnly)
+	resp, err := c.cli.ContainerCreate(c.ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// RunShell opens an interactive shell in a temporary container of image with
+// volumeName mounted at ShellMountPoint, attached to the user's terminal.
+// The container is removed when the shell exits.
+func (c *Client) RunShell(volumeName, image string, readOnly bool) error {
+	inFd, isTerminal := term.GetFdInfo(os.Stdin)
+	if !isTerminal {
+		return fmt.Errorf("an interactive terminal is required")
+	}
+
+	id, err := c.createShellContainer(volumeName, image, readOnly)
+	if err != nil {
+		return err
+	}
+
+	// Ensure container cleanup
+	defer func() {
+		if err := c.cli.ContainerRemove(c.cleanupCtx(), id, container.RemoveOptions{Force: true}); err != nil {
+			c.warn("failed to remove temporary container %s: %v", id, err)
+		}
+	}()
+
+	attach, err := c.cli.ContainerAttach(c.ctx, id, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer attach.Close()
+
+	// Register the wait before starting so a quick exit is not missed
+	statusCh, errCh := c.cli.ContainerWait(c.ctx, id, container.WaitConditionNextExit)
+
+	if err := c.cli.ContainerStart(c.ctx, id, container.StartOptions{}); err != nil {
+		return err
+	}
+
+	state, err := term.SetRawTerminal(inFd)
+	if err != nil {
+		return err
+	}
+	defer term.RestoreTerminal(inFd, state)
+
+	if size, err := term.GetWinsize(inFd); err == nil {
+		c.cli.ContainerResize(c.ctx, id, container.ResizeOptions{Height: uint(size.Height), Width: uint(size.Width)})
+	}
+
+	// With a TTY the output is a single raw stream
+	go io.Copy(os.Stdout, attach.Reader)
+	go io.Copy(attach.Conn, os.Stdin)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-statusCh:
+		return nil
+	}
+}
+
+// copyRoot is where copy containers mount the volume
+const copyRoot = "/data"
+
+// createCopyContainer creates, without starting it, a worker container with
+// volumeName mounted at copyRoot, for use with the archive API. The returned
+// function removes the container.
+func (c *Client) createCopyContainer(volumeName string, readOnly bool) (string, func(), error) {
+	if err := c.ensureImage(AlpineImage); err != nil {
+		return "", nil, err
+	}
+
+	resp, err := c.cli.ContainerCreate(c.ctx, &container.Config{
+		Image: AlpineImage,
+		Cmd:   []string{"true"},
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{{
+			Type:     mount.TypeVolume,
+			Source:   volumeName,
+			Target:   copyRoot,
+			ReadOnly: readOnly,
+		}},
+	}, nil, nil, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	return resp.ID, func() {
+		if err := c.cli.ContainerRemove(c.cleanupCtx(), resp.ID, container.RemoveOptions{Force: true}); err != nil {
+			c.warn("failed to remove temporary container %s: %v", resp.ID, err)
+		}
+	}, nil
+}
+
+// CopyToVolume copies the local file or directory src to dst, a path inside
+// the volume. If dst is an existing directory src is copied into it,
+// otherwise it is copied to dst itself.
+func (c *Client) CopyToVolume(volumeName, src, dst string) error {
+	if _, err := os.Lstat(src); err != nil {
+		return err
+	}
+
+	id, cleanup, err := c.createCopyContainer(volumeName, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	target := path.Join(copyRoot, dst)
+	dir, name := path.Dir(target), path.Base(target)
+	if stat, err := c.cli.ContainerStatPath(c.ctx, id, target); err == nil && stat.Mode.IsDir() {
+		dir, name = target, filepath.Base(src)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, src, name))
+	}()
+	defer pr.Close()
+
+	return c.cli.CopyToContainer(c.ctx, id, dir, pr, container.CopyToContainerOptions{})
+}
+
+// CopyFromVolume copies src, a file or directory inside the volume, to the
+// local path dst. If dst is an existing directory src is copied into it,
+// otherwise it is copied to dst itself.
+func (c *Client) CopyFromVolume(volumeName, src, dst string) error {
+	id, cleanup, err := c.createCopyContainer(volumeName, true)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	content, stat, err := c.cli.CopyFromContainer(c.ctx, id, path.Join(copyRoot, src))
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	target := dst
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		target = filepath.Join(dst, stat.Name)
+	}
+	return extractTar(content, stat.Name, target)
+}
+
+// writeTar writes src, a file or directory tree, to w as a tar archive whose
+// entries are rooted at name
+func writeTar(w io.Writer, src, name string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(name, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar extracts a tar archive whose entries are rooted at name to
+// target, so that the entry name itself becomes target. Entries outside name
+// or escaping target are rejected.
+func extractTar(r io.Reader, name, target string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := strings.TrimSuffix(hdr.Name, "/")
+		rel, ok := strings.CutPrefix(entry, name)
+		if !ok || (rel != "" && !strings.HasPrefix(rel, "/")) {
+			return fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+		rel = filepath.FromSlash(strings.TrimPrefix(rel, "/"))
+		if !filepath.IsLocal(rel) && rel != "" {
+			return fmt.Errorf("archive entry %q escapes the destination", hdr.Name)
+		}
+		dest := filepath.Join(target, rel)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dest, hdr.FileInfo().Mode().Perm()|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.Remove(dest)
+			if err := os.Symlink(hdr.Linkname, dest); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// CopyVolume copies data from one volume to another
+func (c *Client) CopyVolume(sourceVolume, targetVolume string) error {
+	// Create target volume if it doesn't exist
+	if !c.VolumeExists(targetVolume) {
+		if err := c.CreateVolume(targetVolume); err != nil {
+			return err
+		}
+	}
+
+	// Run a temporary container to copy data
+	return c.runWorker(AlpineImage, "copy", []string{"sh", "-c", "cp -a /source/. /target/"}, []mount.Mount{
+		{
+			Type:     mount.TypeVolume,
+			Source:   sourceVolume,
+			Target:   "/source",
+			ReadOnly: true,
+		},
+		{
+			Type:   mount.TypeVolume,
+			Source: targetVolume,
+			Target: "/target",
+		},
+	})
+}
+
+// MirrorVolume replaces the contents of targetVolume with a copy of
+// sourceVolume. Unlike CopyVolume, files that only the target has are
+// removed, so the target ends up exactly like the source.
+func (c *Client) MirrorVolume(sourceVolume, targetVolume string) error {
+	if !c.VolumeExists(targetVolume) {
+		if err := c.CreateVolume(targetVolume); err != nil {
+			return err
+		}
+	}
+
+	return c.runWorker(AlpineImage, "mirror", mirrorCmd("/source", "/target"), []mount.Mount{
+		{
+			Type:     mount.TypeVolume,
+			Source:   sourceVolume,
+			Target:   "/source",
+			ReadOnly: true,
+		},
+		{
+			Type:   mount.TypeVolume,
+			Source: targetVolume,
+			Target: "/target",
+		},
+	})
+}
+
+// mirrorCmd builds the command that empties target and copies the contents
+// of source into it
+func mirrorCmd(source, target string) []string {
+	script := fmt.Sprintf("set -e; find '%s' -mindepth 1 -maxdepth 1 -exec rm -rf {} +; cp -a '%s'/. '%s'/", target, source, target)
+	return []string{"sh", "-c", script}
+}
+
 // PullImage ensures the alpine image is available
 func (c *Client) PullImage(imageName string) error {
 	reader, err := c.cli.ImagePull(c.ctx, imageName, image.PullOptions{})
@@ -517,6 +1800,52 @@ func (c *Client) StopContainersUsingVolume(volumeName string) error {
 	return nil
 }
 
+// StopContainers stops the given containers by ID, stopping at the first failure
+func (c *Client) StopContainers(ids []string) error {
+	timeout := DefaultContainerTimeout
+	for _, id := range ids {
+		if err := c.cli.ContainerStop(c.ctx, id, container.StopOptions{Timeout: &timeout}); err != nil {
+			return fmt.Errorf("failed to stop container %s: %w", shortID(id), err)
+		}
+	}
+
+	return nil
+}
+
+// StartContainers starts the given containers by ID. Every container is
+// attempted; failures are returned together. As it brings back containers
+// stopped for an operation, it runs even once the context is done.
+func (c *Client) StartContainers(ids []string) error {
+	var errs []error
+	for _, id := range ids {
+		if err := c.cli.ContainerStart(c.cleanupCtx(), id, container.StartOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to start container %s: %w", shortID(id), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RemoveContainers removes the given stopped containers by ID or name,
+// stopping at the first failure
+func (c *Client) RemoveContainers(ids []string) error {
+	for _, id := range ids {
+		if err := c.cli.ContainerRemove(c.ctx, id, container.RemoveOptions{}); err != nil {
+			return fmt.Errorf("failed to remove container %s: %w", shortID(id), err)
+		}
+	}
+
+	return nil
+}
+
+// shortID truncates a container ID to the 12-character form shown by docker ps
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
 // RestartContainersUsingVolume restarts containers using the volume
 func (c *Client) RestartContainersUsingVolume(volumeName string) error {
 	containers, err := c.GetContainersUsingVolume(volumeName)
@@ -541,14 +1870,14 @@ func (c *Client) GetUnusedVolumes() ([]*volume.Volume, error) {
 		return nil, err
 	}
 
+	inUse, err := c.GetVolumesInUse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check which volumes are in use: %w", err)
+	}
+
 	var unused []*volume.Volume
 	for _, vol := range vols {
-		inUse, err := c.IsVolumeInUse(vol.Name)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to check if volume %s is in use: %v\n", vol.Name, err)
-			continue
-		}
-		if !inUse {
+		if !inUse[vol.Name] {
 			unused = append(unused, vol)
 		}
 	}
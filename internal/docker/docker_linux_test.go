@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestXattrsSurviveBackupAndRestore(t *testing.T) {
+	requireGNUTar(t)
+
+	root := t.TempDir()
+	src := filepath.Join(root, "volume")
+	target := filepath.Join(root, "target")
+	for _, dir := range []string{src, target} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+	}
+	file := filepath.Join(src, "pg_hba.conf")
+	if err := os.WriteFile(file, []byte("local all all trust"), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := syscall.Setxattr(file, "user.dvm.test", []byte("kept"), 0); err != nil {
+		t.Skipf("the filesystem does not support extended attributes: %v", err)
+	}
+
+	tarOpts := TarOptions{Xattrs: true}
+	archive := filepath.Join(root, "app_data.tar.gz")
+	runHostTar(t, backupCmd(archive, src, true, 0, tarOpts))
+	runHostTar(t, restoreCmd(archive, target, CompressionGzip, tarOpts, nil))
+
+	buf := make([]byte, 64)
+	n, err := syscall.Getxattr(filepath.Join(target, "pg_hba.conf"), "user.dvm.test", buf)
+	if err != nil {
+		t.Fatalf("expected the attribute to be restored: %v", err)
+	}
+	if got := string(buf[:n]); got != "kept" {
+		t.Fatalf("expected attribute value %q, got %q", "kept", got)
+	}
+
+	// Restores with xattrs run GNU tar, extracting every namespace
+	daemon := &fakeDaemon{volumes: map[string]string{"app_data": "local"}}
+	c := newFakeClient(t, daemon)
+	if err := c.RestoreVolume("app_data", archive, tarOpts); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	config := daemon.configs[len(daemon.configs)-1]
+	if config.Image != GNUTarImage || !strings.Contains(strings.Join(config.Cmd, " "), "--xattrs --xattrs-include=* --acls") {
+		t.Fatalf("expected a %s worker extracting xattrs, got %s %v", GNUTarImage, config.Image, config.Cmd)
+	}
+}
@@ -0,0 +1,1475 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// fakeDaemon is a stub Docker Engine API. It records container start/stop
+// actions and the mounts of every worker container it is asked to create,
+// and keeps a minimal set of volumes.
+type fakeDaemon struct {
+	mu       sync.Mutex
+	actions  []string
+	failIDs  map[string]bool
+	exitCode int
+	stdout   string   // standard output of successful worker containers
+	failLogs []string // lines logged by failed workers, alternating stdout and stderr frames
+
+	volumes        map[string]string // name -> driver
+	sizes          map[string]int64  // name -> bytes reported by system df
+	labels         map[string]map[string]string
+	volumeFilters  []string // label filters received by volume list requests
+	workers        [][]mount.Mount
+	configs        []container.Config
+	removedVolumes []string
+	createdVolumes []volume.CreateOptions
+
+	// failCreates makes the next container create requests fail with
+	// failStatus; createAttempts counts all create requests
+	failCreates    int
+	failStatus     int
+	createAttempts int
+
+	// archive holds the files served by the archive API, keyed by their
+	// path inside the container; directories are implied by the paths.
+	// uploads records the destination and file entries of every upload.
+	archive map[string]string
+	uploads []upload
+
+	// missingImages are absent until built; builds records the Dockerfile
+	// of every build, which fails with buildError if set
+	missingImages map[string]bool
+	builds        []string
+	buildError    string
+}
+
+type upload struct {
+	Path    string
+	Entries map[string]string // entry name -> content, "" for directories
+}
+
+// statArchivePath reports whether p exists in the fake archive and if it
+// is a directory
+func (f *fakeDaemon) statArchivePath(p string) (container.PathStat, bool) {
+	if _, ok := f.archive[p]; ok {
+		return container.PathStat{Name: path.Base(p), Mode: 0o644}, true
+	}
+	for file := range f.archive {
+		if strings.HasPrefix(file, p+"/") {
+			return container.PathStat{Name: path.Base(p), Mode: os.ModeDir | 0o755}, true
+		}
+	}
+	return container.PathStat{}, false
+}
+
+func (f *fakeDaemon) serveArchive(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+
+	if r.Method == http.MethodPut {
+		rec := upload{Path: p, Entries: map[string]string{}}
+		tr := tar.NewReader(r.Body)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(tr)
+			rec.Entries[hdr.Name] = string(data)
+		}
+		f.uploads = append(f.uploads, rec)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	stat, ok := f.statArchivePath(p)
+	if !ok {
+		http.Error(w, `{"message":"Could not find the file in container"}`, http.StatusNotFound)
+		return
+	}
+	encoded, _ := json.Marshal(stat)
+	w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(encoded))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	tw := tar.NewWriter(w)
+	if !stat.Mode.IsDir() {
+		content := f.archive[p]
+		tw.WriteHeader(&tar.Header{Name: stat.Name, Mode: 0o644, Size: int64(len(content))})
+		io.WriteString(tw, content)
+	} else {
+		tw.WriteHeader(&tar.Header{Name: stat.Name + "/", Mode: 0o755, Typeflag: tar.TypeDir})
+		for file, content := range f.archive {
+			if rel, ok := strings.CutPrefix(file, p+"/"); ok {
+				tw.WriteHeader(&tar.Header{Name: stat.Name + "/" + rel, Mode: 0o644, Size: int64(len(content))})
+				io.WriteString(tw, content)
+			}
+		}
+	}
+	tw.Close()
+}
+
+func (f *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Paths look like /v1.47/<resource>/...
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+	resource, name := parts[1], ""
+	if len(parts) > 2 {
+		name = parts[2]
+	}
+
+	switch {
+	case resource == "volumes" && name == "" && r.Method == http.MethodGet:
+		args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wanted := args.Get("label")
+		f.volumeFilters = append(f.volumeFilters, wanted...)
+
+		var resp volume.ListResponse
+		for name, driver := range f.volumes {
+			if matchesLabels(f.labels[name], wanted) {
+				resp.Volumes = append(resp.Volumes, &volume.Volume{Name: name, Driver: driver, Labels: f.labels[name]})
+			}
+		}
+		writeJSON(w, resp)
+
+	case resource == "images" && r.Method == http.MethodGet:
+		if f.missingImages[name] {
+			http.Error(w, `{"message":"no such image"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]string{"Id": "sha256:alpine"})
+
+	case resource == "build" && r.Method == http.MethodPost:
+		tr := tar.NewReader(r.Body)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			if hdr.Name == "Dockerfile" {
+				dockerfile, _ := io.ReadAll(tr)
+				f.builds = append(f.builds, string(dockerfile))
+			}
+		}
+		if f.buildError != "" {
+			writeJSON(w, map[string]any{"errorDetail": map[string]string{"message": f.buildError}, "error": f.buildError})
+			return
+		}
+		delete(f.missingImages, r.URL.Query().Get("t"))
+		writeJSON(w, map[string]string{"stream": "Successfully built\n"})
+
+	case resource == "system" && name == "df":
+		var du types.DiskUsage
+		for name, size := range f.sizes {
+			du.Volumes = append(du.Volumes, &volume.Volume{
+				Name:      name,
+				UsageData: &volume.UsageData{Size: size, RefCount: -1},
+			})
+		}
+		writeJSON(w, du)
+
+	case resource == "volumes" && name == "create" && r.Method == http.MethodPost:
+		var req volume.CreateOptions
+		json.NewDecoder(r.Body).Decode(&req)
+		if f.volumes == nil {
+			f.volumes = map[string]string{}
+		}
+		if req.Driver == "" {
+			req.Driver = "local"
+		}
+		f.volumes[req.Name] = req.Driver
+		f.createdVolumes = append(f.createdVolumes, req)
+		writeJSON(w, volume.Volume{Name: req.Name, Driver: req.Driver, Options: req.DriverOpts})
+
+	case resource == "volumes" && r.Method == http.MethodGet:
+		driver, ok := f.volumes[name]
+		if !ok {
+			http.Error(w, `{"message":"no such volume"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, volume.Volume{Name: name, Driver: driver})
+
+	case resource == "volumes" && r.Method == http.MethodDelete:
+		delete(f.volumes, name)
+		f.removedVolumes = append(f.removedVolumes, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	case resource == "containers" && name == "create" && r.Method == http.MethodPost:
+		f.createAttempts++
+		if f.failCreates > 0 {
+			f.failCreates--
+			http.Error(w, `{"message":"daemon busy"}`, f.failStatus)
+			return
+		}
+		var req struct {
+			container.Config
+			HostConfig container.HostConfig
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.workers = append(f.workers, req.HostConfig.Mounts)
+		f.configs = append(f.configs, req.Config)
+		writeJSON(w, container.CreateResponse{ID: fmt.Sprintf("worker%d", len(f.workers))})
+
+	case resource == "containers" && r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+
+	case resource == "containers" && len(parts) == 4 && parts[3] == "archive":
+		f.serveArchive(w, r)
+
+	case resource == "containers" && len(parts) == 4 && parts[3] == "wait":
+		writeJSON(w, container.WaitResponse{StatusCode: int64(f.exitCode)})
+
+	case resource == "containers" && len(parts) == 4 && parts[3] == "logs":
+		if f.exitCode == 0 {
+			io.WriteString(stdcopy.NewStdWriter(w, stdcopy.Stdout), f.stdout)
+			return
+		}
+		if len(f.failLogs) > 0 {
+			streams := []io.Writer{stdcopy.NewStdWriter(w, stdcopy.Stdout), stdcopy.NewStdWriter(w, stdcopy.Stderr)}
+			for i, line := range f.failLogs {
+				io.WriteString(streams[i%2], line+"\n")
+			}
+			return
+		}
+		io.WriteString(w, "tar: unexpected end of file")
+
+	case resource == "containers" && len(parts) == 4 && r.Method == http.MethodPost:
+		action := parts[3]
+		f.actions = append(f.actions, action+" "+name)
+		if f.failIDs[name] {
+			http.Error(w, `{"message":"boom"}`, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// matchesLabels reports whether labels satisfy every "key" or "key=value" filter
+func matchesLabels(labels map[string]string, filters []string) bool {
+	for _, filter := range filters {
+		key, value, hasValue := strings.Cut(filter, "=")
+		got, ok := labels[key]
+		if !ok || (hasValue && got != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func newFakeClient(t *testing.T, daemon *fakeDaemon) *Client {
+	t.Helper()
+	srv := httptest.NewServer(daemon)
+	t.Cleanup(srv.Close)
+
+	cli, err := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(srv.URL, "http://")),
+		client.WithVersion("1.47"),
+		client.WithHTTPClient(srv.Client()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { cli.Close() })
+
+	return &Client{cli: cli, ctx: context.Background()}
+}
+
+func TestStopAndStartContainersActOnlyOnGivenIDs(t *testing.T) {
+	daemon := &fakeDaemon{}
+	c := newFakeClient(t, daemon)
+
+	snapshot := []string{"aaa111", "bbb222"}
+	if err := c.StopContainers(snapshot); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if err := c.StartContainers(snapshot); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	want := []string{"stop aaa111", "stop bbb222", "start aaa111", "start bbb222"}
+	if strings.Join(daemon.actions, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected actions %v, got %v", want, daemon.actions)
+	}
+}
+
+func TestStartContainersAttemptsAll(t *testing.T) {
+	daemon := &fakeDaemon{failIDs: map[string]bool{"aaa111": true}}
+	c := newFakeClient(t, daemon)
+
+	err := c.StartContainers([]string{"aaa111", "bbb222"})
+	if err == nil || !strings.Contains(err.Error(), "aaa111") {
+		t.Fatalf("expected error mentioning aaa111, got %v", err)
+	}
+
+	want := []string{"start aaa111", "start bbb222"}
+	if strings.Join(daemon.actions, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected actions %v, got %v", want, daemon.actions)
+	}
+}
+
+func TestStopContainersStopsAtFirstFailure(t *testing.T) {
+	daemon := &fakeDaemon{failIDs: map[string]bool{"aaa111": true}}
+	c := newFakeClient(t, daemon)
+
+	if err := c.StopContainers([]string{"aaa111", "bbb222"}); err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(daemon.actions) != 1 || daemon.actions[0] != "stop aaa111" {
+		t.Fatalf("expected only aaa111 to be stopped, got %v", daemon.actions)
+	}
+}
+
+func TestNewClientReportsUnreachableDaemon(t *testing.T) {
+	// A daemon whose ping always fails
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	host := "tcp://" + strings.TrimPrefix(srv.URL, "http://")
+	t.Setenv("DOCKER_HOST", host)
+	// Keep the docker CLI context fallback out of the picture
+	t.Setenv("PATH", "")
+
+	_, err := NewClient()
+	if !errors.Is(err, ErrDockerUnavailable) {
+		t.Fatalf("expected ErrDockerUnavailable, got %v", err)
+	}
+	if !strings.Contains(err.Error(), host) || !strings.Contains(err.Error(), "is it running?") {
+		t.Fatalf("expected actionable error naming %s, got %v", host, err)
+	}
+}
+
+// writeTruncatedBackup writes a gzip archive cut off halfway through.
+func writeTruncatedBackup(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(bytes.Repeat([]byte("data"), 4096))
+	zw.Close()
+
+	path := filepath.Join(t.TempDir(), "app_data_2024-01-01_000000.tar.gz")
+	if err := os.WriteFile(path, buf.Bytes()[:buf.Len()/2], 0o644); err != nil {
+		t.Fatalf("failed to write backup: %v", err)
+	}
+	return path
+}
+
+// mountsVolume reports whether any of mounts writes to the named volume.
+func mountsVolume(mounts []mount.Mount, name string) bool {
+	for _, m := range mounts {
+		if m.Type == mount.TypeVolume && m.Source == name && !m.ReadOnly {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRestoreVolumeAtomicLeavesTargetUntouchedOnTruncatedArchive(t *testing.T) {
+	daemon := &fakeDaemon{
+		exitCode: 1, // tar fails on the truncated archive
+		volumes:  map[string]string{"app_data": "local"},
+	}
+	c := newFakeClient(t, daemon)
+
+	err := c.RestoreVolumeAtomic("app_data", writeTruncatedBackup(t), TarOptions{})
+	if err == nil || !strings.Contains(err.Error(), "app_data was left untouched") {
+		t.Fatalf("expected extraction error, got %v", err)
+	}
+
+	if len(daemon.workers) != 1 {
+		t.Fatalf("expected only the extraction worker to run, got %d workers", len(daemon.workers))
+	}
+	for _, mounts := range daemon.workers {
+		if mountsVolume(mounts, "app_data") {
+			t.Fatalf("target volume was mounted writable: %+v", mounts)
+		}
+	}
+	if _, ok := daemon.volumes["app_data"]; !ok {
+		t.Fatalf("target volume was removed")
+	}
+	if len(daemon.removedVolumes) != 1 || !strings.HasPrefix(daemon.removedVolumes[0], "app_data_dvm_restore_") {
+		t.Fatalf("expected scratch volume to be removed, got %v", daemon.removedVolumes)
+	}
+}
+
+func TestRestoreVolumeAtomicReplacesTargetAfterExtraction(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]string{"app_data": "local"}}
+	c := newFakeClient(t, daemon)
+
+	if err := c.RestoreVolumeAtomic("app_data", writeTruncatedBackup(t), TarOptions{}); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	if len(daemon.workers) != 2 {
+		t.Fatalf("expected extraction and replace workers, got %d", len(daemon.workers))
+	}
+	if mountsVolume(daemon.workers[0], "app_data") {
+		t.Fatalf("extraction worker mounted the target volume: %+v", daemon.workers[0])
+	}
+	if !mountsVolume(daemon.workers[1], "app_data") {
+		t.Fatalf("replace worker did not mount the target volume: %+v", daemon.workers[1])
+	}
+	if len(daemon.removedVolumes) != 1 || daemon.removedVolumes[0] == "app_data" {
+		t.Fatalf("expected only the scratch volume to be removed, got %v", daemon.removedVolumes)
+	}
+}
+
+func TestCreateVolumeWithOptions(t *testing.T) {
+	daemon := &fakeDaemon{}
+	c := newFakeClient(t, daemon)
+
+	opts := map[string]string{"type": "nfs", "o": "addr=10.0.0.1", "device": ":/exports"}
+	labels := map[string]string{"com.docker.compose.project": "shop", "com.docker.compose.volume": "media"}
+	if err := c.CreateVolumeWithOptions("media", "local", opts, labels); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if err := c.CreateVolume("plain"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	if len(daemon.createdVolumes) != 2 {
+		t.Fatalf("expected two create requests, got %+v", daemon.createdVolumes)
+	}
+	got := daemon.createdVolumes[0]
+	if got.Name != "media" || got.Driver != "local" || got.DriverOpts["device"] != ":/exports" {
+		t.Fatalf("expected driver and options to be sent, got %+v", got)
+	}
+	if got.Labels["com.docker.compose.project"] != "shop" || len(got.Labels) != 2 {
+		t.Fatalf("expected labels to be sent, got %+v", got.Labels)
+	}
+	if got := daemon.createdVolumes[1]; got.Name != "plain" || len(got.DriverOpts) != 0 || len(got.Labels) != 0 {
+		t.Fatalf("expected a plain volume, got %+v", got)
+	}
+}
+
+func TestRestoreVolumeAtomicRejectsNonLocalDriver(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]string{"app_data": "nfs"}}
+	c := newFakeClient(t, daemon)
+
+	err := c.RestoreVolumeAtomic("app_data", writeTruncatedBackup(t), TarOptions{})
+	if !errors.Is(err, ErrAtomicUnsupported) {
+		t.Fatalf("expected ErrAtomicUnsupported, got %v", err)
+	}
+	if len(daemon.workers) != 0 || len(daemon.removedVolumes) != 0 {
+		t.Fatalf("expected no changes, got workers %v, removed %v", daemon.workers, daemon.removedVolumes)
+	}
+}
+
+func TestGetVolumeSizes(t *testing.T) {
+	daemon := &fakeDaemon{sizes: map[string]int64{
+		"app_data":   2048,
+		"app_cache":  512,
+		"nfs_volume": -1, // driver does not report usage
+	}}
+	c := newFakeClient(t, daemon)
+
+	sizes, err := c.GetVolumeSizes()
+	if err != nil {
+		t.Fatalf("failed to get sizes: %v", err)
+	}
+	if len(sizes) != 2 || sizes["app_data"] != 2048 || sizes["app_cache"] != 512 {
+		t.Fatalf("unexpected sizes: %v", sizes)
+	}
+
+	if size, err := c.GetVolumeSize("app_data"); err != nil || size != 2048 {
+		t.Fatalf("expected 2048, got %d (%v)", size, err)
+	}
+	if _, err := c.GetVolumeSize("nfs_volume"); err == nil {
+		t.Fatalf("expected error for volume without usage data")
+	}
+}
+
+func TestVolumeChecksum(t *testing.T) {
+	daemon := &fakeDaemon{stdout: "3f2a9c0e  -\n"}
+	c := newFakeClient(t, daemon)
+
+	sum, err := c.VolumeChecksum("app_data")
+	if err != nil {
+		t.Fatalf("checksum failed: %v", err)
+	}
+	if sum != "3f2a9c0e" {
+		t.Fatalf("expected 3f2a9c0e, got %q", sum)
+	}
+	if len(daemon.workers) != 1 || daemon.workers[0][0].Source != "app_data" || !daemon.workers[0][0].ReadOnly {
+		t.Fatalf("expected app_data to be mounted read-only, got %+v", daemon.workers)
+	}
+
+	daemon.stdout = ""
+	if _, err := c.VolumeChecksum("app_data"); err == nil {
+		t.Fatalf("expected error for empty output")
+	}
+}
+
+func TestListVolumesByLabel(t *testing.T) {
+	daemon := &fakeDaemon{
+		volumes: map[string]string{
+			"custom_db_name": "local",
+			"shop_cache":     "local",
+			"other_data":     "local",
+			"manual":         "local",
+		},
+		labels: map[string]map[string]string{
+			"custom_db_name": {LabelComposeProject: "shop"},
+			"shop_cache":     {LabelComposeProject: "shop"},
+			"other_data":     {LabelComposeProject: "other"},
+		},
+	}
+	c := newFakeClient(t, daemon)
+
+	vols, err := c.ListVolumesByLabel(LabelComposeProject, "shop")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+
+	var names []string
+	for _, vol := range vols {
+		names = append(names, vol.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "custom_db_name,shop_cache" {
+		t.Fatalf("expected shop volumes regardless of name, got %v", names)
+	}
+	if len(daemon.volumeFilters) != 1 || daemon.volumeFilters[0] != LabelComposeProject+"=shop" {
+		t.Fatalf("expected the daemon to filter by label, got %v", daemon.volumeFilters)
+	}
+
+	vols, err = c.ListVolumesByLabel(LabelComposeProject, "")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(vols) != 3 {
+		t.Fatalf("expected every compose volume for a key-only filter, got %d", len(vols))
+	}
+}
+
+// requireGNUTar skips the test unless the host has GNU tar, which the
+// incremental worker commands are written for
+func requireGNUTar(t *testing.T) {
+	t.Helper()
+	out, err := exec.Command("tar", "--version").Output()
+	if err != nil || !strings.Contains(string(out), "GNU tar") {
+		t.Skip("GNU tar is not available")
+	}
+}
+
+// runHostTar runs a worker command on the host instead of in a container
+func runHostTar(t *testing.T, cmd []string) {
+	t.Helper()
+	if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+		t.Fatalf("%v failed: %v\n%s", cmd, err, out)
+	}
+}
+
+// readTree returns the regular files under dir, keyed by relative path
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		tree[rel] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", dir, err)
+	}
+	return tree
+}
+
+func TestIncrementalChainRestoresFinalState(t *testing.T) {
+	requireGNUTar(t)
+
+	root := t.TempDir()
+	src := filepath.Join(root, "volume")
+	backups := filepath.Join(root, "backups")
+	for _, dir := range []string{filepath.Join(src, "data"), backups} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+	}
+	write := func(rel, content string) {
+		if err := os.WriteFile(filepath.Join(src, rel), []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	// Level 0
+	write("data/keep.txt", "unchanged")
+	write("data/edit.txt", "v1")
+	write("data/remove.txt", "gone soon")
+	base := filepath.Join(backups, "db_2024-01-01_000000.tar.gz")
+	runHostTar(t, incrementalBackupCmd(SnapshotPath(base), base, src, true, 0, TarOptions{}))
+
+	// Modify the volume, then take a level-1 increment from a copy of the
+	// base snapshot, as BackupVolumeIncremental does
+	write("data/edit.txt", "v2 with more content")
+	write("data/new.txt", "added")
+	if err := os.Remove(filepath.Join(src, "data", "remove.txt")); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	delta := filepath.Join(backups, "db_2024-01-02_000000.tar.gz")
+	if err := copyFile(SnapshotPath(base), SnapshotPath(delta)); err != nil {
+		t.Fatalf("snapshot copy failed: %v", err)
+	}
+	runHostTar(t, incrementalBackupCmd(SnapshotPath(delta), delta, src, true, 9, TarOptions{}))
+
+	// The delta carries only what changed
+	out, err := exec.Command("tar", "-tzf", delta).Output()
+	if err != nil {
+		t.Fatalf("listing delta failed: %v", err)
+	}
+	if strings.Contains(string(out), "keep.txt") {
+		t.Fatalf("expected unchanged file to be left out of the delta, got:\n%s", out)
+	}
+
+	// Restore the chain into a target holding stale data
+	target := filepath.Join(root, "target")
+	if err := os.MkdirAll(filepath.Join(target, "data"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "data", "stale.txt"), []byte("stale"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	runHostTar(t, []string{"sh", "-c", chainRestoreScript([]string{base, delta}, target, TarOptions{})})
+
+	want := readTree(t, src)
+	got := readTree(t, target)
+	if len(got) != len(want) {
+		t.Fatalf("expected files %v, got %v", want, got)
+	}
+	for path, content := range want {
+		if got[path] != content {
+			t.Errorf("%s: expected %q, got %q", path, content, got[path])
+		}
+	}
+}
+
+func TestRestoreVolumeChainMountsArchivesInOrder(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]string{"app_data": "local"}}
+	c := newFakeClient(t, daemon)
+
+	dir := t.TempDir()
+	var chain []string
+	for _, name := range []string{"base.tar.gz", "delta1.tar.gz", "delta2.tar.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		chain = append(chain, path)
+	}
+
+	if err := c.RestoreVolumeChain("app_data", chain, TarOptions{}); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	if len(daemon.workers) != 1 {
+		t.Fatalf("expected a single restore worker, got %d", len(daemon.workers))
+	}
+	mounts := daemon.workers[0]
+	if !mountsVolume(mounts, "app_data") {
+		t.Fatalf("restore worker did not mount the target volume: %+v", mounts)
+	}
+	var sources []string
+	for _, m := range mounts {
+		if m.Type == mount.TypeBind {
+			sources = append(sources, m.Source)
+		}
+	}
+	if strings.Join(sources, ",") != strings.Join(chain, ",") {
+		t.Fatalf("expected archives mounted in chain order %v, got %v", chain, sources)
+	}
+}
+
+func TestRestoreCmdExtractsOnlyMembers(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "volume")
+	target := filepath.Join(root, "target")
+	write := func(dir, rel, content string) {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	write(src, "data/uploads/a.png", "a")
+	write(src, "data/uploads/sub/b.png", "b")
+	write(src, "data/db.sqlite", "backed up")
+	write(src, "top.txt", "top")
+	archive := filepath.Join(root, "app_data.tar.gz")
+	runHostTar(t, backupCmd(archive, src, true, 0, TarOptions{}))
+
+	// The live volume lost its uploads but has newer data elsewhere
+	write(target, "data/db.sqlite", "live")
+	runHostTar(t, restoreCmd(archive, target, CompressionGzip, TarOptions{}, []string{"data/uploads"}))
+
+	want := map[string]string{
+		filepath.Join("data", "uploads", "a.png"):        "a",
+		filepath.Join("data", "uploads", "sub", "b.png"): "b",
+		filepath.Join("data", "db.sqlite"):               "live",
+	}
+	if got := readTree(t, target); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// RestoreVolume hands the members to the worker
+	daemon := &fakeDaemon{volumes: map[string]string{"app_data": "local"}}
+	c := newFakeClient(t, daemon)
+	if err := c.RestoreVolume("app_data", archive, TarOptions{}, "data/uploads"); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	cmd := daemon.configs[len(daemon.configs)-1].Cmd
+	if cmd[len(cmd)-1] != "./data/uploads" {
+		t.Fatalf("expected the member to be passed to tar, got %v", cmd)
+	}
+}
+
+func TestRestoreChownsMembers(t *testing.T) {
+	if cmd := strings.Join(restoreCmd("/backup/a.tar.gz", "/target", CompressionGzip, TarOptions{}, nil), " "); cmd != "tar -x --numeric-owner -z -f /backup/a.tar.gz -C /target" {
+		t.Fatalf("unexpected restore command %q", cmd)
+	}
+
+	// Only the restored members are given to the new owner
+	daemon := &fakeDaemon{volumes: map[string]string{"app_data": "local"}}
+	c := newFakeClient(t, daemon)
+	archive := filepath.Join(t.TempDir(), "app_data.tar.gz")
+	if err := os.WriteFile(archive, []byte{0x1f, 0x8b}, 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := c.RestoreVolume("app_data", archive, TarOptions{Owner: "1000:1000"}, "data/uploads"); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if len(daemon.configs) != 2 {
+		t.Fatalf("expected a restore and a chown worker, got %d", len(daemon.configs))
+	}
+	if cmd := strings.Join(daemon.configs[1].Cmd, " "); cmd != "chown -R -h 1000:1000 /target/data/uploads" {
+		t.Fatalf("unexpected chown command %q", cmd)
+	}
+
+	script := chainRestoreScript([]string{"/backup/0.tar"}, "/target", TarOptions{Owner: "1000"})
+	if !strings.Contains(script, "--numeric-owner") || !strings.HasSuffix(script, "chown -R -h '1000' '/target'\n") {
+		t.Fatalf("expected the chain to restore numeric owners and chown afterwards, got:\n%s", script)
+	}
+}
+
+func TestListArchiveContents(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "volume")
+	if err := os.MkdirAll(filepath.Join(src, "data"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	for name, content := range map[string]string{"data/a.txt": "hello", "data/with space.bin": strings.Repeat("x", 2048)} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if err := os.Symlink("a.txt", filepath.Join(src, "data", "link")); err != nil {
+		t.Fatalf("symlink failed: %v", err)
+	}
+	archive := filepath.Join(root, "app_data.tar.gz")
+	runHostTar(t, backupCmd(archive, src, true, 0, TarOptions{}))
+
+	// The listing of the host's tar parses like busybox's below
+	cmd := listArchiveCmd(archive, CompressionGzip)
+	out, err := exec.Command(cmd[0], cmd[1:]...).Output()
+	if err != nil {
+		t.Fatalf("listing failed: %v", err)
+	}
+	entries, err := parseTarListing(string(out))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	got := make(map[string]ArchiveEntry)
+	for _, e := range entries {
+		got[e.Name] = e
+	}
+	for name, want := range map[string]ArchiveEntry{
+		"./data/":               {Name: "./data/", Dir: true},
+		"./data/a.txt":          {Name: "./data/a.txt", Size: 5},
+		"./data/with space.bin": {Name: "./data/with space.bin", Size: 2048},
+		"./data/link":           {Name: "./data/link"},
+	} {
+		if got[name] != want {
+			t.Errorf("%s: expected %+v, got %+v", name, want, got[name])
+		}
+	}
+
+	// ListArchiveContents runs tar in a worker with the archive mounted
+	daemon := &fakeDaemon{stdout: "drwxr-xr-x root/root         0 2024-01-01 00:00:00 ./\n" +
+		"-rw-r--r-- root/root         5 2024-01-01 00:00:00 ./data/a.txt\n" +
+		"lrwxrwxrwx root/root         0 2024-01-01 00:00:00 ./data/link -> a.txt\n"}
+	c := newFakeClient(t, daemon)
+	entries, err = c.ListArchiveContents(archive)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	want := []ArchiveEntry{{Name: "./", Dir: true}, {Name: "./data/a.txt", Size: 5}, {Name: "./data/link"}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("expected %+v, got %+v", want, entries)
+	}
+	mounts := daemon.workers[0]
+	if len(mounts) != 1 || mounts[0].Source != root || !mounts[0].ReadOnly {
+		t.Fatalf("expected the archive directory mounted read-only, got %+v", mounts)
+	}
+	if cmd = daemon.configs[len(daemon.configs)-1].Cmd; strings.Join(cmd, " ") != "tar -t -v -z -f /backup/app_data.tar.gz" {
+		t.Fatalf("unexpected command %v", cmd)
+	}
+
+	// zstd archives are listed in ZstdImage
+	zstdArchive := filepath.Join(root, "app_data.tar.zst")
+	if err := os.WriteFile(zstdArchive, []byte{0x28, 0xb5, 0x2f, 0xfd}, 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := c.ListArchiveContents(zstdArchive); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	config := daemon.configs[len(daemon.configs)-1]
+	if config.Image != ZstdImage || strings.Join(config.Cmd, " ") != "tar -t -v -I zstd -f /backup/app_data.tar.zst" {
+		t.Fatalf("expected tar -I zstd in %s, got %v in %s", ZstdImage, config.Cmd, config.Image)
+	}
+}
+
+func TestBackupCmd(t *testing.T) {
+	tests := []struct {
+		compress bool
+		level    int
+		tarOpts  TarOptions
+		want     string
+	}{
+		{false, 0, TarOptions{}, "tar -c -f /backup/out -C /source ."},
+		{true, 0, TarOptions{}, "tar -c -z -f /backup/out -C /source ."},
+		{true, 6, TarOptions{}, "sh -c set -o pipefail; tar -c -f - -C '/source' . | gzip -6 > '/backup/out'"},
+		{false, 6, TarOptions{}, "tar -c -f /backup/out -C /source ."},
+		{false, 0, TarOptions{Sparse: true}, "tar -c --sparse -f /backup/out -C /source ."},
+		{true, 0, TarOptions{Sparse: true}, "tar -c --sparse -z -f /backup/out -C /source ."},
+		{true, 6, TarOptions{Sparse: true}, "tar -c --sparse -I gzip -6 -f /backup/out -C /source ."},
+		{true, 0, TarOptions{Xattrs: true}, "tar -c --xattrs --acls -z -f /backup/out -C /source ."},
+		{true, 0, TarOptions{Sparse: true, Xattrs: true}, "tar -c --sparse --xattrs --acls -z -f /backup/out -C /source ."},
+		{true, 0, TarOptions{FollowSymlinks: true}, "tar -c -h -z -f /backup/out -C /source ."},
+		{true, 6, TarOptions{FollowSymlinks: true}, "sh -c set -o pipefail; tar -c -h -f - -C '/source' . | gzip -6 > '/backup/out'"},
+		{false, 0, TarOptions{FollowSymlinks: true, Sparse: true}, "tar -c -h --sparse -f /backup/out -C /source ."},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(backupCmd("/backup/out", "/source", tt.compress, tt.level, tt.tarOpts), " "); got != tt.want {
+			t.Errorf("compress=%v level=%d tarOpts=%+v: expected %q, got %q", tt.compress, tt.level, tt.tarOpts, tt.want, got)
+		}
+	}
+}
+
+func TestSparseBackupKeepsHoles(t *testing.T) {
+	requireGNUTar(t)
+
+	root := t.TempDir()
+	src := filepath.Join(root, "volume")
+	target := filepath.Join(root, "target")
+	for _, dir := range []string{src, target} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+	}
+
+	// A 256 MiB disk image holding only a few bytes at each end
+	const apparent = 256 << 20
+	image := filepath.Join(src, "disk.img")
+	f, err := os.Create(image)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := f.WriteString("head"); err == nil {
+		_, err = f.WriteAt([]byte("tail"), apparent-4)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if diskUsage(t, image) > apparent/2 {
+		t.Skip("the filesystem does not support sparse files")
+	}
+
+	archive := filepath.Join(root, "app_data.tar")
+	runHostTar(t, backupCmd(archive, src, false, 0, TarOptions{Sparse: true}))
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Size() > apparent/100 {
+		t.Fatalf("expected the archive to be much smaller than %d bytes, got %d", apparent, info.Size())
+	}
+
+	runHostTar(t, restoreCmd(archive, target, CompressionNone, TarOptions{Sparse: true}, nil))
+	restored := filepath.Join(target, "disk.img")
+	data, err := os.ReadFile(restored)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(data) != apparent || string(data[:4]) != "head" || string(data[apparent-4:]) != "tail" {
+		t.Fatalf("restored image differs from the original (%d bytes)", len(data))
+	}
+	if usage := diskUsage(t, restored); usage > apparent/2 {
+		t.Fatalf("expected the restored image to keep its holes, it uses %d bytes", usage)
+	}
+
+	// Sparse workers run GNU tar; busybox tar cannot handle holes
+	daemon := &fakeDaemon{}
+	c := newFakeClient(t, daemon)
+	c.BackupVolume("app_data", filepath.Join(t.TempDir(), "app_data.tar.gz"), true, 0, TarOptions{Sparse: true})
+	if len(daemon.configs) != 1 || daemon.configs[0].Image != GNUTarImage {
+		t.Fatalf("expected a %s worker, got %+v", GNUTarImage, daemon.configs)
+	}
+}
+
+func TestBackupFollowSymlinks(t *testing.T) {
+	requireGNUTar(t)
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "config.yml"), []byte("port: 80\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := os.Symlink("config.yml", filepath.Join(src, "current.yml")); err != nil {
+		t.Fatalf("symlink failed: %v", err)
+	}
+
+	// member returns the header and content of current.yml in archive
+	member := func(archive string) (*tar.Header, string) {
+		f, err := os.Open(archive)
+		if err != nil {
+			t.Fatalf("open failed: %v", err)
+		}
+		defer f.Close()
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				t.Fatalf("current.yml not found in %s: %v", archive, err)
+			}
+			if hdr.Name == "./current.yml" {
+				data, _ := io.ReadAll(tr)
+				return hdr, string(data)
+			}
+		}
+	}
+
+	archive := filepath.Join(t.TempDir(), "links.tar")
+	runHostTar(t, backupCmd(archive, src, false, 0, TarOptions{}))
+	if hdr, _ := member(archive); hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "config.yml" {
+		t.Fatalf("expected current.yml to be stored as a link, got type %c -> %q", hdr.Typeflag, hdr.Linkname)
+	}
+
+	archive = filepath.Join(t.TempDir(), "dereferenced.tar")
+	runHostTar(t, backupCmd(archive, src, false, 0, TarOptions{FollowSymlinks: true}))
+	if hdr, data := member(archive); hdr.Typeflag != tar.TypeReg || data != "port: 80\n" {
+		t.Fatalf("expected current.yml to hold the target's content, got type %c with %q", hdr.Typeflag, data)
+	}
+}
+
+func TestMirrorCmdReplacesContents(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "snapshot")
+	target := filepath.Join(root, "volume")
+	for path, content := range map[string]string{
+		"snapshot/app.conf":     "v1",
+		"snapshot/data/rows.db": "rows",
+		"volume/app.conf":       "v2",
+		"volume/new.log":        "written after the snapshot",
+		"volume/.cache/entry":   "stale",
+		"volume/data/extra.db":  "extra",
+	} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	runHostTar(t, mirrorCmd(source, target))
+
+	if got, want := readTree(t, target), readTree(t, source); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the volume to match the snapshot %v, got %v", want, got)
+	}
+}
+
+// diskUsage returns the bytes allocated on disk for the file at path
+func diskUsage(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		t.Skip("disk usage is not available on this platform")
+	}
+	return stat.Blocks * 512
+}
+
+func TestBackupVolumePassesCompressLevel(t *testing.T) {
+	daemon := &fakeDaemon{}
+	c := newFakeClient(t, daemon)
+
+	// The fake worker writes no archive, so only the command is checked
+	c.BackupVolume("app_data", filepath.Join(t.TempDir(), "app_data.tar.gz"), true, 7, TarOptions{})
+	if len(daemon.configs) != 1 {
+		t.Fatalf("expected one worker, got %d", len(daemon.configs))
+	}
+	if cmd := strings.Join(daemon.configs[0].Cmd, " "); !strings.Contains(cmd, "| gzip -7 >") {
+		t.Fatalf("expected the level in the worker command, got %q", cmd)
+	}
+}
+
+func TestZstdBackupCmd(t *testing.T) {
+	tests := []struct {
+		level   int
+		tarOpts TarOptions
+		want    string
+	}{
+		{0, TarOptions{}, "tar -c -I zstd -f /backup/out -C /source ."},
+		{1, TarOptions{}, "tar -c -I zstd -1 -f /backup/out -C /source ."},
+		{19, TarOptions{}, "tar -c -I zstd -19 -f /backup/out -C /source ."},
+		{19, TarOptions{Sparse: true, Xattrs: true}, "tar -c --sparse --xattrs --acls -I zstd -19 -f /backup/out -C /source ."},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(zstdBackupCmd("/backup/out", "/source", tt.level, tt.tarOpts), " "); got != tt.want {
+			t.Errorf("level=%d tarOpts=%+v: expected %q, got %q", tt.level, tt.tarOpts, tt.want, got)
+		}
+	}
+}
+
+func TestBackupVolumeCompressesZstdInZstdImage(t *testing.T) {
+	daemon := &fakeDaemon{}
+	c := newFakeClient(t, daemon)
+
+	c.BackupVolume("app_data", filepath.Join(t.TempDir(), "app_data.tar.zst"), true, 19, TarOptions{})
+	if len(daemon.configs) != 1 {
+		t.Fatalf("expected one worker, got %d", len(daemon.configs))
+	}
+	if daemon.configs[0].Image != ZstdImage {
+		t.Fatalf("expected the backup to run in %s, got %s", ZstdImage, daemon.configs[0].Image)
+	}
+	if cmd := strings.Join(daemon.configs[0].Cmd, " "); !strings.Contains(cmd, "-I zstd -19 ") {
+		t.Fatalf("expected zstd with the level in the worker command, got %q", cmd)
+	}
+}
+
+func TestZstdBackupRoundTrip(t *testing.T) {
+	requireGNUTar(t)
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not installed")
+	}
+
+	root := t.TempDir()
+	src := filepath.Join(root, "volume")
+	target := filepath.Join(root, "target")
+	for _, dir := range []string{src, target} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+	}
+	content := strings.Repeat("zstd ", 1000)
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte(content), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	archive := filepath.Join(root, "app_data.tar.zst")
+	runHostTar(t, zstdBackupCmd(archive, src, 19, TarOptions{}))
+	if compression, err := DetectCompression(archive); err != nil || compression != CompressionZstd {
+		t.Fatalf("expected a zstd archive, got %q (%v)", compression, err)
+	}
+
+	runHostTar(t, []string{"tar", "-x", "-I", "zstd", "-f", archive, "-C", target})
+	data, err := os.ReadFile(filepath.Join(target, "a.txt"))
+	if err != nil || string(data) != content {
+		t.Fatalf("expected the file to round-trip, got %q (%v)", data, err)
+	}
+}
+
+func TestRestoreZstdRunsInZstdImage(t *testing.T) {
+	daemon := &fakeDaemon{volumes: map[string]string{"app_data": "local"}}
+	c := newFakeClient(t, daemon)
+	archive := filepath.Join(t.TempDir(), "app_data.tar.zst")
+	if err := os.WriteFile(archive, []byte{0x28, 0xb5, 0x2f, 0xfd}, 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := c.RestoreVolume("app_data", archive, TarOptions{}); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	config := daemon.configs[len(daemon.configs)-1]
+	if config.Image != ZstdImage {
+		t.Fatalf("expected the restore to run in %s, got %s", ZstdImage, config.Image)
+	}
+	if cmd := strings.Join(config.Cmd, " "); cmd != "tar -x --numeric-owner -I zstd -f /backup/app_data.tar.zst -C /target" {
+		t.Fatalf("unexpected restore command %q", cmd)
+	}
+}
+
+func TestEnsureImageBuildsZstdImage(t *testing.T) {
+	daemon := &fakeDaemon{missingImages: map[string]bool{ZstdImage: true}}
+	c := newFakeClient(t, daemon)
+
+	if err := c.ensureImage(ZstdImage); err != nil {
+		t.Fatalf("ensure image failed: %v", err)
+	}
+	if len(daemon.builds) != 1 || daemon.builds[0] != zstdDockerfile {
+		t.Fatalf("expected the image to be built from zstdDockerfile, got %q", daemon.builds)
+	}
+	if err := c.ensureImage(ZstdImage); err != nil || len(daemon.builds) != 1 {
+		t.Fatalf("expected the built image to be reused, got %v after %d builds", err, len(daemon.builds))
+	}
+
+	daemon = &fakeDaemon{missingImages: map[string]bool{ZstdImage: true}, buildError: "apk failed"}
+	c = newFakeClient(t, daemon)
+	if err := c.ensureImage(ZstdImage); err == nil || !strings.Contains(err.Error(), "apk failed") {
+		t.Fatalf("expected the build error, got %v", err)
+	}
+}
+
+func TestBackupVolumeIncrementalCleansUpOnFailure(t *testing.T) {
+	daemon := &fakeDaemon{exitCode: 2}
+	c := newFakeClient(t, daemon)
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.snar")
+	if err := os.WriteFile(base, []byte("snapshot"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	output := filepath.Join(dir, "app_data_2024-01-02_000000.tar.gz")
+	if err := c.BackupVolumeIncremental("app_data", output, base, true, 0, TarOptions{}); err == nil {
+		t.Fatalf("expected backup to fail")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "base.snar" {
+		t.Fatalf("expected only the base snapshot to remain, got %v", entries)
+	}
+	if data, _ := os.ReadFile(base); string(data) != "snapshot" {
+		t.Fatalf("base snapshot was modified: %q", data)
+	}
+}
+
+func TestTailContainerLogs(t *testing.T) {
+	lines := []string{"tar: starting"}
+	for i := 0; i < 500; i++ {
+		lines = append(lines, "tar: ./data/f: Permission denied")
+	}
+	lines = append(lines, "tar: error exit delayed from previous errors")
+
+	daemon := &fakeDaemon{exitCode: 2, failLogs: lines}
+	c := newFakeClient(t, daemon)
+
+	logs, err := c.tailContainerLogs("worker1", 1024)
+	if err != nil {
+		t.Fatalf("tail failed: %v", err)
+	}
+	if strings.ContainsAny(logs, "\x00\x01\x02") {
+		t.Fatalf("expected stream headers to be stripped, got %q", logs)
+	}
+	if len(logs) > 1024+64 {
+		t.Fatalf("expected at most about 1 KB of logs, got %d bytes", len(logs))
+	}
+	if strings.Contains(logs, "tar: starting") || !strings.HasPrefix(logs, "(") || !strings.Contains(logs, "bytes of earlier output omitted") {
+		t.Fatalf("expected the front of the output to be dropped with a note, got %q", logs)
+	}
+	if !strings.Contains(logs, "tar: ./data/f: Permission denied (repeated ") {
+		t.Fatalf("expected repeated lines to be collapsed, got %q", logs)
+	}
+	if !strings.HasSuffix(logs, "tar: error exit delayed from previous errors") {
+		t.Fatalf("expected the last line to be kept, got %q", logs)
+	}
+
+	// A failing backup carries the bounded tail in its ExitError
+	err = c.BackupVolume("app_data", filepath.Join(t.TempDir(), "app_data.tar.gz"), true, 0, TarOptions{})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || len(exitErr.Logs) > maxWorkerLogBytes+64 || !strings.Contains(exitErr.Logs, "repeated") {
+		t.Fatalf("expected an ExitError with bounded logs, got %v", err)
+	}
+
+	// Raw output, as from containers with a TTY, is kept as is
+	daemon.failLogs = nil
+	if logs, err := c.tailContainerLogs("worker1", 1024); err != nil || logs != "tar: unexpected end of file" {
+		t.Fatalf("expected raw logs unchanged, got %q, %v", logs, err)
+	}
+}
+
+func TestRestoreVolumeErrorHasReadableLogs(t *testing.T) {
+	daemon := &fakeDaemon{
+		exitCode: 2,
+		volumes:  map[string]string{"app_data": "local"},
+		failLogs: []string{"tar: ./db: Cannot open: Permission denied", "tar: Exiting with failure status due to previous errors"},
+	}
+	c := newFakeClient(t, daemon)
+
+	err := c.RestoreVolume("app_data", writeTruncatedBackup(t), TarOptions{})
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an ExitError, got %v", err)
+	}
+	want := "tar: ./db: Cannot open: Permission denied\ntar: Exiting with failure status due to previous errors"
+	if exitErr.Logs != want {
+		t.Fatalf("expected demultiplexed logs %q, got %q", want, exitErr.Logs)
+	}
+}
+
+func TestRunWorkerRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		failCreates  int
+		failStatus   int
+		exitCode     int
+		attempts     int
+		wantErr      bool
+		wantAttempts int
+		wantRetries  int
+	}{
+		{"succeedsAfterTransientFailures", 2, http.StatusServiceUnavailable, 0, 3, false, 3, 2},
+		{"rateLimited", 1, http.StatusTooManyRequests, 0, 3, false, 2, 1},
+		{"givesUpAfterAttempts", 3, http.StatusServiceUnavailable, 0, 2, true, 2, 1},
+		{"permanentErrorNotRetried", 1, http.StatusBadRequest, 0, 3, true, 1, 0},
+		{"nonZeroExitNotRetried", 0, 0, 2, 3, true, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{failCreates: tt.failCreates, failStatus: tt.failStatus, exitCode: tt.exitCode}
+			c := newFakeClient(t, daemon)
+			var log bytes.Buffer
+			c.SetRetryPolicy(RetryPolicy{Attempts: tt.attempts, Backoff: time.Millisecond}, &log)
+
+			err := c.CopyVolume("src_data", "dst_data")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if daemon.createAttempts != tt.wantAttempts {
+				t.Fatalf("expected %d create attempts, got %d", tt.wantAttempts, daemon.createAttempts)
+			}
+			if got := strings.Count(log.String(), "retrying"); got != tt.wantRetries {
+				t.Fatalf("expected %d logged retries, got %d:\n%s", tt.wantRetries, got, log.String())
+			}
+
+			var exitErr *ExitError
+			if tt.exitCode != 0 && (!errors.As(err, &exitErr) || exitErr.Status != int64(tt.exitCode)) {
+				t.Fatalf("expected ExitError with status %d, got %v", tt.exitCode, err)
+			}
+		})
+	}
+}
+
+func TestCreateShellContainer(t *testing.T) {
+	for _, readOnly := range []bool{false, true} {
+		daemon := &fakeDaemon{}
+		c := newFakeClient(t, daemon)
+
+		if _, err := c.createShellContainer("app_data", "busybox:1.36", readOnly); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+		if len(daemon.configs) != 1 {
+			t.Fatalf("expected one container, got %d", len(daemon.configs))
+		}
+
+		cfg := daemon.configs[0]
+		if cfg.Image != "busybox:1.36" || strings.Join(cfg.Cmd, " ") != "sh" || cfg.WorkingDir != ShellMountPoint {
+			t.Fatalf("unexpected container config: %+v", cfg)
+		}
+		if !cfg.Tty || !cfg.OpenStdin || !cfg.AttachStdin || !cfg.AttachStdout {
+			t.Fatalf("expected an interactive TTY, got %+v", cfg)
+		}
+
+		mounts := daemon.workers[0]
+		if len(mounts) != 1 || mounts[0].Source != "app_data" || mounts[0].Target != ShellMountPoint || mounts[0].ReadOnly != readOnly {
+			t.Fatalf("unexpected mounts for readOnly=%v: %+v", readOnly, mounts)
+		}
+	}
+}
+
+func TestCopyToVolume(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "conf", "nested"), 0o755); err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "conf", "app.yml"), []byte("port: 80"), 0o644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "conf", "nested", "extra.yml"), []byte("debug: true"), 0o644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		dst     string
+		wantDir string
+		want    map[string]string
+	}{
+		{
+			name:    "fileIntoExistingDir",
+			src:     filepath.Join(src, "conf", "app.yml"),
+			dst:     "/etc",
+			wantDir: "/data/etc",
+			want:    map[string]string{"app.yml": "port: 80"},
+		},
+		{
+			name:    "fileToNewName",
+			src:     filepath.Join(src, "conf", "app.yml"),
+			dst:     "etc/renamed.yml",
+			wantDir: "/data/etc",
+			want:    map[string]string{"renamed.yml": "port: 80"},
+		},
+		{
+			name:    "directoryIntoExistingDir",
+			src:     filepath.Join(src, "conf"),
+			dst:     "/etc",
+			wantDir: "/data/etc",
+			want: map[string]string{
+				"conf/":                 "",
+				"conf/app.yml":          "port: 80",
+				"conf/nested/":          "",
+				"conf/nested/extra.yml": "debug: true",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{archive: map[string]string{"/data/etc/hosts": ""}}
+			c := newFakeClient(t, daemon)
+
+			if err := c.CopyToVolume("app_data", tt.src, tt.dst); err != nil {
+				t.Fatalf("copy failed: %v", err)
+			}
+
+			mounts := daemon.workers[0]
+			if len(mounts) != 1 || mounts[0].Source != "app_data" || mounts[0].Target != "/data" || mounts[0].ReadOnly {
+				t.Fatalf("expected app_data mounted writable at /data, got %+v", mounts)
+			}
+			if len(daemon.uploads) != 1 {
+				t.Fatalf("expected one upload, got %d", len(daemon.uploads))
+			}
+			up := daemon.uploads[0]
+			if up.Path != tt.wantDir {
+				t.Fatalf("expected upload to %s, got %s", tt.wantDir, up.Path)
+			}
+			if fmt.Sprint(up.Entries) != fmt.Sprint(tt.want) {
+				t.Fatalf("expected entries %v, got %v", tt.want, up.Entries)
+			}
+		})
+	}
+}
+
+func TestCopyFromVolume(t *testing.T) {
+	archive := map[string]string{
+		"/data/etc/app.yml":          "port: 80",
+		"/data/etc/nested/extra.yml": "debug: true",
+	}
+
+	t.Run("fileToNewName", func(t *testing.T) {
+		daemon := &fakeDaemon{archive: archive}
+		c := newFakeClient(t, daemon)
+
+		dst := filepath.Join(t.TempDir(), "local.yml")
+		if err := c.CopyFromVolume("app_data", "etc/app.yml", dst); err != nil {
+			t.Fatalf("copy failed: %v", err)
+		}
+		data, err := os.ReadFile(dst)
+		if err != nil || string(data) != "port: 80" {
+			t.Fatalf("expected copied file, got %q, %v", data, err)
+		}
+
+		mounts := daemon.workers[0]
+		if len(mounts) != 1 || mounts[0].Source != "app_data" || !mounts[0].ReadOnly {
+			t.Fatalf("expected app_data mounted read-only, got %+v", mounts)
+		}
+	})
+
+	t.Run("directoryIntoExistingDir", func(t *testing.T) {
+		daemon := &fakeDaemon{archive: archive}
+		c := newFakeClient(t, daemon)
+
+		dst := t.TempDir()
+		if err := c.CopyFromVolume("app_data", "/etc", dst); err != nil {
+			t.Fatalf("copy failed: %v", err)
+		}
+		got := readTree(t, filepath.Join(dst, "etc"))
+		want := map[string]string{"app.yml": "port: 80", "nested/extra.yml": "debug: true"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("missingPath", func(t *testing.T) {
+		daemon := &fakeDaemon{archive: archive}
+		c := newFakeClient(t, daemon)
+
+		if err := c.CopyFromVolume("app_data", "missing", t.TempDir()); err == nil {
+			t.Fatalf("expected error for missing path")
+		}
+	})
+}
+
+func TestExtractTarRejectsEscapingEntries(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "etc/../../evil", Mode: 0o644})
+	tw.Close()
+
+	if err := extractTar(&buf, "etc", filepath.Join(t.TempDir(), "etc")); err == nil {
+		t.Fatalf("expected error for entry escaping the destination")
+	}
+}
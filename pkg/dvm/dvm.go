@@ -0,0 +1,128 @@
+// Package dvm lets other Go programs embed Docker Volume Manager instead of
+// running the dvm CLI.
+//
+// Create a Context with New, passing a Config and, optionally, a Docker
+// client, a metadata database and writers for output. Its methods (Backup,
+// Restore, List, ListVolumes, History and so on) are the commands of the
+// CLI, taking the same options. Backup, Clean and Archive report per-volume
+// results through LastSummary.
+//
+// The types here are aliases of the types the CLI itself uses, so they stay
+// in step with it.
+package dvm
+
+import (
+	"github.com/koyashimano/docker-volume-manager/internal/commands"
+	"github.com/koyashimano/docker-volume-manager/internal/config"
+	"github.com/koyashimano/docker-volume-manager/internal/database"
+	"github.com/koyashimano/docker-volume-manager/internal/docker"
+)
+
+// Context runs dvm commands
+type Context = commands.Context
+
+// Options configures a Context created with New
+type Options = commands.Options
+
+// Config is the dvm configuration, as read from ~/.dvm/config.yaml
+type Config = config.Config
+
+// DockerClient is the Docker daemon as the commands use it. NewDockerClient
+// returns the real one; any other implementation can be passed in Options.
+type DockerClient = commands.DockerClient
+
+// MetaStore is the record of backups and volume metadata as the commands
+// use it. *DB implements it on SQLite.
+type MetaStore = commands.MetaStore
+
+// DB is the SQLite metadata database recording backups
+type DB = database.DB
+
+// BackupRecord is a backup recorded in the metadata database
+type BackupRecord = database.BackupRecord
+
+// TarOptions selects the GNU tar features of backups and restores, as
+// passed to a DockerClient
+type TarOptions = docker.TarOptions
+
+// Command options
+type (
+	BackupOptions   = commands.BackupOptions
+	RestoreOptions  = commands.RestoreOptions
+	ArchiveOptions  = commands.ArchiveOptions
+	CheckOptions    = commands.CheckOptions
+	CleanOptions    = commands.CleanOptions
+	CloneOptions    = commands.CloneOptions
+	ContentsOptions = commands.ContentsOptions
+	CopyOptions     = commands.CopyOptions
+	DoctorOptions   = commands.DoctorOptions
+	HistoryOptions  = commands.HistoryOptions
+	InspectOptions  = commands.InspectOptions
+	ListOptions     = commands.ListOptions
+	MountOptions    = commands.MountOptions
+	PruneOptions    = commands.PruneOptions
+	RollbackOptions = commands.RollbackOptions
+	SnapshotOptions = commands.SnapshotOptions
+	SwapOptions     = commands.SwapOptions
+	TagOptions      = commands.TagOptions
+)
+
+// Command results
+type (
+	Summary        = commands.Summary
+	Result         = commands.Result
+	VolumeListItem = commands.VolumeListItem
+	BatchError     = commands.BatchError
+)
+
+// Statuses of a single volume in a Summary
+const (
+	StatusOK      = commands.StatusOK
+	StatusSkipped = commands.StatusSkipped
+	StatusFailed  = commands.StatusFailed
+)
+
+// Errors returned by commands, to be checked with errors.Is
+var (
+	ErrVolumeNotFound    = commands.ErrVolumeNotFound
+	ErrServiceNotFound   = commands.ErrServiceNotFound
+	ErrAmbiguousVolume   = commands.ErrAmbiguousVolume
+	ErrComposeNotFound   = commands.ErrComposeNotFound
+	ErrVolumeInUse       = commands.ErrVolumeInUse
+	ErrBackupNotFound    = commands.ErrBackupNotFound
+	ErrInsufficientSpace = commands.ErrInsufficientSpace
+	ErrDockerUnavailable = commands.ErrDockerUnavailable
+	ErrBackupOverdue     = commands.ErrBackupOverdue
+	ErrTimeout           = commands.ErrTimeout
+)
+
+// New creates a Context ready to run commands
+func New(opts Options) (*Context, error) {
+	return commands.New(opts)
+}
+
+// DefaultConfig returns the configuration used when no config file exists
+func DefaultConfig() *Config {
+	return config.DefaultConfig()
+}
+
+// LoadConfig loads a config file, applying DVM_* environment overrides and
+// defaults for missing values. A missing file yields the defaults.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// NewDockerClient connects to the Docker daemon configured by the
+// environment (DOCKER_HOST and friends)
+func NewDockerClient() (DockerClient, error) {
+	cli, err := docker.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+// OpenDB opens the metadata database at path, creating it if needed
+func OpenDB(path string) (*DB, error) {
+	return database.NewDB(path)
+}
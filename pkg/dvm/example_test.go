@@ -0,0 +1,49 @@
+package dvm_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/koyashimano/docker-volume-manager/pkg/dvm"
+)
+
+// Back up two volumes and list the volumes of a Compose project, capturing
+// the progress output instead of printing it
+func Example() {
+	cfg, err := dvm.LoadConfig("/etc/dvm/config.yaml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	ctx, err := dvm.New(dvm.Options{
+		Config: cfg,
+		DBPath: "/var/lib/dvm/meta.db",
+		Out:    &out,
+		Quiet:  true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ctx.Close()
+
+	if err := ctx.LoadCompose("/srv/shop/compose.yaml", ""); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ctx.Backup(dvm.BackupOptions{Services: []string{"db", "redis"}, Tags: []string{"nightly"}}); err != nil {
+		log.Fatal(err)
+	}
+	for _, result := range ctx.LastSummary().Results {
+		fmt.Println(result.Volume, result.Status, result.Path)
+	}
+
+	volumes, err := ctx.ListVolumes(dvm.ListOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, v := range volumes {
+		fmt.Println(v.Service, v.VolumeName, v.InUse)
+	}
+}